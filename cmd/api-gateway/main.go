@@ -24,6 +24,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"whatsapp/internal/api-gateway/handlers"
@@ -46,6 +47,16 @@ func main() {
 
     router := gin.Default()
 
+    // Only honour X-Forwarded-For from known proxies so clients cannot spoof
+    // the address used for login throttling in the user service
+    var trustedProxies []string
+    if proxies := getEnv("TRUSTED_PROXIES", ""); proxies != "" {
+        trustedProxies = strings.Split(proxies, ",")
+    }
+    if err := router.SetTrustedProxies(trustedProxies); err != nil {
+        log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+    }
+
     userServiceURL := getEnv("USER_SERVICE_URL", "http://localhost:8081")
     messageServiceURL := getEnv("MESSAGE_SERVICE_URL", "http://localhost:8082")
 
@@ -80,6 +91,7 @@ func main() {
     userHandler := handlers.NewUserHandler(userServiceURL)
     groupHandler := handlers.NewGroupHandler(userServiceURL)
     messageHandler := handlers.NewMessageHandler(messageServiceURL)
+    uploadHandler := handlers.NewUploadHandler(messageServiceURL)
     // Pass the RabbitMQ client to the WebSocket handler
     wsHandler := handlers.NewWebSocketHandler(messageServiceURL, mqClient, authService)
 
@@ -89,9 +101,19 @@ func main() {
         api.POST("/users/register", authHandler.Register)
         api.POST("/users/login", authHandler.Login)
         
+        api.DELETE("/users/me", middleware.AuthRequired(), userHandler.DeleteAccount)
+        api.POST("/users/me/deletion/cancel", middleware.AuthRequired(), userHandler.CancelAccountDeletion)
+        api.GET("/users/me/export", middleware.AuthRequired(), userHandler.ExportData)
+        api.PUT("/users/me/username", middleware.AuthRequired(), userHandler.ChangeUsername)
+        api.POST("/users/me/phone/code", middleware.AuthRequired(), userHandler.RequestPhoneCode)
+        api.POST("/users/me/phone/verify", middleware.AuthRequired(), userHandler.VerifyPhone)
+        api.GET("/users/me/privacy", middleware.AuthRequired(), userHandler.GetPrivacy)
+        api.PUT("/users/me/privacy", middleware.AuthRequired(), userHandler.UpdatePrivacy)
+        api.GET("/users/handle/:username", middleware.AuthRequired(), userHandler.GetByUsername)
         api.GET("/users/search", middleware.AuthRequired(), userHandler.SearchUsers)
         api.GET("/users/contacts", middleware.AuthRequired(), userHandler.GetUserContacts)
 		api.POST("/users/contacts", middleware.AuthRequired(), userHandler.AddContact)
+		api.POST("/users/contacts/sync", middleware.AuthRequired(), userHandler.SyncContacts)
 		api.DELETE("/users/contacts/:id", middleware.AuthRequired(), userHandler.DeleteContact)
 		
         api.GET("/users/:id", middleware.AuthRequired(), userHandler.GetUserByID)
@@ -101,12 +123,84 @@ func main() {
         // Group endpoints
         api.POST("/groups", middleware.AuthRequired(), groupHandler.CreateGroup)
         api.GET("/groups", middleware.AuthRequired(), groupHandler.GetUserGroups)
+        api.PUT("/groups/:id/settings", middleware.AuthRequired(), groupHandler.UpdateGroupSettings)
+        api.POST("/communities", middleware.AuthRequired(), groupHandler.CreateCommunity)
+        api.GET("/communities", middleware.AuthRequired(), groupHandler.GetUserCommunities)
+        api.GET("/communities/:id", middleware.AuthRequired(), groupHandler.GetCommunity)
+        api.GET("/communities/:id/groups", middleware.AuthRequired(), groupHandler.GetCommunityGroups)
+        api.POST("/communities/:id/groups", middleware.AuthRequired(), groupHandler.AddCommunityGroup)
+        api.DELETE("/communities/:id/groups/:group_id", middleware.AuthRequired(), groupHandler.RemoveCommunityGroup)
+        api.POST("/communities/:id/groups/:group_id/join", middleware.AuthRequired(), groupHandler.JoinCommunityGroup)
+        api.DELETE("/communities/:id/members/:user_id", middleware.AuthRequired(), groupHandler.RemoveCommunityMember)
+        api.POST("/communities/:id/admins", middleware.AuthRequired(), groupHandler.AddCommunityAdmin)
+        api.DELETE("/communities/:id/admins/:user_id", middleware.AuthRequired(), groupHandler.RemoveCommunityAdmin)
+        api.POST("/broadcasts", middleware.AuthRequired(), messageHandler.CreateBroadcastList)
+        api.GET("/broadcasts", middleware.AuthRequired(), messageHandler.GetBroadcastLists)
+        api.GET("/broadcasts/:id", middleware.AuthRequired(), messageHandler.GetBroadcastList)
+        api.PUT("/broadcasts/:id", middleware.AuthRequired(), messageHandler.UpdateBroadcastList)
+        api.DELETE("/broadcasts/:id", middleware.AuthRequired(), messageHandler.DeleteBroadcastList)
+        api.POST("/channels", middleware.AuthRequired(), messageHandler.CreateChannel)
+        api.GET("/channels", middleware.AuthRequired(), messageHandler.SearchChannels)
+        api.GET("/channels/following", middleware.AuthRequired(), messageHandler.GetFollowedChannels)
+        api.GET("/channels/:id", middleware.AuthRequired(), messageHandler.GetChannel)
+        api.PUT("/channels/:id/follow", middleware.AuthRequired(), messageHandler.FollowChannel)
+        api.DELETE("/channels/:id/follow", middleware.AuthRequired(), messageHandler.UnfollowChannel)
+        api.POST("/channels/:id/admins", middleware.AuthRequired(), messageHandler.AddChannelAdmin)
+        api.DELETE("/channels/:id/admins/:user_id", middleware.AuthRequired(), messageHandler.RemoveChannelAdmin)
+        api.POST("/channels/:id/posts", middleware.AuthRequired(), messageHandler.CreateChannelPost)
+        api.GET("/channels/:id/posts", middleware.AuthRequired(), messageHandler.GetChannelPosts)
+        api.PUT("/channels/:id/posts/:post_id/reaction", middleware.AuthRequired(), messageHandler.ReactToChannelPost)
+        api.DELETE("/channels/:id/posts/:post_id/reaction", middleware.AuthRequired(), messageHandler.UnreactToChannelPost)
+        api.POST("/statuses", middleware.AuthRequired(), messageHandler.PostStatus)
+        api.GET("/statuses", middleware.AuthRequired(), messageHandler.GetStatuses)
+        api.GET("/statuses/mine", middleware.AuthRequired(), messageHandler.GetMyStatuses)
+        api.GET("/statuses/privacy", middleware.AuthRequired(), messageHandler.GetStatusPrivacy)
+        api.PUT("/statuses/privacy", middleware.AuthRequired(), messageHandler.UpdateStatusPrivacy)
+        api.PUT("/statuses/:id/view", middleware.AuthRequired(), messageHandler.ViewStatus)
+        api.GET("/statuses/:id/viewers", middleware.AuthRequired(), messageHandler.GetStatusViewers)
+        api.DELETE("/statuses/:id", middleware.AuthRequired(), messageHandler.DeleteStatus)
+        api.GET("/calls", middleware.AuthRequired(), messageHandler.GetCalls)
+        api.GET("/chats/:id/settings", middleware.AuthRequired(), messageHandler.GetChatSettings)
+        api.PUT("/chats/:id/disappearing", middleware.AuthRequired(), messageHandler.SetDisappearingTimer)
+        api.PUT("/chats/:id/draft", middleware.AuthRequired(), messageHandler.SaveDraft)
+        api.DELETE("/chats/:id/draft", middleware.AuthRequired(), messageHandler.DeleteDraft)
+        api.GET("/drafts", middleware.AuthRequired(), messageHandler.GetDrafts)
+        api.PUT("/groups/:id/mute", middleware.AuthRequired(), messageHandler.MuteGroup)
+        api.DELETE("/groups/:id/mute", middleware.AuthRequired(), messageHandler.UnmuteGroup)
+        api.POST("/groups/:id/mentions/read", middleware.AuthRequired(), messageHandler.MarkMentionsRead)
         
         // Message endpoints
         api.POST("/messages", middleware.AuthRequired(), messageHandler.SendMessage)
         api.GET("/messages/search", middleware.AuthRequired(), messageHandler.SearchMessages)
-        api.GET("/messages/:UserID", middleware.AuthRequired(), messageHandler.GetMessages)
+        api.GET("/messages/mentions", middleware.AuthRequired(), messageHandler.GetMentions)
+        api.GET("/messages/mentions/unread", middleware.AuthRequired(), messageHandler.GetUnreadMentions)
+        api.GET("/messages/starred", middleware.AuthRequired(), messageHandler.GetStarredMessages)
+        api.GET("/messages/pinned", middleware.AuthRequired(), messageHandler.GetPinnedMessages)
+        api.POST("/messages/scheduled", middleware.AuthRequired(), messageHandler.ScheduleMessage)
+        api.GET("/messages/scheduled", middleware.AuthRequired(), messageHandler.GetScheduledMessages)
+        api.PATCH("/messages/scheduled/:id", middleware.AuthRequired(), messageHandler.UpdateScheduledMessage)
+        api.DELETE("/messages/scheduled/:id", middleware.AuthRequired(), messageHandler.CancelScheduledMessage)
+        api.GET("/messages/:id", middleware.AuthRequired(), messageHandler.GetMessages)
         api.PATCH("/messages/:id/status", middleware.AuthRequired(), messageHandler.UpdateMessageStatus)
+        api.PUT("/messages/:id/vote", middleware.AuthRequired(), messageHandler.Vote)
+        api.GET("/messages/:id/poll", middleware.AuthRequired(), messageHandler.GetPollResults)
+        api.GET("/messages/:id/thread", middleware.AuthRequired(), messageHandler.GetThread)
+        api.PUT("/messages/:id/star", middleware.AuthRequired(), messageHandler.StarMessage)
+        api.DELETE("/messages/:id/star", middleware.AuthRequired(), messageHandler.UnstarMessage)
+        api.PUT("/messages/:id/pin", middleware.AuthRequired(), messageHandler.PinMessage)
+        api.DELETE("/messages/:id/pin", middleware.AuthRequired(), messageHandler.UnpinMessage)
+
+        // Media endpoints; /upload is kept for existing clients
+        api.POST("/media", middleware.AuthRequired(), uploadHandler.HandleUpload)
+        api.POST("/upload", middleware.AuthRequired(), uploadHandler.HandleUpload)
+        api.GET("/media/usage", middleware.AuthRequired(), uploadHandler.GetUsage)
+        api.GET("/media/:id", middleware.AuthRequired(), uploadHandler.ServeMedia)
+        api.GET("/media/blobs/:key", uploadHandler.ServeBlob)
+        api.POST("/media/uploads", middleware.AuthRequired(), uploadHandler.CreateUpload)
+        api.PATCH("/media/uploads/:id", middleware.AuthRequired(), uploadHandler.UploadChunk)
+        api.HEAD("/media/uploads/:id", middleware.AuthRequired(), uploadHandler.GetUploadOffset)
+        api.POST("/media/uploads/:id/finalize", middleware.AuthRequired(), uploadHandler.FinalizeUpload)
+        api.DELETE("/media/uploads/:id", middleware.AuthRequired(), uploadHandler.CancelUpload)
         
         // WebSocket endpoint
         api.GET("/ws", wsHandler.HandleWebSocket)
@@ -3,15 +3,21 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"time"
+	_ "time/tzdata" // scheduled messages take local times in IANA timezones, which alpine images lack
 
 	"whatsapp/internal/api-gateway/middleware"
 	"whatsapp/internal/message-service/handlers"
+	"whatsapp/internal/message-service/linkpreview"
 	"whatsapp/pkg/auth"
 	"whatsapp/pkg/database"
 	"whatsapp/pkg/rabbitmq"
+	"whatsapp/pkg/storage"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -60,6 +66,17 @@ func main() {
         log.Fatalf("Failed to declare queue: %v", err)
     }
 
+    accountQueue, err := mqClient.DeclareQueue("account_events")
+    if err != nil {
+        log.Fatalf("Failed to declare queue: %v", err)
+    }
+
+    // Call signals relayed by the gateways
+    callQueue, err := mqClient.DeclareQueue("call_signals")
+    if err != nil {
+        log.Fatalf("Failed to declare queue: %v", err)
+    }
+
     dlQueue, err := mqClient.DeclareQueue("dead_letters")
     if err != nil {
         log.Fatalf("Failed to declare dead letter queue: %v", err)
@@ -74,28 +91,231 @@ func main() {
         log.Fatalf("Failed to bind queue: %v", err)
     }
 
+    if err = mqClient.BindQueue(accountQueue.Name, "account.deleted.*", "messages"); err != nil {
+        log.Fatalf("Failed to bind queue: %v", err)
+    }
+
+    if err = mqClient.BindQueue(callQueue.Name, "call.#", "messages"); err != nil {
+        log.Fatalf("Failed to bind queue: %v", err)
+    }
+
     if err = mqClient.BindQueue(dlQueue.Name, "#", "dead-letters"); err != nil {
         log.Fatalf("Failed to bind dead letter queue: %v", err)
     }
     
-    messageCollection := dbClient.GetCollection("whatsapp", "messages")
-    groupsCollection := dbClient.GetCollection("whatsapp", "groups")
-    usersCollection := dbClient.GetCollection("whatsapp", "users")
-    
-    messageHandler := handlers.NewMessageHandler(messageCollection, groupsCollection, usersCollection, mqClient)
+    db := dbClient.GetDatabase("whatsapp")
+
+    mediaStore, err := newMediaStore(jwtSecret)
+    if err != nil {
+        log.Fatalf("Failed to initialize media storage: %v", err)
+    }
+
+    mediaURLTTL := 24 * time.Hour
+    if hours, err := strconv.Atoi(getEnv("MEDIA_URL_TTL_HOURS", "")); err == nil && hours > 0 {
+        mediaURLTTL = time.Duration(hours) * time.Hour
+    }
+
+    // Per-user storage quota for uploads, 0 disables it
+    mediaQuotaMB := int64(2048)
+    if mb, err := strconv.ParseInt(getEnv("MEDIA_QUOTA_MB", ""), 10, 64); err == nil && mb >= 0 {
+        mediaQuotaMB = mb
+    }
+
+    mediaHandler := handlers.NewMediaHandler(db, mediaStore, handlers.MediaConfig{
+        Limits: handlers.DefaultMediaLimits(),
+        URLTTL: mediaURLTTL,
+        Quota:  mediaQuotaMB << 20,
+    })
+
+    // Previews fetch pages from the internet on behalf of senders, so they can be turned off
+    var linkPreviews *linkpreview.Previewer
+    var linkPreviewCache *linkpreview.MongoCache
+    if enabled, err := strconv.ParseBool(getEnv("LINK_PREVIEWS_ENABLED", "true")); err != nil || enabled {
+        linkPreviewCache = linkpreview.NewMongoCache(db.Collection("link_previews"))
+        fetcher := linkpreview.NewHTTPFetcher(linkpreview.FetcherConfig{
+            Timeout:   5 * time.Second,
+            MaxBytes:  512 << 10,
+            UserAgent: "WhatsAppCloneBot/1.0 (link preview)",
+        })
+        linkPreviews = linkpreview.NewPreviewer(fetcher, linkPreviewCache, 24*time.Hour, time.Hour)
+    }
+
+    messageHandler := handlers.NewMessageHandler(db, mediaHandler, linkPreviews, mqClient)
+
+    channelHandler := handlers.NewChannelHandler(db, messageHandler, mqClient)
+
+    statusHandler := handlers.NewStatusHandler(db, messageHandler, mqClient)
+
+    callHandler := handlers.NewCallHandler(db, messageHandler, mqClient)
+
+    indexCtx, cancelIndexes := context.WithTimeout(context.Background(), 10*time.Second)
+    if err := mediaHandler.EnsureIndexes(indexCtx); err != nil {
+        log.Printf("Warning: Failed to create media indexes: %v", err)
+    }
+    if err := mediaHandler.EnsureUploadIndexes(indexCtx); err != nil {
+        log.Printf("Warning: Failed to create upload indexes: %v", err)
+    }
+    if err := messageHandler.EnsurePollIndexes(indexCtx); err != nil {
+        log.Printf("Warning: Failed to create poll indexes: %v", err)
+    }
+    if err := messageHandler.EnsureMentionIndexes(indexCtx); err != nil {
+        log.Printf("Warning: Failed to create mention indexes: %v", err)
+    }
+    if err := messageHandler.EnsureStarIndexes(indexCtx); err != nil {
+        log.Printf("Warning: Failed to create star indexes: %v", err)
+    }
+    if err := messageHandler.EnsurePinIndexes(indexCtx); err != nil {
+        log.Printf("Warning: Failed to create pin indexes: %v", err)
+    }
+    if err := messageHandler.EnsureDisappearingIndexes(indexCtx); err != nil {
+        log.Printf("Warning: Failed to create disappearing message indexes: %v", err)
+    }
+    if err := messageHandler.EnsureScheduledIndexes(indexCtx); err != nil {
+        log.Printf("Warning: Failed to create scheduled message indexes: %v", err)
+    }
+    if err := messageHandler.EnsureBroadcastIndexes(indexCtx); err != nil {
+        log.Printf("Warning: Failed to create broadcast list indexes: %v", err)
+    }
+    if err := messageHandler.EnsureThreadIndexes(indexCtx); err != nil {
+        log.Printf("Warning: Failed to create thread indexes: %v", err)
+    }
+    if err := messageHandler.EnsureDraftIndexes(indexCtx); err != nil {
+        log.Printf("Warning: Failed to create draft indexes: %v", err)
+    }
+    if err := channelHandler.EnsureIndexes(indexCtx); err != nil {
+        log.Printf("Warning: Failed to create channel indexes: %v", err)
+    }
+    if err := statusHandler.EnsureIndexes(indexCtx); err != nil {
+        log.Printf("Warning: Failed to create status indexes: %v", err)
+    }
+    if err := callHandler.EnsureIndexes(indexCtx); err != nil {
+        log.Printf("Warning: Failed to create call indexes: %v", err)
+    }
+    if linkPreviewCache != nil {
+        if err := linkPreviewCache.EnsureIndexes(indexCtx); err != nil {
+            log.Printf("Warning: Failed to create link preview indexes: %v", err)
+        }
+    }
+    cancelIndexes()
+
+    // Media stored before references were counted must not be collected
+    refsCtx, cancelRefs := context.WithTimeout(context.Background(), 10*time.Minute)
+    if err := mediaHandler.InitMediaRefs(refsCtx); err != nil {
+        log.Fatalf("Failed to count media references: %v", err)
+    }
+    cancelRefs()
+    // Chats with pins from before pins were counted need their counter too
+    pinsCtx, cancelPins := context.WithTimeout(context.Background(), 10*time.Minute)
+    if err := messageHandler.InitPinCounts(pinsCtx); err != nil {
+        log.Fatalf("Failed to count pinned messages: %v", err)
+    }
+    cancelPins()
+    mediaHandler.StartUploadReaper(time.Hour)
+    mediaHandler.StartMediaCollector(time.Hour)
+    messageHandler.StartMessageReaper(time.Minute)
+    messageHandler.StartScheduler(15 * time.Second)
+    statusHandler.StartStatusReaper(time.Minute)
+    callHandler.StartRingTimeouts(5 * time.Second)
+
+    go func() {
+        ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+        defer cancel()
+        if err := mediaHandler.InitUsage(ctx); err != nil {
+            log.Printf("Warning: Failed to compute storage usage: %v", err)
+        }
+        if err := messageHandler.BackfillMessageTypes(ctx); err != nil {
+            log.Printf("Warning: Failed to backfill message types: %v", err)
+        }
+    }()
     
     if err = mqClient.Consume(messageQueue.Name, messageHandler.HandleIncomingMessage); err != nil {
         log.Fatalf("Failed to start consuming messages: %v", err)
     }
+
+    if err = mqClient.Consume(callQueue.Name, callHandler.HandleSignal); err != nil {
+        log.Fatalf("Failed to start consuming call signals: %v", err)
+    }
+
+    accountEventsHandler, err := handlers.NewAccountEventsHandler(db.Collection("messages"), db.Collection("chat_settings"), mediaHandler, getEnv("DELETED_ACCOUNT_MESSAGE_POLICY", handlers.DeletedAccountKeep))
+    if err != nil {
+        log.Fatalf("Invalid configuration: %v", err)
+    }
+
+    if err = mqClient.Consume(accountQueue.Name, accountEventsHandler.HandleAccountDeleted); err != nil {
+        log.Fatalf("Failed to start consuming account events: %v", err)
+    }
     
     router := gin.Default()
-    
-    router.Use(middleware.AuthMiddleware(authService))
-    
-    router.POST("/messages", messageHandler.SendMessage)
-    router.GET("/messages/search", messageHandler.SearchMessages)
-    router.GET("/messages/:UserID", messageHandler.GetMessages) 
-    router.PATCH("/messages/:id/status", messageHandler.UpdateMessageStatus)
+
+    // Signed media URLs carry their own authorization, so browsers can load them directly
+    router.GET("/media/blobs/:key", mediaHandler.ServeBlob)
+
+    authRoutes := router.Group("")
+    authRoutes.Use(middleware.AuthMiddleware(authService))
+    {
+        authRoutes.POST("/messages", messageHandler.SendMessage)
+        authRoutes.GET("/messages/search", messageHandler.SearchMessages)
+        authRoutes.GET("/messages/export", messageHandler.ExportMessages)
+        authRoutes.GET("/messages/mentions", messageHandler.GetMentions)
+        authRoutes.GET("/messages/mentions/unread", messageHandler.GetUnreadMentions)
+        authRoutes.GET("/messages/starred", messageHandler.GetStarredMessages)
+        authRoutes.GET("/messages/pinned", messageHandler.GetPinnedMessages)
+        authRoutes.POST("/messages/scheduled", messageHandler.ScheduleMessage)
+        authRoutes.GET("/messages/scheduled", messageHandler.GetScheduledMessages)
+        authRoutes.PATCH("/messages/scheduled/:id", messageHandler.UpdateScheduledMessage)
+        authRoutes.DELETE("/messages/scheduled/:id", messageHandler.CancelScheduledMessage)
+        authRoutes.GET("/messages/:id", messageHandler.GetMessages)
+        authRoutes.PATCH("/messages/:id/status", messageHandler.UpdateMessageStatus)
+        authRoutes.PUT("/messages/:id/vote", messageHandler.Vote)
+        authRoutes.GET("/messages/:id/poll", messageHandler.GetPollResults)
+        authRoutes.GET("/messages/:id/thread", messageHandler.GetThread)
+        authRoutes.PUT("/messages/:id/star", messageHandler.StarMessage)
+        authRoutes.DELETE("/messages/:id/star", messageHandler.UnstarMessage)
+        authRoutes.PUT("/messages/:id/pin", messageHandler.PinMessage)
+        authRoutes.DELETE("/messages/:id/pin", messageHandler.UnpinMessage)
+        authRoutes.POST("/broadcasts", messageHandler.CreateBroadcastList)
+        authRoutes.GET("/broadcasts", messageHandler.GetBroadcastLists)
+        authRoutes.GET("/broadcasts/:id", messageHandler.GetBroadcastList)
+        authRoutes.PUT("/broadcasts/:id", messageHandler.UpdateBroadcastList)
+        authRoutes.DELETE("/broadcasts/:id", messageHandler.DeleteBroadcastList)
+        authRoutes.POST("/channels", channelHandler.CreateChannel)
+        authRoutes.GET("/channels", channelHandler.SearchChannels)
+        authRoutes.GET("/channels/following", channelHandler.GetFollowedChannels)
+        authRoutes.GET("/channels/:id", channelHandler.GetChannel)
+        authRoutes.PUT("/channels/:id/follow", channelHandler.FollowChannel)
+        authRoutes.DELETE("/channels/:id/follow", channelHandler.UnfollowChannel)
+        authRoutes.POST("/channels/:id/admins", channelHandler.AddChannelAdmin)
+        authRoutes.DELETE("/channels/:id/admins/:user_id", channelHandler.RemoveChannelAdmin)
+        authRoutes.POST("/channels/:id/posts", channelHandler.CreateChannelPost)
+        authRoutes.GET("/channels/:id/posts", channelHandler.GetChannelPosts)
+        authRoutes.PUT("/channels/:id/posts/:post_id/reaction", channelHandler.ReactToChannelPost)
+        authRoutes.DELETE("/channels/:id/posts/:post_id/reaction", channelHandler.UnreactToChannelPost)
+        authRoutes.POST("/statuses", statusHandler.PostStatus)
+        authRoutes.GET("/statuses", statusHandler.GetStatuses)
+        authRoutes.GET("/statuses/mine", statusHandler.GetMyStatuses)
+        authRoutes.GET("/statuses/privacy", statusHandler.GetStatusPrivacy)
+        authRoutes.PUT("/statuses/privacy", statusHandler.UpdateStatusPrivacy)
+        authRoutes.PUT("/statuses/:id/view", statusHandler.ViewStatus)
+        authRoutes.GET("/statuses/:id/viewers", statusHandler.GetStatusViewers)
+        authRoutes.DELETE("/statuses/:id", statusHandler.DeleteStatus)
+        authRoutes.GET("/calls", callHandler.GetCalls)
+        authRoutes.GET("/chats/:id/settings", messageHandler.GetChatSettings)
+        authRoutes.PUT("/chats/:id/disappearing", messageHandler.SetDisappearingTimer)
+        authRoutes.PUT("/chats/:id/draft", messageHandler.SaveDraft)
+        authRoutes.DELETE("/chats/:id/draft", messageHandler.DeleteDraft)
+        authRoutes.GET("/drafts", messageHandler.GetDrafts)
+        authRoutes.PUT("/groups/:id/mute", messageHandler.MuteGroup)
+        authRoutes.DELETE("/groups/:id/mute", messageHandler.UnmuteGroup)
+        authRoutes.POST("/groups/:id/mentions/read", messageHandler.MarkMentionsRead)
+        authRoutes.POST("/media", mediaHandler.Upload)
+        authRoutes.GET("/media/usage", mediaHandler.GetUsage)
+        authRoutes.GET("/media/:id", mediaHandler.GetMedia)
+        authRoutes.POST("/media/uploads", mediaHandler.CreateUpload)
+        authRoutes.PATCH("/media/uploads/:id", mediaHandler.UploadChunk)
+        authRoutes.HEAD("/media/uploads/:id", mediaHandler.GetUploadOffset)
+        authRoutes.POST("/media/uploads/:id/finalize", mediaHandler.FinalizeUpload)
+        authRoutes.DELETE("/media/uploads/:id", mediaHandler.CancelUpload)
+    }
     
     port := getEnv("PORT", "8082")
     log.Printf("Message Service starting on port %s", port)
@@ -104,6 +324,29 @@ func main() {
     }
 }
 
+// newMediaStore creates the blob store selected by MEDIA_STORAGE: "local" (default) or "s3"
+func newMediaStore(jwtSecret string) (storage.Store, error) {
+    switch getEnv("MEDIA_STORAGE", "local") {
+    case "local":
+        // Local URLs are served by this service through the gateway
+        secret := getEnv("MEDIA_URL_SECRET", jwtSecret)
+        return storage.NewLocalStore(getEnv("MEDIA_DIR", "media"), getEnv("MEDIA_PUBLIC_URL", "/api/media/blobs/"), []byte(secret))
+    case "s3":
+        forcePathStyle, _ := strconv.ParseBool(getEnv("S3_FORCE_PATH_STYLE", "false"))
+        return storage.NewS3Store(storage.S3Config{
+            Endpoint:        os.Getenv("S3_ENDPOINT"),
+            PublicEndpoint:  os.Getenv("S3_PUBLIC_ENDPOINT"),
+            Region:          os.Getenv("S3_REGION"),
+            Bucket:          os.Getenv("S3_BUCKET"),
+            AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+            SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+            ForcePathStyle:  forcePathStyle,
+        })
+    default:
+        return nil, fmt.Errorf("unknown MEDIA_STORAGE %q", os.Getenv("MEDIA_STORAGE"))
+    }
+}
+
 func getEnv(key, defaultValue string) string {
     value := os.Getenv(key)
     if value == "" {
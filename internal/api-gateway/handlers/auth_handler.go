@@ -72,6 +72,7 @@ func (h *AuthHandler) proxyRequest(c *gin.Context, path string, method string) {
 
     req.Header = c.Request.Header
     req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("X-Forwarded-For", c.ClientIP())
 
     client := &http.Client{}
     resp, err := client.Do(req)
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"whatsapp/pkg/models"
+	"whatsapp/pkg/rabbitmq"
+
+	"github.com/gorilla/websocket"
+)
+
+// channelSubscriptions tracks which channels the users connected to this
+// gateway follow and keeps the gateway's own queue bound to exactly those
+// channels. A post is then published once per channel and each gateway
+// receives it once, however many followers it holds.
+type channelSubscriptions struct {
+	mu             sync.Mutex
+	rabbitMQClient *rabbitmq.Client
+	queue          string
+	followers      map[string]map[string]bool // channel ID -> connected followers
+	channels       map[string]map[string]bool // user ID -> followed channels
+	conns          map[string]*wsClient       // user ID -> the socket the subscriptions belong to
+}
+
+func newChannelSubscriptions(rabbitMQClient *rabbitmq.Client, queue string) *channelSubscriptions {
+	return &channelSubscriptions{
+		rabbitMQClient: rabbitMQClient,
+		queue:          queue,
+		followers:      make(map[string]map[string]bool),
+		channels:       make(map[string]map[string]bool),
+		conns:          make(map[string]*wsClient),
+	}
+}
+
+// connect subscribes the socket of userID to the channels they follow. The
+// lookup before it can finish after the socket closed, so nothing is bound
+// unless isCurrent still holds; disconnect runs after the socket is
+// unregistered, so it then finds and drops whatever connect bound.
+func (s *channelSubscriptions) connect(userID string, client *wsClient, channelIDs []string, isCurrent func() bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !isCurrent() {
+		return
+	}
+	// A newer socket of the same user replaces the old one
+	s.dropUser(userID)
+	s.conns[userID] = client
+	s.channels[userID] = make(map[string]bool, len(channelIDs))
+	for _, channelID := range channelIDs {
+		s.add(userID, channelID)
+	}
+}
+
+// disconnect drops the subscriptions of userID unless a newer socket took them over
+func (s *channelSubscriptions) disconnect(userID string, client *wsClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conns[userID] == client {
+		s.dropUser(userID)
+	}
+}
+
+// update applies a follow change of a user connected to this gateway
+func (s *channelSubscriptions) update(change models.ChannelFollowUpdate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, connected := s.conns[change.UserID]; !connected {
+		return
+	}
+	if change.Following {
+		s.add(change.UserID, change.ChannelID)
+	} else {
+		s.remove(change.UserID, change.ChannelID)
+	}
+}
+
+// localFollowers returns the connected followers of a channel
+func (s *channelSubscriptions) localFollowers(channelID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userIDs := make([]string, 0, len(s.followers[channelID]))
+	for userID := range s.followers[channelID] {
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs
+}
+
+func (s *channelSubscriptions) add(userID, channelID string) {
+	if s.channels[userID][channelID] {
+		return
+	}
+	s.channels[userID][channelID] = true
+
+	if s.followers[channelID] == nil {
+		// First local follower, so start receiving the channel's posts
+		if err := s.rabbitMQClient.BindQueue(s.queue, models.ChannelRoutingKey(channelID), "messages"); err != nil {
+			log.Printf("Failed to subscribe to channel %s: %v", channelID, err)
+		}
+		s.followers[channelID] = make(map[string]bool)
+	}
+	s.followers[channelID][userID] = true
+}
+
+func (s *channelSubscriptions) remove(userID, channelID string) {
+	if !s.channels[userID][channelID] {
+		return
+	}
+	delete(s.channels[userID], channelID)
+
+	delete(s.followers[channelID], userID)
+	if len(s.followers[channelID]) == 0 {
+		delete(s.followers, channelID)
+		if err := s.rabbitMQClient.UnbindQueue(s.queue, models.ChannelRoutingKey(channelID), "messages"); err != nil {
+			log.Printf("Failed to unsubscribe from channel %s: %v", channelID, err)
+		}
+	}
+}
+
+func (s *channelSubscriptions) dropUser(userID string) {
+	for channelID := range s.channels[userID] {
+		s.remove(userID, channelID)
+	}
+	delete(s.channels, userID)
+	delete(s.conns, userID)
+}
+
+// subscribeChannels looks up the channels a newly connected user follows and
+// subscribes their socket to them
+func (h *WebSocketHandler) subscribeChannels(userID string, client *wsClient, authHeader string) {
+	if h.channels == nil {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodGet, h.messageServiceURL+"/channels/following", nil)
+	if err != nil {
+		log.Printf("Error creating request: %v", err)
+		return
+	}
+	req.Header.Set("Authorization", authHeader)
+
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		log.Printf("Failed to look up channels of user %s: %v", userID, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Failed to look up channels of user %s: status %d", userID, resp.StatusCode)
+		return
+	}
+	var channels []models.ChannelResponse
+	if err := json.NewDecoder(resp.Body).Decode(&channels); err != nil {
+		log.Printf("Failed to read channels of user %s: %v", userID, err)
+		return
+	}
+
+	channelIDs := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		channelIDs = append(channelIDs, channel.ID)
+	}
+	h.channels.connect(userID, client, channelIDs, func() bool { return h.isCurrent(userID, client) })
+}
+
+// handleChannelMessage delivers channel posts to the connected followers and
+// keeps the subscriptions up to date with follow changes. Call events arrive
+// on the same queue and go to the recipients connected to this gateway.
+func (h *WebSocketHandler) handleChannelMessage(body []byte) error {
+	var envelope struct {
+		Type         string   `json:"type"`
+		RecipientIDs []string `json:"recipient_ids"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		log.Printf("Error unmarshalling channel message: %v", err)
+		return err
+	}
+
+	if len(envelope.RecipientIDs) > 0 {
+		return h.deliverEvent(body)
+	}
+
+	if envelope.Type != models.EventChannelPost {
+		var change models.ChannelFollowUpdate
+		if err := json.Unmarshal(body, &change); err != nil {
+			log.Printf("Error unmarshalling channel follow update: %v", err)
+			return err
+		}
+		h.channels.update(change)
+		return nil
+	}
+
+	var post struct {
+		ChannelID string `json:"channel_id"`
+	}
+	if err := json.Unmarshal(body, &post); err != nil {
+		log.Printf("Error unmarshalling channel post: %v", err)
+		return err
+	}
+
+	for _, userID := range h.channels.localFollowers(post.ChannelID) {
+		if client, ok := h.client(userID); ok {
+			if err := client.WriteMessage(websocket.TextMessage, body); err != nil {
+				log.Printf("Error sending channel post to WebSocket: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// channelQueueName names the queue of one gateway instance
+func channelQueueName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "gateway"
+	}
+	return fmt.Sprintf("websocket_channels.%s.%d", host, os.Getpid())
+}
@@ -30,6 +30,61 @@ func (h *GroupHandler) GetUserGroups(c *gin.Context) {
     h.proxyRequest(c, "/groups", http.MethodGet)
 }
 
+// UpdateGroupSettings proxies a request to change the settings of a group
+func (h *GroupHandler) UpdateGroupSettings(c *gin.Context) {
+    h.proxyRequest(c, "/groups/"+c.Param("id")+"/settings", http.MethodPut)
+}
+
+// CreateCommunity proxies a request to create a community
+func (h *GroupHandler) CreateCommunity(c *gin.Context) {
+    h.proxyRequest(c, "/communities", http.MethodPost)
+}
+
+// GetUserCommunities proxies a request to list the communities of the user
+func (h *GroupHandler) GetUserCommunities(c *gin.Context) {
+    h.proxyRequest(c, "/communities", http.MethodGet)
+}
+
+// GetCommunity proxies a request to get a community
+func (h *GroupHandler) GetCommunity(c *gin.Context) {
+    h.proxyRequest(c, "/communities/"+c.Param("id"), http.MethodGet)
+}
+
+// GetCommunityGroups proxies a request to list the groups of a community
+func (h *GroupHandler) GetCommunityGroups(c *gin.Context) {
+    h.proxyRequest(c, "/communities/"+c.Param("id")+"/groups", http.MethodGet)
+}
+
+// AddCommunityGroup proxies a request to add a group to a community
+func (h *GroupHandler) AddCommunityGroup(c *gin.Context) {
+    h.proxyRequest(c, "/communities/"+c.Param("id")+"/groups", http.MethodPost)
+}
+
+// RemoveCommunityGroup proxies a request to remove a group from a community
+func (h *GroupHandler) RemoveCommunityGroup(c *gin.Context) {
+    h.proxyRequest(c, "/communities/"+c.Param("id")+"/groups/"+c.Param("group_id"), http.MethodDelete)
+}
+
+// JoinCommunityGroup proxies a request to join a group of a community
+func (h *GroupHandler) JoinCommunityGroup(c *gin.Context) {
+    h.proxyRequest(c, "/communities/"+c.Param("id")+"/groups/"+c.Param("group_id")+"/join", http.MethodPost)
+}
+
+// RemoveCommunityMember proxies a request to remove a user from every group of a community
+func (h *GroupHandler) RemoveCommunityMember(c *gin.Context) {
+    h.proxyRequest(c, "/communities/"+c.Param("id")+"/members/"+c.Param("user_id"), http.MethodDelete)
+}
+
+// AddCommunityAdmin proxies a request to add a community admin
+func (h *GroupHandler) AddCommunityAdmin(c *gin.Context) {
+    h.proxyRequest(c, "/communities/"+c.Param("id")+"/admins", http.MethodPost)
+}
+
+// RemoveCommunityAdmin proxies a request to remove a community admin
+func (h *GroupHandler) RemoveCommunityAdmin(c *gin.Context) {
+    h.proxyRequest(c, "/communities/"+c.Param("id")+"/admins/"+c.Param("user_id"), http.MethodDelete)
+}
+
 // proxyRequest forwards the request to the user service
 // Duplicated from UserHandler for simplicity to avoid circular deps or common pkg overhead for now
 func (h *GroupHandler) proxyRequest(c *gin.Context, path string, method string) {
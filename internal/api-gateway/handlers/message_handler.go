@@ -27,7 +27,7 @@ func (h *MessageHandler) SendMessage(c *gin.Context) {
 
 // GetMessages retrieves messages for a specific user conversation
 func (h *MessageHandler) GetMessages(c *gin.Context) {
-    UserID := c.Param("UserID")
+    UserID := c.Param("id")
     h.proxyRequest(c, "/messages/"+UserID+"?"+c.Request.URL.RawQuery, http.MethodGet)
 }
 
@@ -37,11 +37,256 @@ func (h *MessageHandler) UpdateMessageStatus(c *gin.Context) {
     h.proxyRequest(c, "/messages/"+messageID+"/status", http.MethodPatch)
 }
 
+// Vote forwards a poll vote to the message service
+func (h *MessageHandler) Vote(c *gin.Context) {
+    h.proxyRequest(c, "/messages/"+c.Param("id")+"/vote", http.MethodPut)
+}
+
+// GetPollResults retrieves the results of a poll message
+func (h *MessageHandler) GetPollResults(c *gin.Context) {
+    h.proxyRequest(c, "/messages/"+c.Param("id")+"/poll", http.MethodGet)
+}
+
 // SearchMessages forwards search requests to the message service
 func (h *MessageHandler) SearchMessages(c *gin.Context) {
     h.proxyRequest(c, "/messages/search?"+c.Request.URL.RawQuery, http.MethodGet)
 }
 
+// StarMessage forwards a request to star a message to the message service
+func (h *MessageHandler) StarMessage(c *gin.Context) {
+    h.proxyRequest(c, "/messages/"+c.Param("id")+"/star", http.MethodPut)
+}
+
+// UnstarMessage forwards a request to unstar a message to the message service
+func (h *MessageHandler) UnstarMessage(c *gin.Context) {
+    h.proxyRequest(c, "/messages/"+c.Param("id")+"/star", http.MethodDelete)
+}
+
+// GetStarredMessages lists the current user's starred messages
+func (h *MessageHandler) GetStarredMessages(c *gin.Context) {
+    h.proxyRequest(c, "/messages/starred?"+c.Request.URL.RawQuery, http.MethodGet)
+}
+
+// GetThread retrieves a group message with the replies in its thread
+func (h *MessageHandler) GetThread(c *gin.Context) {
+    h.proxyRequest(c, "/messages/"+c.Param("id")+"/thread?"+c.Request.URL.RawQuery, http.MethodGet)
+}
+
+// PinMessage forwards a request to pin a message to the message service
+func (h *MessageHandler) PinMessage(c *gin.Context) {
+    h.proxyRequest(c, "/messages/"+c.Param("id")+"/pin", http.MethodPut)
+}
+
+// UnpinMessage forwards a request to unpin a message to the message service
+func (h *MessageHandler) UnpinMessage(c *gin.Context) {
+    h.proxyRequest(c, "/messages/"+c.Param("id")+"/pin", http.MethodDelete)
+}
+
+// GetPinnedMessages lists the pinned messages of a chat
+func (h *MessageHandler) GetPinnedMessages(c *gin.Context) {
+    h.proxyRequest(c, "/messages/pinned?"+c.Request.URL.RawQuery, http.MethodGet)
+}
+
+// ScheduleMessage forwards a message to be sent later to the message service
+func (h *MessageHandler) ScheduleMessage(c *gin.Context) {
+    h.proxyRequest(c, "/messages/scheduled", http.MethodPost)
+}
+
+// GetScheduledMessages lists the current user's scheduled messages
+func (h *MessageHandler) GetScheduledMessages(c *gin.Context) {
+    h.proxyRequest(c, "/messages/scheduled?"+c.Request.URL.RawQuery, http.MethodGet)
+}
+
+// UpdateScheduledMessage forwards a change of a scheduled message to the message service
+func (h *MessageHandler) UpdateScheduledMessage(c *gin.Context) {
+    h.proxyRequest(c, "/messages/scheduled/"+c.Param("id"), http.MethodPatch)
+}
+
+// CancelScheduledMessage forwards the cancellation of a scheduled message to the message service
+func (h *MessageHandler) CancelScheduledMessage(c *gin.Context) {
+    h.proxyRequest(c, "/messages/scheduled/"+c.Param("id"), http.MethodDelete)
+}
+
+// CreateBroadcastList forwards a new broadcast list to the message service
+func (h *MessageHandler) CreateBroadcastList(c *gin.Context) {
+    h.proxyRequest(c, "/broadcasts", http.MethodPost)
+}
+
+// GetBroadcastLists lists the current user's broadcast lists
+func (h *MessageHandler) GetBroadcastLists(c *gin.Context) {
+    h.proxyRequest(c, "/broadcasts", http.MethodGet)
+}
+
+// GetBroadcastList retrieves one of the current user's broadcast lists
+func (h *MessageHandler) GetBroadcastList(c *gin.Context) {
+    h.proxyRequest(c, "/broadcasts/"+c.Param("id"), http.MethodGet)
+}
+
+// UpdateBroadcastList forwards a change of a broadcast list to the message service
+func (h *MessageHandler) UpdateBroadcastList(c *gin.Context) {
+    h.proxyRequest(c, "/broadcasts/"+c.Param("id"), http.MethodPut)
+}
+
+// DeleteBroadcastList forwards the deletion of a broadcast list to the message service
+func (h *MessageHandler) DeleteBroadcastList(c *gin.Context) {
+    h.proxyRequest(c, "/broadcasts/"+c.Param("id"), http.MethodDelete)
+}
+
+// CreateChannel forwards a new channel to the message service
+func (h *MessageHandler) CreateChannel(c *gin.Context) {
+    h.proxyRequest(c, "/channels", http.MethodPost)
+}
+
+// SearchChannels finds channels by name
+func (h *MessageHandler) SearchChannels(c *gin.Context) {
+    h.proxyRequest(c, "/channels?"+c.Request.URL.RawQuery, http.MethodGet)
+}
+
+// GetFollowedChannels lists the channels the current user follows
+func (h *MessageHandler) GetFollowedChannels(c *gin.Context) {
+    h.proxyRequest(c, "/channels/following", http.MethodGet)
+}
+
+// GetChannel retrieves a channel
+func (h *MessageHandler) GetChannel(c *gin.Context) {
+    h.proxyRequest(c, "/channels/"+c.Param("id"), http.MethodGet)
+}
+
+// FollowChannel forwards a request to follow a channel to the message service
+func (h *MessageHandler) FollowChannel(c *gin.Context) {
+    h.proxyRequest(c, "/channels/"+c.Param("id")+"/follow", http.MethodPut)
+}
+
+// UnfollowChannel forwards a request to unfollow a channel to the message service
+func (h *MessageHandler) UnfollowChannel(c *gin.Context) {
+    h.proxyRequest(c, "/channels/"+c.Param("id")+"/follow", http.MethodDelete)
+}
+
+// AddChannelAdmin forwards a new channel admin to the message service
+func (h *MessageHandler) AddChannelAdmin(c *gin.Context) {
+    h.proxyRequest(c, "/channels/"+c.Param("id")+"/admins", http.MethodPost)
+}
+
+// RemoveChannelAdmin forwards the removal of a channel admin to the message service
+func (h *MessageHandler) RemoveChannelAdmin(c *gin.Context) {
+    h.proxyRequest(c, "/channels/"+c.Param("id")+"/admins/"+c.Param("user_id"), http.MethodDelete)
+}
+
+// CreateChannelPost forwards a channel post to the message service
+func (h *MessageHandler) CreateChannelPost(c *gin.Context) {
+    h.proxyRequest(c, "/channels/"+c.Param("id")+"/posts", http.MethodPost)
+}
+
+// GetChannelPosts lists the posts of a channel
+func (h *MessageHandler) GetChannelPosts(c *gin.Context) {
+    h.proxyRequest(c, "/channels/"+c.Param("id")+"/posts?"+c.Request.URL.RawQuery, http.MethodGet)
+}
+
+// ReactToChannelPost forwards a reaction to a channel post to the message service
+func (h *MessageHandler) ReactToChannelPost(c *gin.Context) {
+    h.proxyRequest(c, "/channels/"+c.Param("id")+"/posts/"+c.Param("post_id")+"/reaction", http.MethodPut)
+}
+
+// UnreactToChannelPost forwards the removal of a reaction to a channel post to the message service
+func (h *MessageHandler) UnreactToChannelPost(c *gin.Context) {
+    h.proxyRequest(c, "/channels/"+c.Param("id")+"/posts/"+c.Param("post_id")+"/reaction", http.MethodDelete)
+}
+
+// PostStatus forwards a new status to the message service
+func (h *MessageHandler) PostStatus(c *gin.Context) {
+    h.proxyRequest(c, "/statuses", http.MethodPost)
+}
+
+// GetStatuses retrieves the active statuses of the user's contacts
+func (h *MessageHandler) GetStatuses(c *gin.Context) {
+    h.proxyRequest(c, "/statuses", http.MethodGet)
+}
+
+// GetMyStatuses retrieves the user's own active statuses
+func (h *MessageHandler) GetMyStatuses(c *gin.Context) {
+    h.proxyRequest(c, "/statuses/mine", http.MethodGet)
+}
+
+// GetStatusPrivacy retrieves who sees the user's statuses
+func (h *MessageHandler) GetStatusPrivacy(c *gin.Context) {
+    h.proxyRequest(c, "/statuses/privacy", http.MethodGet)
+}
+
+// UpdateStatusPrivacy forwards a change of who sees the user's statuses to the message service
+func (h *MessageHandler) UpdateStatusPrivacy(c *gin.Context) {
+    h.proxyRequest(c, "/statuses/privacy", http.MethodPut)
+}
+
+// ViewStatus forwards that the user viewed a status to the message service
+func (h *MessageHandler) ViewStatus(c *gin.Context) {
+    h.proxyRequest(c, "/statuses/"+c.Param("id")+"/view", http.MethodPut)
+}
+
+// GetStatusViewers retrieves who viewed one of the user's statuses
+func (h *MessageHandler) GetStatusViewers(c *gin.Context) {
+    h.proxyRequest(c, "/statuses/"+c.Param("id")+"/viewers", http.MethodGet)
+}
+
+// DeleteStatus forwards the deletion of a status to the message service
+func (h *MessageHandler) DeleteStatus(c *gin.Context) {
+    h.proxyRequest(c, "/statuses/"+c.Param("id"), http.MethodDelete)
+}
+
+// GetCalls retrieves the user's call log
+func (h *MessageHandler) GetCalls(c *gin.Context) {
+    h.proxyRequest(c, "/calls?"+c.Request.URL.RawQuery, http.MethodGet)
+}
+
+// GetChatSettings retrieves the settings of a group or direct chat
+func (h *MessageHandler) GetChatSettings(c *gin.Context) {
+    h.proxyRequest(c, "/chats/"+c.Param("id")+"/settings", http.MethodGet)
+}
+
+// SetDisappearingTimer forwards a change of a chat's disappearing messages timer to the message service
+func (h *MessageHandler) SetDisappearingTimer(c *gin.Context) {
+    h.proxyRequest(c, "/chats/"+c.Param("id")+"/disappearing", http.MethodPut)
+}
+
+// SaveDraft forwards the draft of a chat to the message service
+func (h *MessageHandler) SaveDraft(c *gin.Context) {
+    h.proxyRequest(c, "/chats/"+c.Param("id")+"/draft", http.MethodPut)
+}
+
+// DeleteDraft forwards the clearing of a chat's draft to the message service
+func (h *MessageHandler) DeleteDraft(c *gin.Context) {
+    h.proxyRequest(c, "/chats/"+c.Param("id")+"/draft", http.MethodDelete)
+}
+
+// GetDrafts retrieves the user's drafts in all chats
+func (h *MessageHandler) GetDrafts(c *gin.Context) {
+    h.proxyRequest(c, "/drafts", http.MethodGet)
+}
+
+// GetMentions lists recent messages mentioning the current user
+func (h *MessageHandler) GetMentions(c *gin.Context) {
+    h.proxyRequest(c, "/messages/mentions?"+c.Request.URL.RawQuery, http.MethodGet)
+}
+
+// GetUnreadMentions retrieves the unread mention counters per group
+func (h *MessageHandler) GetUnreadMentions(c *gin.Context) {
+    h.proxyRequest(c, "/messages/mentions/unread", http.MethodGet)
+}
+
+// MarkMentionsRead resets the unread mention counter of a group
+func (h *MessageHandler) MarkMentionsRead(c *gin.Context) {
+    h.proxyRequest(c, "/groups/"+c.Param("id")+"/mentions/read", http.MethodPost)
+}
+
+// MuteGroup forwards a request to mute a group to the message service
+func (h *MessageHandler) MuteGroup(c *gin.Context) {
+    h.proxyRequest(c, "/groups/"+c.Param("id")+"/mute", http.MethodPut)
+}
+
+// UnmuteGroup forwards a request to unmute a group to the message service
+func (h *MessageHandler) UnmuteGroup(c *gin.Context) {
+    h.proxyRequest(c, "/groups/"+c.Param("id")+"/mute", http.MethodDelete)
+}
+
 // proxyRequest forwards the request to the message service
 func (h *MessageHandler) proxyRequest(c *gin.Context, path string, method string) {
     var requestBody []byte
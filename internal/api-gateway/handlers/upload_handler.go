@@ -1,51 +1,117 @@
 package handlers
 
 import (
-    "fmt"
+    "io"
     "net/http"
-    "os"
-    "path/filepath"
-    "time"
+    "net/url"
 
     "github.com/gin-gonic/gin"
 )
 
+// UploadHandler streams media uploads and downloads to and from the message service
 type UploadHandler struct {
-    uploadDir string
+    messageServiceURL string
+    client            *http.Client
 }
 
-func NewUploadHandler(uploadDir string) *UploadHandler {
-    // Ensure upload directory exists
-    if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-        os.MkdirAll(uploadDir, 0755)
-    }
+// NewUploadHandler creates a new upload handler for the API gateway
+func NewUploadHandler(messageServiceURL string) *UploadHandler {
     return &UploadHandler{
-        uploadDir: uploadDir,
+        messageServiceURL: messageServiceURL,
+        client: &http.Client{
+            // Media downloads answer with a redirect to a signed URL, which the client has to follow itself
+            CheckRedirect: func(req *http.Request, via []*http.Request) error {
+                return http.ErrUseLastResponse
+            },
+        },
     }
 }
 
+// HandleUpload forwards a multipart upload to the message service without buffering it
 func (h *UploadHandler) HandleUpload(c *gin.Context) {
-    file, err := c.FormFile("file")
+    h.streamRequest(c, "/media", http.MethodPost)
+}
+
+// ServeMedia streams a media file from the message service
+func (h *UploadHandler) ServeMedia(c *gin.Context) {
+    h.streamRequest(c, "/media/"+url.PathEscape(c.Param("id")), http.MethodGet)
+}
+
+// GetUsage proxies storage usage requests to the message service
+func (h *UploadHandler) GetUsage(c *gin.Context) {
+    h.streamRequest(c, "/media/usage", http.MethodGet)
+}
+
+// CreateUpload proxies a request to start a resumable upload
+func (h *UploadHandler) CreateUpload(c *gin.Context) {
+    h.streamRequest(c, "/media/uploads", http.MethodPost)
+}
+
+// UploadChunk streams a chunk of a resumable upload to the message service
+func (h *UploadHandler) UploadChunk(c *gin.Context) {
+    h.streamRequest(c, "/media/uploads/"+url.PathEscape(c.Param("id")), http.MethodPatch)
+}
+
+// GetUploadOffset proxies a request for the progress of a resumable upload
+func (h *UploadHandler) GetUploadOffset(c *gin.Context) {
+    h.streamRequest(c, "/media/uploads/"+url.PathEscape(c.Param("id")), http.MethodHead)
+}
+
+// FinalizeUpload proxies a request to finish a resumable upload
+func (h *UploadHandler) FinalizeUpload(c *gin.Context) {
+    h.streamRequest(c, "/media/uploads/"+url.PathEscape(c.Param("id"))+"/finalize", http.MethodPost)
+}
+
+// CancelUpload proxies a request to discard a resumable upload
+func (h *UploadHandler) CancelUpload(c *gin.Context) {
+    h.streamRequest(c, "/media/uploads/"+url.PathEscape(c.Param("id")), http.MethodDelete)
+}
+
+// ServeBlob streams a file by signed URL from the message service's local storage
+func (h *UploadHandler) ServeBlob(c *gin.Context) {
+    h.streamRequest(c, "/media/blobs/"+url.PathEscape(c.Param("key"))+"?"+c.Request.URL.RawQuery, http.MethodGet)
+}
+
+// streamHeaders are the request headers forwarded to the message service
+var streamHeaders = []string{
+    "Authorization",
+    "Content-Type",
+    "Range",
+    "If-Range",
+    "If-None-Match",
+    "If-Modified-Since",
+    "Upload-Offset",
+    "Upload-Checksum",
+}
+
+// streamRequest forwards the request to the message service, copying bodies
+// in both directions instead of reading them into memory
+func (h *UploadHandler) streamRequest(c *gin.Context, path string, method string) {
+    req, err := http.NewRequestWithContext(c.Request.Context(), method, h.messageServiceURL+path, c.Request.Body)
     if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create request"})
         return
     }
+    req.ContentLength = c.Request.ContentLength
 
-    // Generate unique filename
-    ext := filepath.Ext(file.Filename)
-    filename := fmt.Sprintf("%d_%s%s", time.Now().UnixNano(), "file", ext)
-    filepath := filepath.Join(h.uploadDir, filename)
+    for _, header := range streamHeaders {
+        if value := c.GetHeader(header); value != "" {
+            req.Header.Set(header, value)
+        }
+    }
 
-    // Save file
-    if err := c.SaveUploadedFile(file, filepath); err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+    resp, err := h.client.Do(req)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Message service unavailable"})
         return
     }
+    defer resp.Body.Close()
 
-    // Return file URL (assuming static file serving is set up)
-    fileURL := fmt.Sprintf("/uploads/%s", filename)
-    c.JSON(http.StatusOK, gin.H{
-        "url": fileURL,
-        "filename": filename,
-    })
+    for key, values := range resp.Header {
+        for _, value := range values {
+            c.Writer.Header().Add(key, value)
+        }
+    }
+    c.Status(resp.StatusCode)
+    io.Copy(c.Writer, resp.Body)
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io"
 	"net/http"
+	"net/url"
 
 	"github.com/gin-gonic/gin"
 )
@@ -59,6 +60,57 @@ func (h *UserHandler) DeleteContact(c *gin.Context) {
     h.proxyRequest(c, "/users/contacts/"+contactID, http.MethodDelete)
 }
 
+// DeleteAccount proxies a request to schedule deletion of the current user's account
+func (h *UserHandler) DeleteAccount(c *gin.Context) {
+    h.proxyRequest(c, "/users/me", http.MethodDelete)
+}
+
+// CancelAccountDeletion proxies a request to cancel a pending account deletion
+func (h *UserHandler) CancelAccountDeletion(c *gin.Context) {
+    h.proxyRequest(c, "/users/me/deletion/cancel", http.MethodPost)
+}
+
+// ExportData proxies a request to download the current user's data archive
+func (h *UserHandler) ExportData(c *gin.Context) {
+    h.proxyRequest(c, "/users/me/export", http.MethodGet)
+}
+
+// ChangeUsername proxies a request to change the current user's handle
+func (h *UserHandler) ChangeUsername(c *gin.Context) {
+    h.proxyRequest(c, "/users/me/username", http.MethodPut)
+}
+
+// GetByUsername proxies a request to look up a user by handle
+func (h *UserHandler) GetByUsername(c *gin.Context) {
+    username := c.Param("username")
+    h.proxyRequest(c, "/users/handle/"+url.PathEscape(username), http.MethodGet)
+}
+
+// GetPrivacy proxies a request to get the current user's privacy settings
+func (h *UserHandler) GetPrivacy(c *gin.Context) {
+    h.proxyRequest(c, "/users/me/privacy", http.MethodGet)
+}
+
+// UpdatePrivacy proxies a request to update the current user's privacy settings
+func (h *UserHandler) UpdatePrivacy(c *gin.Context) {
+    h.proxyRequest(c, "/users/me/privacy", http.MethodPut)
+}
+
+// RequestPhoneCode proxies a request to send a verification code to the current user's phone number
+func (h *UserHandler) RequestPhoneCode(c *gin.Context) {
+    h.proxyRequest(c, "/users/me/phone/code", http.MethodPost)
+}
+
+// VerifyPhone proxies a request to verify the current user's phone number
+func (h *UserHandler) VerifyPhone(c *gin.Context) {
+    h.proxyRequest(c, "/users/me/phone/verify", http.MethodPost)
+}
+
+// SyncContacts proxies a request to find registered users among hashed address book entries
+func (h *UserHandler) SyncContacts(c *gin.Context) {
+    h.proxyRequest(c, "/users/contacts/sync", http.MethodPost)
+}
+
 // proxyRequest forwards the request to the user service
 func (h *UserHandler) proxyRequest(c *gin.Context, path string, method string) {
     var requestBody []byte
@@ -75,6 +127,7 @@ func (h *UserHandler) proxyRequest(c *gin.Context, path string, method string) {
 
     req.Header = c.Request.Header
     req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("X-Forwarded-For", c.ClientIP())
 
     client := &http.Client{}
     resp, err := client.Do(req)
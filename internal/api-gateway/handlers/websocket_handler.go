@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -22,17 +24,49 @@ import (
 type WebSocketHandler struct {
     messageServiceURL string
     upgrader         websocket.Upgrader
-    clients          map[string]*websocket.Conn
+    clients          map[string]*wsClient
     clientsMutex     sync.RWMutex
     rabbitMQClient   *rabbitmq.Client
     authService      *auth.Service
+    channels         *channelSubscriptions // nil without RabbitMQ
+}
+
+// wsClient is the socket of a connected user. A connection supports only one
+// writer at a time, so everything sent to the client goes through it.
+type wsClient struct {
+    conn    *websocket.Conn
+    session string // identifies the connection in call signals
+    writeMu sync.Mutex
+}
+
+// newSessionID returns a random ID for a new connection
+func newSessionID() string {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return fmt.Sprintf("%d", time.Now().UnixNano())
+    }
+    return hex.EncodeToString(b)
+}
+
+// WriteJSON sends v to the client as a JSON text message
+func (c *wsClient) WriteJSON(v interface{}) error {
+    c.writeMu.Lock()
+    defer c.writeMu.Unlock()
+    return c.conn.WriteJSON(v)
+}
+
+// WriteMessage sends a message to the client
+func (c *wsClient) WriteMessage(messageType int, data []byte) error {
+    c.writeMu.Lock()
+    defer c.writeMu.Unlock()
+    return c.conn.WriteMessage(messageType, data)
 }
 
 // NewWebSocketHandler creates a new WebSocketHandler
 func NewWebSocketHandler(messageServiceURL string, rabbitMQClient *rabbitmq.Client, authService *auth.Service) *WebSocketHandler {
     handler := &WebSocketHandler{
         messageServiceURL: messageServiceURL,
-        clients:          make(map[string]*websocket.Conn),
+        clients:          make(map[string]*wsClient),
         clientsMutex:     sync.RWMutex{},
         rabbitMQClient:   rabbitMQClient,
         authService:      authService,
@@ -72,6 +106,29 @@ func NewWebSocketHandler(messageServiceURL string, rabbitMQClient *rabbitmq.Clie
             log.Printf("Failed to bind typing queue: %v", err)
         }
 
+        // Bind events addressed to a list of recipients
+        if err = rabbitMQClient.BindQueue(queue.Name, "event.#", "messages"); err != nil {
+            log.Printf("Failed to bind event queue: %v", err)
+        }
+
+        // Channel posts are routed per channel, so every gateway needs its own queue
+        channelQueue, err := rabbitMQClient.DeclareTransientQueue(channelQueueName())
+        if err != nil {
+            log.Printf("Failed to declare channel queue: %v", err)
+        } else {
+            if err = rabbitMQClient.BindQueue(channelQueue.Name, "channel_follows.#", "messages"); err != nil {
+                log.Printf("Failed to bind channel follows: %v", err)
+            }
+            // Call signals must reach the gateway the other side is connected to
+            if err = rabbitMQClient.BindQueue(channelQueue.Name, models.CallEventRoutingKey("#"), "messages"); err != nil {
+                log.Printf("Failed to bind call events: %v", err)
+            }
+            handler.channels = newChannelSubscriptions(rabbitMQClient, channelQueue.Name)
+            if err = rabbitMQClient.Consume(channelQueue.Name, handler.handleChannelMessage); err != nil {
+                log.Printf("Failed to start consuming channel posts: %v", err)
+            }
+        }
+
         log.Printf("WebSocket Handler: RabbitMQ Consumer Setup Complete")
         
         // Start consuming messages
@@ -106,10 +163,10 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
     log.Printf("WebSocket connection attempt from user: %s", UserIDStr)
 
     h.clientsMutex.Lock()
-    existingConn, exists := h.clients[UserIDStr]
+    existingClient, exists := h.clients[UserIDStr]
     if exists {
         log.Printf("Closing existing connection for user: %s", UserIDStr)
-        existingConn.Close()
+        existingClient.conn.Close()
         delete(h.clients, UserIDStr)
     }
     h.clientsMutex.Unlock()
@@ -132,10 +189,13 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
         return nil
     })
 
+    client := &wsClient{conn: conn, session: newSessionID()}
     h.clientsMutex.Lock()
-    h.clients[UserIDStr] = conn
+    h.clients[UserIDStr] = client
     h.clientsMutex.Unlock()
 
+    go h.subscribeChannels(UserIDStr, client, "Bearer "+token)
+
     if h.rabbitMQClient != nil {
         statusUpdate := models.StatusUpdate{Status: "online"}
         routingKey := fmt.Sprintf("status.user.%s", UserIDStr)
@@ -150,11 +210,25 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
         pingTicker.Stop()
         conn.Close()
         h.clientsMutex.Lock()
-        delete(h.clients, UserIDStr)
+        // A newer connection of the same user may have taken over already
+        replaced := h.clients[UserIDStr] != client
+        if !replaced {
+            delete(h.clients, UserIDStr)
+        }
         h.clientsMutex.Unlock()
+        if h.channels != nil {
+            h.channels.disconnect(UserIDStr, client)
+        }
         
         log.Printf("WebSocket connection closed for user: %s", UserIDStr)
 
+        // Calls cannot go on without the client, unless it reconnected. Only the
+        // call joined or last signaled from this connection ends, so a client
+        // that resumed signaling on another gateway keeps its call.
+        if !replaced {
+            h.publishCallSignal(UserIDStr, client.session, models.CallSignal{Signal: models.CallSignalHangup})
+        }
+
         if h.rabbitMQClient != nil {
             statusUpdate := models.StatusUpdate{Status: "offline"}
             routingKey := fmt.Sprintf("status.user.%s", UserIDStr)
@@ -182,7 +256,7 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
         }
         
         if messageType == websocket.TextMessage && string(p) == "ping" {
-            if err := conn.WriteMessage(websocket.TextMessage, []byte("pong")); err != nil {
+            if err := client.WriteMessage(websocket.TextMessage, []byte("pong")); err != nil {
                 log.Printf("Error sending pong to user %s: %v", UserIDStr, err)
                 break
             }
@@ -217,6 +291,20 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
                 continue
             }
 
+            if msgType, ok := baseMsg["type"].(string); ok && msgType == models.CallFrameType {
+                var signal models.CallSignal
+                if err := json.Unmarshal(p, &signal); err != nil {
+                    log.Printf("Error unmarshalling call signal: %v", err)
+                    continue
+                }
+                if !models.IsValidCallSignal(signal.Signal) {
+                    log.Printf("Ignoring unknown call signal %q from user %s", signal.Signal, UserIDStr)
+                    continue
+                }
+                h.publishCallSignal(UserIDStr, client.session, signal)
+                continue
+            }
+
             var msg models.MessageRequest
             if err := json.Unmarshal(p, &msg); err != nil {
                 log.Printf("Error unmarshalling message: %v", err)
@@ -235,16 +323,30 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 
 // sendTypingEventDirect sends typing event directly to WebSocket client
 func (h *WebSocketHandler) sendTypingEventDirect(event models.TypingEvent) {
-    h.clientsMutex.RLock()
-    defer h.clientsMutex.RUnlock()
-
-    if conn, ok := h.clients[event.ReceiverID]; ok {
-        if err := conn.WriteJSON(event); err != nil {
+    if client, ok := h.client(event.ReceiverID); ok {
+        if err := client.WriteJSON(event); err != nil {
             log.Printf("Error sending typing event to WebSocket: %v", err)
         }
     }
 }
 
+// publishCallSignal relays a call signal from the connection session of userID
+// to the message service, which tracks the call and forwards the signal to the
+// other participants
+func (h *WebSocketHandler) publishCallSignal(userID, session string, signal models.CallSignal) {
+    if h.rabbitMQClient == nil {
+        log.Printf("Dropping %s call signal from user %s: RabbitMQ is not available", signal.Signal, userID)
+        return
+    }
+
+    signal.SenderID = userID
+    signal.SessionID = session
+    signal.Timestamp = time.Now().Format(time.RFC3339)
+    if err := h.rabbitMQClient.PublishToExchange("messages", models.CallRoutingKey(signal.Signal), signal); err != nil {
+        log.Printf("Failed to publish call signal: %v", err)
+    }
+}
+
 // sendMessageViaHTTP sends a message payload using HTTP to the message service
 func (h *WebSocketHandler) sendMessageViaHTTP(payload interface{}, authHeader string) {
     reqBody, err := json.Marshal(payload)
@@ -286,54 +388,50 @@ func (h *WebSocketHandler) handleIncomingRabbitMQMessage(body []byte) error {
         return err
     }
 
+    if _, ok := msg["recipient_ids"]; ok {
+        return h.deliverEvent(body)
+    }
+
     if msgType, ok := msg["type"].(string); ok && msgType == "typing" {
         if receiverID, ok := msg["receiver_id"].(string); ok {
-            h.clientsMutex.RLock()
-            if conn, ok := h.clients[receiverID]; ok {
-                if err := conn.WriteJSON(msg); err != nil {
+            if client, ok := h.client(receiverID); ok {
+                if err := client.WriteJSON(msg); err != nil {
                     log.Printf("Error sending typing event to WebSocket: %v", err)
                 }
             }
-            h.clientsMutex.RUnlock()
         }
         return nil
     }
 
     if msgType, ok := msg["type"].(string); ok && msgType == "batch" {
         if senderID, ok := msg["sender_id"].(string); ok {
-            h.clientsMutex.RLock()
-            if conn, ok := h.clients[senderID]; ok {
-                if err := conn.WriteJSON(msg); err != nil {
+            if client, ok := h.client(senderID); ok {
+                if err := client.WriteJSON(msg); err != nil {
                     log.Printf("Error sending batch update to WebSocket: %v", err)
                 }
             }
-            h.clientsMutex.RUnlock()
         }
         return nil
     }
 
     if _, ok := msg["content"].(string); ok {
         if receiverID, ok := msg["receiver_id"].(string); ok {
-            h.clientsMutex.RLock()
-            if conn, ok := h.clients[receiverID]; ok {
-                if err := conn.WriteJSON(msg); err != nil {
+            if client, ok := h.client(receiverID); ok {
+                if err := client.WriteJSON(msg); err != nil {
                     log.Printf("Error sending message to WebSocket: %v", err)
                 }
             }
-            h.clientsMutex.RUnlock()
         }
         return nil
     }
 
     if _, ok := msg["message_id"].(string); ok {
         if senderID, ok := msg["sender_id"].(string); ok {
-            h.clientsMutex.RLock()
-            if conn, ok := h.clients[senderID]; ok {
-                if err := conn.WriteJSON(msg); err != nil {
+            if client, ok := h.client(senderID); ok {
+                if err := client.WriteJSON(msg); err != nil {
                     log.Printf("Error sending status update to WebSocket: %v", err)
                 }
             }
-            h.clientsMutex.RUnlock()
         }
         return nil
     }
@@ -347,6 +445,42 @@ func (h *WebSocketHandler) handleIncomingRabbitMQMessage(body []byte) error {
     return nil
 }
 
+// deliverEvent writes an event to the connected recipients, leaving out the recipient list itself
+func (h *WebSocketHandler) deliverEvent(body []byte) error {
+    var event models.Event
+    if err := json.Unmarshal(body, &event); err != nil {
+        log.Printf("Error unmarshalling event: %v", err)
+        return err
+    }
+
+    recipientIDs := event.RecipientIDs
+    event.RecipientIDs = nil
+
+    for _, recipientID := range recipientIDs {
+        if client, ok := h.client(recipientID); ok {
+            if err := client.WriteJSON(event); err != nil {
+                log.Printf("Error sending %s event to WebSocket: %v", event.Type, err)
+            }
+        }
+    }
+    return nil
+}
+
+// client returns the socket of a user connected to this gateway
+func (h *WebSocketHandler) client(userID string) (*wsClient, bool) {
+    h.clientsMutex.RLock()
+    defer h.clientsMutex.RUnlock()
+    client, ok := h.clients[userID]
+    return client, ok
+}
+
+// isCurrent reports whether client is still the registered socket of userID
+func (h *WebSocketHandler) isCurrent(userID string, client *wsClient) bool {
+    h.clientsMutex.RLock()
+    defer h.clientsMutex.RUnlock()
+    return h.clients[userID] == client
+}
+
 // SendMessage forwards a message to the message service via HTTP or RabbitMQ
 func (h *WebSocketHandler) SendMessage(c *gin.Context) {
     UserID, exists := c.Get("UserID")
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"whatsapp/pkg/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Policies for the messages of a deleted account
+const (
+	// DeletedAccountKeep leaves messages untouched; the sender shows up as the anonymized account
+	DeletedAccountKeep = "keep"
+	// DeletedAccountAnonymize removes the content and media of the account's messages but keeps them in the timeline
+	DeletedAccountAnonymize = "anonymize"
+	// DeletedAccountDelete removes the account's messages entirely
+	DeletedAccountDelete = "delete"
+)
+
+// AccountEventsHandler applies account lifecycle events published by the user service
+type AccountEventsHandler struct {
+	messagesCollection     *mongo.Collection
+	chatSettingsCollection *mongo.Collection
+	media                  *MediaHandler
+	messagePolicy          string
+}
+
+// NewAccountEventsHandler creates a handler that treats messages of deleted
+// accounts according to messagePolicy. Media the removed messages leave
+// unused is deleted through media, and their pins are released in
+// chatSettingsCollection.
+func NewAccountEventsHandler(messagesCollection, chatSettingsCollection *mongo.Collection, media *MediaHandler, messagePolicy string) (*AccountEventsHandler, error) {
+	switch messagePolicy {
+	case DeletedAccountKeep, DeletedAccountAnonymize, DeletedAccountDelete:
+	default:
+		return nil, fmt.Errorf("unknown deleted account message policy %q", messagePolicy)
+	}
+
+	return &AccountEventsHandler{
+		messagesCollection:     messagesCollection,
+		chatSettingsCollection: chatSettingsCollection,
+		media:                  media,
+		messagePolicy:          messagePolicy,
+	}, nil
+}
+
+// HandleAccountDeleted processes an account.deleted event from RabbitMQ
+func (h *AccountEventsHandler) HandleAccountDeleted(data []byte) error {
+	var event models.AccountDeletedEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+
+	userID, err := primitive.ObjectIDFromHex(event.UserID)
+	if err != nil {
+		// A malformed event can never succeed, so don't requeue it
+		log.Printf("Ignoring account deletion with invalid user ID %q", event.UserID)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if h.messagePolicy == DeletedAccountKeep {
+		return nil
+	}
+	refs, err := h.mediaRefs(ctx, userID)
+	if err != nil {
+		return err
+	}
+	pins, err := h.pins(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	switch h.messagePolicy {
+	case DeletedAccountAnonymize:
+		update := bson.M{
+			"$set": bson.M{
+				"content":    "",
+				"deleted_at": time.Now(),
+				"updated_at": time.Now(),
+			},
+			"$unset": bson.M{
+				"media_url":    "",
+				"media_id":     "",
+				"media_info":   "",
+				"document":     "",
+				"location":     "",
+				"contact":      "",
+				"poll":         "",
+				"link_preview": "",
+				"mentions":     "",
+				"mentions_all": "",
+				"pinned_at":    "",
+				"pinned_by":    "",
+			},
+		}
+		result, err := h.messagesCollection.UpdateMany(ctx, bson.M{"sender_id": userID}, update)
+		if err != nil {
+			return err
+		}
+		log.Printf("Anonymized %d messages of deleted account %s", result.ModifiedCount, event.UserID)
+
+	case DeletedAccountDelete:
+		result, err := h.messagesCollection.DeleteMany(ctx, bson.M{"sender_id": userID})
+		if err != nil {
+			return err
+		}
+		log.Printf("Deleted %d messages of deleted account %s", result.DeletedCount, event.UserID)
+	}
+
+	h.media.detachMedia(ctx, refs)
+	releasePins(ctx, h.chatSettingsCollection, pins)
+	return nil
+}
+
+// pins counts the pinned messages of userID, keyed by chat
+func (h *AccountEventsHandler) pins(ctx context.Context, userID primitive.ObjectID) (map[string]int64, error) {
+	cursor, err := h.messagesCollection.Find(ctx,
+		bson.M{"sender_id": userID, "pinned_at": bson.M{"$exists": true}, "deleted_at": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"group_id": 1, "sender_id": 1, "receiver_id": 1, "pinned_at": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var messages []models.Message
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	return pinnedPerChat(messages), nil
+}
+
+// mediaRefs counts the references the messages of userID hold on each media
+func (h *AccountEventsHandler) mediaRefs(ctx context.Context, userID primitive.ObjectID) (map[primitive.ObjectID]int64, error) {
+	cursor, err := h.messagesCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"sender_id": userID, "media_id": bson.M{"$exists": true}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$media_id", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var counts []struct {
+		MediaID primitive.ObjectID `bson:"_id"`
+		Count   int64              `bson:"count"`
+	}
+	if err := cursor.All(ctx, &counts); err != nil {
+		return nil, err
+	}
+
+	refs := make(map[primitive.ObjectID]int64, len(counts))
+	for _, count := range counts {
+		refs[count.MediaID] = count.Count
+	}
+	return refs, nil
+}
@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxBroadcastLists is the most broadcast lists a user can have
+const maxBroadcastLists = 50
+
+// EnsureBroadcastIndexes creates the index for listing a user's broadcast lists
+func (h *MessageHandler) EnsureBroadcastIndexes(ctx context.Context) error {
+	_, err := h.broadcastsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "owner_id", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+	return err
+}
+
+// CreateBroadcastList godoc
+// @Summary      Create a broadcast list
+// @Description  Creates a list of up to 256 recipients that one message can be sent to as separate 1:1 messages. Recipients are not told about the list.
+// @Tags         broadcasts
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        list  body      models.BroadcastListRequest  true  "Name and recipients"
+// @Success      201   {object}  models.BroadcastListResponse
+// @Failure      400   {object}  models.ErrorResponse
+// @Failure      401   {object}  models.ErrorResponse
+// @Failure      409   {object}  models.ErrorResponse
+// @Failure      500   {object}  models.ErrorResponse
+// @Router       /broadcasts [post]
+func (h *MessageHandler) CreateBroadcastList(c *gin.Context) {
+	var input models.BroadcastListRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	recipientIDs, ok := h.parseRecipients(c, userID, input.RecipientIDs)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	count, err := h.broadcastsCollection.CountDocuments(ctx, bson.M{"owner_id": userID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if count >= maxBroadcastLists {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("You can have at most %d broadcast lists", maxBroadcastLists)})
+		return
+	}
+
+	now := time.Now()
+	list := models.BroadcastList{
+		ID:           primitive.NewObjectID(),
+		OwnerID:      userID,
+		Name:         input.Name,
+		RecipientIDs: recipientIDs,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if _, err := h.broadcastsCollection.InsertOne(ctx, list); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create broadcast list"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, broadcastListResponse(list))
+}
+
+// GetBroadcastLists godoc
+// @Summary      List broadcast lists
+// @Description  Lists the current user's broadcast lists, oldest first
+// @Tags         broadcasts
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}   models.BroadcastListResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /broadcasts [get]
+func (h *MessageHandler) GetBroadcastLists(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	cursor, err := h.broadcastsCollection.Find(ctx, bson.M{"owner_id": userID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var lists []models.BroadcastList
+	if err := cursor.All(ctx, &lists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	responses := []models.BroadcastListResponse{}
+	for _, list := range lists {
+		responses = append(responses, broadcastListResponse(list))
+	}
+	c.JSON(http.StatusOK, responses)
+}
+
+// GetBroadcastList godoc
+// @Summary      Get a broadcast list
+// @Description  Returns one of the current user's broadcast lists
+// @Tags         broadcasts
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      string  true  "Broadcast list ID"
+// @Success      200  {object}  models.BroadcastListResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /broadcasts/{id} [get]
+func (h *MessageHandler) GetBroadcastList(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	list, ok := h.loadBroadcastList(c, c.Param("id"), userID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, broadcastListResponse(list))
+}
+
+// UpdateBroadcastList godoc
+// @Summary      Update a broadcast list
+// @Description  Replaces the name and recipients of one of the current user's broadcast lists
+// @Tags         broadcasts
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path      string                       true  "Broadcast list ID"
+// @Param        list  body      models.BroadcastListRequest  true  "Name and recipients"
+// @Success      200   {object}  models.BroadcastListResponse
+// @Failure      400   {object}  models.ErrorResponse
+// @Failure      401   {object}  models.ErrorResponse
+// @Failure      404   {object}  models.ErrorResponse
+// @Failure      500   {object}  models.ErrorResponse
+// @Router       /broadcasts/{id} [put]
+func (h *MessageHandler) UpdateBroadcastList(c *gin.Context) {
+	var input models.BroadcastListRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	listID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid broadcast list ID"})
+		return
+	}
+
+	recipientIDs, ok := h.parseRecipients(c, userID, input.RecipientIDs)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	var list models.BroadcastList
+	err = h.broadcastsCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": listID, "owner_id": userID},
+		bson.M{"$set": bson.M{"name": input.Name, "recipient_ids": recipientIDs, "updated_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&list)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Broadcast list not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update broadcast list"})
+		return
+	}
+
+	c.JSON(http.StatusOK, broadcastListResponse(list))
+}
+
+// DeleteBroadcastList godoc
+// @Summary      Delete a broadcast list
+// @Description  Deletes one of the current user's broadcast lists. Messages already sent through it stay in their 1:1 chats.
+// @Tags         broadcasts
+// @Security     BearerAuth
+// @Param        id   path  string  true  "Broadcast list ID"
+// @Success      204
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /broadcasts/{id} [delete]
+func (h *MessageHandler) DeleteBroadcastList(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	listID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid broadcast list ID"})
+		return
+	}
+
+	result, err := h.broadcastsCollection.DeleteOne(context.Background(), bson.M{"_id": listID, "owner_id": userID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete broadcast list"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Broadcast list not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// parseRecipients validates the recipients of a broadcast list of ownerID,
+// dropping duplicates and keeping their order, and responds with an error if
+// they are not valid
+func (h *MessageHandler) parseRecipients(c *gin.Context, ownerID primitive.ObjectID, hexIDs []string) ([]primitive.ObjectID, bool) {
+	recipientIDs := make([]primitive.ObjectID, 0, len(hexIDs))
+	seen := make(map[primitive.ObjectID]bool, len(hexIDs))
+	for _, hexID := range hexIDs {
+		id, err := primitive.ObjectIDFromHex(hexID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid recipient ID %q", hexID)})
+			return nil, false
+		}
+		if id == ownerID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot add yourself to a broadcast list"})
+			return nil, false
+		}
+		if !seen[id] {
+			seen[id] = true
+			recipientIDs = append(recipientIDs, id)
+		}
+	}
+	if len(recipientIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A broadcast list needs at least one recipient"})
+		return nil, false
+	}
+	if len(recipientIDs) > models.MaxBroadcastRecipients {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A broadcast list can have at most %d recipients", models.MaxBroadcastRecipients)})
+		return nil, false
+	}
+
+	count, err := h.usersCollection.CountDocuments(context.Background(), bson.M{"_id": bson.M{"$in": recipientIDs}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+	if int(count) != len(recipientIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown recipient"})
+		return nil, false
+	}
+	return recipientIDs, true
+}
+
+// loadBroadcastList loads a broadcast list of userID, responding with an error if there is none
+func (h *MessageHandler) loadBroadcastList(c *gin.Context, listIDHex string, userID primitive.ObjectID) (models.BroadcastList, bool) {
+	var list models.BroadcastList
+	listID, err := primitive.ObjectIDFromHex(listIDHex)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid broadcast list ID"})
+		return list, false
+	}
+
+	// Lists are private, so other users' lists are reported as missing
+	err = h.broadcastsCollection.FindOne(context.Background(), bson.M{"_id": listID, "owner_id": userID}).Decode(&list)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Broadcast list not found"})
+		return list, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return list, false
+	}
+	return list, true
+}
+
+func broadcastListResponse(list models.BroadcastList) models.BroadcastListResponse {
+	return models.BroadcastListResponse{
+		ID:           list.ID.Hex(),
+		Name:         list.Name,
+		RecipientIDs: objectIDHexes(list.RecipientIDs),
+		CreatedAt:    list.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:    list.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// sendBroadcast sends a copy of template, built by buildMessage, as a 1:1
+// message to every recipient of a broadcast list who has the sender as a
+// contact, so that replies land in their private chats with the sender
+func (h *MessageHandler) sendBroadcast(c *gin.Context, template models.Message, listIDHex string) {
+	list, ok := h.loadBroadcastList(c, listIDHex, template.SenderID)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	contacts, err := h.usersCollection.Database().Collection("contacts").Find(ctx,
+		bson.M{"UserID": bson.M{"$in": list.RecipientIDs}, "contact_id": template.SenderID},
+		options.Find().SetProjection(bson.M{"UserID": 1}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var contactDocs []struct {
+		UserID primitive.ObjectID `bson:"UserID"`
+	}
+	if err := contacts.All(ctx, &contactDocs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	hasSender := make(map[primitive.ObjectID]bool, len(contactDocs))
+	for _, doc := range contactDocs {
+		hasSender[doc.UserID] = true
+	}
+
+	response := models.BroadcastResponse{
+		BroadcastID: list.ID.Hex(),
+		Messages:    []models.MessageResponse{},
+		SkippedIDs:  []string{},
+	}
+	var copies []models.Message
+	for _, recipientID := range list.RecipientIDs {
+		if !hasSender[recipientID] {
+			response.SkippedIDs = append(response.SkippedIDs, recipientID.Hex())
+			continue
+		}
+		msg := template
+		msg.ID = primitive.NewObjectID()
+		msg.ReceiverID = recipientID
+		copies = append(copies, msg)
+	}
+	if len(copies) == 0 {
+		c.JSON(http.StatusCreated, response)
+		return
+	}
+
+	h.stampExpiries(ctx, copies)
+
+	docs := make([]interface{}, 0, len(copies))
+	for _, msg := range copies {
+		docs = append(docs, msg)
+	}
+	if !template.MediaID.IsZero() {
+		if err := h.media.attachMedia(ctx, template.MediaID, int64(len(copies))); err != nil {
+			if errors.Is(err, errMediaNotFound) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save message"})
+			}
+			return
+		}
+	}
+	if _, err := h.messagesCollection.InsertMany(ctx, docs); err != nil {
+		if !template.MediaID.IsZero() {
+			h.media.detachMedia(ctx, map[primitive.ObjectID]int64{template.MediaID: int64(len(copies))})
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save message"})
+		return
+	}
+
+	for _, msg := range copies {
+		messageResponse := h.messageResponse(msg)
+		h.publishDirectMessage(messageResponse)
+		response.Messages = append(response.Messages, messageResponse)
+	}
+
+	// One after the other, so that the first fetch fills the preview cache for the rest
+	go func() {
+		for _, msg := range copies {
+			h.attachLinkPreview(msg)
+		}
+	}()
+
+	log.Printf("Broadcast %s sent %d messages, skipped %d recipients", list.ID.Hex(), len(copies), len(response.SkippedIDs))
+	c.JSON(http.StatusCreated, response)
+}
@@ -0,0 +1,718 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxCallLogPage is the most calls GetCalls returns at once
+const maxCallLogPage = 100
+
+// liveCallStates are the states of calls that have not ended
+var liveCallStates = []string{models.CallStateRinging, models.CallStateActive}
+
+// callLockGrace is how long a call lock is kept even if its call is not live,
+// which covers the time between taking the lock and saving or joining the call
+const callLockGrace = time.Minute
+
+// callLock marks a user as being in a call. There is one per user, so taking
+// it is what makes a user busy, atomically.
+type callLock struct {
+	UserID    primitive.ObjectID `bson:"_id"`
+	CallID    primitive.ObjectID `bson:"call_id"`
+	SessionID string             `bson:"session_id,omitempty"` // gateway connection the user is in the call from
+	CreatedAt time.Time          `bson:"created_at"`
+}
+
+// CallHandler tracks voice and video calls. Clients signal on the WebSocket and
+// the gateways relay the signals through the messages exchange to HandleSignal,
+// which keeps the state of each call and forwards the signals to the other
+// participants as events, wherever they are connected. Media flows between the
+// clients; the server only sees the signaling.
+type CallHandler struct {
+	callsCollection *mongo.Collection
+	locksCollection *mongo.Collection
+	messages        *MessageHandler
+	rabbitMQClient  RabbitMQClient
+}
+
+// NewCallHandler creates a call handler. Call entries are added to chats through messages.
+func NewCallHandler(db *mongo.Database, messages *MessageHandler, rabbitMQClient RabbitMQClient) *CallHandler {
+	return &CallHandler{
+		callsCollection: db.Collection("calls"),
+		locksCollection: db.Collection("call_locks"),
+		messages:        messages,
+		rabbitMQClient:  rabbitMQClient,
+	}
+}
+
+// EnsureIndexes creates the indexes for hang-ups, ring timeouts, call logs and releasing call locks
+func (h *CallHandler) EnsureIndexes(ctx context.Context) error {
+	_, err := h.callsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "joined_ids", Value: 1}, {Key: "state", Value: 1}}},
+		{Keys: bson.D{{Key: "state", Value: 1}, {Key: "ring_expires_at", Value: 1}}},
+		{Keys: bson.D{{Key: "caller_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "invitee_ids", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = h.locksCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "call_id", Value: 1}},
+	})
+	return err
+}
+
+// HandleSignal processes a call signal relayed by a gateway. Signals are only
+// useful for a few seconds, so they are never requeued; refused signals are
+// answered with a call_failed event to their sender.
+func (h *CallHandler) HandleSignal(body []byte) error {
+	var signal models.CallSignal
+	if err := json.Unmarshal(body, &signal); err != nil {
+		log.Printf("Dropping malformed call signal: %v", err)
+		return nil
+	}
+	senderID, err := primitive.ObjectIDFromHex(signal.SenderID)
+	if err != nil {
+		log.Printf("Dropping call signal without a valid sender: %q", signal.SenderID)
+		return nil
+	}
+	signal.Type = ""
+	// The session only matters here, peers do not see it
+	sessionID := signal.SessionID
+	signal.SessionID = ""
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	switch {
+	case signal.Signal == models.CallSignalOffer && signal.CallID == "":
+		err = h.startCall(ctx, senderID, sessionID, signal)
+	case signal.Signal == models.CallSignalHangup && signal.CallID == "":
+		err = h.hangUpCurrentCalls(ctx, senderID, sessionID)
+	default:
+		err = h.handleCallSignal(ctx, senderID, sessionID, signal)
+	}
+	if err != nil {
+		h.publishCallEvent(models.EventCallFailed, []string{signal.SenderID}, models.CallError{
+			Signal: signal.Signal,
+			CallID: signal.CallID,
+			Error:  err.Error(),
+		})
+	}
+	return nil
+}
+
+// startCall rings the receiver or the group members named in an offer.
+// Invitees who are in another call are marked busy and not rung.
+func (h *CallHandler) startCall(ctx context.Context, callerID primitive.ObjectID, sessionID string, signal models.CallSignal) error {
+	now := time.Now()
+	call := models.Call{
+		ID:            primitive.NewObjectID(),
+		CallerID:      callerID,
+		Video:         signal.Video,
+		State:         models.CallStateRinging,
+		JoinedIDs:     []primitive.ObjectID{callerID},
+		RingExpiresAt: now.Add(models.CallRingTimeout),
+		CreatedAt:     now,
+	}
+
+	switch {
+	case signal.GroupID != "":
+		groupID, err := primitive.ObjectIDFromHex(signal.GroupID)
+		if err != nil {
+			return errors.New("Invalid group ID")
+		}
+		members, err := h.messages.fetchGroupMembers(groupID)
+		if err != nil {
+			log.Printf("Failed to fetch members of group %s for a call: %v", groupID.Hex(), err)
+			return errors.New("Group not found")
+		}
+		if !slices.Contains(members, callerID) {
+			return errors.New("Group not found")
+		}
+		for _, memberID := range members {
+			if memberID != callerID {
+				call.InviteeIDs = append(call.InviteeIDs, memberID)
+			}
+		}
+		if len(call.InviteeIDs) == 0 {
+			return errors.New("Nobody else is in the group")
+		}
+		call.GroupID = groupID
+	case signal.ReceiverID != "":
+		receiverID, err := primitive.ObjectIDFromHex(signal.ReceiverID)
+		if err != nil {
+			return errors.New("Invalid receiver ID")
+		}
+		if receiverID == callerID {
+			return errors.New("You cannot call yourself")
+		}
+		// Whoever can be messaged directly can be called
+		if err := h.messages.checkDirectRecipient(receiverID); err != nil {
+			return err
+		}
+		call.ReceiverID = receiverID
+		call.InviteeIDs = []primitive.ObjectID{receiverID}
+	default:
+		return errors.New("receiver_id or group_id is required")
+	}
+
+	locked, err := h.lockCall(ctx, callerID, call.ID, sessionID)
+	if err != nil {
+		log.Printf("Failed to lock %s into a call: %v", callerID.Hex(), err)
+		return errors.New("Failed to start the call")
+	}
+	if !locked {
+		return errors.New("You are already in a call")
+	}
+
+	busy, err := h.busyUsers(ctx, call.InviteeIDs)
+	if err != nil {
+		log.Printf("Failed to check who is in a call: %v", err)
+		h.unlockCall(ctx, callerID, call.ID)
+		return errors.New("Failed to start the call")
+	}
+	var ringIDs []string
+	for _, inviteeID := range call.InviteeIDs {
+		if busy[inviteeID] {
+			call.BusyIDs = append(call.BusyIDs, inviteeID)
+		} else {
+			ringIDs = append(ringIDs, inviteeID.Hex())
+		}
+	}
+
+	if _, err := h.callsCollection.InsertOne(ctx, call); err != nil {
+		log.Printf("Failed to save call: %v", err)
+		h.unlockCall(ctx, callerID, call.ID)
+		return errors.New("Failed to start the call")
+	}
+
+	if len(ringIDs) == 0 {
+		h.endCall(ctx, call, models.CallEndBusy)
+		return nil
+	}
+
+	// The caller learns the call ID from the update
+	h.publishCallEvent(models.EventCallUpdated, []string{callerID.Hex()}, callResponse(call))
+	signal.CallID = call.ID.Hex()
+	signal.Timestamp = now.Format(time.RFC3339)
+	h.publishCallEvent(models.EventCallOffer, ringIDs, signal)
+	return nil
+}
+
+// handleCallSignal processes a signal about an existing call
+func (h *CallHandler) handleCallSignal(ctx context.Context, senderID primitive.ObjectID, sessionID string, signal models.CallSignal) error {
+	if !models.IsValidCallSignal(signal.Signal) {
+		return errors.New("Unknown call signal")
+	}
+	callID, err := primitive.ObjectIDFromHex(signal.CallID)
+	if err != nil {
+		return errors.New("Invalid call ID")
+	}
+
+	var call models.Call
+	if err := h.callsCollection.FindOne(ctx, bson.M{"_id": callID}).Decode(&call); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return errors.New("Call not found")
+		}
+		log.Printf("Failed to load call %s: %v", callID.Hex(), err)
+		return errors.New("Failed to load the call")
+	}
+	if !isCallParticipant(call, senderID) {
+		return errors.New("Call not found")
+	}
+	if call.State == models.CallStateEnded {
+		return errors.New("The call has ended")
+	}
+	if sessionID != "" && slices.Contains(call.JoinedIDs, senderID) {
+		// The participant may have reconnected, possibly to another gateway, and
+		// its call now ends when that connection closes
+		_, err := h.locksCollection.UpdateOne(ctx,
+			bson.M{"_id": senderID, "call_id": call.ID, "session_id": bson.M{"$ne": sessionID}},
+			bson.M{"$set": bson.M{"session_id": sessionID}},
+		)
+		if err != nil {
+			log.Printf("Failed to move call %s of %s to a new connection: %v", call.ID.Hex(), senderID.Hex(), err)
+		}
+	}
+
+	switch signal.Signal {
+	case models.CallSignalRinging:
+		signal.Timestamp = time.Now().Format(time.RFC3339)
+		h.publishCallEvent(models.EventCallRinging, []string{call.CallerID.Hex()}, signal)
+		return nil
+	case models.CallSignalAccept:
+		return h.acceptCall(ctx, call, senderID, sessionID)
+	case models.CallSignalReject:
+		return h.rejectCall(ctx, call, senderID)
+	case models.CallSignalHangup:
+		return h.leaveCall(ctx, call, senderID)
+	}
+
+	// Offers, answers and ICE candidates go to a single peer
+	targetID, err := callSignalTarget(call, senderID, signal.TargetID)
+	if err != nil {
+		return err
+	}
+	eventType := map[string]string{
+		models.CallSignalOffer:        models.EventCallOffer,
+		models.CallSignalAnswer:       models.EventCallAnswer,
+		models.CallSignalICECandidate: models.EventCallICECandidate,
+	}[signal.Signal]
+	signal.TargetID = targetID.Hex()
+	signal.Timestamp = time.Now().Format(time.RFC3339)
+	h.publishCallEvent(eventType, []string{targetID.Hex()}, signal)
+	return nil
+}
+
+// acceptCall adds an invitee who picked up from sessionID to the call
+func (h *CallHandler) acceptCall(ctx context.Context, call models.Call, userID primitive.ObjectID, sessionID string) error {
+	if userID == call.CallerID {
+		return errors.New("You cannot accept your own call")
+	}
+	if slices.Contains(call.JoinedIDs, userID) {
+		return nil
+	}
+
+	locked, err := h.lockCall(ctx, userID, call.ID, sessionID)
+	if err != nil {
+		log.Printf("Failed to lock %s into a call: %v", userID.Hex(), err)
+		return errors.New("Failed to accept the call")
+	}
+	if !locked {
+		return errors.New("Hang up your other call first")
+	}
+
+	update := bson.M{
+		"$set":      bson.M{"state": models.CallStateActive},
+		"$min":      bson.M{"answered_at": time.Now()},
+		"$addToSet": bson.M{"joined_ids": userID, "answered_ids": userID},
+		"$pull":     bson.M{"rejected_ids": userID},
+	}
+	updated, err := h.updateLiveCall(ctx, call.ID, bson.M{}, update)
+	if err != nil {
+		h.unlockCall(ctx, userID, call.ID)
+		return err
+	}
+	h.publishCallEvent(models.EventCallUpdated, callParticipantIDs(updated), callResponse(updated))
+	return nil
+}
+
+// rejectCall declines a call for an invitee. The call ends once every invitee
+// declined or was busy before anyone picked up.
+func (h *CallHandler) rejectCall(ctx context.Context, call models.Call, userID primitive.ObjectID) error {
+	if userID == call.CallerID {
+		return errors.New("Hang up to cancel your own call")
+	}
+	if slices.Contains(call.JoinedIDs, userID) {
+		return errors.New("Hang up to leave the call")
+	}
+
+	updated, err := h.updateLiveCall(ctx, call.ID, bson.M{}, bson.M{"$addToSet": bson.M{"rejected_ids": userID}})
+	if err != nil {
+		return err
+	}
+	if updated.State == models.CallStateRinging && len(updated.RejectedIDs)+len(updated.BusyIDs) >= len(updated.InviteeIDs) {
+		h.endCall(ctx, updated, models.CallEndRejected)
+		return nil
+	}
+	h.publishCallEvent(models.EventCallUpdated, callParticipantIDs(updated), callResponse(updated))
+	return nil
+}
+
+// leaveCall hangs up for userID. The call ends when the caller hangs up before
+// anyone picked up, or when fewer than two people are left in it.
+func (h *CallHandler) leaveCall(ctx context.Context, call models.Call, userID primitive.ObjectID) error {
+	if !slices.Contains(call.JoinedIDs, userID) {
+		// Hanging up a call that is still ringing declines it
+		return h.rejectCall(ctx, call, userID)
+	}
+
+	updated, err := h.updateLiveCall(ctx, call.ID, bson.M{"joined_ids": userID}, bson.M{"$pull": bson.M{"joined_ids": userID}})
+	if err != nil {
+		// Already gone, e.g. after hanging up on another device
+		return nil
+	}
+	h.unlockCall(ctx, userID, call.ID)
+
+	switch {
+	case updated.State == models.CallStateRinging:
+		h.endCall(ctx, updated, models.CallEndCancelled)
+	case len(updated.JoinedIDs) < 2:
+		h.endCall(ctx, updated, models.CallEndCompleted)
+	default:
+		h.publishCallEvent(models.EventCallUpdated, callParticipantIDs(updated), callResponse(updated))
+	}
+	return nil
+}
+
+// hangUpCurrentCalls takes userID out of the call they are in from the
+// connection sessionID, or out of every call without a session. Gateways send
+// it when the user's connection closes, so that calls do not outlive their
+// clients, while a call the user carries on from another connection continues.
+func (h *CallHandler) hangUpCurrentCalls(ctx context.Context, userID primitive.ObjectID, sessionID string) error {
+	filter := bson.M{
+		"joined_ids": userID,
+		"state":      bson.M{"$in": liveCallStates},
+	}
+	if sessionID != "" {
+		var lock callLock
+		err := h.locksCollection.FindOne(ctx, bson.M{"_id": userID, "session_id": sessionID}).Decode(&lock)
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		if err != nil {
+			log.Printf("Failed to look up the call of %s: %v", userID.Hex(), err)
+			return nil
+		}
+		filter["_id"] = lock.CallID
+	}
+
+	cursor, err := h.callsCollection.Find(ctx, filter)
+	if err != nil {
+		log.Printf("Failed to look up calls of %s: %v", userID.Hex(), err)
+		return nil
+	}
+	var calls []models.Call
+	if err := cursor.All(ctx, &calls); err != nil {
+		log.Printf("Failed to read calls of %s: %v", userID.Hex(), err)
+		return nil
+	}
+	for _, call := range calls {
+		if err := h.leaveCall(ctx, call, userID); err != nil {
+			log.Printf("Failed to hang up call %s for %s: %v", call.ID.Hex(), userID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// updateLiveCall applies update to a call that has not ended and returns the result
+func (h *CallHandler) updateLiveCall(ctx context.Context, callID primitive.ObjectID, filter, update bson.M) (models.Call, error) {
+	filter["_id"] = callID
+	filter["state"] = bson.M{"$in": liveCallStates}
+
+	var updated models.Call
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := h.callsCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updated); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return updated, errors.New("The call has ended")
+		}
+		log.Printf("Failed to update call %s: %v", callID.Hex(), err)
+		return updated, errors.New("Failed to update the call")
+	}
+	return updated, nil
+}
+
+// endCall ends a call, adds its entry to the chat and tells everyone called.
+// Only the first of concurrent attempts to end a call has an effect.
+func (h *CallHandler) endCall(ctx context.Context, call models.Call, reason string) {
+	now := time.Now()
+	set := bson.M{
+		"state":      models.CallStateEnded,
+		"ended_at":   now,
+		"end_reason": reason,
+		"joined_ids": []primitive.ObjectID{},
+	}
+	if call.AnsweredAt != nil {
+		set["duration"] = int64(now.Sub(*call.AnsweredAt).Seconds())
+	}
+
+	var ended models.Call
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	filter := bson.M{"_id": call.ID, "state": bson.M{"$in": liveCallStates}}
+	if err := h.callsCollection.FindOneAndUpdate(ctx, filter, bson.M{"$set": set}, opts).Decode(&ended); err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Failed to end call %s: %v", call.ID.Hex(), err)
+		}
+		return
+	}
+	if _, err := h.locksCollection.DeleteMany(ctx, bson.M{"call_id": ended.ID}); err != nil {
+		log.Printf("Failed to release the participants of call %s: %v", ended.ID.Hex(), err)
+	}
+
+	// The entry sits in the chat where the call started
+	entry := models.Message{
+		ID:         primitive.NewObjectID(),
+		SenderID:   ended.CallerID,
+		ReceiverID: ended.ReceiverID,
+		GroupID:    ended.GroupID,
+		Type:       models.MessageTypeCall,
+		Call: &models.CallInfo{
+			CallID:    ended.ID,
+			Video:     ended.Video,
+			EndReason: ended.EndReason,
+			Duration:  ended.Duration,
+		},
+		CreatedAt: ended.CreatedAt,
+		Status:    models.MessageStatusSent,
+	}
+	if _, err := h.messages.deliverMessage(entry); err != nil {
+		log.Printf("Failed to add call %s to its chat: %v", ended.ID.Hex(), err)
+	} else {
+		ended.MessageID = entry.ID
+		if _, err := h.callsCollection.UpdateOne(ctx, bson.M{"_id": ended.ID}, bson.M{"$set": bson.M{"message_id": entry.ID}}); err != nil {
+			log.Printf("Failed to link call %s to its chat entry: %v", ended.ID.Hex(), err)
+		}
+	}
+
+	h.publishCallEvent(models.EventCallEnded, callParticipantIDs(ended), callResponse(ended))
+}
+
+// StartRingTimeouts ends calls that rang for models.CallRingTimeout without
+// anyone picking up, checking every interval
+func (h *CallHandler) StartRingTimeouts(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			h.endUnansweredCalls()
+		}
+	}()
+}
+
+// endUnansweredCalls ends the ringing calls whose ring timeout passed as missed
+func (h *CallHandler) endUnansweredCalls() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cursor, err := h.callsCollection.Find(ctx, bson.M{
+		"state":           models.CallStateRinging,
+		"ring_expires_at": bson.M{"$lte": time.Now()},
+	})
+	if err != nil {
+		log.Printf("Failed to look up unanswered calls: %v", err)
+		return
+	}
+	var calls []models.Call
+	if err := cursor.All(ctx, &calls); err != nil {
+		log.Printf("Failed to read unanswered calls: %v", err)
+		return
+	}
+	for _, call := range calls {
+		h.endCall(ctx, call, models.CallEndMissed)
+	}
+}
+
+// lockCall takes the call lock of userID for callID from the connection
+// sessionID. It reports false if the user is in another call.
+func (h *CallHandler) lockCall(ctx context.Context, userID, callID primitive.ObjectID, sessionID string) (bool, error) {
+	for range 2 {
+		_, err := h.locksCollection.InsertOne(ctx, callLock{
+			UserID:    userID,
+			CallID:    callID,
+			SessionID: sessionID,
+			CreatedAt: time.Now(),
+		})
+		if err == nil {
+			return true, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return false, err
+		}
+
+		var lock callLock
+		err = h.locksCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&lock)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if lock.CallID == callID {
+			return true, nil
+		}
+		if time.Since(lock.CreatedAt) < callLockGrace {
+			return false, nil
+		}
+		live, err := h.callsCollection.CountDocuments(ctx, bson.M{
+			"_id":        lock.CallID,
+			"joined_ids": userID,
+			"state":      bson.M{"$in": liveCallStates},
+		})
+		if err != nil {
+			return false, err
+		}
+		if live > 0 {
+			return false, nil
+		}
+		// Left behind by a call that ended without releasing it
+		if _, err := h.locksCollection.DeleteOne(ctx, bson.M{"_id": userID, "call_id": lock.CallID}); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// unlockCall releases the call lock userID holds for callID
+func (h *CallHandler) unlockCall(ctx context.Context, userID, callID primitive.ObjectID) {
+	if _, err := h.locksCollection.DeleteOne(ctx, bson.M{"_id": userID, "call_id": callID}); err != nil {
+		log.Printf("Failed to release call %s of %s: %v", callID.Hex(), userID.Hex(), err)
+	}
+}
+
+// busyUsers returns which of userIDs are in a call
+func (h *CallHandler) busyUsers(ctx context.Context, userIDs []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	cursor, err := h.locksCollection.Find(ctx, bson.M{"_id": bson.M{"$in": userIDs}})
+	if err != nil {
+		return nil, err
+	}
+	var locks []callLock
+	if err := cursor.All(ctx, &locks); err != nil {
+		return nil, err
+	}
+
+	busy := make(map[primitive.ObjectID]bool, len(locks))
+	for _, lock := range locks {
+		busy[lock.UserID] = true
+	}
+	return busy, nil
+}
+
+// GetCalls godoc
+// @Summary      Get the call log
+// @Description  Returns the calls you placed or were called in, newest first. To call, send frames of type "call" on the WebSocket, see models.CallSignal.
+// @Tags         calls
+// @Produce      json
+// @Security     BearerAuth
+// @Param        limit   query     int     false  "Maximum number of calls (default 50, at most 100)"
+// @Param        before  query     string  false  "Only calls started before this RFC 3339 timestamp"
+// @Param        missed  query     bool    false  "Only incoming calls you did not pick up"
+// @Success      200     {array}   models.CallLogEntry
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      401     {object}  models.ErrorResponse
+// @Failure      500     {object}  models.ErrorResponse
+// @Router       /calls [get]
+func (h *CallHandler) GetCalls(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	filter := bson.M{"$or": []bson.M{{"caller_id": userID}, {"invitee_ids": userID}}}
+	if missed, _ := strconv.ParseBool(c.Query("missed")); missed {
+		filter = bson.M{
+			"invitee_ids":  userID,
+			"answered_ids": bson.M{"$ne": userID},
+			"state":        models.CallStateEnded,
+		}
+	}
+	if beforeParam := c.Query("before"); beforeParam != "" {
+		before, err := time.Parse(time.RFC3339, beforeParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid before timestamp"})
+			return
+		}
+		filter["created_at"] = bson.M{"$lt": before}
+	}
+
+	limit := 50
+	if limitParam := c.Query("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = min(parsed, maxCallLogPage)
+	}
+
+	ctx := context.Background()
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := h.callsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var calls []models.Call
+	if err := cursor.All(ctx, &calls); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	entries := make([]models.CallLogEntry, 0, len(calls))
+	for _, call := range calls {
+		outgoing := call.CallerID == userID
+		entries = append(entries, models.CallLogEntry{
+			CallResponse: callResponse(call),
+			Outgoing:     outgoing,
+			Missed:       !outgoing && call.State == models.CallStateEnded && !slices.Contains(call.AnsweredIDs, userID),
+		})
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// isCallParticipant reports whether userID placed or was called in call
+func isCallParticipant(call models.Call, userID primitive.ObjectID) bool {
+	return call.CallerID == userID || slices.Contains(call.InviteeIDs, userID)
+}
+
+// callParticipantIDs returns the IDs of the caller and everyone called
+func callParticipantIDs(call models.Call) []string {
+	return objectIDHexes(append([]primitive.ObjectID{call.CallerID}, call.InviteeIDs...))
+}
+
+// callSignalTarget resolves the peer an offer, answer or ICE candidate from senderID is for
+func callSignalTarget(call models.Call, senderID primitive.ObjectID, targetIDHex string) (primitive.ObjectID, error) {
+	if targetIDHex == "" {
+		if !call.GroupID.IsZero() {
+			return primitive.NilObjectID, errors.New("target_id is required in group calls")
+		}
+		if senderID == call.CallerID {
+			return call.ReceiverID, nil
+		}
+		return call.CallerID, nil
+	}
+
+	targetID, err := primitive.ObjectIDFromHex(targetIDHex)
+	if err != nil {
+		return primitive.NilObjectID, errors.New("Invalid target ID")
+	}
+	if targetID == senderID || !isCallParticipant(call, targetID) {
+		return primitive.NilObjectID, errors.New("The target is not in the call")
+	}
+	return targetID, nil
+}
+
+// publishCallEvent sends a call event to recipients through every gateway
+func (h *CallHandler) publishCallEvent(eventType string, recipientIDs []string, data interface{}) {
+	event := models.NewEvent(eventType, recipientIDs, data)
+	if err := h.rabbitMQClient.PublishToExchange("messages", models.CallEventRoutingKey(event.Type), event); err != nil {
+		log.Printf("Failed to publish %s event: %v", eventType, err)
+	}
+}
+
+// callResponse converts a stored call into its API representation
+func callResponse(call models.Call) models.CallResponse {
+	return models.CallResponse{
+		ID:          call.ID.Hex(),
+		CallerID:    call.CallerID.Hex(),
+		ReceiverID:  optionalIDHex(call.ReceiverID),
+		GroupID:     optionalIDHex(call.GroupID),
+		Video:       call.Video,
+		State:       call.State,
+		InviteeIDs:  objectIDHexes(call.InviteeIDs),
+		JoinedIDs:   objectIDHexes(call.JoinedIDs),
+		RejectedIDs: objectIDHexes(call.RejectedIDs),
+		BusyIDs:     objectIDHexes(call.BusyIDs),
+		AnsweredAt:  formatOptionalTime(call.AnsweredAt),
+		EndedAt:     formatOptionalTime(call.EndedAt),
+		EndReason:   call.EndReason,
+		Duration:    call.Duration,
+		MessageID:   optionalIDHex(call.MessageID),
+		CreatedAt:   call.CreatedAt.Format(time.RFC3339),
+	}
+}
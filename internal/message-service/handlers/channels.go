@@ -0,0 +1,906 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// maxChannelsPage is the most channels SearchChannels returns at once
+	maxChannelsPage = 50
+	// maxChannelPostsPage is the most posts GetChannelPosts returns at once
+	maxChannelPostsPage = 100
+	// maxReactionBytes bounds reactions to a short emoji sequence
+	maxReactionBytes = 32
+)
+
+// ChannelHandler handles announcement channels. Posts are published once per
+// channel on the messages exchange instead of once per follower; gateways bind
+// the channels their connected users follow and deliver posts locally.
+type ChannelHandler struct {
+	channelsCollection  *mongo.Collection
+	followersCollection *mongo.Collection
+	postsCollection     *mongo.Collection
+	reactionsCollection *mongo.Collection
+	usersCollection     *mongo.Collection
+	messages            *MessageHandler
+	rabbitMQClient      RabbitMQClient
+}
+
+// NewChannelHandler creates a channel handler. Posts are validated and
+// rendered like chat messages by messages.
+func NewChannelHandler(db *mongo.Database, messages *MessageHandler, rabbitMQClient RabbitMQClient) *ChannelHandler {
+	return &ChannelHandler{
+		channelsCollection:  db.Collection("channels"),
+		followersCollection: db.Collection("channel_followers"),
+		postsCollection:     db.Collection("channel_posts"),
+		reactionsCollection: db.Collection("channel_reactions"),
+		usersCollection:     db.Collection("users"),
+		messages:            messages,
+		rabbitMQClient:      rabbitMQClient,
+	}
+}
+
+// EnsureIndexes creates the indexes for channel search, follows, posts and reactions
+func (h *ChannelHandler) EnsureIndexes(ctx context.Context) error {
+	if _, err := h.channelsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "follower_count", Value: -1}},
+	}); err != nil {
+		return err
+	}
+	if _, err := h.followersCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "channel_id", Value: 1}, {Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "followed_at", Value: -1}}},
+	}); err != nil {
+		return err
+	}
+	if _, err := h.postsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "channel_id", Value: 1}, {Key: "created_at", Value: -1}},
+	}); err != nil {
+		return err
+	}
+	_, err := h.reactionsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "post_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// CreateChannel godoc
+// @Summary      Create a channel
+// @Description  Creates an announcement channel. The creator owns it, is its first admin and follows it.
+// @Tags         channels
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        channel  body      models.ChannelRequest  true  "Channel details"
+// @Success      201      {object}  models.ChannelResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      401      {object}  models.ErrorResponse
+// @Failure      500      {object}  models.ErrorResponse
+// @Router       /channels [post]
+func (h *ChannelHandler) CreateChannel(c *gin.Context) {
+	var input models.ChannelRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	now := time.Now()
+	channel := models.Channel{
+		ID:            primitive.NewObjectID(),
+		Name:          name,
+		Description:   strings.TrimSpace(input.Description),
+		OwnerID:       userID,
+		AdminIDs:      []primitive.ObjectID{userID},
+		FollowerCount: 1,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	ctx := context.Background()
+	if _, err := h.channelsCollection.InsertOne(ctx, channel); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create channel"})
+		return
+	}
+	follower := models.ChannelFollower{ChannelID: channel.ID, UserID: userID, FollowedAt: now}
+	if _, err := h.followersCollection.InsertOne(ctx, follower); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to follow channel"})
+		return
+	}
+	h.publishFollowUpdate(channel.ID, userID, true)
+
+	c.JSON(http.StatusCreated, channelResponse(channel, userID, true))
+}
+
+// SearchChannels godoc
+// @Summary      Find channels
+// @Description  Lists channels whose name contains q, most followed first
+// @Tags         channels
+// @Produce      json
+// @Security     BearerAuth
+// @Param        q      query     string  false  "Part of the channel name"
+// @Param        limit  query     int     false  "Maximum number of channels (default 20, at most 50)"
+// @Success      200    {array}   models.ChannelResponse
+// @Failure      400    {object}  models.ErrorResponse
+// @Failure      401    {object}  models.ErrorResponse
+// @Failure      500    {object}  models.ErrorResponse
+// @Router       /channels [get]
+func (h *ChannelHandler) SearchChannels(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	limit := 20
+	if limitParam := c.Query("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = min(parsed, maxChannelsPage)
+	}
+
+	filter := bson.M{}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		filter["name"] = bson.M{"$regex": regexp.QuoteMeta(q), "$options": "i"}
+	}
+
+	ctx := context.Background()
+	cursor, err := h.channelsCollection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "follower_count", Value: -1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(limit)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var channels []models.Channel
+	if err := cursor.All(ctx, &channels); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	following, err := h.followedAmong(ctx, userID, channels)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	responses := []models.ChannelResponse{}
+	for _, channel := range channels {
+		responses = append(responses, channelResponse(channel, userID, following[channel.ID]))
+	}
+	c.JSON(http.StatusOK, responses)
+}
+
+// GetFollowedChannels godoc
+// @Summary      List followed channels
+// @Description  Lists the channels the current user follows, most recently followed first
+// @Tags         channels
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}   models.ChannelResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /channels/following [get]
+func (h *ChannelHandler) GetFollowedChannels(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	cursor, err := h.followersCollection.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "followed_at", Value: -1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var follows []models.ChannelFollower
+	if err := cursor.All(ctx, &follows); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if len(follows) == 0 {
+		c.JSON(http.StatusOK, []models.ChannelResponse{})
+		return
+	}
+
+	channelIDs := make([]primitive.ObjectID, 0, len(follows))
+	for _, follow := range follows {
+		channelIDs = append(channelIDs, follow.ChannelID)
+	}
+	cursor, err = h.channelsCollection.Find(ctx, bson.M{"_id": bson.M{"$in": channelIDs}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var channels []models.Channel
+	if err := cursor.All(ctx, &channels); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	byID := make(map[primitive.ObjectID]models.Channel, len(channels))
+	for _, channel := range channels {
+		byID[channel.ID] = channel
+	}
+
+	responses := []models.ChannelResponse{}
+	for _, channelID := range channelIDs {
+		if channel, ok := byID[channelID]; ok {
+			responses = append(responses, channelResponse(channel, userID, true))
+		}
+	}
+	c.JSON(http.StatusOK, responses)
+}
+
+// GetChannel godoc
+// @Summary      Get a channel
+// @Description  Returns a channel and whether the current user follows it
+// @Tags         channels
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      string  true  "Channel ID"
+// @Success      200  {object}  models.ChannelResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /channels/{id} [get]
+func (h *ChannelHandler) GetChannel(c *gin.Context) {
+	channel, userID, ok := h.loadChannel(c)
+	if !ok {
+		return
+	}
+	following, err := h.isFollowing(context.Background(), channel.ID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, channelResponse(channel, userID, following))
+}
+
+// FollowChannel godoc
+// @Summary      Follow a channel
+// @Description  Makes the current user follow a channel, so that its posts are pushed to them. Following a followed channel again has no effect.
+// @Tags         channels
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      string  true  "Channel ID"
+// @Success      200  {object}  models.ChannelResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /channels/{id}/follow [put]
+func (h *ChannelHandler) FollowChannel(c *gin.Context) {
+	channel, userID, ok := h.loadChannel(c)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	result, err := h.followersCollection.UpdateOne(ctx,
+		bson.M{"channel_id": channel.ID, "user_id": userID},
+		bson.M{"$setOnInsert": bson.M{"followed_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to follow channel"})
+		return
+	}
+	if err == nil && result.UpsertedCount > 0 {
+		channel.FollowerCount++
+		if _, err := h.channelsCollection.UpdateOne(ctx, bson.M{"_id": channel.ID}, bson.M{"$inc": bson.M{"follower_count": 1}}); err != nil {
+			log.Printf("Failed to count follower of channel %s: %v", channel.ID.Hex(), err)
+		}
+		h.publishFollowUpdate(channel.ID, userID, true)
+	}
+
+	c.JSON(http.StatusOK, channelResponse(channel, userID, true))
+}
+
+// UnfollowChannel godoc
+// @Summary      Unfollow a channel
+// @Description  Stops the current user from following a channel. Admins can still post after unfollowing.
+// @Tags         channels
+// @Security     BearerAuth
+// @Param        id   path  string  true  "Channel ID"
+// @Success      204
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /channels/{id}/follow [delete]
+func (h *ChannelHandler) UnfollowChannel(c *gin.Context) {
+	channel, userID, ok := h.loadChannel(c)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	result, err := h.followersCollection.DeleteOne(ctx, bson.M{"channel_id": channel.ID, "user_id": userID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unfollow channel"})
+		return
+	}
+	if result.DeletedCount > 0 {
+		if _, err := h.channelsCollection.UpdateOne(ctx, bson.M{"_id": channel.ID}, bson.M{"$inc": bson.M{"follower_count": -1}}); err != nil {
+			log.Printf("Failed to uncount follower of channel %s: %v", channel.ID.Hex(), err)
+		}
+		h.publishFollowUpdate(channel.ID, userID, false)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// AddChannelAdmin godoc
+// @Summary      Add a channel admin
+// @Description  Lets another user post in a channel. Only the owner can add admins.
+// @Tags         channels
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id     path      string                      true  "Channel ID"
+// @Param        admin  body      models.ChannelAdminRequest  true  "New admin"
+// @Success      200    {object}  models.ChannelResponse
+// @Failure      400    {object}  models.ErrorResponse
+// @Failure      401    {object}  models.ErrorResponse
+// @Failure      403    {object}  models.ErrorResponse
+// @Failure      404    {object}  models.ErrorResponse
+// @Failure      500    {object}  models.ErrorResponse
+// @Router       /channels/{id}/admins [post]
+func (h *ChannelHandler) AddChannelAdmin(c *gin.Context) {
+	var input models.ChannelAdminRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	adminID, err := primitive.ObjectIDFromHex(input.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx := context.Background()
+	count, err := h.usersCollection.CountDocuments(ctx, bson.M{"_id": adminID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	h.updateAdmins(c, bson.M{"$addToSet": bson.M{"admin_ids": adminID}})
+}
+
+// RemoveChannelAdmin godoc
+// @Summary      Remove a channel admin
+// @Description  Stops a user from posting in a channel. Only the owner can remove admins, and the owner always stays one.
+// @Tags         channels
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id       path      string  true  "Channel ID"
+// @Param        user_id  path      string  true  "Admin to remove"
+// @Success      200      {object}  models.ChannelResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      401      {object}  models.ErrorResponse
+// @Failure      403      {object}  models.ErrorResponse
+// @Failure      404      {object}  models.ErrorResponse
+// @Failure      500      {object}  models.ErrorResponse
+// @Router       /channels/{id}/admins/{user_id} [delete]
+func (h *ChannelHandler) RemoveChannelAdmin(c *gin.Context) {
+	adminID, err := primitive.ObjectIDFromHex(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	h.updateAdmins(c, bson.M{"$pull": bson.M{"admin_ids": adminID}}, adminID)
+}
+
+// updateAdmins applies an update of the admins of the channel in the :id path
+// parameter on behalf of its owner and responds with the channel. removed are
+// the admins the update takes away, which cannot include the owner.
+func (h *ChannelHandler) updateAdmins(c *gin.Context, update bson.M, removed ...primitive.ObjectID) {
+	channel, userID, ok := h.loadChannel(c)
+	if !ok {
+		return
+	}
+	if channel.OwnerID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the channel owner can change admins"})
+		return
+	}
+	for _, id := range removed {
+		if id == channel.OwnerID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The owner is always an admin"})
+			return
+		}
+	}
+
+	ctx := context.Background()
+	update["$set"] = bson.M{"updated_at": time.Now()}
+	err := h.channelsCollection.FindOneAndUpdate(ctx, bson.M{"_id": channel.ID}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&channel)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update channel"})
+		return
+	}
+
+	following, err := h.isFollowing(ctx, channel.ID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, channelResponse(channel, userID, following))
+}
+
+// CreateChannelPost godoc
+// @Summary      Post in a channel
+// @Description  Posts a message to a channel. Only admins can post. Any message type except polls works; receiver_id, group_id and broadcast_id must be left out. The post is published once to the channel_post topic of the channel, and gateways push it to connected followers.
+// @Tags         channels
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path      string                 true  "Channel ID"
+// @Param        post  body      models.MessageRequest  true  "Post content"
+// @Success      201   {object}  models.MessageResponse
+// @Failure      400   {object}  models.ErrorResponse
+// @Failure      401   {object}  models.ErrorResponse
+// @Failure      403   {object}  models.ErrorResponse
+// @Failure      404   {object}  models.ErrorResponse
+// @Failure      500   {object}  models.ErrorResponse
+// @Router       /channels/{id}/posts [post]
+func (h *ChannelHandler) CreateChannelPost(c *gin.Context) {
+	var input models.MessageRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	channel, userID, ok := h.loadChannel(c)
+	if !ok {
+		return
+	}
+	if !channel.IsAdmin(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only channel admins can post"})
+		return
+	}
+	if input.ReceiverID != "" || input.GroupID != "" || input.BroadcastID != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Channel posts cannot have receiver_id, group_id or broadcast_id"})
+		return
+	}
+
+	post, err := h.messages.buildContent(userID, input, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Poll votes are tied to chat messages
+	if post.Type == models.MessageTypePoll {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Polls are not supported in channels"})
+		return
+	}
+	post.ChannelID = channel.ID
+
+	ctx := context.Background()
+	media := h.messages.media
+	if !post.MediaID.IsZero() {
+		if err := media.attachMedia(ctx, post.MediaID, 1); err != nil {
+			if errors.Is(err, errMediaNotFound) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save post"})
+			}
+			return
+		}
+	}
+	if _, err := h.postsCollection.InsertOne(ctx, post); err != nil {
+		if !post.MediaID.IsZero() {
+			media.detachMedia(ctx, map[primitive.ObjectID]int64{post.MediaID: 1})
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save post"})
+		return
+	}
+
+	response := h.messages.messageResponse(post)
+	event := models.ChannelPostEvent{
+		Type:      models.EventChannelPost,
+		ChannelID: channel.ID.Hex(),
+		Post:      response,
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+	if err := h.rabbitMQClient.PublishToExchange("messages", models.ChannelRoutingKey(channel.ID.Hex()), event); err != nil {
+		log.Printf("Failed to publish post %s of channel %s: %v", post.ID.Hex(), channel.ID.Hex(), err)
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetChannelPosts godoc
+// @Summary      List channel posts
+// @Description  Lists the posts of a channel, newest first, with their reaction counts and the caller's own reaction. Channels are public, so anyone can read them.
+// @Tags         channels
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id      path      string  true   "Channel ID"
+// @Param        limit   query     int     false  "Maximum number of posts (default 50, at most 100)"
+// @Param        before  query     string  false  "Only posts created before this RFC 3339 timestamp"
+// @Success      200     {array}   models.MessageResponse
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      401     {object}  models.ErrorResponse
+// @Failure      404     {object}  models.ErrorResponse
+// @Failure      500     {object}  models.ErrorResponse
+// @Router       /channels/{id}/posts [get]
+func (h *ChannelHandler) GetChannelPosts(c *gin.Context) {
+	channel, userID, ok := h.loadChannel(c)
+	if !ok {
+		return
+	}
+
+	filter := bson.M{"channel_id": channel.ID}
+	if beforeParam := c.Query("before"); beforeParam != "" {
+		before, err := time.Parse(time.RFC3339, beforeParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid before timestamp"})
+			return
+		}
+		filter["created_at"] = bson.M{"$lt": before}
+	}
+
+	limit := 50
+	if limitParam := c.Query("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = min(parsed, maxChannelPostsPage)
+	}
+
+	ctx := context.Background()
+	cursor, err := h.postsCollection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(int64(limit)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var posts []models.Message
+	if err := cursor.All(ctx, &posts); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	responses := []models.MessageResponse{}
+	for _, post := range posts {
+		responses = append(responses, h.messages.messageResponse(post))
+	}
+	h.markReactions(ctx, userID, responses)
+	c.JSON(http.StatusOK, responses)
+}
+
+// ReactToChannelPost godoc
+// @Summary      React to a channel post
+// @Description  Sets the current user's reaction to a post, replacing an earlier one. Only followers can react.
+// @Tags         channels
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id        path      string                  true  "Channel ID"
+// @Param        post_id   path      string                  true  "Post ID"
+// @Param        reaction  body      models.ReactionRequest  true  "Reaction"
+// @Success      200       {object}  models.MessageResponse
+// @Failure      400       {object}  models.ErrorResponse
+// @Failure      401       {object}  models.ErrorResponse
+// @Failure      403       {object}  models.ErrorResponse
+// @Failure      404       {object}  models.ErrorResponse
+// @Failure      500       {object}  models.ErrorResponse
+// @Router       /channels/{id}/posts/{post_id}/reaction [put]
+func (h *ChannelHandler) ReactToChannelPost(c *gin.Context) {
+	var input models.ReactionRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validReaction(input.Emoji) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reaction"})
+		return
+	}
+	post, userID, ok := h.loadReactablePost(c)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	var previous models.ChannelReaction
+	err := h.reactionsCollection.FindOneAndUpdate(ctx,
+		bson.M{"post_id": post.ID, "user_id": userID},
+		bson.M{"$set": bson.M{"emoji": input.Emoji, "reacted_at": time.Now()}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+	).Decode(&previous)
+	if err != nil && err != mongo.ErrNoDocuments {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save reaction"})
+		return
+	}
+
+	if previous.Emoji != input.Emoji {
+		inc := bson.M{"reaction_counts." + input.Emoji: 1}
+		if previous.Emoji != "" {
+			inc["reaction_counts."+previous.Emoji] = -1
+		}
+		h.countReactions(ctx, post.ID, inc, previous.Emoji)
+	}
+
+	h.respondWithPost(c, post.ID, userID)
+}
+
+// UnreactToChannelPost godoc
+// @Summary      Remove a reaction to a channel post
+// @Description  Removes the current user's reaction to a post
+// @Tags         channels
+// @Security     BearerAuth
+// @Param        id       path  string  true  "Channel ID"
+// @Param        post_id  path  string  true  "Post ID"
+// @Success      204
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /channels/{id}/posts/{post_id}/reaction [delete]
+func (h *ChannelHandler) UnreactToChannelPost(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	postID, err := primitive.ObjectIDFromHex(c.Param("post_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return
+	}
+
+	// Reactions are the user's own, so no follow check is needed to remove one
+	ctx := context.Background()
+	var previous models.ChannelReaction
+	err = h.reactionsCollection.FindOneAndDelete(ctx, bson.M{"post_id": postID, "user_id": userID}).Decode(&previous)
+	if err != nil && err != mongo.ErrNoDocuments {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove reaction"})
+		return
+	}
+	if err == nil {
+		h.countReactions(ctx, postID, bson.M{"reaction_counts." + previous.Emoji: -1}, previous.Emoji)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// validReaction reports whether emoji is a short emoji sequence that can be used as a field name
+func validReaction(emoji string) bool {
+	if emoji == "" || len(emoji) > maxReactionBytes || strings.ContainsAny(emoji, ".$") {
+		return false
+	}
+	hasEmoji := false
+	for _, r := range emoji {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return false
+		}
+		if r >= 0x80 {
+			hasEmoji = true
+		}
+	}
+	return hasEmoji
+}
+
+// countReactions applies inc to the reaction counts of a post and drops the
+// count of emptied, the reaction that was taken back, once it reaches zero
+func (h *ChannelHandler) countReactions(ctx context.Context, postID primitive.ObjectID, inc bson.M, emptied string) {
+	if _, err := h.postsCollection.UpdateOne(ctx, bson.M{"_id": postID}, bson.M{"$inc": inc}); err != nil {
+		log.Printf("Failed to count reactions to post %s: %v", postID.Hex(), err)
+		return
+	}
+	if emptied == "" {
+		return
+	}
+	field := "reaction_counts." + emptied
+	if _, err := h.postsCollection.UpdateOne(ctx,
+		bson.M{"_id": postID, field: bson.M{"$lte": 0}},
+		bson.M{"$unset": bson.M{field: ""}},
+	); err != nil {
+		log.Printf("Failed to clean up reactions to post %s: %v", postID.Hex(), err)
+	}
+}
+
+// respondWithPost responds with the current state of a post as seen by userID
+func (h *ChannelHandler) respondWithPost(c *gin.Context, postID, userID primitive.ObjectID) {
+	ctx := context.Background()
+	var post models.Message
+	if err := h.postsCollection.FindOne(ctx, bson.M{"_id": postID}).Decode(&post); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	responses := []models.MessageResponse{h.messages.messageResponse(post)}
+	h.markReactions(ctx, userID, responses)
+	c.JSON(http.StatusOK, responses[0])
+}
+
+// markReactions sets the caller's own reaction on posts
+func (h *ChannelHandler) markReactions(ctx context.Context, userID primitive.ObjectID, posts []models.MessageResponse) {
+	if len(posts) == 0 {
+		return
+	}
+
+	postIDs := make([]primitive.ObjectID, 0, len(posts))
+	for _, post := range posts {
+		if id, err := primitive.ObjectIDFromHex(post.ID); err == nil {
+			postIDs = append(postIDs, id)
+		}
+	}
+
+	cursor, err := h.reactionsCollection.Find(ctx, bson.M{"user_id": userID, "post_id": bson.M{"$in": postIDs}})
+	if err != nil {
+		log.Printf("Failed to look up reactions: %v", err)
+		return
+	}
+	var reactions []models.ChannelReaction
+	if err := cursor.All(ctx, &reactions); err != nil {
+		log.Printf("Failed to look up reactions: %v", err)
+		return
+	}
+
+	mine := make(map[string]string, len(reactions))
+	for _, reaction := range reactions {
+		mine[reaction.PostID.Hex()] = reaction.Emoji
+	}
+	for i := range posts {
+		posts[i].MyReaction = mine[posts[i].ID]
+	}
+}
+
+// loadChannel loads the channel in the :id path parameter, responding with an error if there is none
+func (h *ChannelHandler) loadChannel(c *gin.Context) (models.Channel, primitive.ObjectID, bool) {
+	var channel models.Channel
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return channel, userID, false
+	}
+	channelID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel ID"})
+		return channel, userID, false
+	}
+
+	err = h.channelsCollection.FindOne(context.Background(), bson.M{"_id": channelID}).Decode(&channel)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return channel, userID, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return channel, userID, false
+	}
+	return channel, userID, true
+}
+
+// loadReactablePost loads the post in the :post_id path parameter of the
+// channel in :id, responding with an error unless the caller follows the channel
+func (h *ChannelHandler) loadReactablePost(c *gin.Context) (models.Message, primitive.ObjectID, bool) {
+	var post models.Message
+
+	channel, userID, ok := h.loadChannel(c)
+	if !ok {
+		return post, userID, false
+	}
+	postID, err := primitive.ObjectIDFromHex(c.Param("post_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return post, userID, false
+	}
+
+	ctx := context.Background()
+	following, err := h.isFollowing(ctx, channel.ID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return post, userID, false
+	}
+	if !following {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Follow the channel to react to its posts"})
+		return post, userID, false
+	}
+
+	err = h.postsCollection.FindOne(ctx, bson.M{"_id": postID, "channel_id": channel.ID}).Decode(&post)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return post, userID, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return post, userID, false
+	}
+	return post, userID, true
+}
+
+func (h *ChannelHandler) isFollowing(ctx context.Context, channelID, userID primitive.ObjectID) (bool, error) {
+	count, err := h.followersCollection.CountDocuments(ctx, bson.M{"channel_id": channelID, "user_id": userID}, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+// followedAmong returns which of channels userID follows
+func (h *ChannelHandler) followedAmong(ctx context.Context, userID primitive.ObjectID, channels []models.Channel) (map[primitive.ObjectID]bool, error) {
+	following := make(map[primitive.ObjectID]bool)
+	if len(channels) == 0 {
+		return following, nil
+	}
+
+	channelIDs := make([]primitive.ObjectID, 0, len(channels))
+	for _, channel := range channels {
+		channelIDs = append(channelIDs, channel.ID)
+	}
+	cursor, err := h.followersCollection.Find(ctx, bson.M{"user_id": userID, "channel_id": bson.M{"$in": channelIDs}})
+	if err != nil {
+		return nil, err
+	}
+	var follows []models.ChannelFollower
+	if err := cursor.All(ctx, &follows); err != nil {
+		return nil, err
+	}
+	for _, follow := range follows {
+		following[follow.ChannelID] = true
+	}
+	return following, nil
+}
+
+// publishFollowUpdate tells the gateways that userID followed or unfollowed a
+// channel, so that the one holding their socket can subscribe to its posts
+func (h *ChannelHandler) publishFollowUpdate(channelID, userID primitive.ObjectID, following bool) {
+	update := models.ChannelFollowUpdate{
+		ChannelID: channelID.Hex(),
+		UserID:    userID.Hex(),
+		Following: following,
+	}
+	if err := h.rabbitMQClient.PublishToExchange("messages", models.ChannelFollowsRoutingKey(userID.Hex()), update); err != nil {
+		log.Printf("Failed to publish %s following channel %s: %v", userID.Hex(), channelID.Hex(), err)
+	}
+}
+
+func channelResponse(channel models.Channel, userID primitive.ObjectID, following bool) models.ChannelResponse {
+	return models.ChannelResponse{
+		ID:            channel.ID.Hex(),
+		Name:          channel.Name,
+		Description:   channel.Description,
+		OwnerID:       channel.OwnerID.Hex(),
+		AdminIDs:      objectIDHexes(channel.AdminIDs),
+		FollowerCount: max(channel.FollowerCount, 0),
+		Following:     following,
+		IsAdmin:       channel.IsAdmin(userID),
+		CreatedAt:     channel.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// loadChatMessage loads the message in the :id path parameter for the current
+// user, responding with an error unless the user takes part in its chat
+func (h *MessageHandler) loadChatMessage(c *gin.Context) (models.Message, primitive.ObjectID, bool) {
+	var msg models.Message
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return msg, userID, false
+	}
+
+	messageID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return msg, userID, false
+	}
+
+	ctx := context.Background()
+	if err := h.messagesCollection.FindOne(ctx, bson.M{"_id": messageID}).Decode(&msg); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return msg, userID, false
+	}
+
+	participant, err := h.isParticipant(ctx, msg, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return msg, userID, false
+	}
+	if !participant {
+		// Same answer as for unknown IDs, so that IDs cannot be probed
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return msg, userID, false
+	}
+
+	return msg, userID, true
+}
+
+// isParticipant reports whether userID takes part in the chat msg belongs to
+func (h *MessageHandler) isParticipant(ctx context.Context, msg models.Message, userID primitive.ObjectID) (bool, error) {
+	if !msg.GroupID.IsZero() {
+		count, err := h.groupsCollection.CountDocuments(ctx, bson.M{"_id": msg.GroupID, "member_ids": userID})
+		return count > 0, err
+	}
+	return msg.SenderID == userID || msg.ReceiverID == userID, nil
+}
+
+// checkGroupMember responds with 404 unless userID is a member of the group,
+// so that non-members cannot tell groups from unknown IDs
+func (h *MessageHandler) checkGroupMember(c *gin.Context, groupID, userID primitive.ObjectID) bool {
+	member, err := h.isParticipant(context.Background(), models.Message{GroupID: groupID}, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if !member {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return false
+	}
+	return true
+}
+
+// chatParticipants returns the IDs of everyone in the chat msg belongs to
+func (h *MessageHandler) chatParticipants(msg models.Message) ([]string, error) {
+	if !msg.GroupID.IsZero() {
+		members, err := h.fetchGroupMembers(msg.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, 0, len(members))
+		for _, member := range members {
+			ids = append(ids, member.Hex())
+		}
+		return ids, nil
+	}
+	return []string{msg.SenderID.Hex(), msg.ReceiverID.Hex()}, nil
+}
+
+// loadChat resolves chatIDHex, a group or the other user of a direct chat, for the
+// current user. It returns a message that stands in for the chat in helpers such
+// as chatParticipants, and responds with an error unless the user takes part in the chat.
+func (h *MessageHandler) loadChat(c *gin.Context, chatIDHex string) (models.Message, primitive.ObjectID, bool) {
+	var chat models.Message
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return chat, userID, false
+	}
+
+	chatID, err := primitive.ObjectIDFromHex(chatIDHex)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		return chat, userID, false
+	}
+
+	ctx := context.Background()
+	groups, err := h.groupsCollection.CountDocuments(ctx, bson.M{"_id": chatID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return chat, userID, false
+	}
+
+	if groups > 0 {
+		chat = models.Message{GroupID: chatID}
+		participant, err := h.isParticipant(ctx, chat, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return chat, userID, false
+		}
+		if !participant {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
+			return chat, userID, false
+		}
+		return chat, userID, true
+	}
+
+	users, err := h.usersCollection.CountDocuments(ctx, bson.M{"_id": chatID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return chat, userID, false
+	}
+	if users == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
+		return chat, userID, false
+	}
+	return models.Message{SenderID: userID, ReceiverID: chatID}, userID, true
+}
+
+// chatKey identifies the chat msg belongs to: its group, or the two users of a direct chat
+func chatKey(msg models.Message) string {
+	if !msg.GroupID.IsZero() {
+		return msg.GroupID.Hex()
+	}
+	a, b := msg.SenderID.Hex(), msg.ReceiverID.Hex()
+	if b < a {
+		a, b = b, a
+	}
+	return a + ":" + b
+}
+
+// postSystemMessage adds a system message about something actorID did to the chat
+// msg belongs to and delivers it like any other message
+func (h *MessageHandler) postSystemMessage(msg models.Message, actorID primitive.ObjectID, system models.SystemMessage) {
+	message := models.Message{
+		ID:        primitive.NewObjectID(),
+		SenderID:  actorID,
+		GroupID:   msg.GroupID,
+		Type:      models.MessageTypeSystem,
+		System:    &system,
+		CreatedAt: time.Now(),
+		Status:    models.MessageStatusSent,
+	}
+	if msg.GroupID.IsZero() {
+		message.ReceiverID = msg.ReceiverID
+		if msg.ReceiverID == actorID {
+			message.ReceiverID = msg.SenderID
+		}
+	}
+
+	if _, err := h.messagesCollection.InsertOne(context.Background(), message); err != nil {
+		log.Printf("Failed to save %s system message: %v", system.Action, err)
+		return
+	}
+
+	response := h.messageResponse(message)
+	if !message.GroupID.IsZero() {
+		h.fanOutGroupMessage(response)
+	} else if err := h.rabbitMQClient.PublishToExchange("messages", fmt.Sprintf("message.%s", message.ReceiverID.Hex()), response); err != nil {
+		log.Printf("Failed to publish %s system message: %v", system.Action, err)
+	}
+}
+
+// publishChatEvent sends an event to everyone in the chat msg belongs to
+func (h *MessageHandler) publishChatEvent(msg models.Message, eventType string, data interface{}) {
+	recipientIDs, err := h.chatParticipants(msg)
+	if err != nil {
+		log.Printf("Failed to look up participants of chat %s: %v", chatKey(msg), err)
+		return
+	}
+
+	event := models.NewEvent(eventType, recipientIDs, data)
+	if err := h.rabbitMQClient.PublishToExchange("messages", models.EventRoutingKey(event.Type), event); err != nil {
+		log.Printf("Failed to publish %s event for chat %s: %v", eventType, chatKey(msg), err)
+	}
+}
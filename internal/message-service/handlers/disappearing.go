@@ -0,0 +1,469 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// expiredBatchSize is the most expired messages the reaper deletes at once
+	expiredBatchSize = 500
+	// reapLease is how long a reaper holds the messages it claimed before
+	// another replica may take them over
+	reapLease = 2 * time.Minute
+)
+
+// EnsureDisappearingIndexes creates the index the message reaper uses to find expired messages
+func (h *MessageHandler) EnsureDisappearingIndexes(ctx context.Context) error {
+	_, err := h.messagesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetPartialFilterExpression(bson.M{"expires_at": bson.M{"$exists": true}}),
+	})
+	return err
+}
+
+// unexpired matches messages without an expiry and those that have not
+// expired yet. The reaper runs periodically, so expired messages can linger.
+func unexpired() bson.M {
+	return bson.M{"$not": bson.M{"$lte": time.Now()}}
+}
+
+// GetChatSettings godoc
+// @Summary      Get chat settings
+// @Description  Returns the settings of a group or direct chat, such as its disappearing messages timer
+// @Tags         chats
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      string  true  "Group ID, or the ID of the other user of a direct chat"
+// @Success      200  {object}  models.ChatSettingsResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /chats/{id}/settings [get]
+func (h *MessageHandler) GetChatSettings(c *gin.Context) {
+	chat, _, ok := h.loadChat(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	settings, err := h.chatSettings(context.Background(), chat)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, chatSettingsResponse(chat, settings))
+}
+
+// SetDisappearingTimer godoc
+// @Summary      Set the disappearing messages timer
+// @Description  Makes messages sent to a chat from now on disappear after 24h, 7d or 90d, or turns disappearing messages off. Anyone in a direct chat can change it; in groups only admins can. Participants get a system message and a chat_settings_updated event.
+// @Tags         chats
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id     path      string                           true  "Group ID, or the ID of the other user of a direct chat"
+// @Param        timer  body      models.DisappearingTimerRequest  true  "New timer"
+// @Success      200    {object}  models.ChatSettingsResponse
+// @Failure      400    {object}  models.ErrorResponse
+// @Failure      401    {object}  models.ErrorResponse
+// @Failure      403    {object}  models.ErrorResponse
+// @Failure      404    {object}  models.ErrorResponse
+// @Failure      500    {object}  models.ErrorResponse
+// @Router       /chats/{id}/disappearing [put]
+func (h *MessageHandler) SetDisappearingTimer(c *gin.Context) {
+	var input models.DisappearingTimerRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := models.DisappearingTimers[input.Timer]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown timer %q; use off, 24h, 7d or 90d", input.Timer)})
+		return
+	}
+
+	chat, userID, ok := h.loadChat(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	if !chat.GroupID.IsZero() {
+		var group models.Group
+		if err := h.groupsCollection.FindOne(ctx, bson.M{"_id": chat.GroupID}).Decode(&group); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !group.IsAdmin(userID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only group admins can change disappearing messages"})
+			return
+		}
+	}
+
+	previous, err := h.chatSettings(ctx, chat)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	settings := models.ChatSettings{
+		ID:                chatKey(chat),
+		GroupID:           chat.GroupID,
+		DisappearingTimer: input.Timer,
+		UpdatedBy:         userID,
+		UpdatedAt:         time.Now(),
+	}
+	if chat.GroupID.IsZero() {
+		settings.UserIDs = []primitive.ObjectID{chat.SenderID, chat.ReceiverID}
+	}
+	// The pin counter of the chat lives in the same document and has to stay
+	update := bson.M{
+		"$set": bson.M{
+			"disappearing_timer": settings.DisappearingTimer,
+			"updated_by":         settings.UpdatedBy,
+			"updated_at":         settings.UpdatedAt,
+		},
+		"$setOnInsert": chatSettingsDefaults(chat, "disappearing_timer"),
+	}
+	if _, err := h.chatSettingsCollection.UpdateOne(ctx, bson.M{"_id": settings.ID}, update, options.Update().SetUpsert(true)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update chat settings"})
+		return
+	}
+
+	response := chatSettingsResponse(chat, settings)
+	if previous.DisappearingTimer != settings.DisappearingTimer {
+		go func() {
+			h.postSystemMessage(chat, userID, models.SystemMessage{Action: models.SystemActionDisappearingTimer, Timer: settings.DisappearingTimer})
+			h.publishChatEvent(chat, models.EventChatSettingsUpdated, response)
+		}()
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// chatSettings returns the settings of the chat msg belongs to, or the defaults if there are none
+func (h *MessageHandler) chatSettings(ctx context.Context, msg models.Message) (models.ChatSettings, error) {
+	var settings models.ChatSettings
+	err := h.chatSettingsCollection.FindOne(ctx, bson.M{"_id": chatKey(msg)}).Decode(&settings)
+	if err == mongo.ErrNoDocuments {
+		return models.ChatSettings{ID: chatKey(msg), DisappearingTimer: models.DisappearingTimerOff}, nil
+	}
+	return settings, err
+}
+
+// chatSettingsDefaults returns the fields a new settings document of the chat
+// msg belongs to starts with, leaving out the fields an upsert sets itself
+func chatSettingsDefaults(msg models.Message, except ...string) bson.M {
+	defaults := bson.M{
+		"disappearing_timer": models.DisappearingTimerOff,
+		"pinned_count":       0,
+	}
+	if !msg.GroupID.IsZero() {
+		defaults["group_id"] = msg.GroupID
+	} else {
+		defaults["user_ids"] = []primitive.ObjectID{msg.SenderID, msg.ReceiverID}
+	}
+	for _, field := range except {
+		delete(defaults, field)
+	}
+	return defaults
+}
+
+func chatSettingsResponse(chat models.Message, settings models.ChatSettings) models.ChatSettingsResponse {
+	response := models.ChatSettingsResponse{
+		DisappearingTimer: settings.DisappearingTimer,
+		UpdatedBy:         optionalIDHex(settings.UpdatedBy),
+	}
+	if !settings.UpdatedAt.IsZero() {
+		response.UpdatedAt = settings.UpdatedAt.Format(time.RFC3339)
+	}
+	if !chat.GroupID.IsZero() {
+		response.GroupID = chat.GroupID.Hex()
+	} else {
+		response.UserIDs = []string{chat.SenderID.Hex(), chat.ReceiverID.Hex()}
+	}
+	return response
+}
+
+// stampExpiry sets when msg disappears if its chat has disappearing messages on
+func (h *MessageHandler) stampExpiry(ctx context.Context, msg *models.Message) {
+	settings, err := h.chatSettings(ctx, *msg)
+	if err != nil {
+		log.Printf("Failed to look up settings of chat %s: %v", chatKey(*msg), err)
+		return
+	}
+	if ttl := models.DisappearingTimers[settings.DisappearingTimer]; ttl > 0 {
+		expiresAt := msg.CreatedAt.Add(ttl)
+		msg.ExpiresAt = &expiresAt
+	}
+}
+
+// stampExpiries is stampExpiry for many messages, looking up the settings of their chats at once
+func (h *MessageHandler) stampExpiries(ctx context.Context, messages []models.Message) {
+	keys := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		keys = append(keys, chatKey(msg))
+	}
+
+	cursor, err := h.chatSettingsCollection.Find(ctx, bson.M{"_id": bson.M{"$in": keys}})
+	if err != nil {
+		log.Printf("Failed to look up chat settings: %v", err)
+		return
+	}
+	var settings []models.ChatSettings
+	if err := cursor.All(ctx, &settings); err != nil {
+		log.Printf("Failed to look up chat settings: %v", err)
+		return
+	}
+
+	timers := make(map[string]string, len(settings))
+	for _, s := range settings {
+		timers[s.ID] = s.DisappearingTimer
+	}
+	for i := range messages {
+		if ttl := models.DisappearingTimers[timers[chatKey(messages[i])]]; ttl > 0 {
+			expiresAt := messages[i].CreatedAt.Add(ttl)
+			messages[i].ExpiresAt = &expiresAt
+		}
+	}
+}
+
+// StartMessageReaper deletes expired disappearing messages every interval.
+// Several replicas may run it: each claims the messages it deletes with a lease.
+func (h *MessageHandler) StartMessageReaper(interval time.Duration) {
+	owner := primitive.NewObjectID().Hex()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			h.reapExpiredMessages(owner)
+		}
+	}()
+}
+
+// reapExpiredMessages deletes expired messages along with their stars, votes,
+// pins and media no other message uses, and tells the participants of each chat. Thread
+// roots take their replies with them; threads that only lose replies are
+// updated to the replies left.
+func (h *MessageHandler) reapExpiredMessages(owner string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	total := 0
+	for {
+		expired, messages, err := h.claimExpiredMessages(ctx, owner)
+		if err != nil {
+			log.Printf("Failed to claim expired messages: %v", err)
+			return
+		}
+		if expired == 0 {
+			break
+		}
+		if len(messages) == 0 {
+			// Another replica holds the lease on everything left
+			break
+		}
+
+		messageIDs := make([]primitive.ObjectID, 0, len(messages))
+		for _, msg := range messages {
+			messageIDs = append(messageIDs, msg.ID)
+		}
+		if _, err := h.messagesCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": messageIDs}, "reap_owner": owner}); err != nil {
+			log.Printf("Failed to delete expired messages: %v", err)
+			return
+		}
+		total += len(messages)
+
+		if _, err := h.starsCollection.DeleteMany(ctx, bson.M{"message_id": bson.M{"$in": messageIDs}}); err != nil {
+			log.Printf("Failed to delete stars of expired messages: %v", err)
+		}
+		if _, err := h.pollVotesCollection.DeleteMany(ctx, bson.M{"message_id": bson.M{"$in": messageIDs}}); err != nil {
+			log.Printf("Failed to delete votes of expired messages: %v", err)
+		}
+
+		// Forwarded media may still be used by other messages
+		h.media.detachMedia(ctx, messageMediaRefs(messages))
+		h.removeThreadReplies(ctx, messages)
+		releasePins(ctx, h.chatSettingsCollection, pinnedPerChat(messages))
+
+		chats := make(map[string][]models.Message)
+		for _, msg := range messages {
+			chats[chatKey(msg)] = append(chats[chatKey(msg)], msg)
+		}
+		for _, expired := range chats {
+			event := models.MessagesExpired{}
+			if chat := expired[0]; !chat.GroupID.IsZero() {
+				event.GroupID = chat.GroupID.Hex()
+			} else {
+				event.UserIDs = []string{chat.SenderID.Hex(), chat.ReceiverID.Hex()}
+			}
+			for _, msg := range expired {
+				event.MessageIDs = append(event.MessageIDs, msg.ID.Hex())
+			}
+			h.publishChatEvent(expired[0], models.EventMessagesExpired, event)
+		}
+
+		if expired < expiredBatchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Printf("Deleted %d expired messages", total)
+	}
+}
+
+// claimExpiredMessages leases a batch of expired messages to owner, together
+// with the replies of the thread roots among them, and returns how many
+// expired messages it found and the messages it claimed. A lease left by a
+// replica that died lapses after reapLease.
+func (h *MessageHandler) claimExpiredMessages(ctx context.Context, owner string) (int, []models.Message, error) {
+	now := time.Now()
+	claimable := bson.M{"$not": bson.M{"$gt": now}}
+	cursor, err := h.messagesCollection.Find(ctx,
+		bson.M{"expires_at": bson.M{"$lte": now}, "reap_lease_until": claimable},
+		options.Find().SetProjection(bson.M{"_id": 1}).SetLimit(expiredBatchSize),
+	)
+	if err != nil {
+		return 0, nil, err
+	}
+	var expired []models.Message
+	if err := cursor.All(ctx, &expired); err != nil {
+		return 0, nil, err
+	}
+	if len(expired) == 0 {
+		return 0, nil, nil
+	}
+	expiredIDs := make([]primitive.ObjectID, 0, len(expired))
+	for _, msg := range expired {
+		expiredIDs = append(expiredIDs, msg.ID)
+	}
+
+	lease := bson.M{"$set": bson.M{"reap_owner": owner, "reap_lease_until": now.Add(reapLease)}}
+	if _, err := h.messagesCollection.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": expiredIDs}, "reap_lease_until": claimable}, lease); err != nil {
+		return 0, nil, err
+	}
+	claimed, err := h.leasedMessages(ctx, owner, bson.M{"_id": bson.M{"$in": expiredIDs}})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Replies go with their root, whether or not they expired themselves
+	var rootIDs []primitive.ObjectID
+	for _, msg := range claimed {
+		if msg.ThreadReplyCount > 0 {
+			rootIDs = append(rootIDs, msg.ID)
+		}
+	}
+	if len(rootIDs) > 0 {
+		if _, err := h.messagesCollection.UpdateMany(ctx,
+			bson.M{"thread_root_id": bson.M{"$in": rootIDs}, "_id": bson.M{"$nin": expiredIDs}, "reap_lease_until": claimable}, lease); err != nil {
+			return 0, nil, err
+		}
+		claimedReplies, err := h.leasedMessages(ctx, owner, bson.M{"thread_root_id": bson.M{"$in": rootIDs}, "_id": bson.M{"$nin": expiredIDs}})
+		if err != nil {
+			return 0, nil, err
+		}
+		claimed = append(claimed, claimedReplies...)
+	}
+	return len(expired), claimed, nil
+}
+
+// leasedMessages returns the messages matching filter that owner holds a lease on
+func (h *MessageHandler) leasedMessages(ctx context.Context, owner string, filter bson.M) ([]models.Message, error) {
+	filter["reap_owner"] = owner
+	filter["reap_lease_until"] = bson.M{"$gt": time.Now()}
+	cursor, err := h.messagesCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{
+		"_id": 1, "sender_id": 1, "receiver_id": 1, "group_id": 1, "media_id": 1,
+		"thread_root_id": 1, "thread_reply_count": 1, "created_at": 1, "pinned_at": 1, "deleted_at": 1,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	var messages []models.Message
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// removeThreadReplies takes deleted replies off the threads they belong to,
+// unless the root was deleted with them, and tells the group about each
+// thread's new state
+func (h *MessageHandler) removeThreadReplies(ctx context.Context, deleted []models.Message) {
+	deletedIDs := make(map[primitive.ObjectID]bool, len(deleted))
+	for _, msg := range deleted {
+		deletedIDs[msg.ID] = true
+	}
+	type removal struct {
+		count  int64
+		latest time.Time
+	}
+	removals := make(map[primitive.ObjectID]*removal)
+	for _, msg := range deleted {
+		if msg.ThreadRootID.IsZero() || deletedIDs[msg.ThreadRootID] {
+			continue
+		}
+		r := removals[msg.ThreadRootID]
+		if r == nil {
+			r = &removal{}
+			removals[msg.ThreadRootID] = r
+		}
+		r.count++
+		if msg.CreatedAt.After(r.latest) {
+			r.latest = msg.CreatedAt
+		}
+	}
+
+	for rootID, r := range removals {
+		if _, err := h.messagesCollection.UpdateOne(ctx, bson.M{"_id": rootID}, bson.M{"$inc": bson.M{"thread_reply_count": -r.count}}); err != nil {
+			log.Printf("Failed to update reply count of thread %s: %v", rootID.Hex(), err)
+			continue
+		}
+
+		// The last reply time only moves back if no newer reply came in meanwhile
+		var last models.Message
+		err := h.messagesCollection.FindOne(ctx,
+			bson.M{"thread_root_id": rootID, "expires_at": unexpired()},
+			options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetProjection(bson.M{"created_at": 1}),
+		).Decode(&last)
+		update := bson.M{"$set": bson.M{"thread_last_reply_at": last.CreatedAt}}
+		if err == mongo.ErrNoDocuments {
+			update = bson.M{"$unset": bson.M{"thread_last_reply_at": ""}}
+		} else if err != nil {
+			log.Printf("Failed to look up last reply of thread %s: %v", rootID.Hex(), err)
+			continue
+		}
+		if _, err := h.messagesCollection.UpdateOne(ctx,
+			bson.M{"_id": rootID, "thread_last_reply_at": bson.M{"$lte": r.latest}}, update); err != nil {
+			log.Printf("Failed to update last reply of thread %s: %v", rootID.Hex(), err)
+			continue
+		}
+
+		var root models.Message
+		if err := h.messagesCollection.FindOne(ctx, bson.M{"_id": rootID}).Decode(&root); err != nil {
+			if err != mongo.ErrNoDocuments {
+				log.Printf("Failed to look up thread %s: %v", rootID.Hex(), err)
+			}
+			continue
+		}
+		h.publishChatEvent(root, models.EventThreadUpdated, models.ThreadUpdate{
+			RootID:      root.ID.Hex(),
+			GroupID:     root.GroupID.Hex(),
+			ReplyCount:  root.ThreadReplyCount,
+			LastReplyAt: formatOptionalTime(root.ThreadLastReplyAt),
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureDraftIndexes creates the index that keeps one draft per user and chat
+func (h *MessageHandler) EnsureDraftIndexes(ctx context.Context) error {
+	_, err := h.draftsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "chat_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// GetDrafts godoc
+// @Summary      Get drafts
+// @Description  Returns your drafts in all chats, most recently edited first, so that a new device can pick them up
+// @Tags         chats
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}   models.DraftResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /drafts [get]
+func (h *MessageHandler) GetDrafts(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}})
+	cursor, err := h.draftsCollection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var drafts []models.Draft
+	if err := cursor.All(ctx, &drafts); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	responses := make([]models.DraftResponse, 0, len(drafts))
+	for _, draft := range drafts {
+		responses = append(responses, draftResponse(draft))
+	}
+	c.JSON(http.StatusOK, responses)
+}
+
+// SaveDraft godoc
+// @Summary      Save a draft
+// @Description  Saves the unsent text of a chat, replacing the previous draft; empty text clears it. Your other devices get a draft_updated event. Sending a message to the chat clears its draft. Send updated_at, the time of the edit on your device, so that an older edit arriving late is refused with 409 and the newer draft instead of overwriting it.
+// @Tags         chats
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id     path      string               true  "Group ID, or the ID of the other user of a direct chat"
+// @Param        draft  body      models.DraftRequest  true  "Draft text"
+// @Success      200    {object}  models.DraftResponse
+// @Failure      400    {object}  models.ErrorResponse
+// @Failure      401    {object}  models.ErrorResponse
+// @Failure      404    {object}  models.ErrorResponse
+// @Failure      409    {object}  models.DraftResponse
+// @Failure      500    {object}  models.ErrorResponse
+// @Router       /chats/{id}/draft [put]
+func (h *MessageHandler) SaveDraft(c *gin.Context) {
+	var input models.DraftRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	chat, userID, ok := h.loadChat(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	draft := newDraft(userID, chat)
+	if input.UpdatedAt != "" {
+		editedAt, err := time.Parse(time.RFC3339Nano, input.UpdatedAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "updated_at must be an RFC 3339 timestamp"})
+			return
+		}
+		// A device whose clock runs ahead must not lock out the others
+		if editedAt.Before(draft.UpdatedAt) {
+			draft.UpdatedAt = editedAt.Truncate(time.Millisecond)
+		}
+	}
+
+	ctx := context.Background()
+	if strings.TrimSpace(input.Text) == "" {
+		cleared, err := h.deleteDraft(ctx, draft)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !cleared && h.respondNewerDraft(c, ctx, draft) {
+			return
+		}
+		c.JSON(http.StatusOK, draftResponse(draft))
+		return
+	}
+
+	// Only an edit at least as recent as the stored one replaces it. An older
+	// one misses the filter and its upsert collides with the unique index.
+	draft.Text = input.Text
+	update := bson.M{
+		"$set": bson.M{
+			"group":      draft.Group,
+			"text":       draft.Text,
+			"updated_at": draft.UpdatedAt,
+		},
+		"$setOnInsert": bson.M{"_id": primitive.NewObjectID()},
+	}
+	filter := bson.M{"user_id": userID, "chat_id": draft.ChatID, "updated_at": bson.M{"$lte": draft.UpdatedAt}}
+	if _, err := h.draftsCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		if mongo.IsDuplicateKeyError(err) && h.respondNewerDraft(c, ctx, draft) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	response := draftResponse(draft)
+	h.publishDraftEvent(userID, response)
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteDraft godoc
+// @Summary      Clear a draft
+// @Description  Clears your draft in a chat. Your other devices get a draft_updated event with empty text.
+// @Tags         chats
+// @Security     BearerAuth
+// @Param        id   path  string  true  "Group ID, or the ID of the other user of a direct chat"
+// @Success      204
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /chats/{id}/draft [delete]
+func (h *MessageHandler) DeleteDraft(c *gin.Context) {
+	chat, userID, ok := h.loadChat(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if _, err := h.deleteDraft(context.Background(), newDraft(userID, chat)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// clearSentDraft clears the sender's draft in the chat a message was just
+// sent to, unless the sender started a new one after sending
+func (h *MessageHandler) clearSentDraft(msg models.Message) {
+	draft := newDraft(msg.SenderID, msg)
+	draft.UpdatedAt = msg.CreatedAt
+	if _, err := h.deleteDraft(context.Background(), draft); err != nil {
+		log.Printf("Failed to clear draft of %s after sending message %s: %v", msg.SenderID.Hex(), msg.ID.Hex(), err)
+	}
+}
+
+// deleteDraft removes a draft edited no later than draft.UpdatedAt and, if
+// there was one, tells the user's devices
+func (h *MessageHandler) deleteDraft(ctx context.Context, draft models.Draft) (bool, error) {
+	result, err := h.draftsCollection.DeleteOne(ctx, bson.M{
+		"user_id":    draft.UserID,
+		"chat_id":    draft.ChatID,
+		"updated_at": bson.M{"$lte": draft.UpdatedAt},
+	})
+	if err != nil {
+		return false, err
+	}
+	if result.DeletedCount == 0 {
+		return false, nil
+	}
+	h.publishDraftEvent(draft.UserID, draftResponse(draft))
+	return true, nil
+}
+
+// respondNewerDraft responds with 409 and the stored draft if it was edited
+// after draft. It reports whether it responded.
+func (h *MessageHandler) respondNewerDraft(c *gin.Context, ctx context.Context, draft models.Draft) bool {
+	var newer models.Draft
+	err := h.draftsCollection.FindOne(ctx, bson.M{
+		"user_id":    draft.UserID,
+		"chat_id":    draft.ChatID,
+		"updated_at": bson.M{"$gt": draft.UpdatedAt},
+	}).Decode(&newer)
+	if err != nil {
+		return false
+	}
+	c.JSON(http.StatusConflict, draftResponse(newer))
+	return true
+}
+
+// publishDraftEvent sends a draft_updated event to the owner of the draft
+func (h *MessageHandler) publishDraftEvent(userID primitive.ObjectID, draft models.DraftResponse) {
+	event := models.NewEvent(models.EventDraftUpdated, []string{userID.Hex()}, draft)
+	if err := h.rabbitMQClient.PublishToExchange("messages", models.EventRoutingKey(event.Type), event); err != nil {
+		log.Printf("Failed to publish %s event: %v", event.Type, err)
+	}
+}
+
+// newDraft returns an empty draft of userID in the chat msg belongs to, as
+// resolved by loadChat or addressed by a message userID sent
+func newDraft(userID primitive.ObjectID, msg models.Message) models.Draft {
+	draft := models.Draft{UserID: userID, UpdatedAt: time.Now().Truncate(time.Millisecond)}
+	switch {
+	case !msg.GroupID.IsZero():
+		draft.ChatID = msg.GroupID
+		draft.Group = true
+	case msg.ReceiverID == userID:
+		draft.ChatID = msg.SenderID
+	default:
+		draft.ChatID = msg.ReceiverID
+	}
+	return draft
+}
+
+// draftResponse converts a draft into its API representation
+func draftResponse(draft models.Draft) models.DraftResponse {
+	return models.DraftResponse{
+		ChatID:    draft.ChatID.Hex(),
+		Group:     draft.Group,
+		Text:      draft.Text,
+		UpdatedAt: draft.UpdatedAt.Format(time.RFC3339Nano),
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"whatsapp/internal/message-service/linkpreview"
+	"whatsapp/pkg/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// linkPreviewTimeout bounds the cache lookup, fetch and update of one preview
+const linkPreviewTimeout = 15 * time.Second
+
+// attachLinkPreview adds a preview of the first link in a text message and
+// sends the updated message to everyone in its chat
+func (h *MessageHandler) attachLinkPreview(msg models.Message) {
+	if h.previews == nil || msg.Type != models.MessageTypeText {
+		return
+	}
+	rawURL := linkpreview.FirstURL(msg.Content)
+	if rawURL == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), linkPreviewTimeout)
+	defer cancel()
+
+	preview, err := h.previews.Preview(ctx, rawURL)
+	if err != nil {
+		log.Printf("No link preview for message %s: %v", msg.ID.Hex(), err)
+		return
+	}
+	if preview == nil {
+		return
+	}
+
+	// The message may have been deleted in the meantime
+	result, err := h.messagesCollection.UpdateOne(ctx,
+		bson.M{"_id": msg.ID, "deleted_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"link_preview": preview}},
+	)
+	if err != nil {
+		log.Printf("Failed to attach link preview to message %s: %v", msg.ID.Hex(), err)
+		return
+	}
+	if result.MatchedCount == 0 {
+		return
+	}
+
+	recipientIDs, err := h.chatParticipants(msg)
+	if err != nil {
+		log.Printf("Failed to look up participants of message %s: %v", msg.ID.Hex(), err)
+		return
+	}
+
+	msg.LinkPreview = preview
+	event := models.NewEvent(models.EventMessageUpdated, recipientIDs, h.messageResponse(msg))
+	if err := h.rabbitMQClient.PublishToExchange("messages", models.EventRoutingKey(event.Type), event); err != nil {
+		log.Printf("Failed to publish link preview of message %s: %v", msg.ID.Hex(), err)
+	}
+}
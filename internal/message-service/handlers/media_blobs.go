@@ -0,0 +1,473 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"whatsapp/pkg/models"
+	"whatsapp/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// unusedMediaTTL is how long uploaded media may stay unattached to any
+	// message before it is deleted
+	unusedMediaTTL = 24 * time.Hour
+	// blobDeletionTimeout is after how long an interrupted blob deletion is resumed
+	blobDeletionTimeout = 10 * time.Minute
+)
+
+// storeBlob takes a reference on the blob holding the content of media,
+// writing content and thumbnails to storage unless an earlier upload of the
+// same file already did
+func (h *MediaHandler) storeBlob(ctx context.Context, media models.Media, content io.ReadSeeker, thumbnails []imageThumbnail) error {
+	keys := []string{media.StorageKey}
+	for _, thumbnail := range media.Thumbnails {
+		keys = append(keys, thumbnail.StorageKey)
+	}
+
+	var blob models.MediaBlob
+	for attempt := 0; ; attempt++ {
+		err := h.blobsCollection.FindOneAndUpdate(ctx,
+			bson.M{"_id": media.SHA256, "deleting": bson.M{"$ne": true}},
+			bson.M{
+				"$inc": bson.M{"ref_count": 1},
+				"$setOnInsert": bson.M{
+					"size":       media.Size,
+					"mime_type":  media.MimeType,
+					"keys":       keys,
+					"stored":     false,
+					"created_at": time.Now(),
+				},
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&blob)
+		if err == nil {
+			break
+		}
+		// A duplicate key means the blob is being deleted; wait for that to finish
+		if !mongo.IsDuplicateKeyError(err) || attempt == 4 {
+			return fmt.Errorf("claim blob %s: %w", media.SHA256, err)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	if blob.Stored {
+		return nil
+	}
+
+	// Writing the same content again is harmless if a concurrent upload is storing it too
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		h.releaseBlob(context.Background(), media)
+		return err
+	}
+	if err := h.store.Put(ctx, media.StorageKey, content, media.Size, media.MimeType); err != nil {
+		h.releaseBlob(context.Background(), media)
+		return fmt.Errorf("store media %s: %w", media.StorageKey, err)
+	}
+	for i, thumbnail := range thumbnails {
+		key := media.Thumbnails[i].StorageKey
+		if err := h.store.Put(ctx, key, bytes.NewReader(thumbnail.data), int64(len(thumbnail.data)), "image/jpeg"); err != nil {
+			h.releaseBlob(context.Background(), media)
+			return fmt.Errorf("store thumbnail %s: %w", key, err)
+		}
+	}
+
+	_, err := h.blobsCollection.UpdateOne(ctx, bson.M{"_id": media.SHA256}, bson.M{"$set": bson.M{"stored": true}})
+	return err
+}
+
+// releaseBlob drops the reference of media on its blob, deleting the blob when
+// it was the last one
+func (h *MediaHandler) releaseBlob(ctx context.Context, media models.Media) {
+	var blob models.MediaBlob
+	err := h.blobsCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": media.StorageKey},
+		bson.M{"$inc": bson.M{"ref_count": -1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&blob)
+	if err == mongo.ErrNoDocuments {
+		// Media uploaded before blobs were shared owns its files
+		keys := []string{media.StorageKey}
+		for _, thumbnail := range media.Thumbnails {
+			keys = append(keys, thumbnail.StorageKey)
+		}
+		h.deleteStorageKeys(ctx, keys)
+		return
+	} else if err != nil {
+		log.Printf("Failed to release blob %s: %v", media.StorageKey, err)
+		return
+	}
+
+	if blob.RefCount <= 0 {
+		h.deleteBlob(ctx, blob.SHA256)
+	}
+}
+
+// deleteBlob removes an unreferenced blob from storage. It does nothing if the
+// blob was claimed again in the meantime.
+func (h *MediaHandler) deleteBlob(ctx context.Context, sha256 string) {
+	now := time.Now()
+
+	// Marking the blob keeps new uploads from claiming it while its files are removed
+	var blob models.MediaBlob
+	err := h.blobsCollection.FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":       sha256,
+			"ref_count": bson.M{"$lte": 0},
+			"$or": []bson.M{
+				{"deleting": bson.M{"$ne": true}},
+				{"deleting_since": bson.M{"$lt": now.Add(-blobDeletionTimeout)}},
+			},
+		},
+		bson.M{"$set": bson.M{"deleting": true, "deleting_since": now}},
+	).Decode(&blob)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Failed to mark blob %s for deletion: %v", sha256, err)
+		}
+		return
+	}
+
+	if !h.deleteStorageKeys(ctx, blob.Keys) {
+		// Left marked, so that the collector retries later
+		return
+	}
+	if _, err := h.blobsCollection.DeleteOne(ctx, bson.M{"_id": sha256}); err != nil {
+		log.Printf("Failed to delete blob %s: %v", sha256, err)
+	}
+}
+
+// deleteStorageKeys removes files from storage, reporting whether all are gone
+func (h *MediaHandler) deleteStorageKeys(ctx context.Context, keys []string) bool {
+	ok := true
+	for _, key := range keys {
+		if err := h.store.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Failed to delete media blob %s: %v", key, err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// reserveQuota charges size bytes and count media items to the storage usage
+// of userID, failing if that would exceed the quota. Pending uploads are
+// charged their announced size with a count of 0.
+func (h *MediaHandler) reserveQuota(ctx context.Context, userID primitive.ObjectID, size, count int64) error {
+	quotaExceeded := &mediaError{
+		http.StatusInsufficientStorage,
+		fmt.Sprintf("Storage quota of %d MB exceeded", h.quota>>20),
+	}
+
+	filter := bson.M{"_id": userID}
+	if h.quota > 0 {
+		if size > h.quota {
+			return quotaExceeded
+		}
+		filter["bytes"] = bson.M{"$lte": h.quota - size}
+	}
+
+	// When the user is over quota the filter does not match and the upsert
+	// collides with the existing document
+	_, err := h.usageCollection.UpdateOne(ctx, filter,
+		bson.M{"$inc": bson.M{"bytes": size, "count": count}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return quotaExceeded
+	}
+	return err
+}
+
+// releaseQuota gives size bytes and count media items of storage usage back to userID
+func (h *MediaHandler) releaseQuota(ctx context.Context, userID primitive.ObjectID, size, count int64) {
+	_, err := h.usageCollection.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$inc": bson.M{"bytes": -size, "count": -count}},
+	)
+	if err != nil {
+		log.Printf("Failed to update storage usage of user %s: %v", userID.Hex(), err)
+	}
+}
+
+// usage returns the storage used by userID
+func (h *MediaHandler) usage(ctx context.Context, userID primitive.ObjectID) (models.MediaUsage, error) {
+	usage := models.MediaUsage{UserID: userID}
+	err := h.usageCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&usage)
+	if err == mongo.ErrNoDocuments {
+		return usage, nil
+	}
+	return usage, err
+}
+
+// GetUsage godoc
+// @Summary      Get storage usage
+// @Description  Returns how much storage the current user's uploads take and the quota
+// @Tags         media
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  models.MediaUsageResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /media/usage [get]
+func (h *MediaHandler) GetUsage(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	usage, err := h.usage(context.Background(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MediaUsageResponse{
+		UsedBytes:  max(usage.Bytes, 0),
+		QuotaBytes: h.quota,
+		MediaCount: max(usage.Count, 0),
+	})
+}
+
+// InitUsage computes the storage usage of every user from their media, for
+// databases created before usage was tracked. It does nothing if usage has
+// been recorded already.
+func (h *MediaHandler) InitUsage(ctx context.Context) error {
+	count, err := h.usageCollection.EstimatedDocumentCount(ctx)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	cursor, err := h.mediaCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$owner_id",
+			"bytes": bson.M{"$sum": "$size"},
+			"count": bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	var usages []models.MediaUsage
+	if err := cursor.All(ctx, &usages); err != nil {
+		return err
+	}
+
+	for _, usage := range usages {
+		// $inc keeps uploads that completed in the meantime
+		if _, err := h.usageCollection.UpdateOne(ctx,
+			bson.M{"_id": usage.UserID},
+			bson.M{"$inc": bson.M{"bytes": usage.Bytes, "count": usage.Count}},
+			options.Update().SetUpsert(true),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errMediaNotFound is returned when media is attached after it was deleted
+var errMediaNotFound = errors.New("Media not found")
+
+// attachMedia counts n new references to media, by messages, scheduled
+// messages, channel posts or statuses about to be saved. It runs before they
+// are saved, so media is never deleted while something is about to use it,
+// and fails with errMediaNotFound if it was deleted already.
+func (h *MediaHandler) attachMedia(ctx context.Context, mediaID primitive.ObjectID, n int64) error {
+	result, err := h.mediaCollection.UpdateOne(ctx, bson.M{"_id": mediaID}, bson.M{"$inc": bson.M{"ref_count": n}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errMediaNotFound
+	}
+	return nil
+}
+
+// detachMedia drops references counted by attachMedia, the given number per
+// media, and deletes media nothing refers to anymore
+func (h *MediaHandler) detachMedia(ctx context.Context, refs map[primitive.ObjectID]int64) {
+	for mediaID, n := range refs {
+		var media models.Media
+		err := h.mediaCollection.FindOneAndUpdate(ctx,
+			bson.M{"_id": mediaID},
+			bson.M{"$inc": bson.M{"ref_count": -n}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&media)
+		if err != nil {
+			if err != mongo.ErrNoDocuments {
+				log.Printf("Failed to release media %s: %v", mediaID.Hex(), err)
+			}
+			continue
+		}
+		if media.RefCount <= 0 {
+			h.deleteUnreferencedMedia(ctx, media)
+		}
+	}
+}
+
+// messageMediaRefs counts the references messages hold on each media
+func messageMediaRefs(messages []models.Message) map[primitive.ObjectID]int64 {
+	refs := make(map[primitive.ObjectID]int64)
+	for _, msg := range messages {
+		if !msg.MediaID.IsZero() {
+			refs[msg.MediaID]++
+		}
+	}
+	return refs
+}
+
+// deleteUnreferencedMedia deletes media unless something refers to it again
+// and reports whether it did
+func (h *MediaHandler) deleteUnreferencedMedia(ctx context.Context, media models.Media) bool {
+	result, err := h.mediaCollection.DeleteOne(ctx, bson.M{"_id": media.ID, "ref_count": bson.M{"$lte": 0}})
+	if err != nil {
+		log.Printf("Failed to delete media %s: %v", media.ID.Hex(), err)
+		return false
+	}
+	if result.DeletedCount == 0 {
+		return false
+	}
+	h.releaseQuota(ctx, media.OwnerID, media.Size, 1)
+	h.releaseBlob(ctx, media)
+	return true
+}
+
+// InitMediaRefs counts the references to media stored before references were
+// tracked. It does nothing once all media has a count, and has to finish
+// before messages are sent, so it runs before the service starts serving.
+func (h *MediaHandler) InitMediaRefs(ctx context.Context) error {
+	pending, err := h.mediaCollection.CountDocuments(ctx, bson.M{"ref_count": bson.M{"$exists": false}}, options.Count().SetLimit(1))
+	if err != nil || pending == 0 {
+		return err
+	}
+
+	refs := make(map[primitive.ObjectID]int64)
+	sources := []struct {
+		collection *mongo.Collection
+		filter     bson.M
+	}{
+		{h.messagesCollection, bson.M{"media_id": bson.M{"$exists": true}}},
+		// Scheduled messages hand their reference to the message once sent
+		{h.scheduledCollection, bson.M{"media_id": bson.M{"$exists": true}, "status": bson.M{"$in": unsentStatuses}}},
+		{h.channelPostsCollection, bson.M{"media_id": bson.M{"$exists": true}}},
+		{h.statusesCollection, bson.M{"media_id": bson.M{"$exists": true}}},
+	}
+	for _, source := range sources {
+		cursor, err := source.collection.Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$match", Value: source.filter}},
+			{{Key: "$group", Value: bson.M{"_id": "$media_id", "count": bson.M{"$sum": 1}}}},
+		})
+		if err != nil {
+			return err
+		}
+		var counts []struct {
+			MediaID primitive.ObjectID `bson:"_id"`
+			Count   int64              `bson:"count"`
+		}
+		if err := cursor.All(ctx, &counts); err != nil {
+			return err
+		}
+		for _, count := range counts {
+			refs[count.MediaID] += count.Count
+		}
+	}
+
+	cursor, err := h.mediaCollection.Find(ctx, bson.M{"ref_count": bson.M{"$exists": false}}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	counted := 0
+	for cursor.Next(ctx) {
+		var media models.Media
+		if err := cursor.Decode(&media); err != nil {
+			return err
+		}
+		if _, err := h.mediaCollection.UpdateOne(ctx,
+			bson.M{"_id": media.ID, "ref_count": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"ref_count": refs[media.ID]}},
+		); err != nil {
+			return err
+		}
+		counted++
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	log.Printf("Counted references to %d media", counted)
+	return nil
+}
+
+// StartMediaCollector periodically deletes media that is not attached to any
+// message and blobs no longer used by any media
+func (h *MediaHandler) StartMediaCollector(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			h.collectMedia()
+			<-ticker.C
+		}
+	}()
+}
+
+func (h *MediaHandler) collectMedia() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	// Media gets some time to be sent after it was uploaded
+	cursor, err := h.mediaCollection.Find(ctx, bson.M{
+		"ref_count":  bson.M{"$lte": 0},
+		"created_at": bson.M{"$lt": time.Now().Add(-unusedMediaTTL)},
+	})
+	if err != nil {
+		log.Printf("Failed to look up media: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	deleted := 0
+	for cursor.Next(ctx) {
+		var media models.Media
+		if err := cursor.Decode(&media); err != nil {
+			log.Printf("Failed to read media: %v", err)
+			continue
+		}
+		if h.deleteUnreferencedMedia(ctx, media) {
+			deleted++
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		log.Printf("Failed to read media: %v", err)
+	}
+
+	// Retry blobs whose deletion failed or was interrupted
+	blobIDs, err := h.blobsCollection.Distinct(ctx, "_id", bson.M{"ref_count": bson.M{"$lte": 0}})
+	if err != nil {
+		log.Printf("Failed to look up unused blobs: %v", err)
+	}
+	for _, id := range blobIDs {
+		if sha256, ok := id.(string); ok {
+			h.deleteBlob(ctx, sha256)
+		}
+	}
+
+	if deleted > 0 {
+		log.Printf("Deleted %d unused media files", deleted)
+	}
+}
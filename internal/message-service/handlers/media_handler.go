@@ -0,0 +1,695 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // register decoders for image.Decode
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"whatsapp/pkg/imaging"
+	"whatsapp/pkg/models"
+	"whatsapp/pkg/storage"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mediaKinds maps the accepted MIME types, as detected from the file content, to their kind
+var mediaKinds = map[string]string{
+	"image/jpeg": models.MediaKindImage,
+	"image/png":  models.MediaKindImage,
+	"image/gif":  models.MediaKindImage,
+	"image/webp": models.MediaKindImage,
+
+	"video/mp4":       models.MediaKindVideo,
+	"video/webm":      models.MediaKindVideo,
+	"video/quicktime": models.MediaKindVideo,
+	"video/3gpp":      models.MediaKindVideo,
+
+	"audio/mpeg":  models.MediaKindAudio,
+	"audio/ogg":   models.MediaKindAudio,
+	"audio/wav":   models.MediaKindAudio,
+	"audio/aac":   models.MediaKindAudio,
+	"audio/x-m4a": models.MediaKindAudio,
+	"audio/amr":   models.MediaKindAudio,
+
+	"application/pdf":               models.MediaKindDocument,
+	"text/plain":                    models.MediaKindDocument,
+	"application/zip":               models.MediaKindDocument,
+	"application/msword":            models.MediaKindDocument,
+	"application/vnd.ms-excel":      models.MediaKindDocument,
+	"application/vnd.ms-powerpoint": models.MediaKindDocument,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   models.MediaKindDocument,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         models.MediaKindDocument,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": models.MediaKindDocument,
+}
+
+// thumbnailSizes are the bounding boxes, in pixels, of the thumbnails generated for images
+var thumbnailSizes = []int{320, 800}
+
+const (
+	// maxImagePixels limits the size of images decoded for thumbnails
+	maxImagePixels = 50_000_000
+	// blurhashSize is the size images are scaled to before computing their blurhash
+	blurhashSize     = 32
+	thumbnailQuality = 80
+)
+
+// MediaLimits holds the maximum upload size in bytes per media kind
+type MediaLimits map[string]int64
+
+// DefaultMediaLimits returns the default upload size limits
+func DefaultMediaLimits() MediaLimits {
+	return MediaLimits{
+		models.MediaKindImage:    16 << 20,
+		models.MediaKindVideo:    64 << 20,
+		models.MediaKindAudio:    16 << 20,
+		models.MediaKindDocument: 100 << 20,
+	}
+}
+
+// largest returns the highest limit of all kinds
+func (l MediaLimits) largest() int64 {
+	var largest int64
+	for _, limit := range l {
+		if limit > largest {
+			largest = limit
+		}
+	}
+	return largest
+}
+
+// MediaConfig holds the settings of a MediaHandler
+type MediaConfig struct {
+	Limits MediaLimits
+	URLTTL time.Duration // validity of download URLs handed out to clients
+	Quota  int64         // storage each user may use for uploads in bytes, 0 for unlimited
+}
+
+// MediaHandler handles media uploads and downloads
+type MediaHandler struct {
+	mediaCollection        *mongo.Collection
+	uploadsCollection      *mongo.Collection
+	blobsCollection        *mongo.Collection
+	usageCollection        *mongo.Collection
+	messagesCollection     *mongo.Collection
+	groupsCollection       *mongo.Collection
+	scheduledCollection    *mongo.Collection
+	channelPostsCollection *mongo.Collection
+	statusesCollection     *mongo.Collection
+	store                  storage.Store
+	limits                 MediaLimits
+	urlTTL                 time.Duration
+	quota                  int64
+}
+
+// NewMediaHandler creates a media handler keeping files in store
+func NewMediaHandler(db *mongo.Database, store storage.Store, config MediaConfig) *MediaHandler {
+	return &MediaHandler{
+		mediaCollection:        db.Collection("media"),
+		uploadsCollection:      db.Collection("media_uploads"),
+		blobsCollection:        db.Collection("media_blobs"),
+		usageCollection:        db.Collection("media_usage"),
+		messagesCollection:     db.Collection("messages"),
+		groupsCollection:       db.Collection("groups"),
+		scheduledCollection:    db.Collection("scheduled_messages"),
+		channelPostsCollection: db.Collection("channel_posts"),
+		statusesCollection:     db.Collection("statuses"),
+		store:                  store,
+		limits:                 config.Limits,
+		urlTTL:                 config.URLTTL,
+		quota:                  config.Quota,
+	}
+}
+
+// EnsureIndexes creates the indexes used by media lookups and access checks
+func (h *MediaHandler) EnsureIndexes(ctx context.Context) error {
+	if _, err := h.mediaCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "owner_id", Value: 1}}},
+		{Keys: bson.D{{Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "ref_count", Value: 1}, {Key: "created_at", Value: 1}}},
+	}); err != nil {
+		return err
+	}
+
+	if _, err := h.blobsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "ref_count", Value: 1}},
+	}); err != nil {
+		return err
+	}
+
+	_, err := h.messagesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "media_id", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	})
+	return err
+}
+
+// Upload godoc
+// @Summary      Upload media
+// @Description  Uploads a file as multipart/form-data field "file". The type is detected from the content, not the file name, and each kind of media has its own size limit. Uploads count against the user's storage quota.
+// @Tags         media
+// @Accept       multipart/form-data
+// @Produce      json
+// @Security     BearerAuth
+// @Param        file  formData  file  true  "File to upload"
+// @Success      201   {object}  models.MediaResponse
+// @Failure      400   {object}  models.ErrorResponse
+// @Failure      401   {object}  models.ErrorResponse
+// @Failure      413   {object}  models.ErrorResponse
+// @Failure      415   {object}  models.ErrorResponse
+// @Failure      500   {object}  models.ErrorResponse
+// @Failure      507   {object}  models.ErrorResponse
+// @Router       /media [post]
+func (h *MediaHandler) Upload(c *gin.Context) {
+	userID, exists := c.Get("UserID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ownerID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	// Leave some room for the multipart framing around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.limits.largest()+1<<20)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	media, err := h.createMedia(c.Request.Context(), ownerID, fileHeader.Filename, file, "", 0)
+	if err != nil {
+		respondMediaError(c, err)
+		return
+	}
+
+	h.respondWithMedia(c, http.StatusCreated, media)
+}
+
+// mediaError is a rejected upload, reported to the client with status
+type mediaError struct {
+	status  int
+	message string
+}
+
+func (e *mediaError) Error() string {
+	return e.message
+}
+
+// respondMediaError reports err from createMedia
+func respondMediaError(c *gin.Context, err error) {
+	var rejected *mediaError
+	if errors.As(err, &rejected) {
+		c.JSON(rejected.status, gin.H{"error": rejected.message})
+		return
+	}
+	log.Printf("Failed to save media: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save media"})
+}
+
+// createMedia checks the type, size and, if given, the SHA-256 of file, stores
+// it and records it as media owned by ownerID. reserved is the quota already
+// charged for the file by a resumable upload; only the difference is charged,
+// and on failure the reservation is left as it was.
+func (h *MediaHandler) createMedia(ctx context.Context, ownerID primitive.ObjectID, filename string, file io.ReadSeeker, expectedSHA256 string, reserved int64) (models.Media, error) {
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return models.Media{}, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return models.Media{}, err
+	}
+
+	detected, err := mimetype.DetectReader(file)
+	if err != nil {
+		return models.Media{}, err
+	}
+	mimeType, _, err := mime.ParseMediaType(detected.String())
+	if err != nil {
+		mimeType = detected.String()
+	}
+
+	kind, ok := mediaKinds[mimeType]
+	if !ok {
+		return models.Media{}, &mediaError{http.StatusUnsupportedMediaType, "Unsupported file type " + mimeType}
+	}
+	if size > h.limits[kind] {
+		return models.Media{}, &mediaError{
+			http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("File too large, %s files may be at most %d MB", kind, h.limits[kind]>>20),
+		}
+	}
+
+	media := models.Media{
+		ID:        primitive.NewObjectID(),
+		OwnerID:   ownerID,
+		Filename:  sanitizeFilename(filename),
+		MimeType:  mimeType,
+		Kind:      kind,
+		Size:      size,
+		CreatedAt: time.Now(),
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return models.Media{}, err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return models.Media{}, err
+	}
+	media.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	if expectedSHA256 != "" && !strings.EqualFold(expectedSHA256, media.SHA256) {
+		return models.Media{}, &mediaError{http.StatusUnprocessableEntity, "Checksum mismatch"}
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return models.Media{}, err
+	}
+	content := file
+	var thumbnails []imageThumbnail
+	if kind == models.MediaKindImage {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return models.Media{}, err
+		}
+		var processed []byte
+		processed, thumbnails, err = h.processImage(&media, data)
+		if err != nil {
+			return models.Media{}, err
+		}
+		// Describe the file as stored, without the metadata
+		sum := sha256.Sum256(processed)
+		media.SHA256 = hex.EncodeToString(sum[:])
+		media.Size = int64(len(processed))
+		content = bytes.NewReader(processed)
+	}
+
+	// Files are kept under their content hash, so identical uploads share one blob
+	media.StorageKey = media.SHA256
+	for _, thumbnail := range thumbnails {
+		media.Thumbnails = append(media.Thumbnails, models.MediaThumbnail{
+			Width:      thumbnail.width,
+			Height:     thumbnail.height,
+			StorageKey: fmt.Sprintf("%s-thumb-%d", media.SHA256, thumbnail.size),
+		})
+	}
+
+	// Stripping metadata can leave the file smaller than the reservation
+	charge := media.Size - reserved
+	if err := h.reserveQuota(ctx, ownerID, charge, 1); err != nil {
+		return models.Media{}, err
+	}
+
+	if err := h.storeBlob(ctx, media, content, thumbnails); err != nil {
+		h.releaseQuota(ctx, ownerID, charge, 1)
+		return models.Media{}, err
+	}
+
+	if _, err := h.mediaCollection.InsertOne(ctx, media); err != nil {
+		h.releaseQuota(ctx, ownerID, charge, 1)
+		h.releaseBlob(context.Background(), media)
+		return models.Media{}, err
+	}
+
+	return media, nil
+}
+
+// imageThumbnail is an encoded thumbnail that has not been stored yet
+type imageThumbnail struct {
+	size   int // bounding box from thumbnailSizes
+	width  int
+	height int
+	data   []byte
+}
+
+// processImage removes EXIF and other metadata from the image in data, applies
+// its orientation to the pixels and generates thumbnails, smallest first. It
+// fills in the dimensions and blurhash of media and returns the file to keep
+// as the original.
+func (h *MediaHandler) processImage(media *models.Media, data []byte) ([]byte, []imageThumbnail, error) {
+	stripped, orientation, err := imaging.StripMetadata(media.MimeType, data)
+	if err != nil {
+		return nil, nil, &mediaError{http.StatusBadRequest, "Invalid image"}
+	}
+	if media.MimeType == "image/webp" {
+		// No WebP decoder in the standard library, so no dimensions or thumbnails
+		return stripped, nil, nil
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(stripped))
+	if err != nil {
+		return nil, nil, &mediaError{http.StatusBadRequest, "Invalid image"}
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, nil, &mediaError{http.StatusBadRequest, "Image dimensions too large"}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		return nil, nil, &mediaError{http.StatusBadRequest, "Invalid image"}
+	}
+	if orientation != 1 {
+		// The orientation tag is gone with the EXIF data, so rotate the pixels instead
+		img = imaging.Orient(img, orientation)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 92}); err != nil {
+			return nil, nil, err
+		}
+		stripped = buf.Bytes()
+	}
+	media.Width = img.Bounds().Dx()
+	media.Height = img.Bounds().Dy()
+
+	// Scale each thumbnail from the next larger one, starting with the largest
+	var thumbnails []imageThumbnail
+	source := image.Image(img)
+	for i := len(thumbnailSizes) - 1; i >= 0; i-- {
+		width, height := imaging.FitSize(media.Width, media.Height, thumbnailSizes[i])
+		if width == media.Width && height == media.Height {
+			// Small enough to be shown as is
+			continue
+		}
+
+		thumbnail := imaging.Resize(source, width, height)
+		var buf bytes.Buffer
+		if err := imaging.EncodeJPEG(&buf, thumbnail, thumbnailQuality); err != nil {
+			return nil, nil, err
+		}
+		thumbnails = append([]imageThumbnail{{thumbnailSizes[i], width, height, buf.Bytes()}}, thumbnails...)
+		source = thumbnail
+	}
+
+	xComponents, yComponents := 4, 3
+	if media.Height > media.Width {
+		xComponents, yComponents = 3, 4
+	}
+	media.Blurhash, err = imaging.Blurhash(imaging.Fit(source, blurhashSize), xComponents, yComponents)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return stripped, thumbnails, nil
+}
+
+// respondWithMedia writes the media record with fresh download URLs
+func (h *MediaHandler) respondWithMedia(c *gin.Context, status int, media models.Media) {
+	response, err := h.mediaResponse(media)
+	if err != nil {
+		log.Printf("Failed to sign URL for media %s: %v", media.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create download URL"})
+		return
+	}
+	c.JSON(status, response)
+}
+
+// mediaResponse converts media into its API representation with signed
+// URLs of the file and its thumbnails
+func (h *MediaHandler) mediaResponse(media models.Media) (models.MediaResponse, error) {
+	response := media.ToResponse()
+	url, err := h.DownloadURL(media)
+	if err != nil {
+		return models.MediaResponse{}, err
+	}
+	response.DownloadURL = url
+
+	for _, thumbnail := range media.Thumbnails {
+		url, err := h.store.URL(thumbnail.StorageKey, h.urlTTL, storage.URLOptions{
+			ContentType:        "image/jpeg",
+			ContentDisposition: "inline",
+		})
+		if err != nil {
+			return models.MediaResponse{}, err
+		}
+		response.Thumbnails = append(response.Thumbnails, models.MediaThumbnailResponse{
+			URL:    url,
+			Width:  thumbnail.Width,
+			Height: thumbnail.Height,
+		})
+	}
+
+	return response, nil
+}
+
+// DownloadURL returns a signed, expiring URL for media
+func (h *MediaHandler) DownloadURL(media models.Media) (string, error) {
+	disposition := "attachment"
+	if media.Kind != models.MediaKindDocument {
+		disposition = "inline"
+	}
+
+	return h.store.URL(media.StorageKey, h.urlTTL, storage.URLOptions{
+		ContentType:        media.MimeType,
+		ContentDisposition: mime.FormatMediaType(disposition, map[string]string{"filename": media.Filename}),
+	})
+}
+
+// ResponseByID returns the API representation of the media with the given ID,
+// with signed URLs
+func (h *MediaHandler) ResponseByID(ctx context.Context, mediaID primitive.ObjectID) (models.MediaResponse, error) {
+	var media models.Media
+	if err := h.mediaCollection.FindOne(ctx, bson.M{"_id": mediaID}).Decode(&media); err != nil {
+		return models.MediaResponse{}, err
+	}
+	return h.mediaResponse(media)
+}
+
+// ResponsesByID looks up the media with the given IDs in one query and
+// returns their API representations by ID. Media that no longer exists is left out.
+func (h *MediaHandler) ResponsesByID(ctx context.Context, mediaIDs []primitive.ObjectID) (map[primitive.ObjectID]models.MediaResponse, error) {
+	responses := make(map[primitive.ObjectID]models.MediaResponse)
+	if len(mediaIDs) == 0 {
+		return responses, nil
+	}
+
+	cursor, err := h.mediaCollection.Find(ctx, bson.M{"_id": bson.M{"$in": mediaIDs}})
+	if err != nil {
+		return nil, err
+	}
+	var media []models.Media
+	if err := cursor.All(ctx, &media); err != nil {
+		return nil, err
+	}
+
+	for _, m := range media {
+		response, err := h.mediaResponse(m)
+		if err != nil {
+			return nil, err
+		}
+		responses[m.ID] = response
+	}
+	return responses, nil
+}
+
+// AccessibleMedia returns the media with the given ID if userID may use it,
+// or nil if it does not exist or belongs to a conversation userID is not part of
+func (h *MediaHandler) AccessibleMedia(ctx context.Context, mediaID, userID primitive.ObjectID) (*models.Media, error) {
+	var media models.Media
+	err := h.mediaCollection.FindOne(ctx, bson.M{"_id": mediaID}).Decode(&media)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	allowed, err := mediaAccessible(ctx, h.messagesCollection, h.groupsCollection, media, userID)
+	if err != nil || !allowed {
+		return nil, err
+	}
+	return &media, nil
+}
+
+// GetMedia godoc
+// @Summary      Download media
+// @Description  Redirects to a short-lived download URL for an uploaded file. Only the uploader and participants of a conversation the file was sent in can fetch it.
+// @Tags         media
+// @Security     BearerAuth
+// @Param        id   path      string  true  "Media ID"
+// @Success      302
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /media/{id} [get]
+func (h *MediaHandler) GetMedia(c *gin.Context) {
+	userID, exists := c.Get("UserID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	mediaID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid media ID"})
+		return
+	}
+
+	ctx := context.Background()
+
+	var media models.Media
+	if err := h.mediaCollection.FindOne(ctx, bson.M{"_id": mediaID}).Decode(&media); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	allowed, err := mediaAccessible(ctx, h.messagesCollection, h.groupsCollection, media, userObjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !allowed {
+		// Same answer as for unknown IDs, so that IDs cannot be probed
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+
+	url, err := h.DownloadURL(media)
+	if err != nil {
+		log.Printf("Failed to sign URL for media %s: %v", media.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create download URL"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, url)
+}
+
+// ServeBlob godoc
+// @Summary      Download a media file by signed URL
+// @Description  Serves a file from local media storage. The URL comes from a media or message response and expires; no Authorization header is needed, so it can be used directly in img and video tags. Supports range requests.
+// @Tags         media
+// @Produce      octet-stream
+// @Param        key        path      string  true   "Storage key"
+// @Param        expires    query     int     true   "Expiry (Unix time)"
+// @Param        signature  query     string  true   "URL signature"
+// @Success      200        {file}    file
+// @Failure      403        {object}  models.ErrorResponse
+// @Failure      404        {object}  models.ErrorResponse
+// @Router       /media/blobs/{key} [get]
+func (h *MediaHandler) ServeBlob(c *gin.Context) {
+	local, ok := h.store.(*storage.LocalStore)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+
+	key := c.Param("key")
+	opts, err := local.Verify(key, c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired media URL"})
+		return
+	}
+
+	blob, err := local.Get(c.Request.Context(), key)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+	defer blob.Close()
+
+	if opts.ContentType != "" {
+		c.Header("Content-Type", opts.ContentType)
+	}
+	if opts.ContentDisposition != "" {
+		c.Header("Content-Disposition", opts.ContentDisposition)
+	}
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "default-src 'none'; sandbox")
+	c.Header("Cache-Control", "private, max-age=3600")
+
+	if seeker, ok := blob.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, "", time.Time{}, seeker)
+		return
+	}
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, blob)
+}
+
+// mediaAccessible reports whether userID may fetch media: the uploader always can,
+// everyone else only if it was sent in one of their direct chats or groups
+func mediaAccessible(ctx context.Context, messagesCollection, groupsCollection *mongo.Collection, media models.Media, userID primitive.ObjectID) (bool, error) {
+	if media.OwnerID == userID {
+		return true, nil
+	}
+
+	groupIDs, err := groupsCollection.Distinct(ctx, "_id", bson.M{"member_ids": userID})
+	if err != nil {
+		return false, err
+	}
+
+	or := []bson.M{
+		{"sender_id": userID},
+		{"receiver_id": userID},
+	}
+	if len(groupIDs) > 0 {
+		or = append(or, bson.M{"group_id": bson.M{"$in": groupIDs}})
+	}
+	count, err := messagesCollection.CountDocuments(ctx, bson.M{
+		"media_id": media.ID,
+		"$or":      or,
+	}, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+// sanitizeFilename keeps the base name of an uploaded file without control characters
+func sanitizeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > 255 {
+		name = string(runes[:255])
+	}
+	if name == "" || name == "." || name == "/" {
+		name = "file"
+	}
+	return name
+}
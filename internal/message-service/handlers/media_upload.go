@@ -0,0 +1,514 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// MaxUploadChunkSize is the largest chunk accepted by a single PATCH request
+	MaxUploadChunkSize = 16 << 20
+	// uploadExpiry is how long an upload survives without receiving data
+	uploadExpiry = 24 * time.Hour
+	// statusChecksumMismatch is returned when a chunk does not match its
+	// Upload-Checksum header, as in the tus checksum extension
+	statusChecksumMismatch = 460
+)
+
+var sha256HexPattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// EnsureUploadIndexes creates the indexes used by resumable uploads
+func (h *MediaHandler) EnsureUploadIndexes(ctx context.Context) error {
+	_, err := h.uploadsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "owner_id", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}},
+	})
+	return err
+}
+
+// CreateUpload godoc
+// @Summary      Start a resumable upload
+// @Description  Announces a file that is then sent in chunks with PATCH requests, which can be resumed after a connection loss. Uploads that receive no data for 24 hours are discarded.
+// @Tags         media
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        upload  body      models.MediaUploadRequest  true  "File description"
+// @Success      201     {object}  models.MediaUploadResponse
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      401     {object}  models.ErrorResponse
+// @Failure      413     {object}  models.ErrorResponse
+// @Failure      500     {object}  models.ErrorResponse
+// @Failure      507     {object}  models.ErrorResponse
+// @Router       /media/uploads [post]
+func (h *MediaHandler) CreateUpload(c *gin.Context) {
+	ownerID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var input models.MediaUploadRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Size <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Size must be positive"})
+		return
+	}
+	if input.Size > h.limits.largest() {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File too large"})
+		return
+	}
+	if input.SHA256 != "" && !sha256HexPattern.MatchString(input.SHA256) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sha256 must be a hex-encoded SHA-256 digest"})
+		return
+	}
+
+	// Reserving the announced size fails early rather than after the whole
+	// file was sent, and keeps parallel uploads within the quota together
+	ctx := context.Background()
+	if err := h.reserveQuota(ctx, ownerID, input.Size, 0); err != nil {
+		respondMediaError(c, err)
+		return
+	}
+
+	now := time.Now()
+	upload := models.MediaUpload{
+		ID:        primitive.NewObjectID(),
+		OwnerID:   ownerID,
+		Filename:  sanitizeFilename(input.Filename),
+		Size:      input.Size,
+		SHA256:    strings.ToLower(input.SHA256),
+		Chunks:    []models.UploadChunk{},
+		Reserved:  true,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(uploadExpiry),
+	}
+
+	if _, err := h.uploadsCollection.InsertOne(ctx, upload); err != nil {
+		h.releaseQuota(ctx, ownerID, input.Size, 0)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload"})
+		return
+	}
+
+	response := upload.ToResponse()
+	c.Header("Location", response.URL)
+	c.Header("Upload-Offset", "0")
+	c.JSON(http.StatusCreated, response)
+}
+
+// UploadChunk godoc
+// @Summary      Upload a chunk
+// @Description  Appends the request body to an upload. Upload-Offset must match the number of bytes received so far; an optional "Upload-Checksum: sha256 <base64>" header is verified. Chunks may be at most 16 MB.
+// @Tags         media
+// @Accept       application/offset+octet-stream
+// @Security     BearerAuth
+// @Param        id               path      string  true   "Upload ID"
+// @Param        Upload-Offset    header    int     true   "Offset of the chunk"
+// @Param        Upload-Checksum  header    string  false  "Chunk checksum, e.g. sha256 n4bQgYhMfWWaL+qgxVrQFaO/TxsrC4Is0V1sFbDwCgg="
+// @Success      204
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      409  {object}  models.ErrorResponse
+// @Failure      413  {object}  models.ErrorResponse
+// @Failure      460  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /media/uploads/{id} [patch]
+func (h *MediaHandler) UploadChunk(c *gin.Context) {
+	upload, ok := h.currentUpload(c)
+	if !ok {
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing or invalid Upload-Offset header"})
+		return
+	}
+	if offset != upload.Offset {
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload-Offset does not match the received data"})
+		return
+	}
+	if upload.Finalizing {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload is being finalized"})
+		return
+	}
+
+	algorithm, expectedSum, err := parseUploadChecksum(c.GetHeader("Upload-Checksum"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Spool the chunk so that its size and checksum are known before it is stored
+	chunk, err := os.CreateTemp("", "chunk-*")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read chunk"})
+		return
+	}
+	defer os.Remove(chunk.Name())
+	defer chunk.Close()
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, MaxUploadChunkSize)
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(chunk, hash), body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Chunk too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read chunk"})
+		return
+	}
+
+	if algorithm != "" && !bytes.Equal(hash.Sum(nil), expectedSum) {
+		c.JSON(statusChecksumMismatch, gin.H{"error": "Checksum mismatch"})
+		return
+	}
+	if offset+size > upload.Size {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Chunk exceeds the upload size"})
+		return
+	}
+	if size == 0 {
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	if _, err := chunk.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read chunk"})
+		return
+	}
+	// Each request writes its own blob, so that a losing concurrent or retried
+	// request cannot delete the chunk another one recorded at the same offset
+	key := fmt.Sprintf("upload-%s-%d-%s", upload.ID.Hex(), offset, primitive.NewObjectID().Hex())
+	if err := h.store.Put(c.Request.Context(), key, chunk, size, "application/octet-stream"); err != nil {
+		log.Printf("Failed to store chunk of upload %s: %v", upload.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store chunk"})
+		return
+	}
+
+	// The offset in the filter makes concurrent PATCH requests for the same range fail
+	now := time.Now()
+	err = h.uploadsCollection.FindOneAndUpdate(
+		context.Background(),
+		bson.M{"_id": upload.ID, "offset": offset, "finalizing": bson.M{"$ne": true}},
+		bson.M{
+			"$set": bson.M{
+				"offset":     offset + size,
+				"updated_at": now,
+				"expires_at": now.Add(uploadExpiry),
+			},
+			"$push": bson.M{"chunks": models.UploadChunk{StorageKey: key, Offset: offset, Size: size}},
+		},
+	).Err()
+	if err != nil {
+		h.store.Delete(context.Background(), key)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusConflict, gin.H{"error": "Upload changed concurrently"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update upload"})
+		}
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(offset+size, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// GetUploadOffset godoc
+// @Summary      Get upload progress
+// @Description  Returns the number of bytes received in the Upload-Offset header and the total size in Upload-Length, so that an interrupted upload can resume
+// @Tags         media
+// @Security     BearerAuth
+// @Param        id   path  string  true  "Upload ID"
+// @Success      200
+// @Failure      401
+// @Failure      404
+// @Router       /media/uploads/{id} [head]
+func (h *MediaHandler) GetUploadOffset(c *gin.Context) {
+	upload, ok := h.currentUpload(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Size, 10))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+}
+
+// FinalizeUpload godoc
+// @Summary      Finish a resumable upload
+// @Description  Assembles a completely received upload, verifies its SHA-256 if one was announced and turns it into a media item, applying the same type and size checks as single uploads
+// @Tags         media
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      string  true  "Upload ID"
+// @Success      201  {object}  models.MediaResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      409  {object}  models.ErrorResponse
+// @Failure      413  {object}  models.ErrorResponse
+// @Failure      415  {object}  models.ErrorResponse
+// @Failure      422  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      507  {object}  models.ErrorResponse
+// @Router       /media/uploads/{id}/finalize [post]
+func (h *MediaHandler) FinalizeUpload(c *gin.Context) {
+	upload, ok := h.currentUpload(c)
+	if !ok {
+		return
+	}
+
+	if upload.Offset != upload.Size {
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload is incomplete"})
+		return
+	}
+
+	ctx := context.Background()
+
+	// Only one finalize request may assemble the file, and the reaper leaves
+	// it alone meanwhile
+	now := time.Now()
+	result, err := h.uploadsCollection.UpdateOne(ctx,
+		bson.M{"_id": upload.ID, "finalizing": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"finalizing": true, "updated_at": now, "expires_at": now.Add(uploadExpiry)}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update upload"})
+		return
+	}
+	if result.ModifiedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload is already being finalized"})
+		return
+	}
+
+	media, err := h.assembleUpload(ctx, upload)
+	if err != nil {
+		var rejected *mediaError
+		if errors.As(err, &rejected) {
+			// The content itself is unacceptable, so retrying cannot help
+			h.discardUpload(ctx, upload)
+		} else {
+			h.uploadsCollection.UpdateOne(ctx, bson.M{"_id": upload.ID}, bson.M{"$unset": bson.M{"finalizing": ""}})
+		}
+		respondMediaError(c, err)
+		return
+	}
+
+	// The reservation now pays for the media
+	upload.Reserved = false
+	h.discardUpload(ctx, upload)
+	h.respondWithMedia(c, http.StatusCreated, media)
+}
+
+// assembleUpload concatenates the chunks of upload and creates the media item
+func (h *MediaHandler) assembleUpload(ctx context.Context, upload models.MediaUpload) (models.Media, error) {
+	file, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return models.Media{}, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	chunks := append([]models.UploadChunk(nil), upload.Chunks...)
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Offset < chunks[j].Offset })
+
+	var offset int64
+	for _, chunk := range chunks {
+		if chunk.Offset != offset {
+			return models.Media{}, fmt.Errorf("upload %s has a gap at offset %d", upload.ID.Hex(), offset)
+		}
+		blob, err := h.store.Get(ctx, chunk.StorageKey)
+		if err != nil {
+			return models.Media{}, fmt.Errorf("read chunk %s: %w", chunk.StorageKey, err)
+		}
+		written, err := io.Copy(file, blob)
+		blob.Close()
+		if err != nil {
+			return models.Media{}, err
+		}
+		offset += written
+	}
+	if offset != upload.Size {
+		return models.Media{}, fmt.Errorf("upload %s assembled to %d of %d bytes", upload.ID.Hex(), offset, upload.Size)
+	}
+
+	var reserved int64
+	if upload.Reserved {
+		reserved = upload.Size
+	}
+	return h.createMedia(ctx, upload.OwnerID, upload.Filename, file, upload.SHA256, reserved)
+}
+
+// CancelUpload godoc
+// @Summary      Cancel a resumable upload
+// @Description  Discards an upload and the data received so far
+// @Tags         media
+// @Security     BearerAuth
+// @Param        id   path      string  true  "Upload ID"
+// @Success      204
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      409  {object}  models.ErrorResponse
+// @Router       /media/uploads/{id} [delete]
+func (h *MediaHandler) CancelUpload(c *gin.Context) {
+	upload, ok := h.currentUpload(c)
+	if !ok {
+		return
+	}
+	if upload.Finalizing {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload is being finalized"})
+		return
+	}
+
+	h.discardUpload(context.Background(), upload)
+	c.Status(http.StatusNoContent)
+}
+
+// discardUpload removes the chunks and the record of upload and gives its
+// quota reservation back. Only the request that deletes the record releases
+// the reservation, so a cancel racing the reaper cannot release it twice.
+func (h *MediaHandler) discardUpload(ctx context.Context, upload models.MediaUpload) {
+	for _, chunk := range upload.Chunks {
+		if err := h.store.Delete(ctx, chunk.StorageKey); err != nil {
+			log.Printf("Failed to delete chunk %s: %v", chunk.StorageKey, err)
+		}
+	}
+	result, err := h.uploadsCollection.DeleteOne(ctx, bson.M{"_id": upload.ID})
+	if err != nil {
+		log.Printf("Failed to delete upload %s: %v", upload.ID.Hex(), err)
+		return
+	}
+	if result.DeletedCount > 0 && upload.Reserved {
+		h.releaseQuota(ctx, upload.OwnerID, upload.Size, 0)
+	}
+}
+
+// StartUploadReaper periodically discards uploads that stopped receiving data
+func (h *MediaHandler) StartUploadReaper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			h.reapUploads()
+			<-ticker.C
+		}
+	}()
+}
+
+func (h *MediaHandler) reapUploads() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	cursor, err := h.uploadsCollection.Find(ctx, bson.M{"expires_at": bson.M{"$lte": time.Now()}}, options.Find().SetLimit(500))
+	if err != nil {
+		log.Printf("Failed to look up abandoned uploads: %v", err)
+		return
+	}
+
+	var uploads []models.MediaUpload
+	if err := cursor.All(ctx, &uploads); err != nil {
+		log.Printf("Failed to read abandoned uploads: %v", err)
+		return
+	}
+
+	for _, upload := range uploads {
+		h.discardUpload(ctx, upload)
+	}
+	if len(uploads) > 0 {
+		log.Printf("Discarded %d abandoned uploads", len(uploads))
+	}
+}
+
+// currentUpload loads the upload in the path, which must belong to the current user
+func (h *MediaHandler) currentUpload(c *gin.Context) (models.MediaUpload, bool) {
+	var upload models.MediaUpload
+
+	ownerID, ok := currentUserID(c)
+	if !ok {
+		return upload, false
+	}
+
+	uploadID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload ID"})
+		return upload, false
+	}
+
+	err = h.uploadsCollection.FindOne(context.Background(), bson.M{"_id": uploadID, "owner_id": ownerID}).Decode(&upload)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return upload, false
+	}
+
+	return upload, true
+}
+
+// parseUploadChecksum parses an "Upload-Checksum: <algorithm> <base64 digest>" header.
+// Only sha256 is supported; an empty header means no checksum.
+func parseUploadChecksum(header string) (string, []byte, error) {
+	if header == "" {
+		return "", nil, nil
+	}
+
+	algorithm, encoded, found := strings.Cut(strings.TrimSpace(header), " ")
+	if !found || algorithm != "sha256" {
+		return "", nil, errors.New("Upload-Checksum must be \"sha256 <base64 digest>\"")
+	}
+	sum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(sum) != sha256.Size {
+		return "", nil, errors.New("Invalid Upload-Checksum digest")
+	}
+	return algorithm, sum, nil
+}
+
+// currentUserID returns the authenticated user's ID, responding with an error if there is none
+func currentUserID(c *gin.Context) (primitive.ObjectID, bool) {
+	userID, exists := c.Get("UserID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return primitive.NilObjectID, false
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return primitive.NilObjectID, false
+	}
+	return objectID, true
+}
@@ -0,0 +1,458 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mentionPattern matches "@handle" at the start of the text or after a character
+// that cannot be part of an email address or another handle
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@.])@([A-Za-z0-9_.]{3,32})`)
+
+// usernameCollation matches the case-insensitive unique index on usernames
+var usernameCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// maxMentionsPage is the most messages GetMentions returns at once
+const maxMentionsPage = 100
+
+// parseMentions returns the lowercased handles mentioned in content and whether it mentions @all
+func parseMentions(content string) (handles []string, all bool) {
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		// A trailing dot ends the sentence, not the handle
+		handle := strings.ToLower(strings.TrimRight(match[1], "."))
+		if len(handle) < 3 || seen[handle] {
+			continue
+		}
+		seen[handle] = true
+		if handle == models.MentionAll {
+			all = true
+		}
+		handles = append(handles, handle)
+	}
+	return handles, all
+}
+
+// resolveMentions sets the members of the message's group that its content mentions.
+// Only admins can mention everyone; for anyone else @all refers to a user named "all".
+func (h *MessageHandler) resolveMentions(ctx context.Context, msg *models.Message) error {
+	handles, all := parseMentions(msg.Content)
+	if len(handles) == 0 {
+		return nil
+	}
+
+	var group models.Group
+	if err := h.groupsCollection.FindOne(ctx, bson.M{"_id": msg.GroupID}).Decode(&group); err != nil {
+		return err
+	}
+
+	members := make(map[primitive.ObjectID]bool, len(group.MemberIDs))
+	for _, memberID := range group.MemberIDs {
+		members[memberID] = true
+	}
+
+	mentioned := make(map[primitive.ObjectID]bool)
+	if all && group.IsAdmin(msg.SenderID) {
+		msg.MentionsAll = true
+		for _, memberID := range group.MemberIDs {
+			mentioned[memberID] = true
+		}
+	} else {
+		cursor, err := h.usersCollection.Find(ctx,
+			bson.M{"username": bson.M{"$in": handles}},
+			options.Find().SetCollation(usernameCollation).SetProjection(bson.M{"_id": 1}),
+		)
+		if err != nil {
+			return err
+		}
+		var users []struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.All(ctx, &users); err != nil {
+			return err
+		}
+		for _, user := range users {
+			// Handles of people outside the group stay plain text
+			if members[user.ID] {
+				mentioned[user.ID] = true
+			}
+		}
+	}
+
+	delete(mentioned, msg.SenderID)
+	msg.Mentions = nil
+	for _, memberID := range group.MemberIDs {
+		if mentioned[memberID] {
+			msg.Mentions = append(msg.Mentions, memberID)
+		}
+	}
+	return nil
+}
+
+// mutedMembers returns the members of a group who have muted it
+func (h *MessageHandler) mutedMembers(ctx context.Context, groupID primitive.ObjectID) (map[string]bool, error) {
+	cursor, err := h.groupSettingsCollection.Find(ctx, bson.M{"group_id": groupID, "muted": true})
+	if err != nil {
+		return nil, err
+	}
+	var settings []models.GroupMemberSettings
+	if err := cursor.All(ctx, &settings); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	muted := make(map[string]bool, len(settings))
+	for _, setting := range settings {
+		if setting.IsMuted(now) {
+			muted[setting.UserID.Hex()] = true
+		}
+	}
+	return muted, nil
+}
+
+// EnsureMentionIndexes creates the indexes for listing mentions and for group member settings
+func (h *MessageHandler) EnsureMentionIndexes(ctx context.Context) error {
+	_, err := h.messagesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "mentions", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().SetPartialFilterExpression(bson.M{"mentions": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = h.groupSettingsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "group_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// GetMentions godoc
+// @Summary      List my mentions
+// @Description  Lists the most recent group messages that mention the current user, newest first
+// @Tags         messages
+// @Produce      json
+// @Security     BearerAuth
+// @Param        limit   query     int     false  "Maximum number of messages (default 50, at most 100)"
+// @Param        before  query     string  false  "Only messages sent before this RFC 3339 timestamp"
+// @Success      200     {array}   models.MessageResponse
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      401     {object}  models.ErrorResponse
+// @Failure      500     {object}  models.ErrorResponse
+// @Router       /messages/mentions [get]
+func (h *MessageHandler) GetMentions(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if limitParam := c.Query("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = min(parsed, maxMentionsPage)
+	}
+
+	filter := bson.M{"mentions": userID, "deleted_at": bson.M{"$exists": false}, "expires_at": unexpired()}
+	if beforeParam := c.Query("before"); beforeParam != "" {
+		before, err := time.Parse(time.RFC3339, beforeParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid before timestamp"})
+			return
+		}
+		filter["created_at"] = bson.M{"$lt": before}
+	}
+
+	ctx := context.Background()
+	groupIDs, err := h.memberGroupIDs(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	// Mentions in groups the user has left are no longer theirs to read
+	filter["group_id"] = bson.M{"$in": groupIDs}
+
+	cursor, err := h.messagesCollection.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var messages []models.Message
+	if err := cursor.All(ctx, &messages); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	responses := []models.MessageResponse{}
+	for _, msg := range messages {
+		responses = append(responses, h.messageResponse(msg))
+	}
+	h.markStarred(ctx, userID, responses)
+	c.JSON(http.StatusOK, responses)
+}
+
+// GetUnreadMentions godoc
+// @Summary      Count unread mentions
+// @Description  Returns, for each group with unseen mentions of the current user, how many there are and the latest one. Mentions count as seen once the group's messages are fetched or they are marked read.
+// @Tags         messages
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}   models.UnreadMentions
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /messages/mentions/unread [get]
+func (h *MessageHandler) GetUnreadMentions(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	groupIDs, err := h.memberGroupIDs(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	unread := []models.UnreadMentions{}
+	if len(groupIDs) == 0 {
+		c.JSON(http.StatusOK, unread)
+		return
+	}
+
+	cursor, err := h.groupSettingsCollection.Find(ctx, bson.M{"user_id": userID, "group_id": bson.M{"$in": groupIDs}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var settings []models.GroupMemberSettings
+	if err := cursor.All(ctx, &settings); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	readAt := make(map[primitive.ObjectID]time.Time, len(settings))
+	for _, setting := range settings {
+		readAt[setting.GroupID] = setting.MentionsReadAt
+	}
+
+	// Each group has its own read position
+	chats := make([]bson.M, 0, len(groupIDs))
+	for _, groupID := range groupIDs {
+		chats = append(chats, bson.M{"group_id": groupID, "created_at": bson.M{"$gt": readAt[groupID]}})
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"mentions": userID, "deleted_at": bson.M{"$exists": false}, "expires_at": unexpired(), "$or": chats}}},
+		{{Key: "$sort", Value: bson.M{"created_at": -1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":    "$group_id",
+			"count":  bson.M{"$sum": 1},
+			"latest": bson.M{"$first": "$_id"},
+		}}},
+		{{Key: "$sort", Value: bson.M{"latest": -1}}},
+	}
+	cursor, err = h.messagesCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var counts []struct {
+		GroupID primitive.ObjectID `bson:"_id"`
+		Count   int                `bson:"count"`
+		Latest  primitive.ObjectID `bson:"latest"`
+	}
+	if err := cursor.All(ctx, &counts); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	for _, count := range counts {
+		unread = append(unread, models.UnreadMentions{
+			GroupID:         count.GroupID.Hex(),
+			Count:           count.Count,
+			LatestMessageID: count.Latest.Hex(),
+		})
+	}
+	c.JSON(http.StatusOK, unread)
+}
+
+// MarkMentionsRead godoc
+// @Summary      Mark mentions as read
+// @Description  Resets the unread mention counter of a group for the current user
+// @Tags         groups
+// @Security     BearerAuth
+// @Param        id   path  string  true  "Group ID"
+// @Success      204
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /groups/{id}/mentions/read [post]
+func (h *MessageHandler) MarkMentionsRead(c *gin.Context) {
+	groupID, userID, ok := h.loadGroupMembership(c)
+	if !ok {
+		return
+	}
+	if err := h.markMentionsRead(context.Background(), groupID, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update mentions"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// markMentionsRead marks every mention of userID in a group up to now as seen
+func (h *MessageHandler) markMentionsRead(ctx context.Context, groupID, userID primitive.ObjectID) error {
+	_, err := h.groupSettingsCollection.UpdateOne(ctx,
+		bson.M{"group_id": groupID, "user_id": userID},
+		bson.M{
+			"$set":         bson.M{"mentions_read_at": time.Now()},
+			"$setOnInsert": bson.M{"muted": false},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// MuteGroup godoc
+// @Summary      Mute a group
+// @Description  Mutes a group for the current user until the given time, or indefinitely. Messages from muted groups are still delivered but marked silent, except those mentioning the user.
+// @Tags         groups
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path      string                   true   "Group ID"
+// @Param        mute  body      models.GroupMuteRequest  false  "Mute end"
+// @Success      200   {object}  models.GroupMuteResponse
+// @Failure      400   {object}  models.ErrorResponse
+// @Failure      401   {object}  models.ErrorResponse
+// @Failure      404   {object}  models.ErrorResponse
+// @Failure      500   {object}  models.ErrorResponse
+// @Router       /groups/{id}/mute [put]
+func (h *MessageHandler) MuteGroup(c *gin.Context) {
+	var input models.GroupMuteRequest
+	// The body is optional
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Until != nil {
+		if !input.Until.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "until must be in the future"})
+			return
+		}
+		until := input.Until.UTC()
+		input.Until = &until
+	}
+
+	groupID, userID, ok := h.loadGroupMembership(c)
+	if !ok {
+		return
+	}
+
+	update := bson.M{"$set": bson.M{"muted": true}}
+	if input.Until != nil {
+		update["$set"].(bson.M)["muted_until"] = *input.Until
+	} else {
+		update["$unset"] = bson.M{"muted_until": ""}
+	}
+	if _, err := h.groupSettingsCollection.UpdateOne(context.Background(),
+		bson.M{"group_id": groupID, "user_id": userID}, update, options.Update().SetUpsert(true),
+	); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mute group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.GroupMuteResponse{GroupID: groupID.Hex(), Muted: true, MutedUntil: input.Until})
+}
+
+// UnmuteGroup godoc
+// @Summary      Unmute a group
+// @Description  Restores notifications for all messages of a group
+// @Tags         groups
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      string  true  "Group ID"
+// @Success      200  {object}  models.GroupMuteResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /groups/{id}/mute [delete]
+func (h *MessageHandler) UnmuteGroup(c *gin.Context) {
+	groupID, userID, ok := h.loadGroupMembership(c)
+	if !ok {
+		return
+	}
+
+	if _, err := h.groupSettingsCollection.UpdateOne(context.Background(),
+		bson.M{"group_id": groupID, "user_id": userID},
+		bson.M{"$set": bson.M{"muted": false}, "$unset": bson.M{"muted_until": ""}},
+	); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unmute group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.GroupMuteResponse{GroupID: groupID.Hex(), Muted: false})
+}
+
+// loadGroupMembership parses the :id group of the path, responding with an
+// error unless the current user is a member
+func (h *MessageHandler) loadGroupMembership(c *gin.Context) (groupID, userID primitive.ObjectID, ok bool) {
+	userID, ok = currentUserID(c)
+	if !ok {
+		return groupID, userID, false
+	}
+
+	groupID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return groupID, userID, false
+	}
+
+	count, err := h.groupsCollection.CountDocuments(context.Background(), bson.M{"_id": groupID, "member_ids": userID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return groupID, userID, false
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return groupID, userID, false
+	}
+	return groupID, userID, true
+}
+
+// memberGroupIDs returns the IDs of the groups userID belongs to
+func (h *MessageHandler) memberGroupIDs(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	cursor, err := h.groupsCollection.Find(ctx, bson.M{"member_ids": userID}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var groups []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(groups))
+	for _, group := range groups {
+		ids = append(ids, group.ID)
+	}
+	return ids, nil
+}
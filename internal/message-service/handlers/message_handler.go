@@ -3,12 +3,15 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
+	"whatsapp/internal/message-service/linkpreview"
 	"whatsapp/pkg/models"
 
 	"github.com/gin-gonic/gin"
@@ -20,10 +23,19 @@ import (
 
 // MessageHandler handles message-related requests
 type MessageHandler struct {
-	messagesCollection *mongo.Collection
-	groupsCollection   *mongo.Collection
-	usersCollection    *mongo.Collection
-	rabbitMQClient     RabbitMQClient
+	messagesCollection      *mongo.Collection
+	groupsCollection        *mongo.Collection
+	usersCollection         *mongo.Collection
+	pollVotesCollection     *mongo.Collection
+	groupSettingsCollection *mongo.Collection
+	starsCollection         *mongo.Collection
+	chatSettingsCollection  *mongo.Collection
+	scheduledCollection     *mongo.Collection
+	broadcastsCollection    *mongo.Collection
+	draftsCollection        *mongo.Collection
+	media                   *MediaHandler
+	previews                *linkpreview.Previewer // nil when link previews are disabled
+	rabbitMQClient          RabbitMQClient
 }
 
 // RabbitMQClient interface for messaging
@@ -34,18 +46,27 @@ type RabbitMQClient interface {
 }
 
 // NewMessageHandler creates a new message handler
-func NewMessageHandler(messagesCollection *mongo.Collection, groupsCollection *mongo.Collection, usersCollection *mongo.Collection, rabbitMQClient RabbitMQClient) *MessageHandler {
+func NewMessageHandler(db *mongo.Database, media *MediaHandler, previews *linkpreview.Previewer, rabbitMQClient RabbitMQClient) *MessageHandler {
 	return &MessageHandler{
-		messagesCollection: messagesCollection,
-		groupsCollection:   groupsCollection,
-		usersCollection:    usersCollection,
-		rabbitMQClient:     rabbitMQClient,
+		messagesCollection:      db.Collection("messages"),
+		groupsCollection:        db.Collection("groups"),
+		usersCollection:         db.Collection("users"),
+		pollVotesCollection:     db.Collection("poll_votes"),
+		groupSettingsCollection: db.Collection("group_member_settings"),
+		starsCollection:         db.Collection("starred_messages"),
+		chatSettingsCollection:  db.Collection("chat_settings"),
+		scheduledCollection:     db.Collection("scheduled_messages"),
+		broadcastsCollection:    db.Collection("broadcast_lists"),
+		draftsCollection:        db.Collection("drafts"),
+		media:                   media,
+		previews:                previews,
+		rabbitMQClient:          rabbitMQClient,
 	}
 }
 
 // SendMessage godoc
 // @Summary      Send a message
-// @Description  Sends a message from one user to another
+// @Description  Sends a message from one user to another, to a group, or as separate 1:1 messages to the recipients of a broadcast list (the response is then a models.BroadcastResponse). The type selects the payload: text needs content, image, video, audio, voice and document need uploaded media (content is the caption), location and contact need their payload.
 // @Tags         messages
 // @Accept       json
 // @Produce      json
@@ -54,6 +75,7 @@ func NewMessageHandler(messagesCollection *mongo.Collection, groupsCollection *m
 // @Success      201      {object}  models.MessageResponse
 // @Failure      400      {object}  models.ErrorResponse
 // @Failure      401      {object}  models.ErrorResponse
+// @Failure      404      {object}  models.ErrorResponse
 // @Failure      500      {object}  models.ErrorResponse
 // @Router       /messages [post]
 func (h *MessageHandler) SendMessage(c *gin.Context) {
@@ -68,97 +90,185 @@ func (h *MessageHandler) SendMessage(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-
-	now := time.Now()
 	senderObjectID, _ := primitive.ObjectIDFromHex(senderID.(string))
 
-	var newMessage models.Message
-	newMessage.ID = primitive.NewObjectID()
-	newMessage.SenderID = senderObjectID
-	newMessage.Content = input.Content
-	newMessage.MediaURL = input.MediaURL
-	newMessage.CreatedAt = now
-	newMessage.Status = models.MessageStatusSent
+	newMessage, err := h.buildMessage(senderObjectID, input, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.BroadcastID != "" {
+		h.sendBroadcast(c, newMessage, input.BroadcastID)
+		return
+	}
+
+	response, err := h.deliverMessage(newMessage)
+	if errors.Is(err, errMediaNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save message"})
+		return
+	}
+	if newMessage.ThreadRootID.IsZero() {
+		h.clearSentDraft(newMessage)
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// buildMessage validates a message request and turns it into a new message
+// from senderID, sent at now. Errors describe what is wrong with the request.
+func (h *MessageHandler) buildMessage(senderID primitive.ObjectID, input models.MessageRequest, now time.Time) (models.Message, error) {
+	newMessage, err := h.buildContent(senderID, input, now)
+	if err != nil {
+		return newMessage, err
+	}
+
 	// Determine if this is a direct message or group message
-    log.Printf("DEBUG: SendMessage Input - GroupID: '%s', ReceiverID: '%s'", input.GroupID, input.ReceiverID)
-	
-    if input.GroupID != "" {
-		// Group Message Logic
+	log.Printf("DEBUG: SendMessage Input - GroupID: '%s', ReceiverID: '%s'", input.GroupID, input.ReceiverID)
+
+	switch {
+	case input.BroadcastID != "":
+		if input.GroupID != "" || input.ReceiverID != "" {
+			return newMessage, errors.New("broadcast_id cannot be combined with receiver_id or group_id")
+		}
+		// sendBroadcast addresses a copy to each recipient
+	case input.GroupID != "":
 		groupObjectID, err := primitive.ObjectIDFromHex(input.GroupID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
-			return
+			return newMessage, errors.New("Invalid group ID")
+		}
+		if err := h.checkGroupPoster(senderID, groupObjectID); err != nil {
+			return newMessage, err
 		}
-        log.Printf("DEBUG: Parsed GroupObjectID: %s", groupObjectID.Hex())
 		newMessage.GroupID = groupObjectID
-		
-		_, err = h.messagesCollection.InsertOne(context.Background(), newMessage)
+	case input.ReceiverID != "":
+		receiverObjectID, err := primitive.ObjectIDFromHex(input.ReceiverID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save group message"})
-			return
+			return newMessage, errors.New("Invalid receiver ID")
+		}
+		if err := h.checkDirectRecipient(receiverObjectID); err != nil {
+			return newMessage, err
 		}
+		newMessage.ReceiverID = receiverObjectID
+	default:
+		return newMessage, errors.New("Either receiver_id or group_id is required")
+	}
 
-        // Construct response with populated GroupID
-        response := models.MessageResponse{
-            ID:             newMessage.ID.Hex(),
-            SenderID:       newMessage.SenderID.Hex(),
-            SenderUsername: h.getUsername(newMessage.SenderID),
-            ReceiverID:     newMessage.ReceiverID.Hex(),
-            GroupID:        newMessage.GroupID.Hex(),
-            Content:        newMessage.Content,
-            MediaURL:       newMessage.MediaURL,
-            CreatedAt:      newMessage.CreatedAt.Format(time.RFC3339),
-            Status:         string(newMessage.Status),
-        }
+	if input.ThreadRootID != "" {
+		rootID, err := h.resolveThreadRoot(newMessage.GroupID, input.ThreadRootID)
+		if err != nil {
+			return newMessage, err
+		}
+		newMessage.ThreadRootID = rootID
+	}
 
-        log.Printf("DEBUG: Response GroupID: %s", response.GroupID)
+	return newMessage, nil
+}
 
-		// Fan-out: Publish message to all group members
-		go h.fanOutGroupMessage(response)
-        
-        c.JSON(http.StatusCreated, response)
+// buildContent validates the content of a message request and turns it into
+// a new message from senderID, sent at now, that is not addressed to anyone yet
+func (h *MessageHandler) buildContent(senderID primitive.ObjectID, input models.MessageRequest, now time.Time) (models.Message, error) {
+	var newMessage models.Message
+	newMessage.ID = primitive.NewObjectID()
+	newMessage.SenderID = senderID
+	newMessage.Content = input.Content
+	newMessage.MediaURL = input.MediaURL
+	newMessage.CreatedAt = now
 
-	} else if input.ReceiverID != "" {
-		// Direct Message Logic
-		receiverObjectID, err := primitive.ObjectIDFromHex(input.ReceiverID)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid receiver ID"})
-			return
+	media, err := h.resolveMedia(senderID, input)
+	if err != nil {
+		return newMessage, err
+	}
+	if media != nil {
+		// Uploaded media is stored by ID; download URLs expire and are signed per response
+		newMessage.MediaID = media.ID
+		newMessage.MediaURL = ""
+	}
+
+	if err := applyMessageType(&newMessage, input, media, now); err != nil {
+		return newMessage, err
+	}
+
+	newMessage.Status = models.MessageStatusSent
+	return newMessage, nil
+}
+
+// deliverMessage saves a message built by buildMessage and sends it to its recipients
+func (h *MessageHandler) deliverMessage(newMessage models.Message) (models.MessageResponse, error) {
+	ctx := context.Background()
+	if !newMessage.GroupID.IsZero() {
+		if err := h.resolveMentions(ctx, &newMessage); err != nil {
+			// The message still goes out, just without mentions
+			log.Printf("Failed to resolve mentions in message %s: %v", newMessage.ID.Hex(), err)
 		}
-		newMessage.ReceiverID = receiverObjectID
+	}
+	h.stampExpiry(ctx, &newMessage)
 
-		_, err = h.messagesCollection.InsertOne(context.Background(), newMessage)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save message"})
-			return
+	if !newMessage.MediaID.IsZero() {
+		if err := h.media.attachMedia(ctx, newMessage.MediaID, 1); err != nil {
+			return models.MessageResponse{}, err
 		}
+	}
+	if _, err := h.messagesCollection.InsertOne(ctx, newMessage); err != nil {
+		if !newMessage.MediaID.IsZero() {
+			h.media.detachMedia(ctx, map[primitive.ObjectID]int64{newMessage.MediaID: 1})
+		}
+		return models.MessageResponse{}, err
+	}
+
+	// The response carries the sender's username for the frontend
+	response := h.messageResponse(newMessage)
 
-        // Construct response with populated ReceiverID
-        response := models.MessageResponse{
-            ID:             newMessage.ID.Hex(),
-            SenderID:       newMessage.SenderID.Hex(),
-            SenderUsername: h.getUsername(newMessage.SenderID),
-            ReceiverID:     newMessage.ReceiverID.Hex(),
-            GroupID:        newMessage.GroupID.Hex(),
-            Content:        newMessage.Content,
-            MediaURL:       newMessage.MediaURL,
-            CreatedAt:      newMessage.CreatedAt.Format(time.RFC3339),
-            Status:         string(newMessage.Status),
-        }
-
-		// Use topic exchange with routing key pattern: message.{receiverId}
-		routingKey := fmt.Sprintf("message.%s", newMessage.ReceiverID.Hex())
-		// Publish the response object so frontend gets username
-		err = h.rabbitMQClient.PublishToExchange("messages", routingKey, response)
+	if !newMessage.ThreadRootID.IsZero() {
+		// Replies go to the thread, not to the group timeline
+		h.addThreadReply(ctx, newMessage, response)
+	} else if !newMessage.GroupID.IsZero() {
+		// Fan-out: Publish message to all group members
+		go h.fanOutGroupMessage(response)
+	} else {
+		h.publishDirectMessage(response)
+	}
+	go h.attachLinkPreview(newMessage)
+
+	return response, nil
+}
+
+// publishDirectMessage sends a 1:1 message to its receiver
+func (h *MessageHandler) publishDirectMessage(response models.MessageResponse) {
+	// Use topic exchange with routing key pattern: message.{receiverId}
+	routingKey := fmt.Sprintf("message.%s", response.ReceiverID)
+	if err := h.rabbitMQClient.PublishToExchange("messages", routingKey, response); err != nil {
+		_ = h.rabbitMQClient.Publish("messages", response)
+	}
+}
+
+// resolveMedia returns the uploaded media a message refers to, either by media_id
+// or by a media_url returned from an upload, or nil for none. Other URLs are
+// kept as plain links. Senders can attach their own uploads and forward media
+// they have access to.
+func (h *MessageHandler) resolveMedia(senderID primitive.ObjectID, input models.MessageRequest) (*models.Media, error) {
+	var mediaID primitive.ObjectID
+	if input.MediaID != "" {
+		id, err := primitive.ObjectIDFromHex(input.MediaID)
 		if err != nil {
-			_ = h.rabbitMQClient.Publish("messages", response)
+			return nil, errors.New("Invalid media ID")
 		}
-        
-        c.JSON(http.StatusCreated, response)
+		mediaID = id
+	} else if id, ok := models.MediaIDFromURL(input.MediaURL); ok {
+		mediaID = id
 	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Either receiver_id or group_id is required"})
-		return
+		return nil, nil
+	}
+
+	media, err := h.media.AccessibleMedia(context.Background(), mediaID, senderID)
+	if err != nil || media == nil {
+		return nil, errors.New("Media not found")
 	}
+	return media, nil
 }
 
 // fanOutGroupMessage handles the distribution of group messages
@@ -169,26 +279,38 @@ func (h *MessageHandler) fanOutGroupMessage(messageResponse models.MessageRespon
 		fmt.Printf("Invalid group ID in fan-out: %v\n", err)
 		return
 	}
-	
+
 	members, err := h.fetchGroupMembers(groupID)
 	if err != nil {
 		fmt.Printf("Failed to fetch group members for fan-out: %v\n", err)
 		return
 	}
 
+	muted, err := h.mutedMembers(context.Background(), groupID)
+	if err != nil {
+		// Better to notify too often than to lose notifications
+		log.Printf("Failed to look up muted members of group %s: %v", groupID.Hex(), err)
+	}
+	mentioned := make(map[string]bool, len(messageResponse.Mentions))
+	for _, memberID := range messageResponse.Mentions {
+		mentioned[memberID] = true
+	}
+
 	for _, memberID := range members {
 		// Don't send back to sender
 		if memberID.Hex() == messageResponse.SenderID {
 			continue
 		}
-		
+
 		// Create a copy of the response for this specific member
 		// We set ReceiverID to the memberID so the WebSocket handler knows who to route to
 		memberMessage := messageResponse
 		memberMessage.ReceiverID = memberID.Hex()
-		
+		// Mentions get through even when the group is muted
+		memberMessage.Silent = muted[memberID.Hex()] && !mentioned[memberID.Hex()]
+
 		routingKey := fmt.Sprintf("message.%s", memberID.Hex())
-		
+
 		// Publish the response (with username)
 		err := h.rabbitMQClient.PublishToExchange("messages", routingKey, memberMessage)
 		if err != nil {
@@ -197,8 +319,6 @@ func (h *MessageHandler) fanOutGroupMessage(messageResponse models.MessageRespon
 	}
 }
 
-
-
 // fetchGroupMembers retrieves member IDs for a group
 func (h *MessageHandler) fetchGroupMembers(groupID primitive.ObjectID) ([]primitive.ObjectID, error) {
 	var group models.Group
@@ -209,6 +329,52 @@ func (h *MessageHandler) fetchGroupMembers(groupID primitive.ObjectID) ([]primit
 	return group.MemberIDs, nil
 }
 
+// checkGroupPoster rejects posts to a group from anyone but its members, and
+// posts to the announcements group of a community from anyone but the
+// community's admins
+func (h *MessageHandler) checkGroupPoster(senderID, groupID primitive.ObjectID) error {
+	ctx := context.Background()
+	var group models.Group
+	if err := h.groupsCollection.FindOne(ctx, bson.M{"_id": groupID}).Decode(&group); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return errors.New("Group not found")
+		}
+		return errors.New("Failed to look up group")
+	}
+	// Same answer as for unknown groups, so that IDs cannot be probed
+	if !slices.Contains(group.MemberIDs, senderID) {
+		return errors.New("Group not found")
+	}
+	if !group.Announcements {
+		return nil
+	}
+
+	var community models.Community
+	communities := h.groupsCollection.Database().Collection("communities")
+	if err := communities.FindOne(ctx, bson.M{"_id": group.CommunityID}).Decode(&community); err != nil || !community.IsAdmin(senderID) {
+		return errors.New("Only community admins can post in the announcements group")
+	}
+	return nil
+}
+
+// checkDirectRecipient returns an error unless receiverID is an account that
+// can be messaged or called directly. Deleted accounts keep their ID but
+// cannot be reached anymore.
+func (h *MessageHandler) checkDirectRecipient(receiverID primitive.ObjectID) error {
+	count, err := h.usersCollection.CountDocuments(context.Background(), bson.M{
+		"_id":        receiverID,
+		"deleted_at": bson.M{"$exists": false},
+	})
+	if err != nil {
+		log.Printf("Failed to look up user %s: %v", receiverID.Hex(), err)
+		return errors.New("Failed to look up user")
+	}
+	if count == 0 {
+		return errors.New("User not found")
+	}
+	return nil
+}
+
 // GetMessageHistory is an alias for GetMessages to maintain compatibility with main.go
 func (h *MessageHandler) GetMessageHistory(c *gin.Context) {
 	h.GetMessages(c)
@@ -221,12 +387,13 @@ func (h *MessageHandler) GetMessageHistory(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Security     BearerAuth
-// @Param        UserID  path      string  true  "User ID to get conversation with"
+// @Param        id       path      string  true  "User or group ID to get conversation with"
 // @Param        limit    query     int     false "Limit results"
 // @Param        before   query     string  false "Get messages before this timestamp"
 // @Success      200      {array}   models.MessageResponse
 // @Failure      400      {object}  models.ErrorResponse
 // @Failure      401      {object}  models.ErrorResponse
+// @Failure      404      {object}  models.ErrorResponse
 // @Failure      500      {object}  models.ErrorResponse
 func (h *MessageHandler) GetMessages(c *gin.Context) {
 	currentUserID, exists := c.Get("UserID")
@@ -239,12 +406,12 @@ func (h *MessageHandler) GetMessages(c *gin.Context) {
 	groupID := c.Query("group_id")
 	otherUserID := c.Query("with") // Changed parameter name to be more explicit via query, or fallback to path
 
-	// Backward compatibility/Path param handling could be tricky if mixed. 
+	// Backward compatibility/Path param handling could be tricky if mixed.
 	// The original main.go probably uses /messages/:UserID
 	// Let's check how main.go defines it. It accepts :UserID.
 	// We should probably check if :UserID matches a Group ID format or if we use a query param.
 	// Or just treat it as a conversation ID.
-	
+
 	// If groupID is not explicitly set, check if 'with' param is a group
 	if groupID == "" && otherUserID != "" {
 		// Check if otherUserID is a group
@@ -257,29 +424,29 @@ func (h *MessageHandler) GetMessages(c *gin.Context) {
 			}
 		}
 	}
-    
-    paramID := c.Param("UserID")
-    
-    // Also check if the path param (UserID) is actually a group ID
-    if groupID == "" && paramID != "" {
-        oid, err := primitive.ObjectIDFromHex(paramID)
-        if err == nil {
-            count, _ := h.groupsCollection.CountDocuments(context.Background(), bson.M{"_id": oid})
-            log.Printf("DEBUG: Checked if paramID %s is group: count=%d", paramID, count)
-            if count > 0 {
-                groupID = paramID
-            }
-        }
-    } 
+
+	paramID := c.Param("id")
+
+	// Also check if the path param (UserID) is actually a group ID
+	if groupID == "" && paramID != "" {
+		oid, err := primitive.ObjectIDFromHex(paramID)
+		if err == nil {
+			count, _ := h.groupsCollection.CountDocuments(context.Background(), bson.M{"_id": oid})
+			log.Printf("DEBUG: Checked if paramID %s is group: count=%d", paramID, count)
+			if count > 0 {
+				groupID = paramID
+			}
+		}
+	}
 
 	currentUserObjectID, err := primitive.ObjectIDFromHex(currentUserID.(string))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
 		return
 	}
-    
-    // Initialize as empty slice to return [] instead of null
-    messagesResponse := []models.MessageResponse{}
+
+	// Initialize as empty slice to return [] instead of null
+	messagesResponse := []models.MessageResponse{}
 
 	limit := 50 // Default limit
 	if limitParam := c.Query("limit"); limitParam != "" {
@@ -298,11 +465,16 @@ func (h *MessageHandler) GetMessages(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
 			return
 		}
-		
+		if !h.checkGroupMember(c, groupObjectID, currentUserObjectID) {
+			return
+		}
+
+		// Thread replies are read with GetThread
 		filter = bson.M{
-			"group_id": groupObjectID,
+			"group_id":       groupObjectID,
+			"thread_root_id": bson.M{"$exists": false},
 		}
-        log.Printf("DEBUG: Filtering by group_id: %s", groupObjectID.Hex())
+		log.Printf("DEBUG: Filtering by group_id: %s", groupObjectID.Hex())
 	} else {
 		// 1:1 Messages
 		// Assuming paramID is the other user's ID
@@ -310,7 +482,7 @@ func (h *MessageHandler) GetMessages(c *gin.Context) {
 			// If not in path, maybe in query `with`
 			paramID = otherUserID
 		}
-		
+
 		if paramID == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "User ID or Group ID required"})
 			return
@@ -342,6 +514,8 @@ func (h *MessageHandler) GetMessages(c *gin.Context) {
 			filter["created_at"] = bson.M{"$lt": beforeTime}
 		}
 	}
+	// Expired messages wait for the reaper but are gone for readers
+	filter["expires_at"] = unexpired()
 
 	findOptions := options.Find().
 		SetLimit(int64(limit)).
@@ -362,36 +536,126 @@ func (h *MessageHandler) GetMessages(c *gin.Context) {
 			continue
 		}
 
-		response := models.MessageResponse{
-			ID:             msg.ID.Hex(),
-			SenderID:       msg.SenderID.Hex(),
-			SenderUsername: h.getUsername(msg.SenderID),
-			ReceiverID:     msg.ReceiverID.Hex(),
-			GroupID:        msg.GroupID.Hex(),
-			Content:        msg.Content,
-			MediaURL:       msg.MediaURL,
-			CreatedAt:      msg.CreatedAt.Format(time.RFC3339),
-			Status:         string(msg.Status),
-		}
-
-		messagesResponse = append(messagesResponse, response)
+		messagesResponse = append(messagesResponse, h.messageResponse(msg))
 	}
-    log.Printf("DEBUG: Found %d messages", len(messagesResponse))
+	log.Printf("DEBUG: Found %d messages", len(messagesResponse))
 
 	if err := cursor.Err(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cursor error"})
 		return
 	}
+	h.markStarred(ctx, currentUserObjectID, messagesResponse)
 
 	// Mark as read logic (only for 1:1 for now, group read receipts are complex)
 	if groupID == "" && paramID != "" {
 		otherUserObjectID, _ := primitive.ObjectIDFromHex(paramID) // Already checked error
 		go h.markMessagesAsRead(otherUserObjectID, currentUserObjectID)
 	}
+	// Opening a group shows its latest messages, including any mentions
+	if groupID != "" && c.Query("before") == "" {
+		groupObjectID, _ := primitive.ObjectIDFromHex(groupID) // Already checked error
+		go func() {
+			if err := h.markMentionsRead(context.Background(), groupObjectID, currentUserObjectID); err != nil {
+				log.Printf("Failed to mark mentions in group %s as read: %v", groupID, err)
+			}
+		}()
+	}
 
 	c.JSON(http.StatusOK, messagesResponse)
 }
 
+// messageResponse converts a stored message into its API representation
+func (h *MessageHandler) messageResponse(msg models.Message) models.MessageResponse {
+	mediaURL := msg.MediaURL
+	var media *models.MediaResponse
+	if !msg.MediaID.IsZero() {
+		response, err := h.media.ResponseByID(context.Background(), msg.MediaID)
+		if err != nil {
+			log.Printf("Failed to resolve media %s of message %s: %v", msg.MediaID.Hex(), msg.ID.Hex(), err)
+		} else {
+			media = &response
+			if msg.Type == "" {
+				// Sent before messages had types
+				msg.Type = mediaKindTypes[response.Kind]
+			}
+		}
+		mediaURL = response.DownloadURL
+	}
+
+	var poll *models.PollResults
+	if msg.Poll != nil && msg.DeletedAt.IsZero() {
+		results, err := h.pollResults(context.Background(), msg, primitive.NilObjectID, false)
+		if err != nil {
+			log.Printf("Failed to count votes of poll %s: %v", msg.ID.Hex(), err)
+		} else {
+			poll = &results
+		}
+	}
+
+	return models.MessageResponse{
+		ID:                msg.ID.Hex(),
+		SenderID:          msg.SenderID.Hex(),
+		SenderUsername:    h.getUsername(msg.SenderID),
+		ReceiverID:        msg.ReceiverID.Hex(),
+		GroupID:           msg.GroupID.Hex(),
+		Type:              msg.TypeOrDefault(),
+		Content:           msg.Content,
+		Preview:           msg.Preview(),
+		MediaURL:          mediaURL,
+		MediaID:           optionalIDHex(msg.MediaID),
+		Media:             media,
+		MediaInfo:         msg.MediaInfo,
+		Document:          msg.Document,
+		Location:          msg.Location,
+		Contact:           msg.Contact,
+		Poll:              poll,
+		LinkPreview:       msg.LinkPreview,
+		Mentions:          objectIDHexes(msg.Mentions),
+		MentionsAll:       msg.MentionsAll,
+		System:            msg.System,
+		Call:              msg.Call,
+		PinnedAt:          formatOptionalTime(msg.PinnedAt),
+		PinnedBy:          optionalIDHex(msg.PinnedBy),
+		ExpiresAt:         formatOptionalTime(msg.ExpiresAt),
+		ChannelID:         optionalIDHex(msg.ChannelID),
+		Reactions:         msg.ReactionCounts,
+		ThreadRootID:      optionalIDHex(msg.ThreadRootID),
+		ThreadReplyCount:  msg.ThreadReplyCount,
+		ThreadLastReplyAt: formatOptionalTime(msg.ThreadLastReplyAt),
+		CreatedAt:         msg.CreatedAt.Format(time.RFC3339),
+		Status:            string(msg.Status),
+		Deleted:           !msg.DeletedAt.IsZero(),
+	}
+}
+
+// formatOptionalTime formats t as RFC 3339, or returns "" if it is unset
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// objectIDHexes returns the hex forms of ids
+func objectIDHexes(ids []primitive.ObjectID) []string {
+	if len(ids) == 0 {
+		return nil
+	}
+	hexes := make([]string, 0, len(ids))
+	for _, id := range ids {
+		hexes = append(hexes, id.Hex())
+	}
+	return hexes
+}
+
+// optionalIDHex returns the hex form of id, or "" if it is unset
+func optionalIDHex(id primitive.ObjectID) string {
+	if id.IsZero() {
+		return ""
+	}
+	return id.Hex()
+}
+
 // Helper to get username
 func (h *MessageHandler) getUsername(senderID primitive.ObjectID) string {
 	var user struct {
@@ -503,7 +767,7 @@ func (h *MessageHandler) UpdateMessageStatus(c *gin.Context) {
 
 // SearchMessages godoc
 // @Summary      Search messages
-// @Description  Full-text search in message content (supports groups and 1:1)
+// @Description  Full-text search in message text and captions, document file names, place names and contact names (supports groups and 1:1). Each result carries a one-line preview.
 // @Tags         messages
 // @Accept       json
 // @Produce      json
@@ -514,6 +778,7 @@ func (h *MessageHandler) UpdateMessageStatus(c *gin.Context) {
 // @Success      200        {array}   models.MessageResponse
 // @Failure      400        {object}  models.ErrorResponse
 // @Failure      401        {object}  models.ErrorResponse
+// @Failure      404        {object}  models.ErrorResponse
 // @Failure      500        {object}  models.ErrorResponse
 // @Router       /messages/search [get]
 func (h *MessageHandler) SearchMessages(c *gin.Context) {
@@ -542,16 +807,22 @@ func (h *MessageHandler) SearchMessages(c *gin.Context) {
 		}
 	}
 
-	// Base filter: regex search on content
+	// Base filter: regex search on content and on the names in typed payloads
+	pattern := bson.M{
+		"$regex":   query,
+		"$options": "i", // case-insensitive
+	}
 	filter := bson.M{
-		"content": bson.M{
-			"$regex":   query,
-			"$options": "i", // case-insensitive
-		},
+		"$and": []bson.M{{"$or": []bson.M{
+			{"content": pattern},
+			{"document.filename": pattern},
+			{"location.name": pattern},
+			{"contact.display_name": pattern},
+		}}},
 	}
 
 	contactID := c.Query("contact_id")
-	
+
 	if contactID != "" {
 		// Specific Chat Search
 		contactObjectID, err := primitive.ObjectIDFromHex(contactID)
@@ -568,9 +839,9 @@ func (h *MessageHandler) SearchMessages(c *gin.Context) {
 		}
 
 		if isGroup {
-			// Filter by Group ID
-			// Security check: Ensure user is member of this group? 
-			// For search, basic check might be enough.
+			if !h.checkGroupMember(c, contactObjectID, currentUserObjectID) {
+				return
+			}
 			filter["group_id"] = contactObjectID
 		} else {
 			// Filter by 1:1 Conversation
@@ -582,7 +853,7 @@ func (h *MessageHandler) SearchMessages(c *gin.Context) {
 
 	} else {
 		// Global Search (All My Chats)
-		
+
 		// 1. Get all groups user is member of
 		// Find groups where "member_ids" contains currentUserObjectID
 		cursor, err := h.groupsCollection.Find(context.Background(), bson.M{"member_ids": currentUserObjectID})
@@ -601,13 +872,14 @@ func (h *MessageHandler) SearchMessages(c *gin.Context) {
 			{"sender_id": currentUserObjectID},
 			{"receiver_id": currentUserObjectID},
 		}
-		
+
 		if len(myGroupIDs) > 0 {
 			orConditions = append(orConditions, bson.M{"group_id": bson.M{"$in": myGroupIDs}})
 		}
-		
+
 		filter["$or"] = orConditions
 	}
+	filter["expires_at"] = unexpired()
 
 	findOptions := options.Find().
 		SetLimit(int64(limit)).
@@ -628,17 +900,65 @@ func (h *MessageHandler) SearchMessages(c *gin.Context) {
 
 	messageResponses := []models.MessageResponse{}
 	for _, message := range messages {
-		messageResponses = append(messageResponses, models.MessageResponse{
-			ID:             message.ID.Hex(),
-			SenderID:       message.SenderID.Hex(),
-			SenderUsername: h.getUsername(message.SenderID),
-			ReceiverID:     message.ReceiverID.Hex(),
-			GroupID:        message.GroupID.Hex(),
-			Content:        message.Content,
-			MediaURL:       message.MediaURL,
-			CreatedAt:      message.CreatedAt.Format(time.RFC3339),
-			Status:         string(message.Status),
-		})
+		messageResponses = append(messageResponses, h.messageResponse(message))
+	}
+	h.markStarred(context.Background(), currentUserObjectID, messageResponses)
+
+	c.JSON(http.StatusOK, messageResponses)
+}
+
+// ExportMessages godoc
+// @Summary      Export my messages
+// @Description  Returns every message the current user sent, plus the direct messages they received, oldest first
+// @Tags         messages
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}   models.MessageResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /messages/export [get]
+func (h *MessageHandler) ExportMessages(c *gin.Context) {
+	currentUserID, exists := c.Get("UserID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	currentUserObjectID, err := primitive.ObjectIDFromHex(currentUserID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	// Group messages written by other members are their data, not the caller's
+	filter := bson.M{
+		"$or": []bson.M{
+			{"sender_id": currentUserObjectID},
+			{"receiver_id": currentUserObjectID, "group_id": bson.M{"$exists": false}},
+		},
+	}
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	ctx := context.Background()
+	cursor, err := h.messagesCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	messageResponses := []models.MessageResponse{}
+	for cursor.Next(ctx) {
+		var msg models.Message
+		if err := cursor.Decode(&msg); err != nil {
+			continue
+		}
+		messageResponses = append(messageResponses, h.messageResponse(msg))
+	}
+
+	if err := cursor.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cursor error"})
+		return
 	}
 
 	c.JSON(http.StatusOK, messageResponses)
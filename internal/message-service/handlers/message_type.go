@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"whatsapp/pkg/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// maxMediaDuration bounds the duration clients may claim for audio and video
+	maxMediaDuration = 24 * time.Hour
+	// maxWaveformSamples is the most amplitude samples a voice note may carry
+	maxWaveformSamples = 128
+	// maxLiveLocation is the longest a live location may be shared for
+	maxLiveLocation = 8 * time.Hour
+	// maxVCardLength is the largest accepted contact card in bytes
+	maxVCardLength = 16 << 10
+)
+
+// mediaKindTypes maps the kind of uploaded media to the message type it is sent as by default
+var mediaKindTypes = map[string]models.MessageType{
+	models.MediaKindImage:    models.MessageTypeImage,
+	models.MediaKindVideo:    models.MessageTypeVideo,
+	models.MediaKindAudio:    models.MessageTypeAudio,
+	models.MediaKindDocument: models.MessageTypeDocument,
+}
+
+// applyMessageType validates the type and payload of a message request and sets them on msg.
+// media is the uploaded media attached to the message, if any.
+func applyMessageType(msg *models.Message, input models.MessageRequest, media *models.Media, now time.Time) error {
+	msgType := input.Type
+	if msgType == "" {
+		switch {
+		case media != nil:
+			msgType = mediaKindTypes[media.Kind]
+		case input.Location != nil:
+			msgType = models.MessageTypeLocation
+		case input.Contact != nil:
+			msgType = models.MessageTypeContact
+		case input.Poll != nil:
+			msgType = models.MessageTypePoll
+		default:
+			msgType = models.MessageTypeText
+		}
+	}
+	if !models.IsValidMessageType(msgType) {
+		return fmt.Errorf("Unknown message type %q", msgType)
+	}
+
+	// Payloads only belong to their own types
+	if input.MediaInfo != nil && msgType != models.MessageTypeVideo && msgType != models.MessageTypeAudio && msgType != models.MessageTypeVoice {
+		return fmt.Errorf("media_info is not allowed in %s messages", msgType)
+	}
+	if input.Document != nil && msgType != models.MessageTypeDocument {
+		return fmt.Errorf("document is not allowed in %s messages", msgType)
+	}
+	if input.Location != nil && msgType != models.MessageTypeLocation {
+		return fmt.Errorf("location is not allowed in %s messages", msgType)
+	}
+	if input.Contact != nil && msgType != models.MessageTypeContact {
+		return fmt.Errorf("contact is not allowed in %s messages", msgType)
+	}
+	if input.Poll != nil && msgType != models.MessageTypePoll {
+		return fmt.Errorf("poll is not allowed in %s messages", msgType)
+	}
+
+	if msgType.HasMedia() {
+		if media == nil {
+			return fmt.Errorf("%s messages need uploaded media", msgType)
+		}
+		if err := checkMediaKind(msgType, media.Kind); err != nil {
+			return err
+		}
+	} else if media != nil || (msgType != models.MessageTypeText && input.MediaURL != "") {
+		return fmt.Errorf("%s messages cannot have media", msgType)
+	}
+
+	msg.Type = msgType
+	switch msgType {
+	case models.MessageTypeText:
+		// A bare link is accepted for clients that predate uploads
+		if strings.TrimSpace(input.Content) == "" && input.MediaURL == "" {
+			return errors.New("Content is required for text messages")
+		}
+
+	case models.MessageTypeVideo, models.MessageTypeAudio, models.MessageTypeVoice:
+		if input.MediaInfo != nil {
+			info, err := validateMediaInfo(*input.MediaInfo)
+			if err != nil {
+				return err
+			}
+			msg.MediaInfo = &info
+		}
+
+	case models.MessageTypeDocument:
+		document := models.DocumentInfo{Filename: media.Filename, Size: media.Size}
+		if input.Document != nil {
+			if input.Document.Filename != "" {
+				document.Filename = sanitizeFilename(input.Document.Filename)
+			}
+			if input.Document.PageCount < 0 || input.Document.PageCount > 100000 {
+				return errors.New("Invalid page count")
+			}
+			document.PageCount = input.Document.PageCount
+		}
+		msg.Document = &document
+
+	case models.MessageTypeLocation:
+		if input.Location == nil {
+			return errors.New("location is required for location messages")
+		}
+		location, err := validateLocation(*input.Location, now)
+		if err != nil {
+			return err
+		}
+		msg.Location = &location
+
+	case models.MessageTypeContact:
+		if input.Contact == nil {
+			return errors.New("contact is required for contact messages")
+		}
+		contact, err := validateContactCard(*input.Contact)
+		if err != nil {
+			return err
+		}
+		msg.Contact = &contact
+
+	case models.MessageTypePoll:
+		if input.Poll == nil {
+			return errors.New("poll is required for poll messages")
+		}
+		poll, err := validatePoll(*input.Poll)
+		if err != nil {
+			return err
+		}
+		msg.Poll = &poll
+	}
+
+	return nil
+}
+
+// checkMediaKind reports an error if media of the given kind cannot be sent as msgType.
+// Any file can be sent as a document.
+func checkMediaKind(msgType models.MessageType, kind string) error {
+	switch msgType {
+	case models.MessageTypeImage, models.MessageTypeVideo, models.MessageTypeAudio:
+		if mediaKindTypes[kind] != msgType {
+			return fmt.Errorf("%s messages need %s media, not %s", msgType, msgType, kind)
+		}
+	case models.MessageTypeVoice:
+		if kind != models.MediaKindAudio {
+			return fmt.Errorf("voice messages need audio media, not %s", kind)
+		}
+	}
+	return nil
+}
+
+func validateMediaInfo(info models.MediaInfo) (models.MediaInfo, error) {
+	if math.IsNaN(info.Duration) || info.Duration < 0 || info.Duration > maxMediaDuration.Seconds() {
+		return info, errors.New("Invalid duration")
+	}
+	if len(info.Waveform) > maxWaveformSamples {
+		return info, fmt.Errorf("waveform may have at most %d samples", maxWaveformSamples)
+	}
+	for _, sample := range info.Waveform {
+		if sample < 0 || sample > 100 {
+			return info, errors.New("waveform samples must be between 0 and 100")
+		}
+	}
+	return info, nil
+}
+
+func validateLocation(location models.Location, now time.Time) (models.Location, error) {
+	if math.IsNaN(location.Latitude) || location.Latitude < -90 || location.Latitude > 90 ||
+		math.IsNaN(location.Longitude) || location.Longitude < -180 || location.Longitude > 180 {
+		return location, errors.New("Invalid coordinates")
+	}
+
+	location.Name = strings.TrimSpace(location.Name)
+	location.Address = strings.TrimSpace(location.Address)
+	if utf8.RuneCountInString(location.Name) > 256 || utf8.RuneCountInString(location.Address) > 512 {
+		return location, errors.New("Location name or address too long")
+	}
+
+	if location.LiveUntil != nil {
+		if !location.LiveUntil.After(now) || location.LiveUntil.After(now.Add(maxLiveLocation)) {
+			return location, fmt.Errorf("live_until must be within the next %d hours", int(maxLiveLocation.Hours()))
+		}
+		liveUntil := location.LiveUntil.UTC()
+		location.LiveUntil = &liveUntil
+	}
+
+	return location, nil
+}
+
+func validateContactCard(card models.ContactCard) (models.ContactCard, error) {
+	card.VCard = strings.TrimSpace(card.VCard)
+	if card.VCard == "" {
+		return card, errors.New("vcard is required")
+	}
+	if len(card.VCard) > maxVCardLength {
+		return card, fmt.Errorf("vcard may be at most %d KB", maxVCardLength>>10)
+	}
+
+	upper := strings.ToUpper(card.VCard)
+	if !strings.HasPrefix(upper, "BEGIN:VCARD") || !strings.Contains(upper, "END:VCARD") {
+		return card, errors.New("vcard must be a vCard (BEGIN:VCARD ... END:VCARD)")
+	}
+
+	card.DisplayName = strings.TrimSpace(card.DisplayName)
+	if card.DisplayName == "" {
+		card.DisplayName = vCardFormattedName(card.VCard)
+	}
+	if card.DisplayName == "" {
+		return card, errors.New("Contact card needs a display_name or an FN property")
+	}
+	if utf8.RuneCountInString(card.DisplayName) > 256 {
+		return card, errors.New("display_name too long")
+	}
+
+	return card, nil
+}
+
+// vCardFormattedName returns the FN property of a vCard, e.g. "FN;CHARSET=UTF-8:Jane Doe"
+func vCardFormattedName(vcard string) string {
+	for _, line := range strings.Split(strings.ReplaceAll(vcard, "\r\n", "\n"), "\n") {
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		property, _, _ := strings.Cut(name, ";")
+		if strings.EqualFold(strings.TrimSpace(property), "FN") {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// BackfillMessageTypes sets the type of messages with uploaded media that were
+// sent before messages had types, so that previews name the right kind
+func (h *MessageHandler) BackfillMessageTypes(ctx context.Context) error {
+	cursor, err := h.messagesCollection.Find(ctx,
+		bson.M{"type": bson.M{"$exists": false}, "media_id": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"media_id": 1}),
+	)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	kinds := make(map[primitive.ObjectID]string)
+	for cursor.Next(ctx) {
+		var msg models.Message
+		if err := cursor.Decode(&msg); err != nil {
+			return err
+		}
+
+		kind, ok := kinds[msg.MediaID]
+		if !ok {
+			var media models.Media
+			if err := h.media.mediaCollection.FindOne(ctx, bson.M{"_id": msg.MediaID}).Decode(&media); err != nil && err != mongo.ErrNoDocuments {
+				return err
+			}
+			kind = media.Kind
+			kinds[msg.MediaID] = kind
+		}
+
+		msgType, ok := mediaKindTypes[kind]
+		if !ok {
+			continue
+		}
+		if _, err := h.messagesCollection.UpdateOne(ctx, bson.M{"_id": msg.ID}, bson.M{"$set": bson.M{"type": msgType}}); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
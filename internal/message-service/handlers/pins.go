@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxPinnedMessages is the most messages a chat can have pinned at once
+const maxPinnedMessages = 3
+
+// EnsurePinIndexes creates the indexes for listing the pinned messages of group and direct chats
+func (h *MessageHandler) EnsurePinIndexes(ctx context.Context) error {
+	pinned := options.Index().SetPartialFilterExpression(bson.M{"pinned_at": bson.M{"$exists": true}})
+	_, err := h.messagesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "group_id", Value: 1}, {Key: "pinned_at", Value: -1}}, Options: pinned},
+		{Keys: bson.D{{Key: "sender_id", Value: 1}, {Key: "receiver_id", Value: 1}, {Key: "pinned_at", Value: -1}}, Options: pinned},
+	})
+	return err
+}
+
+// PinMessage godoc
+// @Summary      Pin a message
+// @Description  Pins a message in its chat, for everyone in it. A chat can have up to 3 pinned messages, and groups can restrict pinning to admins. Participants get a system message and a pins_updated event.
+// @Tags         messages
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      string  true  "Message ID"
+// @Success      200  {array}   models.MessageResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      409  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /messages/{id}/pin [put]
+func (h *MessageHandler) PinMessage(c *gin.Context) {
+	h.setPinned(c, true)
+}
+
+// UnpinMessage godoc
+// @Summary      Unpin a message
+// @Description  Unpins a message in its chat, for everyone in it. Participants get a system message and a pins_updated event.
+// @Tags         messages
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      string  true  "Message ID"
+// @Success      200  {array}   models.MessageResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /messages/{id}/pin [delete]
+func (h *MessageHandler) UnpinMessage(c *gin.Context) {
+	h.setPinned(c, false)
+}
+
+// setPinned pins or unpins the message in the :id path parameter and
+// responds with the pinned messages of its chat
+func (h *MessageHandler) setPinned(c *gin.Context, pin bool) {
+	msg, userID, ok := h.loadChatMessage(c)
+	if !ok {
+		return
+	}
+	if !msg.DeletedAt.IsZero() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if msg.Type == models.MessageTypeSystem {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "System messages cannot be pinned"})
+		return
+	}
+
+	ctx := context.Background()
+	if !msg.GroupID.IsZero() {
+		var group models.Group
+		if err := h.groupsCollection.FindOne(ctx, bson.M{"_id": msg.GroupID}).Decode(&group); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if group.OnlyAdminsCanPin && !group.IsAdmin(userID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only group admins can pin messages"})
+			return
+		}
+	}
+
+	var result *mongo.UpdateResult
+	var err error
+	if pin {
+		if msg.PinnedAt == nil {
+			reserved, err := h.reservePin(ctx, msg)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return
+			}
+			if !reserved {
+				c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("A chat can have at most %d pinned messages; unpin one first", maxPinnedMessages)})
+				return
+			}
+		}
+		result, err = h.messagesCollection.UpdateOne(ctx,
+			bson.M{"_id": msg.ID, "pinned_at": bson.M{"$exists": false}, "deleted_at": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"pinned_at": time.Now(), "pinned_by": userID}},
+		)
+		// The slot goes back if the message was pinned or deleted meanwhile
+		if msg.PinnedAt == nil && (err != nil || result.ModifiedCount == 0) {
+			releasePins(ctx, h.chatSettingsCollection, map[string]int64{chatKey(msg): 1})
+		}
+	} else {
+		result, err = h.messagesCollection.UpdateOne(ctx,
+			bson.M{"_id": msg.ID, "pinned_at": bson.M{"$exists": true}, "deleted_at": bson.M{"$exists": false}},
+			bson.M{"$unset": bson.M{"pinned_at": "", "pinned_by": ""}},
+		)
+		if err == nil && result.ModifiedCount > 0 {
+			releasePins(ctx, h.chatSettingsCollection, map[string]int64{chatKey(msg): 1})
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update message"})
+		return
+	}
+
+	pinned, err := h.pinnedMessages(ctx, msg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Only announce actual changes, not repeated requests
+	if result.ModifiedCount > 0 {
+		action := models.SystemActionUnpinned
+		if pin {
+			action = models.SystemActionPinned
+		}
+		go h.announcePinChange(msg, userID, action, pinned)
+	}
+
+	c.JSON(http.StatusOK, pinned)
+}
+
+// GetPinnedMessages godoc
+// @Summary      List pinned messages
+// @Description  Lists the pinned messages of a group or direct chat, most recently pinned first
+// @Tags         messages
+// @Produce      json
+// @Security     BearerAuth
+// @Param        chat_id  query     string  true  "Group ID, or the ID of the other user of a direct chat"
+// @Success      200      {array}   models.MessageResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      401      {object}  models.ErrorResponse
+// @Failure      404      {object}  models.ErrorResponse
+// @Failure      500      {object}  models.ErrorResponse
+// @Router       /messages/pinned [get]
+func (h *MessageHandler) GetPinnedMessages(c *gin.Context) {
+	chat, userID, ok := h.loadChat(c, c.Query("chat_id"))
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	pinned, err := h.pinnedMessages(ctx, chat)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	h.markStarred(ctx, userID, pinned)
+	c.JSON(http.StatusOK, pinned)
+}
+
+// reservePin takes one of the pin slots of the chat msg belongs to. It
+// returns false if the chat has no slot left: the guarded increment then
+// doesn't match, and the upsert collides with the existing settings.
+func (h *MessageHandler) reservePin(ctx context.Context, msg models.Message) (bool, error) {
+	_, err := h.chatSettingsCollection.UpdateOne(ctx,
+		bson.M{"_id": chatKey(msg), "pinned_count": bson.M{"$lt": maxPinnedMessages}},
+		bson.M{"$inc": bson.M{"pinned_count": 1}, "$setOnInsert": chatSettingsDefaults(msg, "pinned_count")},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// releasePins gives back the pin slots of messages that were unpinned or
+// deleted, keyed by chat
+func releasePins(ctx context.Context, chatSettingsCollection *mongo.Collection, pins map[string]int64) {
+	for key, count := range pins {
+		if _, err := chatSettingsCollection.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$inc": bson.M{"pinned_count": -count}}); err != nil {
+			log.Printf("Failed to release %d pins of chat %s: %v", count, key, err)
+		}
+	}
+}
+
+// pinnedPerChat counts the messages that hold a pin slot, keyed by chat
+func pinnedPerChat(messages []models.Message) map[string]int64 {
+	pins := make(map[string]int64)
+	for _, msg := range messages {
+		if msg.PinnedAt != nil && msg.DeletedAt.IsZero() {
+			pins[chatKey(msg)]++
+		}
+	}
+	return pins
+}
+
+// InitPinCounts counts the pinned messages of chats whose settings have no
+// pin counter yet, which are chats from before pins were counted. Like
+// InitMediaRefs it has to finish before the service starts serving.
+func (h *MessageHandler) InitPinCounts(ctx context.Context) error {
+	// Once every chat with settings counts its pins, chats with pins have settings
+	uncounted, err := h.chatSettingsCollection.CountDocuments(ctx, bson.M{"pinned_count": bson.M{"$exists": false}}, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	counted, err := h.chatSettingsCollection.CountDocuments(ctx, bson.M{"pinned_count": bson.M{"$exists": true}}, options.Count().SetLimit(1))
+	if err != nil || (uncounted == 0 && counted > 0) {
+		return err
+	}
+
+	cursor, err := h.messagesCollection.Find(ctx,
+		bson.M{"pinned_at": bson.M{"$exists": true}, "deleted_at": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"group_id": 1, "sender_id": 1, "receiver_id": 1, "pinned_at": 1}),
+	)
+	if err != nil {
+		return err
+	}
+	var messages []models.Message
+	if err := cursor.All(ctx, &messages); err != nil {
+		return err
+	}
+
+	chats := make(map[string]models.Message)
+	for _, msg := range messages {
+		chats[chatKey(msg)] = msg
+	}
+	chatsCounted := 0
+	for key, count := range pinnedPerChat(messages) {
+		result, err := h.chatSettingsCollection.UpdateOne(ctx,
+			bson.M{"_id": key, "pinned_count": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"pinned_count": count}, "$setOnInsert": chatSettingsDefaults(chats[key], "pinned_count")},
+			options.Update().SetUpsert(true),
+		)
+		// A duplicate means the chat already counts its pins
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+		if err == nil && (result.ModifiedCount > 0 || result.UpsertedCount > 0) {
+			chatsCounted++
+		}
+	}
+
+	result, err := h.chatSettingsCollection.UpdateMany(ctx,
+		bson.M{"pinned_count": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"pinned_count": 0}},
+	)
+	if err != nil {
+		return err
+	}
+	log.Printf("Counted pins of %d chats", chatsCounted+int(result.ModifiedCount))
+	return nil
+}
+
+// pinnedFilter matches the pinned messages of the chat msg belongs to
+func pinnedFilter(msg models.Message) bson.M {
+	filter := bson.M{
+		"pinned_at":  bson.M{"$exists": true},
+		"deleted_at": bson.M{"$exists": false},
+	}
+	if !msg.GroupID.IsZero() {
+		filter["group_id"] = msg.GroupID
+	} else {
+		filter["$or"] = []bson.M{
+			{"sender_id": msg.SenderID, "receiver_id": msg.ReceiverID},
+			{"sender_id": msg.ReceiverID, "receiver_id": msg.SenderID},
+		}
+	}
+	return filter
+}
+
+// pinnedMessages returns the pinned messages of the chat msg belongs to, most recently pinned first
+func (h *MessageHandler) pinnedMessages(ctx context.Context, msg models.Message) ([]models.MessageResponse, error) {
+	cursor, err := h.messagesCollection.Find(ctx, pinnedFilter(msg), options.Find().SetSort(bson.D{{Key: "pinned_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	var messages []models.Message
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+
+	pinned := []models.MessageResponse{}
+	for _, message := range messages {
+		pinned = append(pinned, h.messageResponse(message))
+	}
+	return pinned, nil
+}
+
+// announcePinChange records a pin change as a system message in the chat and
+// sends the chat's new pinned messages to everyone in it
+func (h *MessageHandler) announcePinChange(msg models.Message, actorID primitive.ObjectID, action string, pinned []models.MessageResponse) {
+	h.postSystemMessage(msg, actorID, models.SystemMessage{Action: action, MessageID: msg.ID})
+
+	update := models.PinsUpdate{
+		Action:    action,
+		MessageID: msg.ID.Hex(),
+		ActorID:   actorID.Hex(),
+		Pinned:    pinned,
+	}
+	if !msg.GroupID.IsZero() {
+		update.GroupID = msg.GroupID.Hex()
+	} else {
+		update.UserIDs = []string{msg.SenderID.Hex(), msg.ReceiverID.Hex()}
+	}
+	h.publishChatEvent(msg, models.EventPinsUpdated, update)
+}
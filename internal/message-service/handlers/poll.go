@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maxPollOptions        = 12
+	maxPollQuestionLength = 300
+	maxPollOptionLength   = 100
+)
+
+// EnsurePollIndexes creates the index that allows one vote per user and poll
+func (h *MessageHandler) EnsurePollIndexes(ctx context.Context) error {
+	_, err := h.pollVotesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "message_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// validatePoll checks a poll request and numbers its options
+func validatePoll(input models.PollRequest) (models.Poll, error) {
+	poll := models.Poll{
+		Question:       strings.TrimSpace(input.Question),
+		MultipleChoice: input.MultipleChoice,
+		Anonymous:      input.Anonymous,
+	}
+
+	if poll.Question == "" {
+		return poll, errors.New("Poll question is required")
+	}
+	if utf8.RuneCountInString(poll.Question) > maxPollQuestionLength {
+		return poll, fmt.Errorf("Poll question may be at most %d characters", maxPollQuestionLength)
+	}
+	if len(input.Options) < 2 || len(input.Options) > maxPollOptions {
+		return poll, fmt.Errorf("Polls need between 2 and %d options", maxPollOptions)
+	}
+
+	seen := make(map[string]bool)
+	for i, text := range input.Options {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return poll, errors.New("Poll options cannot be empty")
+		}
+		if utf8.RuneCountInString(text) > maxPollOptionLength {
+			return poll, fmt.Errorf("Poll options may be at most %d characters", maxPollOptionLength)
+		}
+		if seen[strings.ToLower(text)] {
+			return poll, errors.New("Poll options must be unique")
+		}
+		seen[strings.ToLower(text)] = true
+		poll.Options = append(poll.Options, models.PollOption{ID: i, Text: text})
+	}
+
+	return poll, nil
+}
+
+// Vote godoc
+// @Summary      Vote in a poll
+// @Description  Replaces the caller's vote in a poll message with the given options; an empty list retracts the vote. Single-choice polls accept one option. The new tally is pushed to the chat as a poll_updated event.
+// @Tags         messages
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path      string                  true  "Message ID of the poll"
+// @Param        vote  body      models.PollVoteRequest  true  "Chosen options"
+// @Success      200   {object}  models.PollResults
+// @Failure      400   {object}  models.ErrorResponse
+// @Failure      401   {object}  models.ErrorResponse
+// @Failure      404   {object}  models.ErrorResponse
+// @Failure      500   {object}  models.ErrorResponse
+// @Router       /messages/{id}/vote [put]
+func (h *MessageHandler) Vote(c *gin.Context) {
+	var input models.PollVoteRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	msg, userID, ok := h.loadChatMessage(c)
+	if !ok {
+		return
+	}
+	if msg.Poll == nil || !msg.DeletedAt.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Message is not a poll"})
+		return
+	}
+
+	chosen := make(map[int]bool)
+	for _, optionID := range input.OptionIDs {
+		if optionID < 0 || optionID >= len(msg.Poll.Options) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown option %d", optionID)})
+			return
+		}
+		if chosen[optionID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Options must be unique"})
+			return
+		}
+		chosen[optionID] = true
+	}
+	if !msg.Poll.MultipleChoice && len(input.OptionIDs) > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This poll allows only one option"})
+		return
+	}
+
+	ctx := context.Background()
+	filter := bson.M{"message_id": msg.ID, "user_id": userID}
+
+	var err error
+	if len(input.OptionIDs) == 0 {
+		_, err = h.pollVotesCollection.DeleteOne(ctx, filter)
+	} else {
+		now := time.Now()
+		_, err = h.pollVotesCollection.UpdateOne(ctx, filter,
+			bson.M{
+				"$set":         bson.M{"option_ids": input.OptionIDs, "updated_at": now},
+				"$setOnInsert": bson.M{"created_at": now},
+			},
+			options.Update().SetUpsert(true),
+		)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save vote"})
+		return
+	}
+
+	results, err := h.pollResults(ctx, msg, userID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count votes"})
+		return
+	}
+
+	go h.publishPollUpdate(msg, results)
+
+	c.JSON(http.StatusOK, results)
+}
+
+// GetPollResults godoc
+// @Summary      Get poll results
+// @Description  Returns the tally of a poll message and the caller's vote. Unless the poll is anonymous, each option lists who voted for it.
+// @Tags         messages
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      string  true  "Message ID of the poll"
+// @Success      200  {object}  models.PollResults
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /messages/{id}/poll [get]
+func (h *MessageHandler) GetPollResults(c *gin.Context) {
+	msg, userID, ok := h.loadChatMessage(c)
+	if !ok {
+		return
+	}
+	if msg.Poll == nil || !msg.DeletedAt.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Message is not a poll"})
+		return
+	}
+
+	results, err := h.pollResults(context.Background(), msg, userID, !msg.Poll.Anonymous)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count votes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// pollResults tallies the votes of a poll message. The vote of viewerID is
+// included unless it is the nil ID, and voters are listed if withVoters is set.
+func (h *MessageHandler) pollResults(ctx context.Context, msg models.Message, viewerID primitive.ObjectID, withVoters bool) (models.PollResults, error) {
+	results := models.PollResults{
+		MessageID:      msg.ID.Hex(),
+		Question:       msg.Poll.Question,
+		MultipleChoice: msg.Poll.MultipleChoice,
+		Anonymous:      msg.Poll.Anonymous,
+	}
+
+	cursor, err := h.pollVotesCollection.Find(ctx, bson.M{"message_id": msg.ID}, options.Find().SetSort(bson.D{{Key: "updated_at", Value: 1}}))
+	if err != nil {
+		return results, err
+	}
+	var votes []models.PollVote
+	if err := cursor.All(ctx, &votes); err != nil {
+		return results, err
+	}
+
+	var usernames map[primitive.ObjectID]string
+	if withVoters {
+		if usernames, err = h.usernames(ctx, votes); err != nil {
+			return results, err
+		}
+	}
+
+	for _, option := range msg.Poll.Options {
+		results.Options = append(results.Options, models.PollOptionResults{ID: option.ID, Text: option.Text})
+	}
+	for _, vote := range votes {
+		if len(vote.OptionIDs) == 0 {
+			continue
+		}
+		results.TotalVoters++
+		if vote.UserID == viewerID {
+			results.MyVote = vote.OptionIDs
+		}
+		for _, optionID := range vote.OptionIDs {
+			if optionID < 0 || optionID >= len(results.Options) {
+				continue
+			}
+			option := &results.Options[optionID]
+			option.Votes++
+			if withVoters {
+				option.Voters = append(option.Voters, models.PollVoter{
+					UserID:   vote.UserID.Hex(),
+					Username: usernames[vote.UserID],
+				})
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// usernames looks up the usernames of the voters in votes
+func (h *MessageHandler) usernames(ctx context.Context, votes []models.PollVote) (map[primitive.ObjectID]string, error) {
+	ids := make([]primitive.ObjectID, 0, len(votes))
+	for _, vote := range votes {
+		ids = append(ids, vote.UserID)
+	}
+	return h.usernamesByID(ctx, ids)
+}
+
+// usernamesByID looks up the usernames of userIDs in one query
+func (h *MessageHandler) usernamesByID(ctx context.Context, userIDs []primitive.ObjectID) (map[primitive.ObjectID]string, error) {
+	usernames := make(map[primitive.ObjectID]string)
+	if len(userIDs) == 0 {
+		return usernames, nil
+	}
+
+	cursor, err := h.usersCollection.Find(ctx, bson.M{"_id": bson.M{"$in": userIDs}}, options.Find().SetProjection(bson.M{"username": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var users []struct {
+		ID       primitive.ObjectID `bson:"_id"`
+		Username string             `bson:"username"`
+	}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		usernames[user.ID] = user.Username
+	}
+	return usernames, nil
+}
+
+// publishPollUpdate sends the new tally of a poll to everyone in its chat
+func (h *MessageHandler) publishPollUpdate(msg models.Message, results models.PollResults) {
+	recipientIDs, err := h.chatParticipants(msg)
+	if err != nil {
+		log.Printf("Failed to look up participants of poll %s: %v", msg.ID.Hex(), err)
+		return
+	}
+
+	// The caller's own vote is not meant for everyone
+	results.MyVote = nil
+	event := models.NewEvent(models.EventPollUpdated, recipientIDs, results)
+	if err := h.rabbitMQClient.PublishToExchange("messages", models.EventRoutingKey(event.Type), event); err != nil {
+		log.Printf("Failed to publish poll update for %s: %v", msg.ID.Hex(), err)
+	}
+}
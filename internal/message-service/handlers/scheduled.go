@@ -0,0 +1,590 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// maxScheduleAhead is how far in the future a message can be scheduled
+	maxScheduleAhead = 365 * 24 * time.Hour
+	// maxScheduledPerUser is the most unsent scheduled messages a user can have
+	maxScheduledPerUser = 100
+	// scheduleLease is how long a scheduler owns a claimed message before
+	// another replica may take it over
+	scheduleLease = 2 * time.Minute
+	// maxScheduleAttempts is how often sending a scheduled message is tried
+	maxScheduleAttempts = 5
+	// sentScheduledTTL is how long sent scheduled messages stay listed
+	sentScheduledTTL = 7 * 24 * time.Hour
+)
+
+// localTimeLayouts are the accepted formats of local_time
+var localTimeLayouts = []string{"2006-01-02T15:04", "2006-01-02T15:04:05"}
+
+// unsentStatuses are the statuses of scheduled messages that still hold a place in the queue
+var unsentStatuses = []models.ScheduledStatus{models.ScheduledStatusPending, models.ScheduledStatusSending}
+
+// EnsureScheduledIndexes creates the indexes the scheduler and the scheduled message listing use
+func (h *MessageHandler) EnsureScheduledIndexes(ctx context.Context) error {
+	_, err := h.scheduledCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "send_at", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "lease_until", Value: 1}}},
+		{Keys: bson.D{{Key: "sender_id", Value: 1}, {Key: "send_at", Value: 1}}},
+		{Keys: bson.D{{Key: "media_id", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{
+			Keys:    bson.D{{Key: "sent_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(sentScheduledTTL.Seconds())),
+		},
+	})
+	return err
+}
+
+// ScheduleMessage godoc
+// @Summary      Schedule a message
+// @Description  Queues a message to be sent later. The time is either send_at with an offset, or local_time with a timezone, such as 9am in a colleague's timezone. It must be in the future and at most a year ahead. The message is checked now and sent like any other message when it is due; the sender gets a scheduled_message_updated event once it was sent or failed.
+// @Tags         messages
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        message  body      models.ScheduledMessageRequest  true  "Message and when to send it"
+// @Success      201      {object}  models.ScheduledMessageResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      401      {object}  models.ErrorResponse
+// @Failure      409      {object}  models.ErrorResponse
+// @Failure      500      {object}  models.ErrorResponse
+// @Router       /messages/scheduled [post]
+func (h *MessageHandler) ScheduleMessage(c *gin.Context) {
+	var input models.ScheduledMessageRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	if input.Message == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "message is required"})
+		return
+	}
+	if input.Message.BroadcastID != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Broadcasts cannot be scheduled"})
+		return
+	}
+
+	now := time.Now()
+	sendAt, timezone, err := parseSendAt(input, now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	msg, err := h.buildMessage(userID, *input.Message, now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	count, err := h.scheduledCollection.CountDocuments(ctx, bson.M{
+		"sender_id": userID,
+		"status":    bson.M{"$in": unsentStatuses},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if count >= maxScheduledPerUser {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("You can have at most %d scheduled messages", maxScheduledPerUser)})
+		return
+	}
+
+	scheduled := models.ScheduledMessage{
+		ID:        primitive.NewObjectID(),
+		SenderID:  userID,
+		Message:   *input.Message,
+		MessageID: primitive.NewObjectID(),
+		MediaID:   msg.MediaID,
+		SendAt:    sendAt,
+		Timezone:  timezone,
+		Status:    models.ScheduledStatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	// The scheduled message holds on to its media until it is sent
+	if !scheduled.MediaID.IsZero() {
+		if err := h.media.attachMedia(ctx, scheduled.MediaID, 1); err != nil {
+			if errors.Is(err, errMediaNotFound) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule message"})
+			}
+			return
+		}
+	}
+	if _, err := h.scheduledCollection.InsertOne(ctx, scheduled); err != nil {
+		h.detachScheduledMedia(ctx, scheduled.MediaID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule message"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, scheduledMessageResponse(scheduled))
+}
+
+// GetScheduledMessages godoc
+// @Summary      List scheduled messages
+// @Description  Lists the current user's scheduled messages that are waiting, failed or were sent in the last 7 days, soonest first
+// @Tags         messages
+// @Produce      json
+// @Security     BearerAuth
+// @Param        status  query     string  false  "Only messages with this status: pending, sending, sent or failed"
+// @Success      200     {array}   models.ScheduledMessageResponse
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      401     {object}  models.ErrorResponse
+// @Failure      500     {object}  models.ErrorResponse
+// @Router       /messages/scheduled [get]
+func (h *MessageHandler) GetScheduledMessages(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	filter := bson.M{"sender_id": userID}
+	if status := models.ScheduledStatus(c.Query("status")); status != "" {
+		switch status {
+		case models.ScheduledStatusPending, models.ScheduledStatusSending, models.ScheduledStatusSent, models.ScheduledStatusFailed:
+			filter["status"] = status
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+			return
+		}
+	}
+
+	ctx := context.Background()
+	cursor, err := h.scheduledCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "send_at", Value: 1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var scheduled []models.ScheduledMessage
+	if err := cursor.All(ctx, &scheduled); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	responses := []models.ScheduledMessageResponse{}
+	for _, s := range scheduled {
+		responses = append(responses, scheduledMessageResponse(s))
+	}
+	c.JSON(http.StatusOK, responses)
+}
+
+// UpdateScheduledMessage godoc
+// @Summary      Edit a scheduled message
+// @Description  Changes the message, the time, or both, of a scheduled message that has not been sent yet. Fields left out keep their value; a new time is given like when scheduling.
+// @Tags         messages
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id       path      string                          true  "Scheduled message ID"
+// @Param        message  body      models.ScheduledMessageRequest  true  "New message and/or time"
+// @Success      200      {object}  models.ScheduledMessageResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      401      {object}  models.ErrorResponse
+// @Failure      404      {object}  models.ErrorResponse
+// @Failure      409      {object}  models.ErrorResponse
+// @Failure      500      {object}  models.ErrorResponse
+// @Router       /messages/scheduled/{id} [patch]
+func (h *MessageHandler) UpdateScheduledMessage(c *gin.Context) {
+	var input models.ScheduledMessageRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scheduled message ID"})
+		return
+	}
+
+	now := time.Now()
+	set := bson.M{"updated_at": now}
+	if input.SendAt != "" || input.LocalTime != "" {
+		sendAt, timezone, err := parseSendAt(input, now)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		set["send_at"] = sendAt
+		set["timezone"] = timezone
+	}
+	unset := bson.M{}
+	var mediaID primitive.ObjectID
+	if input.Message != nil {
+		if input.Message.BroadcastID != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Broadcasts cannot be scheduled"})
+			return
+		}
+		msg, err := h.buildMessage(userID, *input.Message, now)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		set["message"] = *input.Message
+		mediaID = msg.MediaID
+		if msg.MediaID.IsZero() {
+			unset["media_id"] = ""
+		} else {
+			set["media_id"] = msg.MediaID
+		}
+	}
+	if len(set) == 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to change; give a message or a new time"})
+		return
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	ctx := context.Background()
+	if !mediaID.IsZero() {
+		if err := h.media.attachMedia(ctx, mediaID, 1); err != nil {
+			if errors.Is(err, errMediaNotFound) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scheduled message"})
+			}
+			return
+		}
+	}
+
+	// Only pending messages can change; a claimed one may already be on its way
+	var previous models.ScheduledMessage
+	err = h.scheduledCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "sender_id": userID, "status": models.ScheduledStatusPending},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&previous)
+	if err != nil {
+		h.detachScheduledMedia(ctx, mediaID)
+		if err == mongo.ErrNoDocuments {
+			h.respondNotPending(c, id, userID)
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scheduled message"})
+		}
+		return
+	}
+	if input.Message != nil {
+		h.detachScheduledMedia(ctx, previous.MediaID)
+	}
+
+	var scheduled models.ScheduledMessage
+	if err := h.scheduledCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&scheduled); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, scheduledMessageResponse(scheduled))
+}
+
+// CancelScheduledMessage godoc
+// @Summary      Cancel a scheduled message
+// @Description  Deletes a scheduled message that has not been sent yet, or one that failed
+// @Tags         messages
+// @Security     BearerAuth
+// @Param        id   path  string  true  "Scheduled message ID"
+// @Success      204
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      409  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /messages/scheduled/{id} [delete]
+func (h *MessageHandler) CancelScheduledMessage(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scheduled message ID"})
+		return
+	}
+
+	ctx := context.Background()
+	var scheduled models.ScheduledMessage
+	err = h.scheduledCollection.FindOneAndDelete(ctx, bson.M{
+		"_id":       id,
+		"sender_id": userID,
+		"status":    bson.M{"$in": []models.ScheduledStatus{models.ScheduledStatusPending, models.ScheduledStatusFailed}},
+	}).Decode(&scheduled)
+	if err == mongo.ErrNoDocuments {
+		h.respondNotPending(c, id, userID)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel scheduled message"})
+		return
+	}
+	// Failed messages gave their media back already
+	if scheduled.Status == models.ScheduledStatusPending {
+		h.detachScheduledMedia(ctx, scheduled.MediaID)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// detachScheduledMedia gives back the reference a scheduled message held on its media, if any
+func (h *MessageHandler) detachScheduledMedia(ctx context.Context, mediaID primitive.ObjectID) {
+	if !mediaID.IsZero() {
+		h.media.detachMedia(ctx, map[primitive.ObjectID]int64{mediaID: 1})
+	}
+}
+
+// respondNotPending explains why a scheduled message of userID could not be changed
+func (h *MessageHandler) respondNotPending(c *gin.Context, id, userID primitive.ObjectID) {
+	var scheduled models.ScheduledMessage
+	err := h.scheduledCollection.FindOne(context.Background(), bson.M{"_id": id, "sender_id": userID}).Decode(&scheduled)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scheduled message not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Scheduled message is already %s", scheduled.Status)})
+}
+
+// parseSendAt returns when a scheduled message is due and the timezone it was given in
+func parseSendAt(input models.ScheduledMessageRequest, now time.Time) (time.Time, string, error) {
+	var sendAt time.Time
+	switch {
+	case input.SendAt != "" && input.LocalTime != "":
+		return time.Time{}, "", errors.New("Give either send_at or local_time, not both")
+	case input.SendAt != "":
+		t, err := time.Parse(time.RFC3339, input.SendAt)
+		if err != nil {
+			return time.Time{}, "", errors.New("Invalid send_at; use RFC 3339, such as 2023-08-02T09:00:00+03:00")
+		}
+		sendAt = t
+	case input.LocalTime != "":
+		// "Local" would be the server's zone, which means nothing to the sender
+		if input.Timezone == "" || input.Timezone == "Local" {
+			return time.Time{}, "", errors.New("timezone is required with local_time")
+		}
+		location, err := time.LoadLocation(input.Timezone)
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("Unknown timezone %q", input.Timezone)
+		}
+		var parseErr error
+		for _, layout := range localTimeLayouts {
+			if sendAt, parseErr = time.ParseInLocation(layout, input.LocalTime, location); parseErr == nil {
+				break
+			}
+		}
+		if parseErr != nil {
+			return time.Time{}, "", errors.New("Invalid local_time; use 2006-01-02T15:04")
+		}
+	default:
+		return time.Time{}, "", errors.New("send_at or local_time is required")
+	}
+
+	if !sendAt.After(now) {
+		return time.Time{}, "", errors.New("The time to send at must be in the future")
+	}
+	if sendAt.After(now.Add(maxScheduleAhead)) {
+		return time.Time{}, "", errors.New("Messages can be scheduled at most a year ahead")
+	}
+
+	timezone := input.Timezone
+	if input.SendAt != "" {
+		timezone = ""
+	}
+	return sendAt.UTC(), timezone, nil
+}
+
+func scheduledMessageResponse(s models.ScheduledMessage) models.ScheduledMessageResponse {
+	response := models.ScheduledMessageResponse{
+		ID:        s.ID.Hex(),
+		Message:   s.Message,
+		SendAt:    s.SendAt.Format(time.RFC3339),
+		Timezone:  s.Timezone,
+		Status:    s.Status,
+		Error:     s.Error,
+		SentAt:    formatOptionalTime(s.SentAt),
+		CreatedAt: s.CreatedAt.Format(time.RFC3339),
+	}
+	if s.Status == models.ScheduledStatusSent {
+		response.MessageID = s.MessageID.Hex()
+	}
+	return response
+}
+
+// StartScheduler sends due scheduled messages every interval. Any number of
+// replicas can run it: each message is claimed with a lease, and a message
+// whose scheduler died is taken over once its lease expires.
+func (h *MessageHandler) StartScheduler(interval time.Duration) {
+	owner := primitive.NewObjectID().Hex()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			h.sendDueMessages(owner)
+		}
+	}()
+}
+
+// sendDueMessages claims and sends scheduled messages that are due until there are none left
+func (h *MessageHandler) sendDueMessages(owner string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	for {
+		now := time.Now()
+		var scheduled models.ScheduledMessage
+		err := h.scheduledCollection.FindOneAndUpdate(ctx,
+			bson.M{"$or": []bson.M{
+				{"status": models.ScheduledStatusPending, "send_at": bson.M{"$lte": now}},
+				{"status": models.ScheduledStatusSending, "lease_until": bson.M{"$lt": now}},
+			}},
+			bson.M{
+				"$set": bson.M{
+					"status":      models.ScheduledStatusSending,
+					"lease_owner": owner,
+					"lease_until": now.Add(scheduleLease),
+					"updated_at":  now,
+				},
+				"$inc": bson.M{"attempts": 1},
+			},
+			options.FindOneAndUpdate().
+				SetSort(bson.D{{Key: "send_at", Value: 1}}).
+				SetReturnDocument(options.After),
+		).Decode(&scheduled)
+		if err == mongo.ErrNoDocuments {
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to claim scheduled messages: %v", err)
+			return
+		}
+
+		h.sendScheduled(ctx, owner, scheduled)
+	}
+}
+
+// sendScheduled sends a claimed scheduled message through the normal send path.
+// The message ID is fixed when scheduling, so a retry after a crash finds the
+// message already stored instead of sending it twice.
+func (h *MessageHandler) sendScheduled(ctx context.Context, owner string, scheduled models.ScheduledMessage) {
+	count, err := h.messagesCollection.CountDocuments(ctx, bson.M{"_id": scheduled.MessageID}, options.Count().SetLimit(1))
+	if err != nil {
+		// The lease runs out and the message is tried again
+		log.Printf("Failed to check scheduled message %s: %v", scheduled.ID.Hex(), err)
+		return
+	}
+	if count > 0 {
+		// A scheduler that held the lease before may have stopped between
+		// saving the message and publishing it, so send it out again
+		if err := h.republishMessage(ctx, scheduled.MessageID); err != nil {
+			log.Printf("Failed to republish scheduled message %s: %v", scheduled.ID.Hex(), err)
+			return
+		}
+		h.finishScheduled(ctx, owner, scheduled, models.ScheduledStatusSent, "")
+		return
+	}
+
+	msg, err := h.buildMessage(scheduled.SenderID, scheduled.Message, time.Now())
+	if err != nil {
+		// The media or chat went away since the message was scheduled
+		h.finishScheduled(ctx, owner, scheduled, models.ScheduledStatusFailed, err.Error())
+		return
+	}
+	msg.ID = scheduled.MessageID
+
+	if _, err := h.deliverMessage(msg); err != nil && !mongo.IsDuplicateKeyError(err) {
+		log.Printf("Failed to send scheduled message %s (attempt %d): %v", scheduled.ID.Hex(), scheduled.Attempts, err)
+		if scheduled.Attempts >= maxScheduleAttempts {
+			h.finishScheduled(ctx, owner, scheduled, models.ScheduledStatusFailed, "Failed to save message")
+		}
+		return
+	}
+	h.finishScheduled(ctx, owner, scheduled, models.ScheduledStatusSent, "")
+}
+
+// republishMessage publishes a saved message to its recipients again, as
+// deliverMessage does after saving it. Clients tell repeats apart by message ID.
+func (h *MessageHandler) republishMessage(ctx context.Context, messageID primitive.ObjectID) error {
+	var msg models.Message
+	if err := h.messagesCollection.FindOne(ctx, bson.M{"_id": messageID}).Decode(&msg); err != nil {
+		return err
+	}
+	response := h.messageResponse(msg)
+
+	if !msg.ThreadRootID.IsZero() {
+		// Only the fan-out, as the thread may already count this reply
+		var root models.Message
+		if err := h.messagesCollection.FindOne(ctx, bson.M{"_id": msg.ThreadRootID}).Decode(&root); err != nil {
+			return err
+		}
+		go h.fanOutThreadReply(root, msg, response)
+	} else if !msg.GroupID.IsZero() {
+		go h.fanOutGroupMessage(response)
+	} else {
+		h.publishDirectMessage(response)
+	}
+	return nil
+}
+
+// finishScheduled records the outcome of sending a scheduled message claimed by
+// owner and tells its sender
+func (h *MessageHandler) finishScheduled(ctx context.Context, owner string, scheduled models.ScheduledMessage, status models.ScheduledStatus, reason string) {
+	now := time.Now()
+	set := bson.M{"status": status, "updated_at": now}
+	if status == models.ScheduledStatusSent {
+		set["sent_at"] = now
+	}
+	if reason != "" {
+		set["error"] = reason
+	}
+
+	var updated models.ScheduledMessage
+	err := h.scheduledCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": scheduled.ID, "status": models.ScheduledStatusSending, "lease_owner": owner},
+		bson.M{"$set": set, "$unset": bson.M{"lease_owner": "", "lease_until": ""}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		// The lease ran out and another scheduler took over
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to update scheduled message %s: %v", scheduled.ID.Hex(), err)
+		return
+	}
+	// A sent message holds its own reference to the media
+	h.detachScheduledMedia(ctx, updated.MediaID)
+
+	event := models.NewEvent(models.EventScheduledMessageUpdated, []string{updated.SenderID.Hex()}, scheduledMessageResponse(updated))
+	if err := h.rabbitMQClient.PublishToExchange("messages", models.EventRoutingKey(models.EventScheduledMessageUpdated), event); err != nil {
+		log.Printf("Failed to publish scheduled message update: %v", err)
+	}
+}
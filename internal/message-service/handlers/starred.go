@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxStarredPage is the most starred messages GetStarredMessages returns at once
+const maxStarredPage = 100
+
+// EnsureStarIndexes creates the indexes for starring and listing starred messages
+func (h *MessageHandler) EnsureStarIndexes(ctx context.Context) error {
+	_, err := h.starsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "message_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "starred_at", Value: -1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "chat_id", Value: 1}, {Key: "starred_at", Value: -1}}},
+	})
+	return err
+}
+
+// StarMessage godoc
+// @Summary      Star a message
+// @Description  Adds a message to the current user's starred messages. Starring a starred message again has no effect.
+// @Tags         messages
+// @Security     BearerAuth
+// @Param        id   path  string  true  "Message ID"
+// @Success      204
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /messages/{id}/star [put]
+func (h *MessageHandler) StarMessage(c *gin.Context) {
+	msg, userID, ok := h.loadChatMessage(c)
+	if !ok {
+		return
+	}
+	if !msg.DeletedAt.IsZero() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+
+	chatID := msg.GroupID
+	if chatID.IsZero() {
+		chatID = msg.SenderID
+		if msg.SenderID == userID {
+			chatID = msg.ReceiverID
+		}
+	}
+
+	_, err := h.starsCollection.UpdateOne(context.Background(),
+		bson.M{"user_id": userID, "message_id": msg.ID},
+		bson.M{"$setOnInsert": bson.M{"chat_id": chatID, "starred_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to star message"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// UnstarMessage godoc
+// @Summary      Unstar a message
+// @Description  Removes a message from the current user's starred messages
+// @Tags         messages
+// @Security     BearerAuth
+// @Param        id   path  string  true  "Message ID"
+// @Success      204
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /messages/{id}/star [delete]
+func (h *MessageHandler) UnstarMessage(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	messageID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	// Stars are the user's own, so no access check is needed to remove one
+	if _, err := h.starsCollection.DeleteOne(context.Background(), bson.M{"user_id": userID, "message_id": messageID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unstar message"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetStarredMessages godoc
+// @Summary      List starred messages
+// @Description  Lists the current user's starred messages across all chats, most recently starred first. Messages deleted for everyone are left out.
+// @Tags         messages
+// @Produce      json
+// @Security     BearerAuth
+// @Param        chat_id  query     string  false  "Only messages of this group, or of the direct chat with this user"
+// @Param        limit    query     int     false  "Maximum number of messages (default 50, at most 100)"
+// @Param        before   query     string  false  "Only messages starred before this RFC 3339 timestamp"
+// @Success      200      {array}   models.StarredMessageResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      401      {object}  models.ErrorResponse
+// @Failure      500      {object}  models.ErrorResponse
+// @Router       /messages/starred [get]
+func (h *MessageHandler) GetStarredMessages(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	match := bson.M{"user_id": userID}
+	if chatParam := c.Query("chat_id"); chatParam != "" {
+		chatID, err := primitive.ObjectIDFromHex(chatParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+			return
+		}
+		match["chat_id"] = chatID
+	}
+	if beforeParam := c.Query("before"); beforeParam != "" {
+		before, err := time.Parse(time.RFC3339, beforeParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid before timestamp"})
+			return
+		}
+		match["starred_at"] = bson.M{"$lt": before}
+	}
+
+	limit := 50
+	if limitParam := c.Query("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = min(parsed, maxStarredPage)
+	}
+
+	// Messages deleted for everyone drop out here rather than leaving gaps in a page
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$sort", Value: bson.M{"starred_at": -1}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         h.messagesCollection.Name(),
+			"localField":   "message_id",
+			"foreignField": "_id",
+			"as":           "message",
+		}}},
+		{{Key: "$unwind", Value: "$message"}},
+		{{Key: "$match", Value: bson.M{"message.deleted_at": bson.M{"$exists": false}}}},
+		{{Key: "$limit", Value: limit}},
+	}
+
+	ctx := context.Background()
+	cursor, err := h.starsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var stars []struct {
+		models.StarredMessage `bson:",inline"`
+		Message               models.Message `bson:"message"`
+	}
+	if err := cursor.All(ctx, &stars); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	responses := []models.StarredMessageResponse{}
+	for _, star := range stars {
+		message := h.messageResponse(star.Message)
+		message.Starred = true
+		responses = append(responses, models.StarredMessageResponse{
+			Message:   message,
+			ChatID:    star.ChatID.Hex(),
+			StarredAt: star.StarredAt.Format(time.RFC3339),
+		})
+	}
+	c.JSON(http.StatusOK, responses)
+}
+
+// markStarred sets the starred flag on the messages userID has starred
+func (h *MessageHandler) markStarred(ctx context.Context, userID primitive.ObjectID, messages []models.MessageResponse) {
+	if len(messages) == 0 {
+		return
+	}
+
+	messageIDs := make([]primitive.ObjectID, 0, len(messages))
+	for _, message := range messages {
+		if id, err := primitive.ObjectIDFromHex(message.ID); err == nil {
+			messageIDs = append(messageIDs, id)
+		}
+	}
+
+	cursor, err := h.starsCollection.Find(ctx,
+		bson.M{"user_id": userID, "message_id": bson.M{"$in": messageIDs}},
+		options.Find().SetProjection(bson.M{"message_id": 1}),
+	)
+	if err != nil {
+		log.Printf("Failed to look up starred messages: %v", err)
+		return
+	}
+	var stars []models.StarredMessage
+	if err := cursor.All(ctx, &stars); err != nil {
+		log.Printf("Failed to look up starred messages: %v", err)
+		return
+	}
+
+	starred := make(map[string]bool, len(stars))
+	for _, star := range stars {
+		starred[star.MessageID.Hex()] = true
+	}
+	for i := range messages {
+		messages[i].Starred = starred[messages[i].ID]
+	}
+}
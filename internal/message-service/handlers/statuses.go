@@ -0,0 +1,838 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// maxActiveStatuses caps the statuses a user can have up at once
+	maxActiveStatuses = 30
+	// expiredStatusBatchSize is how many expired statuses the reaper deletes at once
+	expiredStatusBatchSize = 500
+)
+
+// StatusHandler handles statuses, text and media updates that disappear after
+// a day. A status is shown to the author's contacts, narrowed down by the
+// author's status privacy, as they were when it was posted.
+type StatusHandler struct {
+	statusesCollection *mongo.Collection
+	viewsCollection    *mongo.Collection
+	privacyCollection  *mongo.Collection
+	slotsCollection    *mongo.Collection
+	contactsCollection *mongo.Collection
+	messages           *MessageHandler
+	rabbitMQClient     RabbitMQClient
+}
+
+// NewStatusHandler creates a status handler. Contacts are the ones users add
+// in the user service; media is resolved and rendered by messages.
+func NewStatusHandler(db *mongo.Database, messages *MessageHandler, rabbitMQClient RabbitMQClient) *StatusHandler {
+	return &StatusHandler{
+		statusesCollection: db.Collection("statuses"),
+		viewsCollection:    db.Collection("status_views"),
+		privacyCollection:  db.Collection("status_privacy"),
+		slotsCollection:    db.Collection("status_slots"),
+		contactsCollection: db.Collection("contacts"),
+		messages:           messages,
+		rabbitMQClient:     rabbitMQClient,
+	}
+}
+
+// EnsureIndexes creates the indexes for status feeds, views and expiry
+func (h *StatusHandler) EnsureIndexes(ctx context.Context) error {
+	if _, err := h.statusesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "author_id", Value: 1}, {Key: "expires_at", Value: 1}}},
+		{Keys: bson.D{{Key: "audience_ids", Value: 1}, {Key: "expires_at", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}},
+	}); err != nil {
+		return err
+	}
+	_, err := h.viewsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "status_id", Value: 1}, {Key: "viewer_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "viewer_id", Value: 1}, {Key: "status_id", Value: 1}}},
+	})
+	return err
+}
+
+// PostStatus godoc
+// @Summary      Post a status
+// @Description  Posts a text status, or an uploaded image or video with an optional caption. It is shown to your contacts, as narrowed down by your status privacy, for 24 hours. They receive a status_posted event.
+// @Tags         statuses
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        status  body      models.StatusRequest  true  "Status to post"
+// @Success      201     {object}  models.StatusPostResponse
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      401     {object}  models.ErrorResponse
+// @Failure      409     {object}  models.ErrorResponse
+// @Failure      500     {object}  models.ErrorResponse
+// @Router       /statuses [post]
+func (h *StatusHandler) PostStatus(c *gin.Context) {
+	var input models.StatusRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	media, err := h.messages.resolveMedia(userID, models.MessageRequest{MediaID: input.MediaID, MediaURL: input.MediaURL})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if media == nil && input.MediaURL != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Statuses can only show uploaded media"})
+		return
+	}
+
+	now := time.Now()
+	status := models.Status{
+		ID:        primitive.NewObjectID(),
+		AuthorID:  userID,
+		Type:      models.MessageTypeText,
+		Content:   strings.TrimSpace(input.Content),
+		CreatedAt: now,
+		ExpiresAt: now.Add(models.StatusLifetime),
+	}
+	if media != nil {
+		msgType := mediaKindTypes[media.Kind]
+		if msgType != models.MessageTypeImage && msgType != models.MessageTypeVideo {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Statuses can only show images and videos"})
+			return
+		}
+		status.Type = msgType
+		status.MediaID = media.ID
+	} else {
+		if status.Content == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Content is required for text statuses"})
+			return
+		}
+		status.BackgroundColor = input.BackgroundColor
+	}
+
+	ctx := context.Background()
+	status.AudienceIDs, err = h.statusAudience(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	claimed, err := h.claimStatusSlot(ctx, status, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !claimed {
+		c.JSON(http.StatusConflict, gin.H{"error": "You have too many active statuses"})
+		return
+	}
+
+	if !status.MediaID.IsZero() {
+		if err := h.messages.media.attachMedia(ctx, status.MediaID, 1); err != nil {
+			h.releaseStatusSlot(ctx, status)
+			if errors.Is(err, errMediaNotFound) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post status"})
+			}
+			return
+		}
+	}
+	if _, err := h.statusesCollection.InsertOne(ctx, status); err != nil {
+		h.releaseStatusSlot(ctx, status)
+		if !status.MediaID.IsZero() {
+			h.messages.media.detachMedia(ctx, map[primitive.ObjectID]int64{status.MediaID: 1})
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post status"})
+		return
+	}
+
+	responses, err := h.statusResponses(ctx, []models.Status{status})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	response := responses[0]
+	if len(status.AudienceIDs) > 0 {
+		go h.publishStatusEvent(models.EventStatusPosted, objectIDHexes(status.AudienceIDs), response)
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetStatuses godoc
+// @Summary      List statuses of contacts
+// @Description  Lists the active statuses of your contacts that you may see, grouped by contact. Contacts with statuses you have not viewed come first, then the most recent.
+// @Tags         statuses
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}   models.UserStatuses
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /statuses [get]
+func (h *StatusHandler) GetStatuses(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	contactIDs, err := h.contactIDs(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	feed := []models.UserStatuses{}
+	if len(contactIDs) == 0 {
+		c.JSON(http.StatusOK, feed)
+		return
+	}
+
+	filter := bson.M{
+		"author_id":    bson.M{"$in": contactIDs},
+		"audience_ids": userID,
+		"expires_at":   bson.M{"$gt": time.Now()},
+	}
+	cursor, err := h.statusesCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var statuses []models.Status
+	if err := cursor.All(ctx, &statuses); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	statusIDs := make([]primitive.ObjectID, 0, len(statuses))
+	for _, status := range statuses {
+		statusIDs = append(statusIDs, status.ID)
+	}
+	viewed, err := h.viewedStatuses(ctx, userID, statusIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	responses, err := h.statusResponses(ctx, statuses)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	byAuthor := make(map[primitive.ObjectID]int)
+	for k, status := range statuses {
+		response := responses[k]
+		i, seen := byAuthor[status.AuthorID]
+		if !seen {
+			i = len(feed)
+			byAuthor[status.AuthorID] = i
+			feed = append(feed, models.UserStatuses{
+				UserID:    status.AuthorID.Hex(),
+				Username:  response.AuthorUsername,
+				AllViewed: true,
+			})
+		}
+		response.ViewCount = 0
+		response.Viewed = viewed[status.ID]
+		feed[i].Statuses = append(feed[i].Statuses, response)
+		feed[i].AllViewed = feed[i].AllViewed && response.Viewed
+		feed[i].LastPostedAt = response.CreatedAt
+	}
+
+	sort.SliceStable(feed, func(i, j int) bool {
+		if feed[i].AllViewed != feed[j].AllViewed {
+			return !feed[i].AllViewed
+		}
+		return feed[i].LastPostedAt > feed[j].LastPostedAt
+	})
+	c.JSON(http.StatusOK, feed)
+}
+
+// GetMyStatuses godoc
+// @Summary      List your statuses
+// @Description  Lists your active statuses, oldest first, with how many people viewed each
+// @Tags         statuses
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}   models.StatusPostResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /statuses/mine [get]
+func (h *StatusHandler) GetMyStatuses(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	filter := bson.M{"author_id": userID, "expires_at": bson.M{"$gt": time.Now()}}
+	cursor, err := h.statusesCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var statuses []models.Status
+	if err := cursor.All(ctx, &statuses); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	responses, err := h.statusResponses(ctx, statuses)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, responses)
+}
+
+// ViewStatus godoc
+// @Summary      Mark a status as viewed
+// @Description  Records that you viewed a status of a contact. The author receives a status_viewed event the first time.
+// @Tags         statuses
+// @Security     BearerAuth
+// @Param        id   path  string  true  "Status ID"
+// @Success      204
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /statuses/{id}/view [put]
+func (h *StatusHandler) ViewStatus(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	statusID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status ID"})
+		return
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	var status models.Status
+	filter := bson.M{"_id": statusID, "audience_ids": userID, "expires_at": bson.M{"$gt": now}}
+	if err := h.statusesCollection.FindOne(ctx, filter).Decode(&status); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Status not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	view := models.StatusView{StatusID: statusID, ViewerID: userID, ViewedAt: now}
+	if _, err := h.viewsCollection.InsertOne(ctx, view); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record view"})
+		return
+	}
+	if _, err := h.statusesCollection.UpdateOne(ctx, bson.M{"_id": statusID}, bson.M{"$inc": bson.M{"view_count": 1}}); err != nil {
+		log.Printf("Failed to count view of status %s: %v", statusID.Hex(), err)
+	}
+
+	go h.publishStatusEvent(models.EventStatusViewed, []string{status.AuthorID.Hex()}, models.StatusViewed{
+		StatusID: statusID.Hex(),
+		ViewerID: userID.Hex(),
+		ViewedAt: now.Format(time.RFC3339),
+	})
+	c.Status(http.StatusNoContent)
+}
+
+// GetStatusViewers godoc
+// @Summary      List who viewed a status
+// @Description  Lists who viewed one of your statuses, most recent first
+// @Tags         statuses
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      string  true  "Status ID"
+// @Success      200  {array}   models.StatusViewerResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /statuses/{id}/viewers [get]
+func (h *StatusHandler) GetStatusViewers(c *gin.Context) {
+	status, ok := h.loadOwnStatus(c)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	opts := options.Find().SetSort(bson.D{{Key: "viewed_at", Value: -1}})
+	cursor, err := h.viewsCollection.Find(ctx, bson.M{"status_id": status.ID}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var views []models.StatusView
+	if err := cursor.All(ctx, &views); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	viewerIDs := make([]primitive.ObjectID, 0, len(views))
+	for _, view := range views {
+		viewerIDs = append(viewerIDs, view.ViewerID)
+	}
+	usernames, err := h.messages.usernamesByID(ctx, viewerIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	viewers := make([]models.StatusViewerResponse, 0, len(views))
+	for _, view := range views {
+		viewers = append(viewers, models.StatusViewerResponse{
+			UserID:   view.ViewerID.Hex(),
+			Username: usernames[view.ViewerID],
+			ViewedAt: view.ViewedAt.Format(time.RFC3339),
+		})
+	}
+	c.JSON(http.StatusOK, viewers)
+}
+
+// DeleteStatus godoc
+// @Summary      Delete a status
+// @Description  Deletes one of your statuses before it expires. Its audience receives a status_deleted event.
+// @Tags         statuses
+// @Security     BearerAuth
+// @Param        id   path  string  true  "Status ID"
+// @Success      204
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /statuses/{id} [delete]
+func (h *StatusHandler) DeleteStatus(c *gin.Context) {
+	status, ok := h.loadOwnStatus(c)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	if err := h.deleteStatuses(ctx, []models.Status{status}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete status"})
+		return
+	}
+	h.releaseStatusSlot(ctx, status)
+
+	if len(status.AudienceIDs) > 0 {
+		go h.publishStatusEvent(models.EventStatusDeleted, objectIDHexes(status.AudienceIDs), models.StatusDeleted{
+			StatusID: status.ID.Hex(),
+			AuthorID: status.AuthorID.Hex(),
+		})
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetStatusPrivacy godoc
+// @Summary      Get status privacy
+// @Description  Returns who sees the statuses you post: all contacts, contacts except some, or only some contacts
+// @Tags         statuses
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  models.StatusPrivacyResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /statuses/privacy [get]
+func (h *StatusHandler) GetStatusPrivacy(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	privacy, err := h.statusPrivacy(context.Background(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, statusPrivacyResponse(privacy))
+}
+
+// UpdateStatusPrivacy godoc
+// @Summary      Update status privacy
+// @Description  Changes who sees the statuses you post from now on. Statuses already posted keep their audience.
+// @Tags         statuses
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        privacy  body      models.StatusPrivacyRequest  true  "Status privacy"
+// @Success      200      {object}  models.StatusPrivacyResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      401      {object}  models.ErrorResponse
+// @Failure      500      {object}  models.ErrorResponse
+// @Router       /statuses/privacy [put]
+func (h *StatusHandler) UpdateStatusPrivacy(c *gin.Context) {
+	var input models.StatusPrivacyRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.IsValidStatusAudience(input.Audience) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "audience must be contacts, contacts_except or only_share_with"})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	set := bson.M{"audience": input.Audience, "updated_at": time.Now()}
+	for field, hexIDs := range map[string][]string{"excluded_ids": input.ExcludedIDs, "included_ids": input.IncludedIDs} {
+		if hexIDs == nil {
+			continue
+		}
+		ids := make([]primitive.ObjectID, 0, len(hexIDs))
+		for _, hexID := range hexIDs {
+			id, err := primitive.ObjectIDFromHex(hexID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID: " + hexID})
+				return
+			}
+			ids = append(ids, id)
+		}
+		set[field] = ids
+	}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var privacy models.StatusPrivacy
+	if err := h.privacyCollection.FindOneAndUpdate(context.Background(), bson.M{"_id": userID}, bson.M{"$set": set}, opts).Decode(&privacy); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update status privacy"})
+		return
+	}
+	c.JSON(http.StatusOK, statusPrivacyResponse(privacy))
+}
+
+// StartStatusReaper deletes expired statuses every interval
+func (h *StatusHandler) StartStatusReaper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			h.reapExpiredStatuses()
+		}
+	}()
+}
+
+// reapExpiredStatuses deletes expired statuses with their views and media.
+// Clients hide statuses past expires_at on their own, so nobody is notified.
+func (h *StatusHandler) reapExpiredStatuses() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	total := 0
+	for {
+		cursor, err := h.statusesCollection.Find(ctx,
+			bson.M{"expires_at": bson.M{"$lte": time.Now()}},
+			options.Find().SetProjection(bson.M{"_id": 1, "media_id": 1}).SetLimit(expiredStatusBatchSize),
+		)
+		if err != nil {
+			log.Printf("Failed to look up expired statuses: %v", err)
+			return
+		}
+		var statuses []models.Status
+		if err := cursor.All(ctx, &statuses); err != nil {
+			log.Printf("Failed to read expired statuses: %v", err)
+			return
+		}
+		if len(statuses) == 0 {
+			break
+		}
+
+		if err := h.deleteStatuses(ctx, statuses); err != nil {
+			log.Printf("Failed to delete expired statuses: %v", err)
+			return
+		}
+		total += len(statuses)
+
+		if len(statuses) < expiredStatusBatchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Printf("Deleted %d expired statuses", total)
+	}
+}
+
+// deleteStatuses deletes statuses along with their views and any media that
+// nothing else uses
+func (h *StatusHandler) deleteStatuses(ctx context.Context, statuses []models.Status) error {
+	statusIDs := make([]primitive.ObjectID, 0, len(statuses))
+	for _, status := range statuses {
+		statusIDs = append(statusIDs, status.ID)
+	}
+	if _, err := h.statusesCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": statusIDs}}); err != nil {
+		return err
+	}
+	if _, err := h.viewsCollection.DeleteMany(ctx, bson.M{"status_id": bson.M{"$in": statusIDs}}); err != nil {
+		log.Printf("Failed to delete views of statuses: %v", err)
+	}
+
+	// The same upload may have been posted more than once or sent in a chat
+	refs := make(map[primitive.ObjectID]int64)
+	for _, status := range statuses {
+		if !status.MediaID.IsZero() {
+			refs[status.MediaID]++
+		}
+	}
+	h.messages.media.detachMedia(ctx, refs)
+	return nil
+}
+
+// claimStatusSlot counts status among the active statuses of its author
+// unless they already have maxActiveStatuses. Slots of expired statuses are
+// dropped in the same update, so parallel posts cannot exceed the cap.
+func (h *StatusHandler) claimStatusSlot(ctx context.Context, status models.Status, now time.Time) (bool, error) {
+	slot := bson.M{"status_id": status.ID, "expires_at": status.ExpiresAt}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"slots": bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$slots", bson.A{}}},
+			"cond":  bson.M{"$gt": bson.A{"$$this.expires_at", now}},
+		}}}}},
+		{{Key: "$set", Value: bson.M{"slots": bson.M{"$cond": bson.A{
+			bson.M{"$lt": bson.A{bson.M{"$size": "$slots"}, maxActiveStatuses}},
+			bson.M{"$concatArrays": bson.A{"$slots", bson.A{slot}}},
+			"$slots",
+		}}}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var slots struct {
+		Slots []struct {
+			StatusID primitive.ObjectID `bson:"status_id"`
+		} `bson:"slots"`
+	}
+	if err := h.slotsCollection.FindOneAndUpdate(ctx, bson.M{"_id": status.AuthorID}, update, opts).Decode(&slots); err != nil {
+		return false, err
+	}
+	for _, claimed := range slots.Slots {
+		if claimed.StatusID == status.ID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// releaseStatusSlot frees the slot of a status deleted before it expired
+func (h *StatusHandler) releaseStatusSlot(ctx context.Context, status models.Status) {
+	update := bson.M{"$pull": bson.M{"slots": bson.M{"status_id": status.ID}}}
+	if _, err := h.slotsCollection.UpdateOne(ctx, bson.M{"_id": status.AuthorID}, update); err != nil {
+		log.Printf("Failed to release slot of status %s: %v", status.ID.Hex(), err)
+	}
+}
+
+// loadOwnStatus loads the active status in the :id path parameter, responding
+// with 404 unless the current user posted it
+func (h *StatusHandler) loadOwnStatus(c *gin.Context) (models.Status, bool) {
+	var status models.Status
+	userID, ok := currentUserID(c)
+	if !ok {
+		return status, false
+	}
+	statusID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status ID"})
+		return status, false
+	}
+
+	filter := bson.M{"_id": statusID, "author_id": userID, "expires_at": bson.M{"$gt": time.Now()}}
+	if err := h.statusesCollection.FindOne(context.Background(), filter).Decode(&status); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Status not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return status, false
+	}
+	return status, true
+}
+
+// statusAudience returns who may see a status userID posts now: their
+// contacts, narrowed down by their status privacy
+func (h *StatusHandler) statusAudience(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	contactIDs, err := h.contactIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	privacy, err := h.statusPrivacy(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := make(map[primitive.ObjectID]bool)
+	switch privacy.Audience {
+	case models.StatusAudienceContactsExcept:
+		for _, id := range privacy.ExcludedIDs {
+			listed[id] = true
+		}
+	case models.StatusAudienceOnlyShareWith:
+		for _, id := range privacy.IncludedIDs {
+			listed[id] = true
+		}
+	}
+
+	audience := []primitive.ObjectID{}
+	for _, contactID := range contactIDs {
+		switch privacy.Audience {
+		case models.StatusAudienceContactsExcept:
+			if listed[contactID] {
+				continue
+			}
+		case models.StatusAudienceOnlyShareWith:
+			if !listed[contactID] {
+				continue
+			}
+		}
+		audience = append(audience, contactID)
+	}
+	return audience, nil
+}
+
+// statusPrivacy returns the status privacy of userID, sharing with all contacts by default
+func (h *StatusHandler) statusPrivacy(ctx context.Context, userID primitive.ObjectID) (models.StatusPrivacy, error) {
+	privacy := models.StatusPrivacy{UserID: userID, Audience: models.StatusAudienceContacts}
+	err := h.privacyCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&privacy)
+	if err == mongo.ErrNoDocuments {
+		return privacy, nil
+	}
+	return privacy, err
+}
+
+// contactIDs returns the users userID has added as contacts
+func (h *StatusHandler) contactIDs(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	cursor, err := h.contactsCollection.Find(ctx, bson.M{"UserID": userID}, options.Find().SetProjection(bson.M{"contact_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var contacts []struct {
+		ContactID primitive.ObjectID `bson:"contact_id"`
+	}
+	if err := cursor.All(ctx, &contacts); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(contacts))
+	for _, contact := range contacts {
+		ids = append(ids, contact.ContactID)
+	}
+	return ids, nil
+}
+
+// viewedStatuses returns which of statusIDs userID has viewed
+func (h *StatusHandler) viewedStatuses(ctx context.Context, userID primitive.ObjectID, statusIDs []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	viewed := make(map[primitive.ObjectID]bool)
+	if len(statusIDs) == 0 {
+		return viewed, nil
+	}
+	cursor, err := h.viewsCollection.Find(ctx,
+		bson.M{"viewer_id": userID, "status_id": bson.M{"$in": statusIDs}},
+		options.Find().SetProjection(bson.M{"status_id": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var views []models.StatusView
+	if err := cursor.All(ctx, &views); err != nil {
+		return nil, err
+	}
+	for _, view := range views {
+		viewed[view.StatusID] = true
+	}
+	return viewed, nil
+}
+
+// publishStatusEvent sends a status event to recipientIDs
+func (h *StatusHandler) publishStatusEvent(eventType string, recipientIDs []string, data interface{}) {
+	event := models.NewEvent(eventType, recipientIDs, data)
+	if err := h.rabbitMQClient.PublishToExchange("messages", models.EventRoutingKey(event.Type), event); err != nil {
+		log.Printf("Failed to publish %s event: %v", eventType, err)
+	}
+}
+
+// statusResponses converts stored statuses into their API representation
+// for their author, looking up all authors and media in one query each
+func (h *StatusHandler) statusResponses(ctx context.Context, statuses []models.Status) ([]models.StatusPostResponse, error) {
+	var authorIDs, mediaIDs []primitive.ObjectID
+	for _, status := range statuses {
+		authorIDs = append(authorIDs, status.AuthorID)
+		if !status.MediaID.IsZero() {
+			mediaIDs = append(mediaIDs, status.MediaID)
+		}
+	}
+	usernames, err := h.messages.usernamesByID(ctx, authorIDs)
+	if err != nil {
+		return nil, err
+	}
+	media, err := h.messages.media.ResponsesByID(ctx, mediaIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]models.StatusPostResponse, 0, len(statuses))
+	for _, status := range statuses {
+		response := models.StatusPostResponse{
+			ID:              status.ID.Hex(),
+			AuthorID:        status.AuthorID.Hex(),
+			AuthorUsername:  usernames[status.AuthorID],
+			Type:            status.Type,
+			Content:         status.Content,
+			BackgroundColor: status.BackgroundColor,
+			ViewCount:       status.ViewCount,
+			CreatedAt:       status.CreatedAt.Format(time.RFC3339),
+			ExpiresAt:       status.ExpiresAt.Format(time.RFC3339),
+		}
+		if !status.MediaID.IsZero() {
+			if m, ok := media[status.MediaID]; ok {
+				response.Media = &m
+			} else {
+				log.Printf("Media %s of status %s not found", status.MediaID.Hex(), status.ID.Hex())
+			}
+		}
+		responses = append(responses, response)
+	}
+	return responses, nil
+}
+
+// statusPrivacyResponse converts stored status privacy into its API representation
+func statusPrivacyResponse(privacy models.StatusPrivacy) models.StatusPrivacyResponse {
+	response := models.StatusPrivacyResponse{
+		Audience:    privacy.Audience,
+		ExcludedIDs: []string{},
+		IncludedIDs: []string{},
+	}
+	if hexes := objectIDHexes(privacy.ExcludedIDs); hexes != nil {
+		response.ExcludedIDs = hexes
+	}
+	if hexes := objectIDHexes(privacy.IncludedIDs); hexes != nil {
+		response.IncludedIDs = hexes
+	}
+	return response
+}
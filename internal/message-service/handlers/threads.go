@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxThreadPage is the most replies GetThread returns at once
+const maxThreadPage = 100
+
+// EnsureThreadIndexes creates the index for paging through the replies of a thread
+func (h *MessageHandler) EnsureThreadIndexes(ctx context.Context) error {
+	_, err := h.messagesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "thread_root_id", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().SetPartialFilterExpression(bson.M{"thread_root_id": bson.M{"$exists": true}}),
+	})
+	return err
+}
+
+// GetThread godoc
+// @Summary      Get a thread
+// @Description  Returns a group message with a page of the replies in its thread, newest first. For a reply, returns the thread it belongs to.
+// @Tags         messages
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id      path      string  true   "Message ID"
+// @Param        limit   query     int     false  "Maximum number of replies (default 50, at most 100)"
+// @Param        before  query     string  false  "Only replies sent before this RFC 3339 timestamp"
+// @Success      200     {object}  models.ThreadResponse
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      401     {object}  models.ErrorResponse
+// @Failure      404     {object}  models.ErrorResponse
+// @Failure      500     {object}  models.ErrorResponse
+// @Router       /messages/{id}/thread [get]
+func (h *MessageHandler) GetThread(c *gin.Context) {
+	root, userID, ok := h.loadChatMessage(c)
+	if !ok {
+		return
+	}
+	if root.GroupID.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only group messages have threads"})
+		return
+	}
+
+	if root.ExpiresAt != nil && !root.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+
+	ctx := context.Background()
+	if !root.ThreadRootID.IsZero() {
+		if err := h.messagesCollection.FindOne(ctx, bson.M{"_id": root.ThreadRootID, "expires_at": unexpired()}).Decode(&root); err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Thread not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
+			return
+		}
+	}
+
+	filter := bson.M{"thread_root_id": root.ID, "expires_at": unexpired()}
+	if beforeParam := c.Query("before"); beforeParam != "" {
+		before, err := time.Parse(time.RFC3339, beforeParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid before timestamp"})
+			return
+		}
+		filter["created_at"] = bson.M{"$lt": before}
+	}
+
+	limit := 50
+	if limitParam := c.Query("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = min(parsed, maxThreadPage)
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := h.messagesCollection.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var replies []models.Message
+	if err := cursor.All(ctx, &replies); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	messages := make([]models.MessageResponse, 0, len(replies)+1)
+	messages = append(messages, h.messageResponse(root))
+	for _, reply := range replies {
+		messages = append(messages, h.messageResponse(reply))
+	}
+	h.markStarred(ctx, userID, messages)
+
+	c.JSON(http.StatusOK, models.ThreadResponse{
+		Root:    messages[0],
+		Replies: messages[1:],
+	})
+}
+
+// resolveThreadRoot checks that rootIDHex names a message in groupID that can
+// have a thread and returns the ID of the thread's root. Replying to a reply
+// continues the thread it belongs to.
+func (h *MessageHandler) resolveThreadRoot(groupID primitive.ObjectID, rootIDHex string) (primitive.ObjectID, error) {
+	if groupID.IsZero() {
+		return primitive.NilObjectID, errors.New("Threads are only available in groups")
+	}
+	rootID, err := primitive.ObjectIDFromHex(rootIDHex)
+	if err != nil {
+		return primitive.NilObjectID, errors.New("Invalid thread root ID")
+	}
+
+	var root models.Message
+	if err := h.messagesCollection.FindOne(context.Background(), bson.M{"_id": rootID, "group_id": groupID}).Decode(&root); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return primitive.NilObjectID, errors.New("Thread root not found")
+		}
+		return primitive.NilObjectID, errors.New("Failed to look up thread root")
+	}
+	if !root.ThreadRootID.IsZero() {
+		return root.ThreadRootID, nil
+	}
+	if !root.DeletedAt.IsZero() || root.Type == models.MessageTypeSystem || root.Type == models.MessageTypeCall {
+		return primitive.NilObjectID, errors.New("This message cannot have a thread")
+	}
+	return root.ID, nil
+}
+
+// addThreadReply counts a saved reply on its thread root and lets the group know
+func (h *MessageHandler) addThreadReply(ctx context.Context, reply models.Message, response models.MessageResponse) {
+	update := bson.M{
+		"$inc":      bson.M{"thread_reply_count": 1},
+		"$max":      bson.M{"thread_last_reply_at": reply.CreatedAt},
+		"$addToSet": bson.M{"thread_participant_ids": reply.SenderID},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var root models.Message
+	if err := h.messagesCollection.FindOneAndUpdate(ctx, bson.M{"_id": reply.ThreadRootID}, update, opts).Decode(&root); err != nil {
+		log.Printf("Failed to add reply %s to thread %s: %v", reply.ID.Hex(), reply.ThreadRootID.Hex(), err)
+		return
+	}
+
+	go h.fanOutThreadReply(root, reply, response)
+}
+
+// fanOutThreadReply sends a reply to the participants of its thread: the author
+// of the root, everyone who replied and anyone the reply mentions. The rest of
+// the group only learns about the new state of the thread.
+func (h *MessageHandler) fanOutThreadReply(root, reply models.Message, response models.MessageResponse) {
+	members, err := h.fetchGroupMembers(root.GroupID)
+	if err != nil {
+		log.Printf("Failed to fetch group members for thread %s: %v", root.ID.Hex(), err)
+		return
+	}
+
+	participants := map[primitive.ObjectID]bool{root.SenderID: true}
+	for _, participantID := range root.ThreadParticipantIDs {
+		participants[participantID] = true
+	}
+	for _, mentionedID := range reply.Mentions {
+		participants[mentionedID] = true
+	}
+
+	// People who left the group no longer follow its threads
+	var participantIDs, otherIDs []string
+	for _, memberID := range members {
+		if participants[memberID] || reply.MentionsAll {
+			participantIDs = append(participantIDs, memberID.Hex())
+		} else {
+			otherIDs = append(otherIDs, memberID.Hex())
+		}
+	}
+
+	thread := models.ThreadUpdate{
+		RootID:      root.ID.Hex(),
+		GroupID:     root.GroupID.Hex(),
+		ReplyCount:  root.ThreadReplyCount,
+		LastReplyAt: formatOptionalTime(root.ThreadLastReplyAt),
+	}
+	events := []models.Event{models.NewEvent(models.EventThreadReply, participantIDs, models.ThreadReply{ThreadUpdate: thread, Reply: response})}
+	if len(otherIDs) > 0 {
+		events = append(events, models.NewEvent(models.EventThreadUpdated, otherIDs, thread))
+	}
+	for _, event := range events {
+		if err := h.rabbitMQClient.PublishToExchange("messages", models.EventRoutingKey(event.Type), event); err != nil {
+			log.Printf("Failed to publish %s event for thread %s: %v", event.Type, root.ID.Hex(), err)
+		}
+	}
+}
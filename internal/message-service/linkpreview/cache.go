@@ -0,0 +1,57 @@
+package linkpreview
+
+import (
+	"context"
+	"time"
+
+	"whatsapp/pkg/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoCache keeps previews in a MongoDB collection, shared by all message service instances
+type MongoCache struct {
+	collection *mongo.Collection
+}
+
+// NewMongoCache creates a cache backed by collection
+func NewMongoCache(collection *mongo.Collection) *MongoCache {
+	return &MongoCache{collection: collection}
+}
+
+// EnsureIndexes lets MongoDB remove expired previews
+func (c *MongoCache) EnsureIndexes(ctx context.Context) error {
+	_, err := c.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+type cacheEntry struct {
+	URL       string              `bson:"_id"`
+	Preview   *models.LinkPreview `bson:"preview"`
+	ExpiresAt time.Time           `bson:"expires_at"`
+}
+
+// Get returns the cached preview of rawURL
+func (c *MongoCache) Get(ctx context.Context, rawURL string) (*models.LinkPreview, bool, error) {
+	var entry cacheEntry
+	// The TTL monitor runs only once a minute, so check the expiry as well
+	err := c.collection.FindOne(ctx, bson.M{"_id": rawURL, "expires_at": bson.M{"$gt": time.Now()}}).Decode(&entry)
+	if err == mongo.ErrNoDocuments {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return entry.Preview, true, nil
+}
+
+// Put caches preview, which may be nil, for ttl
+func (c *MongoCache) Put(ctx context.Context, rawURL string, preview *models.LinkPreview, ttl time.Duration) error {
+	entry := cacheEntry{URL: rawURL, Preview: preview, ExpiresAt: time.Now().Add(ttl)}
+	_, err := c.collection.ReplaceOne(ctx, bson.M{"_id": rawURL}, entry, options.Replace().SetUpsert(true))
+	return err
+}
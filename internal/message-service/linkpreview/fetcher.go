@@ -0,0 +1,282 @@
+package linkpreview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"whatsapp/pkg/models"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// ErrBlocked is returned for URLs that may not be fetched, such as those
+// pointing into private networks
+var ErrBlocked = errors.New("linkpreview: URL not allowed")
+
+const (
+	maxTitleLength       = 300
+	maxDescriptionLength = 1000
+	maxRedirects         = 5
+)
+
+// FetcherConfig holds the limits of an HTTPFetcher
+type FetcherConfig struct {
+	Timeout   time.Duration // for the whole request, including redirects
+	MaxBytes  int64         // of the page that is read
+	UserAgent string
+}
+
+// HTTPFetcher fetches pages over HTTP and reads their metadata. It only
+// connects to public IP addresses on the standard ports, checking every
+// address it dials, so DNS tricks and redirects cannot reach internal services.
+type HTTPFetcher struct {
+	client    *http.Client
+	maxBytes  int64
+	userAgent string
+}
+
+// NewHTTPFetcher creates a fetcher with the given limits
+func NewHTTPFetcher(config FetcherConfig) *HTTPFetcher {
+	dialer := &net.Dialer{
+		Timeout: config.Timeout,
+		// Runs after name resolution, for each address that is tried
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return ErrBlocked
+			}
+			return nil
+		},
+	}
+
+	transport := &http.Transport{
+		Proxy:                  nil, // a proxy would dial on our behalf, bypassing the checks
+		DialContext:            dialer.DialContext,
+		ForceAttemptHTTP2:      true,
+		TLSHandshakeTimeout:    config.Timeout,
+		ResponseHeaderTimeout:  config.Timeout,
+		MaxResponseHeaderBytes: 64 << 10,
+		MaxIdleConns:           20,
+		IdleConnTimeout:        30 * time.Second,
+	}
+
+	return &HTTPFetcher{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   config.Timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return errors.New("linkpreview: too many redirects")
+				}
+				return checkURL(req.URL)
+			},
+		},
+		maxBytes:  config.MaxBytes,
+		userAgent: config.UserAgent,
+	}
+}
+
+// Fetch reads the OpenGraph and HTML metadata of the page at rawURL
+func (f *HTTPFetcher) Fetch(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkURL(target); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	req.Header.Set("User-Agent", f.userAgent)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("linkpreview: %s returned %s", target.Host, resp.Status)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, nil
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, f.maxBytes), contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := readMetadata(body)
+	preview := &models.LinkPreview{
+		URL:         rawURL,
+		Title:       truncate(firstNonEmpty(meta["og:title"], meta["twitter:title"], meta["title"]), maxTitleLength),
+		Description: truncate(firstNonEmpty(meta["og:description"], meta["twitter:description"], meta["description"]), maxDescriptionLength),
+		SiteName:    truncate(firstNonEmpty(meta["og:site_name"], resp.Request.URL.Hostname()), maxTitleLength),
+	}
+	if preview.Title == "" && preview.Description == "" {
+		return nil, nil
+	}
+
+	// Image URLs are often relative to the final page
+	if image := firstNonEmpty(meta["og:image"], meta["og:image:url"], meta["twitter:image"]); image != "" {
+		if imageURL, err := resp.Request.URL.Parse(image); err == nil && (imageURL.Scheme == "http" || imageURL.Scheme == "https") {
+			preview.ImageURL = imageURL.String()
+		}
+	}
+
+	return preview, nil
+}
+
+// checkURL rejects URLs that are not plain http(s) on the standard ports
+func checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrBlocked
+	}
+	if u.User != nil || u.Hostname() == "" {
+		return ErrBlocked
+	}
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		return ErrBlocked
+	}
+	return nil
+}
+
+// nonPublicNetworks are ranges not covered by the net.IP predicates
+var nonPublicNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",       // "this" network
+		"100.64.0.0/10",   // carrier-grade NAT
+		"192.0.0.0/24",    // IETF protocol assignments
+		"192.0.2.0/24",    // documentation
+		"198.18.0.0/15",   // benchmarking
+		"198.51.100.0/24", // documentation
+		"203.0.113.0/24",  // documentation
+		"240.0.0.0/4",     // reserved, including broadcast
+		"64:ff9b::/96",    // NAT64, which may map to private IPv4 addresses
+		"2001:db8::/32",   // documentation
+	} {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// isPublicIP reports whether ip is a globally routable unicast address
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// readMetadata collects the <title> and the <meta> properties of the head of an HTML page.
+// Keys are lowercased; the first occurrence of each wins.
+func readMetadata(r io.Reader) map[string]string {
+	meta := make(map[string]string)
+	set := func(key, value string) {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if _, exists := meta[key]; !exists && key != "" {
+			meta[key] = value
+		}
+	}
+
+	tokenizer := html.NewTokenizer(r)
+	inTitle := false
+	var title strings.Builder
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			set("title", title.String())
+			return meta
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.Data {
+			case "title":
+				inTitle = true
+			case "meta":
+				var key, content string
+				for _, attr := range token.Attr {
+					switch attr.Key {
+					case "property", "name":
+						if key == "" {
+							key = attr.Val
+						}
+					case "content":
+						content = attr.Val
+					}
+				}
+				set(key, content)
+			case "body":
+				// Metadata lives in the head
+				set("title", title.String())
+				return meta
+			}
+
+		case html.EndTagToken:
+			switch tokenizer.Token().Data {
+			case "title":
+				inTitle = false
+			case "head":
+				set("title", title.String())
+				return meta
+			}
+
+		case html.TextToken:
+			if inTitle {
+				title.Write(tokenizer.Text())
+			}
+		}
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// truncate cleans up whitespace and shortens s to at most limit characters
+func truncate(s string, limit int) string {
+	s = strings.Join(strings.Fields(strings.ToValidUTF8(s, "")), " ")
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:limit-1])) + "…"
+}
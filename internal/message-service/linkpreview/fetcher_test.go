@@ -0,0 +1,124 @@
+package linkpreview
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"8.8.8.8", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"2001:4860:4860::8888", true},
+
+		{"127.0.0.1", false},
+		{"127.255.255.254", false},
+		{"::1", false},
+		{"10.0.0.1", false},
+		{"172.16.5.4", false},
+		{"192.168.1.1", false},
+		{"fc00::1", false},
+		{"fd12:3456:789a::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"100.64.0.1", false},
+		{"100.127.255.255", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"ff02::1", false},
+		{"255.255.255.255", false},
+		{"192.0.2.1", false},
+		{"2001:db8::1", false},
+
+		// IPv4 addresses written as IPv6 must not get around the checks
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"::ffff:100.64.0.1", false},
+		{"::ffff:93.184.216.34", true},
+		{"64:ff9b::a00:1", false},
+	}
+	for _, test := range tests {
+		t.Run(test.ip, func(t *testing.T) {
+			ip := net.ParseIP(test.ip)
+			if ip == nil {
+				t.Fatalf("invalid test address %s", test.ip)
+			}
+			if got := isPublicIP(ip); got != test.public {
+				t.Errorf("isPublicIP(%s) returned %v, want %v", test.ip, got, test.public)
+			}
+		})
+	}
+}
+
+func TestReadMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want map[string]string
+	}{
+		{
+			name: "open graph",
+			page: `<html><head><title>Fallback</title>
+				<meta property="og:title" content="Example">
+				<meta property="og:description" content="An example page">
+				<meta name="description" content="Plain description">
+				</head><body>ignored</body></html>`,
+			want: map[string]string{
+				"title":          "Fallback",
+				"og:title":       "Example",
+				"og:description": "An example page",
+				"description":    "Plain description",
+			},
+		},
+		{
+			name: "first occurrence wins and keys are lowercased",
+			page: `<head><meta property="OG:Title" content="First"><meta property="og:title" content="Second"></head>`,
+			want: map[string]string{"og:title": "First", "title": ""},
+		},
+		{
+			name: "property wins over name",
+			page: `<head><meta property="og:image" name="image" content="https://example.com/a.png"></head>`,
+			want: map[string]string{"og:image": "https://example.com/a.png", "title": ""},
+		},
+		{
+			name: "self-closing tags",
+			page: `<head><title>Page</title><meta name="twitter:title" content="Tweet"/></head>`,
+			want: map[string]string{"title": "Page", "twitter:title": "Tweet"},
+		},
+		{
+			name: "body metadata is ignored",
+			page: `<html><body><meta property="og:title" content="Late"><title>Late</title></body></html>`,
+			want: map[string]string{"title": ""},
+		},
+		{
+			name: "head without closing tag",
+			page: `<title>Unclosed`,
+			want: map[string]string{"title": "Unclosed"},
+		},
+		{
+			name: "meta without key",
+			page: `<head><meta content="orphan"><meta charset="utf-8"></head>`,
+			want: map[string]string{"title": ""},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := readMetadata(strings.NewReader(test.page))
+			if len(got) != len(test.want) {
+				t.Errorf("readMetadata returned %v, want %v", got, test.want)
+			}
+			for key, want := range test.want {
+				if got[key] != want {
+					t.Errorf("readMetadata returned %q for %q, want %q", got[key], key, want)
+				}
+			}
+		})
+	}
+}
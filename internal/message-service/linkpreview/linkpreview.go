@@ -0,0 +1,103 @@
+// Package linkpreview finds URLs in message text and builds previews of the
+// linked pages from their OpenGraph and HTML metadata.
+package linkpreview
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"whatsapp/pkg/models"
+)
+
+// Fetcher retrieves the preview of a single URL. It returns nil if the page
+// has nothing worth showing.
+type Fetcher interface {
+	Fetch(ctx context.Context, rawURL string) (*models.LinkPreview, error)
+}
+
+// Cache stores previews by URL. A nil preview records that a URL has none.
+type Cache interface {
+	Get(ctx context.Context, rawURL string) (preview *models.LinkPreview, found bool, err error)
+	Put(ctx context.Context, rawURL string, preview *models.LinkPreview, ttl time.Duration) error
+}
+
+// Previewer returns previews of URLs, consulting a cache before fetching
+type Previewer struct {
+	fetcher    Fetcher
+	cache      Cache
+	ttl        time.Duration
+	failureTTL time.Duration
+}
+
+// NewPreviewer creates a previewer that caches previews for ttl and URLs
+// without a preview, or whose fetch failed, for failureTTL
+func NewPreviewer(fetcher Fetcher, cache Cache, ttl, failureTTL time.Duration) *Previewer {
+	return &Previewer{
+		fetcher:    fetcher,
+		cache:      cache,
+		ttl:        ttl,
+		failureTTL: failureTTL,
+	}
+}
+
+// Preview returns the preview of rawURL, or nil if there is none
+func (p *Previewer) Preview(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	preview, found, err := p.cache.Get(ctx, rawURL)
+	if err != nil {
+		log.Printf("Failed to read link preview cache: %v", err)
+	} else if found {
+		return preview, nil
+	}
+
+	preview, err = p.fetcher.Fetch(ctx, rawURL)
+	ttl := p.ttl
+	if err != nil || preview == nil {
+		ttl = p.failureTTL
+	}
+	if cacheErr := p.cache.Put(ctx, rawURL, preview, ttl); cacheErr != nil {
+		log.Printf("Failed to cache link preview: %v", cacheErr)
+	}
+	return preview, err
+}
+
+var urlPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"]+`)
+
+// FirstURL returns the first http(s) URL in text, or "" if there is none.
+// Links written as www.example.com are returned with an https scheme.
+func FirstURL(text string) string {
+	for _, match := range urlPattern.FindAllString(text, 5) {
+		candidate := trimURL(match)
+		if strings.HasPrefix(strings.ToLower(candidate), "www.") {
+			candidate = "https://" + candidate
+		}
+
+		parsed, err := url.Parse(candidate)
+		if err != nil || parsed.Hostname() == "" || !strings.Contains(parsed.Hostname(), ".") {
+			continue
+		}
+		return parsed.String()
+	}
+	return ""
+}
+
+// trimURL drops punctuation that ends the sentence rather than the URL
+func trimURL(match string) string {
+	for len(match) > 0 {
+		last := match[len(match)-1]
+		switch {
+		case strings.ContainsRune(".,;:!?'\"*", rune(last)):
+			match = match[:len(match)-1]
+		case last == ')' && strings.Count(match, "(") < strings.Count(match, ")"):
+			match = match[:len(match)-1]
+		case last == ']' && strings.Count(match, "[") < strings.Count(match, "]"):
+			match = match[:len(match)-1]
+		default:
+			return match
+		}
+	}
+	return match
+}
@@ -0,0 +1,61 @@
+package linkpreview
+
+import "testing"
+
+func TestFirstURL(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"see https://example.com/page", "https://example.com/page"},
+		{"HTTP://Example.com/Path?q=1", "http://Example.com/Path?q=1"},
+		{"go to www.example.com now", "https://www.example.com"},
+		{"first http://a.example.com then https://b.example.com", "http://a.example.com"},
+		{"ends a sentence: https://example.com/page.", "https://example.com/page"},
+		{"lots of punctuation https://example.com/page?!...", "https://example.com/page"},
+		{"(see https://example.com/page)", "https://example.com/page"},
+		{"https://en.wikipedia.org/wiki/Go_(programming_language)", "https://en.wikipedia.org/wiki/Go_(programming_language)"},
+		{"(https://en.wikipedia.org/wiki/Go_(programming_language))", "https://en.wikipedia.org/wiki/Go_(programming_language)"},
+		{"[https://example.com/a]", "https://example.com/a"},
+		{`"https://example.com/quoted"`, "https://example.com/quoted"},
+		{"<https://example.com/angle>", "https://example.com/angle"},
+		{"skips http://localhost/admin for https://example.com", "https://example.com"},
+		{"no links here", ""},
+		{"ftp://example.com/file", ""},
+		{"https://", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			if got := FirstURL(test.text); got != test.want {
+				t.Errorf("FirstURL(%q) returned %q, want %q", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestTrimURL(t *testing.T) {
+	tests := []struct {
+		match string
+		want  string
+	}{
+		{"https://example.com", "https://example.com"},
+		{"https://example.com/.", "https://example.com/"},
+		{"https://example.com/a,", "https://example.com/a"},
+		{"https://example.com/a';", "https://example.com/a"},
+		{"https://example.com/a)", "https://example.com/a"},
+		{"https://example.com/(a)", "https://example.com/(a)"},
+		{"https://example.com/(a))", "https://example.com/(a)"},
+		{"https://example.com/a]", "https://example.com/a"},
+		{"https://example.com/[a]", "https://example.com/[a]"},
+		{"https://example.com/a*", "https://example.com/a"},
+		{"...", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.match, func(t *testing.T) {
+			if got := trimURL(test.match); got != test.want {
+				t.Errorf("trimURL(%q) returned %q, want %q", test.match, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,570 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// EventPublisher publishes events to RabbitMQ exchanges
+type EventPublisher interface {
+	PublishToExchange(exchange, routingKey string, data interface{}) error
+}
+
+// AccountHandler handles account deletion and personal data export
+type AccountHandler struct {
+	usersCollection         *mongo.Collection
+	contactsCollection      *mongo.Collection
+	groupsCollection        *mongo.Collection
+	communitiesCollection   *mongo.Collection
+	draftsCollection        *mongo.Collection
+	statusesCollection      *mongo.Collection
+	statusViewsCollection   *mongo.Collection
+	statusPrivacyCollection *mongo.Collection
+	statusSlotsCollection   *mongo.Collection
+	mediaCollection         *mongo.Collection
+	publisher               EventPublisher
+	messageServiceURL       string
+	gracePeriod             time.Duration
+}
+
+// NewAccountHandler creates a new account handler. publisher may be nil when RabbitMQ is unavailable.
+func NewAccountHandler(db *mongo.Database, publisher EventPublisher, messageServiceURL string, gracePeriod time.Duration) *AccountHandler {
+	return &AccountHandler{
+		usersCollection:         db.Collection("users"),
+		contactsCollection:      db.Collection("contacts"),
+		groupsCollection:        db.Collection("groups"),
+		communitiesCollection:   db.Collection("communities"),
+		draftsCollection:        db.Collection("drafts"),
+		statusesCollection:      db.Collection("statuses"),
+		statusViewsCollection:   db.Collection("status_views"),
+		statusPrivacyCollection: db.Collection("status_privacy"),
+		statusSlotsCollection:   db.Collection("status_slots"),
+		mediaCollection:         db.Collection("media"),
+		publisher:               publisher,
+		messageServiceURL:       messageServiceURL,
+		gracePeriod:             gracePeriod,
+	}
+}
+
+// DeleteAccount godoc
+// @Summary      Delete my account
+// @Description  Schedules the current user's account for deletion after a grace period. Requires the account password.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        confirmation  body      models.AccountDeletionRequest  true  "Password confirmation"
+// @Success      202           {object}  models.AccountDeletionResponse
+// @Failure      400           {object}  models.ErrorResponse
+// @Failure      401           {object}  models.ErrorResponse
+// @Failure      500           {object}  models.ErrorResponse
+// @Router       /users/me [delete]
+func (h *AccountHandler) DeleteAccount(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var input models.AccountDeletionRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.Password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	now := time.Now()
+	scheduledAt := now.Add(h.gracePeriod)
+	if !user.DeletionScheduledAt.IsZero() {
+		// Repeating the request must not extend an existing grace period
+		scheduledAt = user.DeletionScheduledAt
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"deletion_requested_at": now,
+			"deletion_scheduled_at": scheduledAt,
+			"updated_at":            now,
+		},
+	}
+	if _, err := h.usersCollection.UpdateOne(context.Background(), bson.M{"_id": user.ID}, update); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule account deletion"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.AccountDeletionResponse{
+		Message:     "Account scheduled for deletion",
+		ScheduledAt: scheduledAt.Format(time.RFC3339),
+	})
+}
+
+// CancelAccountDeletion godoc
+// @Summary      Cancel account deletion
+// @Description  Cancels a pending account deletion during the grace period
+// @Tags         users
+// @Produce      json
+// @Success      200  {object}  models.SuccessResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /users/me/deletion/cancel [post]
+func (h *AccountHandler) CancelAccountDeletion(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.DeletionScheduledAt.IsZero() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No pending account deletion"})
+		return
+	}
+
+	update := bson.M{
+		"$unset": bson.M{
+			"deletion_requested_at": "",
+			"deletion_scheduled_at": "",
+		},
+		"$set": bson.M{"updated_at": time.Now()},
+	}
+	if _, err := h.usersCollection.UpdateOne(context.Background(), bson.M{"_id": user.ID}, update); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel account deletion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Message: "Account deletion cancelled"})
+}
+
+// ExportData godoc
+// @Summary      Export my data
+// @Description  Downloads a ZIP archive with the current user's profile, contacts, groups and message history
+// @Tags         users
+// @Produce      application/zip
+// @Success      200  {file}    file
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      502  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /users/me/export [get]
+func (h *AccountHandler) ExportData(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+
+	contacts, err := h.exportContacts(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export contacts"})
+		return
+	}
+
+	groups, err := h.exportGroups(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export groups"})
+		return
+	}
+
+	// Message history lives in the message service; fetch it with the caller's own token
+	messages, err := h.fetchMessageHistory(c.GetHeader("Authorization"))
+	if err != nil {
+		log.Printf("Failed to fetch message history for export: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to export message history"})
+		return
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", user},
+		{"contacts.json", contacts},
+		{"groups.json", groups},
+		{"messages.json", messages},
+	}
+
+	filename := fmt.Sprintf("whatsapp-export-%s-%s.zip", user.ID.Hex(), time.Now().Format("20060102"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	archive := zip.NewWriter(c.Writer)
+	for _, file := range files {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			log.Printf("Failed to add %s to export: %v", file.name, err)
+			return
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			log.Printf("Failed to write %s to export: %v", file.name, err)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		log.Printf("Failed to finish export archive: %v", err)
+	}
+}
+
+// exportContacts returns the users explicitly added as contacts
+func (h *AccountHandler) exportContacts(ctx context.Context, userID primitive.ObjectID) ([]models.UserResponse, error) {
+	cursor, err := h.contactsCollection.Find(ctx, bson.M{"UserID": userID})
+	if err != nil {
+		return nil, err
+	}
+
+	var contacts []struct {
+		ContactID primitive.ObjectID `bson:"contact_id"`
+	}
+	if err := cursor.All(ctx, &contacts); err != nil {
+		return nil, err
+	}
+
+	contactIDs := []primitive.ObjectID{}
+	for _, contact := range contacts {
+		contactIDs = append(contactIDs, contact.ContactID)
+	}
+
+	responses := []models.UserResponse{}
+	if len(contactIDs) == 0 {
+		return responses, nil
+	}
+
+	userCursor, err := h.usersCollection.Find(ctx, bson.M{"_id": bson.M{"$in": contactIDs}})
+	if err != nil {
+		return nil, err
+	}
+
+	var users []models.User
+	if err := userCursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		responses = append(responses, user.ToPublicResponse())
+	}
+	return responses, nil
+}
+
+// exportGroups returns the groups the user is a member of
+func (h *AccountHandler) exportGroups(ctx context.Context, userID primitive.ObjectID) ([]models.Group, error) {
+	cursor, err := h.groupsCollection.Find(ctx, bson.M{"member_ids": userID})
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []models.Group{}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// fetchMessageHistory downloads the caller's messages from the message service
+func (h *AccountHandler) fetchMessageHistory(authHeader string) ([]json.RawMessage, error) {
+	req, err := http.NewRequest(http.MethodGet, h.messageServiceURL+"/messages/export", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", authHeader)
+
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("message service returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	messages := []json.RawMessage{}
+	if err := json.NewDecoder(resp.Body).Decode(&messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// currentUser loads the authenticated user, writing an error response if that fails
+func (h *AccountHandler) currentUser(c *gin.Context) (models.User, bool) {
+	var user models.User
+
+	userID, exists := c.Get("UserID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return user, false
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return user, false
+	}
+
+	err = h.usersCollection.FindOne(context.Background(), bson.M{
+		"_id":        objectID,
+		"deleted_at": bson.M{"$exists": false},
+	}).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return user, false
+	}
+
+	return user, true
+}
+
+// StartDeletionWorker periodically purges accounts whose grace period has expired
+func (h *AccountHandler) StartDeletionWorker(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// Accounts purged earlier were marked with a "deleted" presence
+		result, err := h.usersCollection.UpdateMany(context.Background(),
+			bson.M{"status": "deleted"},
+			bson.M{"$set": bson.M{"status": "offline", "deleted": true}},
+		)
+		if err != nil {
+			log.Printf("Failed to mark deleted accounts: %v", err)
+		} else if result.ModifiedCount > 0 {
+			log.Printf("Marked %d deleted accounts", result.ModifiedCount)
+		}
+
+		for {
+			h.purgeDueAccounts()
+			<-ticker.C
+		}
+	}()
+}
+
+// purgeDueAccounts anonymizes every account whose deletion is due
+func (h *AccountHandler) purgeDueAccounts() {
+	ctx := context.Background()
+
+	cursor, err := h.usersCollection.Find(ctx, bson.M{
+		"deletion_scheduled_at": bson.M{"$lte": time.Now()},
+		"deleted_at":            bson.M{"$exists": false},
+	})
+	if err != nil {
+		log.Printf("Failed to find accounts due for deletion: %v", err)
+		return
+	}
+
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		log.Printf("Failed to parse accounts due for deletion: %v", err)
+		return
+	}
+
+	for _, user := range users {
+		if err := h.purgeAccount(ctx, user.ID); err != nil {
+			log.Printf("Failed to delete account %s: %v", user.ID.Hex(), err)
+			continue
+		}
+		log.Printf("Deleted account %s", user.ID.Hex())
+	}
+}
+
+// purgeAccount anonymizes the user document, removes contacts and group memberships
+// and notifies the message service, which applies its own message retention policy.
+func (h *AccountHandler) purgeAccount(ctx context.Context, userID primitive.ObjectID) error {
+	now := time.Now()
+
+	// The username and email are replaced so that they can be registered again
+	update := bson.M{
+		"$set": bson.M{
+			"username":   "deleted-" + userID.Hex(),
+			"email":      "deleted-" + userID.Hex() + "@deleted.invalid",
+			"full_name":  "Deleted account",
+			"avatar_url": "",
+			"password":   "",
+			"status":     "offline",
+			"deleted":    true,
+			"deleted_at": now,
+			"updated_at": now,
+		},
+		"$unset": bson.M{
+			"last_login":            "",
+			"deletion_requested_at": "",
+			"deletion_scheduled_at": "",
+			"about":                 "",
+			"about_updated_at":      "",
+			"phone_number":          "",
+			"phone_verified":        "",
+			"phone_key":             "",
+			"email_key":             "",
+			"timezone":              "",
+		},
+	}
+	if _, err := h.usersCollection.UpdateOne(ctx, bson.M{"_id": userID}, update); err != nil {
+		return err
+	}
+
+	_, err := h.contactsCollection.DeleteMany(ctx, bson.M{
+		"$or": []bson.M{
+			{"UserID": userID},
+			{"contact_id": userID},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := h.leaveAllGroups(ctx, userID); err != nil {
+		return err
+	}
+
+	if _, err := h.draftsCollection.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+		return err
+	}
+
+	if err := h.deleteStatuses(ctx, userID); err != nil {
+		return err
+	}
+
+	if h.publisher != nil {
+		event := models.AccountDeletedEvent{
+			Type:      "account_deleted",
+			UserID:    userID.Hex(),
+			DeletedAt: now.Format(time.RFC3339),
+		}
+		routingKey := fmt.Sprintf("account.deleted.%s", userID.Hex())
+		if err := h.publisher.PublishToExchange("messages", routingKey, event); err != nil {
+			log.Printf("Failed to publish account deletion for %s: %v", userID.Hex(), err)
+		}
+	} else {
+		log.Printf("RabbitMQ unavailable: messages of deleted account %s were not processed", userID.Hex())
+	}
+
+	return nil
+}
+
+// deleteStatuses deletes the statuses of the user with everyone's views of
+// them, the views the user left on other statuses and their status settings.
+// The statuses give back their references to media, and the message service
+// collects media nothing uses anymore.
+func (h *AccountHandler) deleteStatuses(ctx context.Context, userID primitive.ObjectID) error {
+	var statuses []struct {
+		ID      primitive.ObjectID `bson:"_id"`
+		MediaID primitive.ObjectID `bson:"media_id,omitempty"`
+	}
+	cursor, err := h.statusesCollection.Find(ctx, bson.M{"author_id": userID}, options.Find().SetProjection(bson.M{"_id": 1, "media_id": 1}))
+	if err != nil {
+		return err
+	}
+	if err := cursor.All(ctx, &statuses); err != nil {
+		return err
+	}
+	statusIDs := make([]primitive.ObjectID, 0, len(statuses))
+	refs := make(map[primitive.ObjectID]int64)
+	for _, status := range statuses {
+		statusIDs = append(statusIDs, status.ID)
+		if !status.MediaID.IsZero() {
+			refs[status.MediaID]++
+		}
+	}
+
+	views := bson.M{"viewer_id": userID}
+	if len(statusIDs) > 0 {
+		views = bson.M{"$or": []bson.M{views, {"status_id": bson.M{"$in": statusIDs}}}}
+	}
+	if _, err := h.statusViewsCollection.DeleteMany(ctx, views); err != nil {
+		return err
+	}
+	if _, err := h.statusesCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": statusIDs}}); err != nil {
+		return err
+	}
+	for mediaID, n := range refs {
+		if _, err := h.mediaCollection.UpdateOne(ctx, bson.M{"_id": mediaID}, bson.M{"$inc": bson.M{"ref_count": -n}}); err != nil {
+			return err
+		}
+	}
+	if _, err := h.statusPrivacyCollection.DeleteOne(ctx, bson.M{"_id": userID}); err != nil {
+		return err
+	}
+	_, err = h.statusSlotsCollection.DeleteOne(ctx, bson.M{"_id": userID})
+	return err
+}
+
+// leaveAllGroups removes the user from every group and community, handing
+// ownership to another member, preferably an admin, and deleting groups that
+// end up empty
+func (h *AccountHandler) leaveAllGroups(ctx context.Context, userID primitive.ObjectID) error {
+	if err := leaveGroups(ctx, h.groupsCollection, h.communitiesCollection, bson.M{"member_ids": userID}, userID); err != nil {
+		return err
+	}
+	return h.leaveAllCommunities(ctx, userID)
+}
+
+// leaveAllCommunities hands the communities the user administers over to
+// another admin, or to whoever now owns the announcements group, and deletes
+// communities that have no members left
+func (h *AccountHandler) leaveAllCommunities(ctx context.Context, userID primitive.ObjectID) error {
+	cursor, err := h.communitiesCollection.Find(ctx, bson.M{"admin_ids": userID})
+	if err != nil {
+		return err
+	}
+
+	var communities []models.Community
+	if err := cursor.All(ctx, &communities); err != nil {
+		return err
+	}
+
+	for _, community := range communities {
+		var adminIDs []primitive.ObjectID
+		for _, adminID := range community.AdminIDs {
+			if adminID != userID {
+				adminIDs = append(adminIDs, adminID)
+			}
+		}
+
+		set := bson.M{"updated_at": time.Now()}
+		if len(adminIDs) == 0 {
+			var announcements models.Group
+			err := h.groupsCollection.FindOne(ctx, bson.M{"_id": community.AnnouncementGroupID}).Decode(&announcements)
+			if err == mongo.ErrNoDocuments {
+				// The user was the last member
+				if err := deleteCommunity(ctx, h.communitiesCollection, h.groupsCollection, community.ID); err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			adminIDs = append(adminIDs, announcements.OwnerID)
+		}
+		if community.OwnerID == userID {
+			set["owner_id"] = adminIDs[0]
+		}
+		set["admin_ids"] = adminIDs
+		if _, err := h.communitiesCollection.UpdateOne(ctx, bson.M{"_id": community.ID}, bson.M{"$set": set}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,757 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxCommunityGroups caps the groups of a community, the announcements group included
+const maxCommunityGroups = 100
+
+// EnsureCommunityIndexes creates the indexes used to look up the groups and
+// admins of communities
+func (h *GroupHandler) EnsureCommunityIndexes(ctx context.Context) error {
+	if _, err := h.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "community_id", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	}); err != nil {
+		return err
+	}
+	_, err := h.communitiesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "admin_ids", Value: 1}},
+	})
+	return err
+}
+
+// CreateCommunity godoc
+// @Summary      Create a community
+// @Description  Creates a community with the caller as owner, together with its announcements group. Groups the caller administers can be linked right away; their members join the community.
+// @Tags         communities
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        community  body      models.CommunityRequest  true  "Community to create"
+// @Success      201        {object}  models.CommunityResponse
+// @Failure      400        {object}  models.ErrorResponse
+// @Failure      401        {object}  models.ErrorResponse
+// @Failure      409        {object}  models.ErrorResponse
+// @Failure      500        {object}  models.ErrorResponse
+// @Router       /communities [post]
+func (h *GroupHandler) CreateCommunity(c *gin.Context) {
+	var input models.CommunityRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	seen := make(map[primitive.ObjectID]bool, len(input.GroupIDs))
+	var groupIDs []primitive.ObjectID
+	for _, hexID := range input.GroupIDs {
+		groupID, err := primitive.ObjectIDFromHex(hexID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID: " + hexID})
+			return
+		}
+		if !seen[groupID] {
+			seen[groupID] = true
+			groupIDs = append(groupIDs, groupID)
+		}
+	}
+	if len(groupIDs) >= maxCommunityGroups {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many groups"})
+		return
+	}
+
+	ctx := context.Background()
+	var groups []models.Group
+	if len(groupIDs) > 0 {
+		cursor, err := h.collection.Find(ctx, bson.M{"_id": bson.M{"$in": groupIDs}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if err := cursor.All(ctx, &groups); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse groups"})
+			return
+		}
+		if len(groups) != len(groupIDs) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Group not found"})
+			return
+		}
+	}
+
+	// Everyone in a linked group becomes a member of the community
+	memberIDs := []primitive.ObjectID{userID}
+	isMember := map[primitive.ObjectID]bool{userID: true}
+	for _, group := range groups {
+		if !group.IsAdmin(userID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only groups you administer can be added: " + group.ID.Hex()})
+			return
+		}
+		if !group.CommunityID.IsZero() {
+			c.JSON(http.StatusConflict, gin.H{"error": "Group already belongs to a community: " + group.ID.Hex()})
+			return
+		}
+		for _, memberID := range group.MemberIDs {
+			if !isMember[memberID] {
+				isMember[memberID] = true
+				memberIDs = append(memberIDs, memberID)
+			}
+		}
+	}
+
+	now := time.Now()
+	community := models.Community{
+		ID:                  primitive.NewObjectID(),
+		Name:                input.Name,
+		Description:         input.Description,
+		OwnerID:             userID,
+		AdminIDs:            []primitive.ObjectID{userID},
+		AnnouncementGroupID: primitive.NewObjectID(),
+		CreatedAt:           now,
+		UpdatedAt:           now,
+	}
+	announcements := models.Group{
+		ID:            community.AnnouncementGroupID,
+		Name:          input.Name,
+		Description:   input.Description,
+		OwnerID:       userID,
+		MemberIDs:     memberIDs,
+		CommunityID:   community.ID,
+		Announcements: true,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	if _, err := h.communitiesCollection.InsertOne(ctx, community); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create community"})
+		return
+	}
+	if _, err := h.collection.InsertOne(ctx, announcements); err != nil {
+		h.communitiesCollection.DeleteOne(ctx, bson.M{"_id": community.ID})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create community"})
+		return
+	}
+	if len(groupIDs) > 0 {
+		// Groups linked to another community in the meantime stay where they are
+		filter := bson.M{"_id": bson.M{"$in": groupIDs}, "community_id": bson.M{"$exists": false}}
+		update := bson.M{"$set": bson.M{"community_id": community.ID, "updated_at": now}}
+		if _, err := h.collection.UpdateMany(ctx, filter, update); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add groups"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusCreated, communityResponse(community, userID))
+}
+
+// GetUserCommunities godoc
+// @Summary      List communities
+// @Description  Lists the communities the current user is a member of
+// @Tags         communities
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}   models.CommunityResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /communities [get]
+func (h *GroupHandler) GetUserCommunities(c *gin.Context) {
+	userID, ok := currentUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	communityIDs, err := h.collection.Distinct(ctx, "community_id", bson.M{"announcements": true, "member_ids": userID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	communities := []models.Community{}
+	if len(communityIDs) > 0 {
+		opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+		cursor, err := h.communitiesCollection.Find(ctx, bson.M{"_id": bson.M{"$in": communityIDs}}, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if err := cursor.All(ctx, &communities); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse communities"})
+			return
+		}
+	}
+
+	responses := make([]models.CommunityResponse, 0, len(communities))
+	for _, community := range communities {
+		responses = append(responses, communityResponse(community, userID))
+	}
+	c.JSON(http.StatusOK, responses)
+}
+
+// GetCommunity godoc
+// @Summary      Get a community
+// @Description  Returns a community the current user is a member of
+// @Tags         communities
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      string  true  "Community ID"
+// @Success      200  {object}  models.CommunityResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /communities/{id} [get]
+func (h *GroupHandler) GetCommunity(c *gin.Context) {
+	userID, ok := currentUserObjectID(c)
+	if !ok {
+		return
+	}
+	community, ok := h.loadCommunity(c, userID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, communityResponse(community, userID))
+}
+
+// GetCommunityGroups godoc
+// @Summary      List the groups of a community
+// @Description  Lists the groups of a community, announcements group first, so that members can find groups to join
+// @Tags         communities
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      string  true  "Community ID"
+// @Success      200  {array}   models.CommunityGroupResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /communities/{id}/groups [get]
+func (h *GroupHandler) GetCommunityGroups(c *gin.Context) {
+	userID, ok := currentUserObjectID(c)
+	if !ok {
+		return
+	}
+	community, ok := h.loadCommunity(c, userID)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	opts := options.Find().SetSort(bson.D{{Key: "announcements", Value: -1}, {Key: "name", Value: 1}})
+	cursor, err := h.collection.Find(ctx, bson.M{"community_id": community.ID}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var groups []models.Group
+	if err := cursor.All(ctx, &groups); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse groups"})
+		return
+	}
+
+	// Members only see who is in the groups they joined themselves
+	responses := make([]models.CommunityGroupResponse, 0, len(groups))
+	for _, group := range groups {
+		joined := false
+		for _, memberID := range group.MemberIDs {
+			if memberID == userID {
+				joined = true
+				break
+			}
+		}
+		responses = append(responses, models.CommunityGroupResponse{
+			ID:            group.ID.Hex(),
+			Name:          group.Name,
+			Description:   group.Description,
+			MemberCount:   len(group.MemberIDs),
+			Announcements: group.Announcements,
+			Joined:        joined,
+		})
+	}
+	c.JSON(http.StatusOK, responses)
+}
+
+// AddCommunityGroup godoc
+// @Summary      Add a group to a community
+// @Description  Links a group to a community. The caller must administer both. Members of the group join the community.
+// @Tags         communities
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id     path      string                        true  "Community ID"
+// @Param        group  body      models.CommunityGroupRequest  true  "Group to add"
+// @Success      200    {object}  models.GroupResponse
+// @Failure      400    {object}  models.ErrorResponse
+// @Failure      401    {object}  models.ErrorResponse
+// @Failure      403    {object}  models.ErrorResponse
+// @Failure      404    {object}  models.ErrorResponse
+// @Failure      409    {object}  models.ErrorResponse
+// @Failure      500    {object}  models.ErrorResponse
+// @Router       /communities/{id}/groups [post]
+func (h *GroupHandler) AddCommunityGroup(c *gin.Context) {
+	var input models.CommunityGroupRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	groupID, err := primitive.ObjectIDFromHex(input.GroupID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	userID, ok := currentUserObjectID(c)
+	if !ok {
+		return
+	}
+	community, ok := h.loadCommunity(c, userID)
+	if !ok {
+		return
+	}
+	if !community.IsAdmin(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only community admins can add groups"})
+		return
+	}
+
+	ctx := context.Background()
+	var group models.Group
+	if err := h.collection.FindOne(ctx, bson.M{"_id": groupID, "member_ids": userID}).Decode(&group); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+	if !group.IsAdmin(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only groups you administer can be added"})
+		return
+	}
+
+	count, err := h.collection.CountDocuments(ctx, bson.M{"community_id": community.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if count >= maxCommunityGroups {
+		c.JSON(http.StatusConflict, gin.H{"error": "The community has reached the maximum number of groups"})
+		return
+	}
+
+	now := time.Now()
+	filter := bson.M{"_id": groupID, "community_id": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"community_id": community.ID, "updated_at": now}}
+	result, err := h.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add group"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Group already belongs to a community"})
+		return
+	}
+
+	membersUpdate := bson.M{
+		"$addToSet": bson.M{"member_ids": bson.M{"$each": group.MemberIDs}},
+		"$set":      bson.M{"updated_at": now},
+	}
+	if _, err := h.collection.UpdateOne(ctx, bson.M{"_id": community.AnnouncementGroupID}, membersUpdate); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add group members to the community"})
+		return
+	}
+
+	group.CommunityID = community.ID
+	c.JSON(http.StatusOK, groupResponse(group))
+}
+
+// RemoveCommunityGroup godoc
+// @Summary      Remove a group from a community
+// @Description  Unlinks a group from a community. The group and its members stay; they remain members of the community. The announcements group cannot be removed. Only community admins can remove groups.
+// @Tags         communities
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id        path  string  true  "Community ID"
+// @Param        group_id  path  string  true  "Group to remove"
+// @Success      204
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /communities/{id}/groups/{group_id} [delete]
+func (h *GroupHandler) RemoveCommunityGroup(c *gin.Context) {
+	groupID, err := primitive.ObjectIDFromHex(c.Param("group_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	userID, ok := currentUserObjectID(c)
+	if !ok {
+		return
+	}
+	community, ok := h.loadCommunity(c, userID)
+	if !ok {
+		return
+	}
+	if !community.IsAdmin(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only community admins can remove groups"})
+		return
+	}
+	if groupID == community.AnnouncementGroupID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The announcements group cannot be removed"})
+		return
+	}
+
+	update := bson.M{
+		"$unset": bson.M{"community_id": ""},
+		"$set":   bson.M{"updated_at": time.Now()},
+	}
+	result, err := h.collection.UpdateOne(context.Background(), bson.M{"_id": groupID, "community_id": community.ID}, update)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove group"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// JoinCommunityGroup godoc
+// @Summary      Join a group of a community
+// @Description  Adds the current user to a group of a community they are a member of
+// @Tags         communities
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id        path      string  true  "Community ID"
+// @Param        group_id  path      string  true  "Group to join"
+// @Success      200       {object}  models.GroupResponse
+// @Failure      400       {object}  models.ErrorResponse
+// @Failure      401       {object}  models.ErrorResponse
+// @Failure      404       {object}  models.ErrorResponse
+// @Failure      500       {object}  models.ErrorResponse
+// @Router       /communities/{id}/groups/{group_id}/join [post]
+func (h *GroupHandler) JoinCommunityGroup(c *gin.Context) {
+	groupID, err := primitive.ObjectIDFromHex(c.Param("group_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	userID, ok := currentUserObjectID(c)
+	if !ok {
+		return
+	}
+	community, ok := h.loadCommunity(c, userID)
+	if !ok {
+		return
+	}
+
+	filter := bson.M{"_id": groupID, "community_id": community.ID}
+	update := bson.M{
+		"$addToSet": bson.M{"member_ids": userID},
+		"$set":      bson.M{"updated_at": time.Now()},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var group models.Group
+	if err := h.collection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&group); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join group"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, groupResponse(group))
+}
+
+// RemoveCommunityMember godoc
+// @Summary      Remove a member from a community
+// @Description  Removes a user from every group of a community at once, the announcements group included. Admins can remove anyone but the owner; members can remove themselves to leave.
+// @Tags         communities
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id       path  string  true  "Community ID"
+// @Param        user_id  path  string  true  "Member to remove"
+// @Success      204
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /communities/{id}/members/{user_id} [delete]
+func (h *GroupHandler) RemoveCommunityMember(c *gin.Context) {
+	memberID, err := primitive.ObjectIDFromHex(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	userID, ok := currentUserObjectID(c)
+	if !ok {
+		return
+	}
+	community, ok := h.loadCommunity(c, userID)
+	if !ok {
+		return
+	}
+	if memberID != userID && !community.IsAdmin(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only community admins can remove members"})
+		return
+	}
+	if memberID == community.OwnerID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The owner cannot be removed from the community"})
+		return
+	}
+
+	ctx := context.Background()
+	isMember, err := h.isCommunityMember(ctx, community, memberID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !isMember {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+
+	if err := leaveGroups(ctx, h.collection, h.communitiesCollection, bson.M{"community_id": community.ID, "member_ids": memberID}, memberID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+	if community.IsAdmin(memberID) {
+		update := bson.M{
+			"$pull": bson.M{"admin_ids": memberID},
+			"$set":  bson.M{"updated_at": time.Now()},
+		}
+		if _, err := h.communitiesCollection.UpdateOne(ctx, bson.M{"_id": community.ID}, update); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+			return
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// AddCommunityAdmin godoc
+// @Summary      Add a community admin
+// @Description  Lets a member manage the groups and members of a community and post in its announcements group. Only the owner can add admins.
+// @Tags         communities
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id     path      string                        true  "Community ID"
+// @Param        admin  body      models.CommunityAdminRequest  true  "New admin"
+// @Success      200    {object}  models.CommunityResponse
+// @Failure      400    {object}  models.ErrorResponse
+// @Failure      401    {object}  models.ErrorResponse
+// @Failure      403    {object}  models.ErrorResponse
+// @Failure      404    {object}  models.ErrorResponse
+// @Failure      500    {object}  models.ErrorResponse
+// @Router       /communities/{id}/admins [post]
+func (h *GroupHandler) AddCommunityAdmin(c *gin.Context) {
+	var input models.CommunityAdminRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	adminID, err := primitive.ObjectIDFromHex(input.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	userID, ok := currentUserObjectID(c)
+	if !ok {
+		return
+	}
+	community, ok := h.loadCommunity(c, userID)
+	if !ok {
+		return
+	}
+	if community.OwnerID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can add admins"})
+		return
+	}
+
+	ctx := context.Background()
+	isMember, err := h.isCommunityMember(ctx, community, adminID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !isMember {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+
+	update := bson.M{
+		"$addToSet": bson.M{"admin_ids": adminID},
+		"$set":      bson.M{"updated_at": time.Now()},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := h.communitiesCollection.FindOneAndUpdate(ctx, bson.M{"_id": community.ID}, update, opts).Decode(&community); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add admin"})
+		return
+	}
+
+	c.JSON(http.StatusOK, communityResponse(community, userID))
+}
+
+// RemoveCommunityAdmin godoc
+// @Summary      Remove a community admin
+// @Description  Takes admin rights away from a member, who stays in the community. Only the owner can remove admins, and the owner always stays one.
+// @Tags         communities
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id       path      string  true  "Community ID"
+// @Param        user_id  path      string  true  "Admin to remove"
+// @Success      200      {object}  models.CommunityResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      401      {object}  models.ErrorResponse
+// @Failure      403      {object}  models.ErrorResponse
+// @Failure      404      {object}  models.ErrorResponse
+// @Failure      500      {object}  models.ErrorResponse
+// @Router       /communities/{id}/admins/{user_id} [delete]
+func (h *GroupHandler) RemoveCommunityAdmin(c *gin.Context) {
+	adminID, err := primitive.ObjectIDFromHex(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	userID, ok := currentUserObjectID(c)
+	if !ok {
+		return
+	}
+	community, ok := h.loadCommunity(c, userID)
+	if !ok {
+		return
+	}
+	if community.OwnerID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can remove admins"})
+		return
+	}
+	if adminID == community.OwnerID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The owner is always an admin"})
+		return
+	}
+
+	update := bson.M{
+		"$pull": bson.M{"admin_ids": adminID},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := h.communitiesCollection.FindOneAndUpdate(context.Background(), bson.M{"_id": community.ID}, update, opts).Decode(&community); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove admin"})
+		return
+	}
+
+	c.JSON(http.StatusOK, communityResponse(community, userID))
+}
+
+// loadCommunity loads the community named by the id parameter, responding
+// with 404 unless userID is a member
+func (h *GroupHandler) loadCommunity(c *gin.Context, userID primitive.ObjectID) (models.Community, bool) {
+	var community models.Community
+	communityID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid community ID"})
+		return community, false
+	}
+
+	ctx := context.Background()
+	if err := h.communitiesCollection.FindOne(ctx, bson.M{"_id": communityID}).Decode(&community); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Community not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return community, false
+	}
+
+	isMember, err := h.isCommunityMember(ctx, community, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return community, false
+	}
+	if !isMember {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Community not found"})
+		return community, false
+	}
+	return community, true
+}
+
+// isCommunityMember reports whether userID belongs to the announcements group of the community
+func (h *GroupHandler) isCommunityMember(ctx context.Context, community models.Community, userID primitive.ObjectID) (bool, error) {
+	count, err := h.collection.CountDocuments(ctx, bson.M{"_id": community.AnnouncementGroupID, "member_ids": userID})
+	return count > 0, err
+}
+
+// deleteCommunity deletes a community and unlinks its remaining groups
+func deleteCommunity(ctx context.Context, communities, groups *mongo.Collection, communityID primitive.ObjectID) error {
+	update := bson.M{
+		"$unset": bson.M{"community_id": "", "announcements": ""},
+		"$set":   bson.M{"updated_at": time.Now()},
+	}
+	if _, err := groups.UpdateMany(ctx, bson.M{"community_id": communityID}, update); err != nil {
+		return err
+	}
+	_, err := communities.DeleteOne(ctx, bson.M{"_id": communityID})
+	return err
+}
+
+// currentUserObjectID returns the ID of the authenticated user, responding
+// with an error if there is none
+func currentUserObjectID(c *gin.Context) (primitive.ObjectID, bool) {
+	currentUserID, exists := c.Get("UserID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return primitive.NilObjectID, false
+	}
+	userID, err := primitive.ObjectIDFromHex(currentUserID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return primitive.NilObjectID, false
+	}
+	return userID, true
+}
+
+// communityResponse converts a stored community into its API representation for userID
+func communityResponse(community models.Community, userID primitive.ObjectID) models.CommunityResponse {
+	adminIDs := make([]string, 0, len(community.AdminIDs))
+	for _, adminID := range community.AdminIDs {
+		adminIDs = append(adminIDs, adminID.Hex())
+	}
+
+	return models.CommunityResponse{
+		ID:                  community.ID.Hex(),
+		Name:                community.Name,
+		Description:         community.Description,
+		OwnerID:             community.OwnerID.Hex(),
+		AdminIDs:            adminIDs,
+		AnnouncementGroupID: community.AnnouncementGroupID.Hex(),
+		IsAdmin:             community.IsAdmin(userID),
+		CreatedAt:           community.CreatedAt.Format(time.RFC3339),
+	}
+}
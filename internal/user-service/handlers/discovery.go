@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"whatsapp/internal/user-service/ratelimit"
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxContactSyncHashes is the maximum number of hashes accepted in one sync request
+const MaxContactSyncHashes = 500
+
+var contactHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// DiscoveryHandler lets users find registered contacts from their address book
+type DiscoveryHandler struct {
+	usersCollection    *mongo.Collection
+	contactsCollection *mongo.Collection
+	contactSecret      []byte
+	limiter            *ratelimit.Limiter
+	ipLimiter          *ratelimit.Limiter
+	globalLimiter      *ratelimit.Limiter
+}
+
+// NewDiscoveryHandler creates a new discovery handler. contactSecret keys the
+// stored hashes, see models.ContactKey. The limiters cap the number of hashes
+// looked up per user, per client IP and in total, which keeps the endpoint
+// from being used to enumerate phone numbers or emails with many accounts.
+func NewDiscoveryHandler(db *mongo.Database, contactSecret []byte, limiter, ipLimiter, globalLimiter *ratelimit.Limiter) *DiscoveryHandler {
+	return &DiscoveryHandler{
+		usersCollection:    db.Collection("users"),
+		contactsCollection: db.Collection("contacts"),
+		contactSecret:      contactSecret,
+		limiter:            limiter,
+		ipLimiter:          ipLimiter,
+		globalLimiter:      globalLimiter,
+	}
+}
+
+// EnsureIndexes creates the indexes used to look up users by hash
+func (h *DiscoveryHandler) EnsureIndexes(ctx context.Context) error {
+	_, err := h.usersCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "phone_key", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "email_key", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+	})
+	return err
+}
+
+// BackfillHashes computes the discovery hashes of accounts created before they
+// existed, and replaces the unkeyed hashes earlier versions stored. Phone
+// numbers are only discoverable once verified.
+func (h *DiscoveryHandler) BackfillHashes(ctx context.Context) error {
+	result, err := h.usersCollection.UpdateMany(ctx,
+		bson.M{"$or": []bson.M{
+			{"phone_hash": bson.M{"$exists": true}},
+			{"email_hash": bson.M{"$exists": true}},
+		}},
+		bson.M{"$unset": bson.M{"phone_hash": "", "email_hash": ""}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Removed unkeyed discovery hashes of %d users", result.ModifiedCount)
+	}
+
+	filter := bson.M{
+		"deleted_at": bson.M{"$exists": false},
+		"$or": []bson.M{
+			{"email_key": bson.M{"$exists": false}},
+			{"phone_verified": true, "phone_key": bson.M{"$exists": false}},
+		},
+	}
+	cursor, err := h.usersCollection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	updated := 0
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+
+		set := bson.M{"email_key": models.ContactKey(h.contactSecret, models.ContactHash(normalizeEmail(user.Email)))}
+		if user.PhoneVerified && user.PhoneNumber != "" {
+			set["phone_key"] = models.ContactKey(h.contactSecret, models.ContactHash(user.PhoneNumber))
+		}
+		if _, err := h.usersCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": set}); err != nil {
+			return err
+		}
+		updated++
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	if updated > 0 {
+		log.Printf("Computed discovery hashes for %d users", updated)
+	}
+	return nil
+}
+
+// SyncContacts godoc
+// @Summary      Find registered contacts
+// @Description  Matches SHA-256 hashes of address book phone numbers (E.164) and emails (lowercased) against registered users, honoring each user's discoverable_by setting. Only verified phone numbers match. Optionally adds every match as a contact. The number of hashes per user, per client IP and in total is limited.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        sync  body      models.ContactSyncRequest  true  "Hashed address book entries"
+// @Success      200   {object}  models.ContactSyncResponse
+// @Failure      400   {object}  models.ErrorResponse
+// @Failure      401   {object}  models.ErrorResponse
+// @Failure      429   {object}  models.RateLimitResponse
+// @Failure      500   {object}  models.ErrorResponse
+// @Router       /users/contacts/sync [post]
+func (h *DiscoveryHandler) SyncContacts(c *gin.Context) {
+	userID, exists := c.Get("UserID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var input models.ContactSyncRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Uploaded hashes by the keyed form they are stored in
+	hashes := make(map[string]string, len(input.Hashes))
+	keys := make([]string, 0, len(input.Hashes))
+	for _, hash := range input.Hashes {
+		hash = strings.ToLower(strings.TrimSpace(hash))
+		if !contactHashPattern.MatchString(hash) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Hashes must be hex-encoded SHA-256 digests"})
+			return
+		}
+		key := models.ContactKey(h.contactSecret, hash)
+		if _, seen := hashes[key]; !seen {
+			hashes[key] = hash
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		c.JSON(http.StatusOK, models.ContactSyncResponse{Matches: []models.ContactMatch{}})
+		return
+	}
+	if len(keys) > MaxContactSyncHashes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many hashes in one request"})
+		return
+	}
+
+	ctx := context.Background()
+
+	// The per-IP and global limits stop enumeration spread over many accounts
+	limits := []struct {
+		limiter *ratelimit.Limiter
+		key     string
+	}{
+		{h.limiter, "contact_sync:" + objectID.Hex()},
+		{h.ipLimiter, "contact_sync_ip:" + c.ClientIP()},
+		{h.globalLimiter, "contact_sync_global"},
+	}
+	for _, limit := range limits {
+		wait, err := limit.limiter.Allow(ctx, limit.key, len(keys))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if wait > 0 {
+			respondTooManyRequests(c, "Contact sync limit reached, please try again later", wait)
+			return
+		}
+	}
+
+	users, err := h.discoverableUsers(ctx, objectID, keys)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	response := models.ContactSyncResponse{Matches: []models.ContactMatch{}}
+	for _, user := range users {
+		// The caller already knows the identifier it matched with, but must not
+		// learn the other one through this endpoint
+		userResponse := user.ToPublicResponse()
+
+		for _, key := range []string{user.PhoneKey, user.EmailKey} {
+			if hash, ok := hashes[key]; ok && key != "" {
+				response.Matches = append(response.Matches, models.ContactMatch{Hash: hash, User: userResponse})
+			}
+		}
+	}
+
+	if input.AddContacts {
+		for _, user := range users {
+			result, err := h.contactsCollection.UpdateOne(
+				ctx,
+				bson.M{"UserID": objectID, "contact_id": user.ID},
+				bson.M{"$setOnInsert": bson.M{"created_at": time.Now()}},
+				options.Update().SetUpsert(true),
+			)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add contacts"})
+				return
+			}
+			if result.UpsertedCount > 0 {
+				response.Added++
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// discoverableUsers returns the users matching any of keys that userID is allowed to discover
+func (h *DiscoveryHandler) discoverableUsers(ctx context.Context, userID primitive.ObjectID, keys []string) ([]models.User, error) {
+	filter := bson.M{
+		"_id":                     bson.M{"$ne": userID},
+		"deleted_at":              bson.M{"$exists": false},
+		"privacy.discoverable_by": bson.M{"$ne": models.DiscoverableByNobody},
+		"$or": []bson.M{
+			// Anyone can put any number on their profile, so only verified ones count
+			{"phone_key": bson.M{"$in": keys}, "phone_verified": true},
+			{"email_key": bson.M{"$in": keys}},
+		},
+	}
+	cursor, err := h.usersCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []models.User
+	if err := cursor.All(ctx, &candidates); err != nil {
+		return nil, err
+	}
+
+	// Users discoverable by their contacts only must have added the caller
+	var restricted []primitive.ObjectID
+	for _, user := range candidates {
+		if user.Privacy.Normalized().DiscoverableBy == models.DiscoverableByContacts {
+			restricted = append(restricted, user.ID)
+		}
+	}
+	allowed := make(map[primitive.ObjectID]bool)
+	if len(restricted) > 0 {
+		owners, err := h.contactsCollection.Distinct(ctx, "UserID", bson.M{
+			"UserID":     bson.M{"$in": restricted},
+			"contact_id": userID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, owner := range owners {
+			if id, ok := owner.(primitive.ObjectID); ok {
+				allowed[id] = true
+			}
+		}
+	}
+
+	users := make([]models.User, 0, len(candidates))
+	for _, user := range candidates {
+		if user.Privacy.Normalized().DiscoverableBy == models.DiscoverableByContacts && !allowed[user.ID] {
+			continue
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
@@ -15,13 +15,15 @@ import (
 
 // GroupHandler handles group-related requests
 type GroupHandler struct {
-	collection *mongo.Collection
+	collection            *mongo.Collection
+	communitiesCollection *mongo.Collection
 }
 
 // NewGroupHandler creates a new group handler
 func NewGroupHandler(db *mongo.Database) *GroupHandler {
 	return &GroupHandler{
-		collection: db.Collection("groups"),
+		collection:            db.Collection("groups"),
+		communitiesCollection: db.Collection("communities"),
 	}
 }
 
@@ -137,22 +139,209 @@ func (h *GroupHandler) GetUserGroups(c *gin.Context) {
 		return
 	}
 
+	drafts, err := h.groupDrafts(context.Background(), currentUserObjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve drafts"})
+		return
+	}
+
 	groupResponses := []models.GroupResponse{}
 	for _, group := range groups {
-		var memberIDs []string
-		for _, oid := range group.MemberIDs {
-			memberIDs = append(memberIDs, oid.Hex())
+		response := groupResponse(group)
+		if draft, ok := drafts[group.ID]; ok {
+			response.Draft = draft.Text
+			response.DraftUpdatedAt = draft.UpdatedAt.Format(time.RFC3339)
 		}
-
-		groupResponses = append(groupResponses, models.GroupResponse{
-			ID:          group.ID.Hex(),
-			Name:        group.Name,
-			Description: group.Description,
-			OwnerID:     group.OwnerID.Hex(),
-			MemberIDs:   memberIDs,
-			CreatedAt:   group.CreatedAt.Format(time.RFC3339),
-		})
+		groupResponses = append(groupResponses, response)
 	}
 
 	c.JSON(http.StatusOK, groupResponses)
 }
+
+// groupDrafts returns the drafts userID left in groups, by group ID. Drafts are
+// saved through the message service.
+func (h *GroupHandler) groupDrafts(ctx context.Context, userID primitive.ObjectID) (map[primitive.ObjectID]models.Draft, error) {
+	cursor, err := h.collection.Database().Collection("drafts").Find(ctx, bson.M{"user_id": userID, "group": true})
+	if err != nil {
+		return nil, err
+	}
+	var drafts []models.Draft
+	if err := cursor.All(ctx, &drafts); err != nil {
+		return nil, err
+	}
+
+	byGroup := make(map[primitive.ObjectID]models.Draft, len(drafts))
+	for _, draft := range drafts {
+		byGroup[draft.ChatID] = draft
+	}
+	return byGroup, nil
+}
+
+// UpdateGroupSettings godoc
+// @Summary      Update group settings
+// @Description  Changes the settings of a group, such as whether only admins can pin messages. Only admins can change settings.
+// @Tags         groups
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id        path      string                       true  "Group ID"
+// @Param        settings  body      models.GroupSettingsRequest  true  "Settings to change"
+// @Success      200       {object}  models.GroupResponse
+// @Failure      400       {object}  models.ErrorResponse
+// @Failure      401       {object}  models.ErrorResponse
+// @Failure      403       {object}  models.ErrorResponse
+// @Failure      404       {object}  models.ErrorResponse
+// @Failure      500       {object}  models.ErrorResponse
+// @Router       /groups/{id}/settings [put]
+func (h *GroupHandler) UpdateGroupSettings(c *gin.Context) {
+	var input models.GroupSettingsRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	currentUserID, exists := c.Get("UserID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(currentUserID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	groupID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	ctx := context.Background()
+	var group models.Group
+	if err := h.collection.FindOne(ctx, bson.M{"_id": groupID, "member_ids": userID}).Decode(&group); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+	if !group.IsAdmin(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only group admins can change settings"})
+		return
+	}
+
+	set := bson.M{"updated_at": time.Now()}
+	if input.OnlyAdminsCanPin != nil {
+		set["only_admins_can_pin"] = *input.OnlyAdminsCanPin
+		group.OnlyAdminsCanPin = *input.OnlyAdminsCanPin
+	}
+	if _, err := h.collection.UpdateOne(ctx, bson.M{"_id": groupID}, bson.M{"$set": set}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, groupResponse(group))
+}
+
+// groupResponse converts a stored group into its API representation
+func groupResponse(group models.Group) models.GroupResponse {
+	var memberIDs []string
+	for _, oid := range group.MemberIDs {
+		memberIDs = append(memberIDs, oid.Hex())
+	}
+
+	var communityID string
+	if !group.CommunityID.IsZero() {
+		communityID = group.CommunityID.Hex()
+	}
+
+	return models.GroupResponse{
+		ID:               group.ID.Hex(),
+		Name:             group.Name,
+		Description:      group.Description,
+		OwnerID:          group.OwnerID.Hex(),
+		MemberIDs:        memberIDs,
+		AvatarURL:        group.AvatarURL,
+		OnlyAdminsCanPin: group.OnlyAdminsCanPin,
+		CommunityID:      communityID,
+		Announcements:    group.Announcements,
+		CreatedAt:        group.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// leaveGroups removes userID from the groups matching filter, handing ownership
+// to another member and deleting groups that end up empty
+func leaveGroups(ctx context.Context, groups, communities *mongo.Collection, filter bson.M, userID primitive.ObjectID) error {
+	cursor, err := groups.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	var matched []models.Group
+	if err := cursor.All(ctx, &matched); err != nil {
+		return err
+	}
+
+	for _, group := range matched {
+		var remaining []primitive.ObjectID
+		for _, memberID := range group.MemberIDs {
+			if memberID != userID {
+				remaining = append(remaining, memberID)
+			}
+		}
+
+		if len(remaining) == 0 {
+			if _, err := groups.DeleteOne(ctx, bson.M{"_id": group.ID}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		set := bson.M{"updated_at": time.Now()}
+		if group.OwnerID == userID {
+			ownerID, err := nextGroupOwner(ctx, communities, group, remaining)
+			if err != nil {
+				return err
+			}
+			set["owner_id"] = ownerID
+		}
+		update := bson.M{
+			"$pull": bson.M{"member_ids": userID},
+			"$set":  set,
+		}
+		if _, err := groups.UpdateOne(ctx, bson.M{"_id": group.ID}, update); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// nextGroupOwner picks who takes over group from the remaining members: an
+// admin of its community if one is a member, else the longest-standing member
+func nextGroupOwner(ctx context.Context, communities *mongo.Collection, group models.Group, remaining []primitive.ObjectID) (primitive.ObjectID, error) {
+	if group.CommunityID.IsZero() {
+		return remaining[0], nil
+	}
+
+	var community models.Community
+	err := communities.FindOne(ctx, bson.M{"_id": group.CommunityID}).Decode(&community)
+	if err == mongo.ErrNoDocuments {
+		return remaining[0], nil
+	}
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	for _, memberID := range remaining {
+		if memberID == community.OwnerID {
+			return memberID, nil
+		}
+	}
+	for _, memberID := range remaining {
+		if community.IsAdmin(memberID) {
+			return memberID, nil
+		}
+	}
+	return remaining[0], nil
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"whatsapp/internal/user-service/ratelimit"
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// phoneCodeExpiry is how long a verification code can be used
+	phoneCodeExpiry = 10 * time.Minute
+	// maxPhoneCodeAttempts is how many wrong codes end a verification
+	maxPhoneCodeAttempts = 5
+)
+
+// CodeSender delivers phone number verification codes, typically by SMS
+type CodeSender interface {
+	SendCode(ctx context.Context, phoneNumber, code string) error
+}
+
+// LogCodeSender writes verification codes to the log instead of sending them,
+// for development setups without an SMS provider
+type LogCodeSender struct{}
+
+// SendCode logs the code
+func (LogCodeSender) SendCode(ctx context.Context, phoneNumber, code string) error {
+	log.Printf("Verification code for %s: %s", phoneNumber, code)
+	return nil
+}
+
+// phoneVerification is a pending verification of a user's phone number
+type phoneVerification struct {
+	UserID      primitive.ObjectID `bson:"_id"`
+	PhoneNumber string             `bson:"phone_number"`
+	CodeHash    string             `bson:"code_hash"`
+	Attempts    int                `bson:"attempts"`
+	ExpiresAt   time.Time          `bson:"expires_at"`
+}
+
+// PhoneHandler verifies that users own the phone number on their profile.
+// Only verified numbers are unique and can be used to discover an account.
+type PhoneHandler struct {
+	usersCollection         *mongo.Collection
+	verificationsCollection *mongo.Collection
+	contactSecret           []byte
+	sender                  CodeSender
+	limiter                 *ratelimit.Limiter
+}
+
+// NewPhoneHandler creates a new phone handler. contactSecret keys the
+// discovery hash of verified numbers, and limiter caps the number of codes
+// each user can request.
+func NewPhoneHandler(db *mongo.Database, contactSecret []byte, sender CodeSender, limiter *ratelimit.Limiter) *PhoneHandler {
+	return &PhoneHandler{
+		usersCollection:         db.Collection("users"),
+		verificationsCollection: db.Collection("phone_verifications"),
+		contactSecret:           contactSecret,
+		sender:                  sender,
+		limiter:                 limiter,
+	}
+}
+
+// EnsureIndexes creates the TTL index that removes expired verifications
+func (h *PhoneHandler) EnsureIndexes(ctx context.Context) error {
+	_, err := h.verificationsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// RequestPhoneCode godoc
+// @Summary      Request a phone verification code
+// @Description  Sends a one-time code to the phone number on the current user's profile. The number is only used for contact discovery once verified with the code. The number of codes per user and day is limited.
+// @Tags         users
+// @Produce      json
+// @Success      202  {object}  models.PhoneVerificationResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      409  {object}  models.ErrorResponse
+// @Failure      429  {object}  models.RateLimitResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /users/me/phone/code [post]
+func (h *PhoneHandler) RequestPhoneCode(c *gin.Context) {
+	userID, ok := h.currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	var user models.User
+	if err := h.usersCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+	if user.PhoneNumber == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Add a phone number to your profile first"})
+		return
+	}
+	if user.PhoneVerified {
+		c.JSON(http.StatusConflict, gin.H{"error": "Phone number is already verified"})
+		return
+	}
+
+	wait, err := h.limiter.Allow(ctx, "phone_code:"+userID.Hex(), 1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if wait > 0 {
+		respondTooManyRequests(c, "Too many verification codes requested, please try again later", wait)
+		return
+	}
+
+	code, err := newPhoneCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create verification code"})
+		return
+	}
+	expiresAt := time.Now().Add(phoneCodeExpiry)
+
+	// A new code replaces any earlier one
+	verification := phoneVerification{
+		UserID:      userID,
+		PhoneNumber: user.PhoneNumber,
+		CodeHash:    phoneCodeHash(userID, code),
+		ExpiresAt:   expiresAt,
+	}
+	if _, err := h.verificationsCollection.ReplaceOne(ctx, bson.M{"_id": userID}, verification, options.Replace().SetUpsert(true)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := h.sender.SendCode(ctx, user.PhoneNumber, code); err != nil {
+		log.Printf("Failed to send verification code to user %s: %v", userID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification code"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.PhoneVerificationResponse{
+		PhoneNumber: user.PhoneNumber,
+		ExpiresAt:   expiresAt.Format(time.RFC3339),
+	})
+}
+
+// VerifyPhone godoc
+// @Summary      Verify my phone number
+// @Description  Confirms the phone number on the current user's profile with the code sent to it. A number can be verified by one account only. After 5 wrong codes a new one has to be requested.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        verification  body      models.PhoneVerificationRequest  true  "Verification code"
+// @Success      200           {object}  models.UserResponse
+// @Failure      400           {object}  models.ErrorResponse
+// @Failure      401           {object}  models.ErrorResponse
+// @Failure      409           {object}  models.ErrorResponse
+// @Failure      500           {object}  models.ErrorResponse
+// @Router       /users/me/phone/verify [post]
+func (h *PhoneHandler) VerifyPhone(c *gin.Context) {
+	userID, ok := h.currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var input models.PhoneVerificationRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Counting the attempt before comparing keeps parallel guesses within the limit
+	ctx := context.Background()
+	var verification phoneVerification
+	err := h.verificationsCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": userID, "expires_at": bson.M{"$gt": time.Now()}, "attempts": bson.M{"$lt": maxPhoneCodeAttempts}},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+	).Decode(&verification)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No valid verification code, please request a new one"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(phoneCodeHash(userID, input.Code)), []byte(verification.CodeHash)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	// The number may have changed since the code was sent
+	var user models.User
+	err = h.usersCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": userID, "phone_number": verification.PhoneNumber},
+		bson.M{"$set": bson.M{
+			"phone_verified": true,
+			"phone_key":      models.ContactKey(h.contactSecret, models.ContactHash(verification.PhoneNumber)),
+			"updated_at":     time.Now(),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Phone number is already verified by another account"})
+		return
+	}
+	if err != nil && err != mongo.ErrNoDocuments {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify phone number"})
+		return
+	}
+
+	if _, err := h.verificationsCollection.DeleteOne(ctx, bson.M{"_id": userID}); err != nil {
+		log.Printf("Failed to delete phone verification of user %s: %v", userID.Hex(), err)
+	}
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusConflict, gin.H{"error": "Phone number changed, please request a new code"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user.ToResponse())
+}
+
+func (h *PhoneHandler) currentUserID(c *gin.Context) (primitive.ObjectID, bool) {
+	userID, exists := c.Get("UserID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return primitive.NilObjectID, false
+	}
+	objectID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return primitive.NilObjectID, false
+	}
+	return objectID, true
+}
+
+// newPhoneCode returns a random six-digit code
+func newPhoneCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// phoneCodeHash returns the stored form of a verification code
+func phoneCodeHash(userID primitive.ObjectID, code string) string {
+	sum := sha256.Sum256([]byte(userID.Hex() + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetPrivacy godoc
+// @Summary      Get privacy settings
+// @Description  Returns the current user's privacy settings
+// @Tags         users
+// @Produce      json
+// @Success      200  {object}  models.PrivacySettings
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /users/me/privacy [get]
+func (h *UserHandler) GetPrivacy(c *gin.Context) {
+	userID, exists := c.Get("UserID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var user models.User
+	if err := h.usersCollection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, user.Privacy.Normalized())
+}
+
+// UpdatePrivacy godoc
+// @Summary      Update privacy settings
+// @Description  Sets who can find the current user by phone number or email hash: everyone, contacts (users the current user has added) or nobody
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        privacy  body      models.PrivacyUpdate  true  "Privacy settings"
+// @Success      200      {object}  models.PrivacySettings
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      401      {object}  models.ErrorResponse
+// @Failure      404      {object}  models.ErrorResponse
+// @Failure      500      {object}  models.ErrorResponse
+// @Router       /users/me/privacy [put]
+func (h *UserHandler) UpdatePrivacy(c *gin.Context) {
+	userID, exists := c.Get("UserID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var input models.PrivacyUpdate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !models.IsValidDiscoverableBy(input.DiscoverableBy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "discoverable_by must be everyone, contacts or nobody"})
+		return
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"privacy.discoverable_by": input.DiscoverableBy,
+			"updated_at":              time.Now(),
+		},
+	}
+	result, err := h.usersCollection.UpdateOne(context.Background(), bson.M{"_id": objectID}, update)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update privacy settings"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PrivacySettings{DiscoverableBy: input.DiscoverableBy}.Normalized())
+}
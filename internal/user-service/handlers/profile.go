@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxAboutLength is the maximum number of characters in a user's about line
+const maxAboutLength = 139
+
+var phoneNumberPattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// phoneNumberSeparators are stripped from phone numbers before validation
+var phoneNumberSeparators = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "")
+
+// NormalizePhoneNumber strips formatting characters from a phone number
+func NormalizePhoneNumber(phone string) string {
+	return phoneNumberSeparators.Replace(strings.TrimSpace(phone))
+}
+
+// validateProfileUpdate checks and normalizes a profile update in place
+func validateProfileUpdate(input *models.ProfileUpdate) error {
+	if input.Status != "" && !models.IsValidPresence(input.Status) {
+		return errors.New("Invalid status, use the about field for custom text")
+	}
+
+	if input.About != nil {
+		about := strings.TrimSpace(*input.About)
+		if utf8.RuneCountInString(about) > maxAboutLength {
+			return errors.New("About must be at most 139 characters")
+		}
+		input.About = &about
+	}
+
+	if input.PhoneNumber != nil && *input.PhoneNumber != "" {
+		phone := NormalizePhoneNumber(*input.PhoneNumber)
+		if !phoneNumberPattern.MatchString(phone) {
+			return errors.New("Phone number must be in international format, e.g. +905551234567")
+		}
+		input.PhoneNumber = &phone
+	}
+
+	if input.Timezone != nil && *input.Timezone != "" {
+		// LoadLocation accepts "Local", which means nothing to other users
+		if *input.Timezone == "Local" {
+			return errors.New("Invalid timezone")
+		}
+		if _, err := time.LoadLocation(*input.Timezone); err != nil {
+			return errors.New("Invalid timezone")
+		}
+	}
+
+	return nil
+}
+
+// userResponseFor returns the full profile of user to the user themselves and
+// the public one to everyone else
+func userResponseFor(c *gin.Context, user models.User) models.UserResponse {
+	if currentUserID, exists := c.Get("UserID"); exists && currentUserID == user.ID.Hex() {
+		return user.ToResponse()
+	}
+	return user.ToPublicResponse()
+}
+
+// publishProfileUpdated notifies the user's own sessions and everyone who may
+// display their name or avatar: users who added them as a contact, fellow group
+// members and direct chat partners
+func (h *UserHandler) publishProfileUpdated(user models.User) {
+	if h.publisher == nil {
+		return
+	}
+
+	recipientIDs, err := h.profileAudience(context.Background(), user.ID)
+	if err != nil {
+		log.Printf("Failed to resolve profile update recipients for %s: %v", user.ID.Hex(), err)
+		return
+	}
+
+	// Recipients include other users, so the event carries the public profile only
+	event := models.NewEvent(models.EventProfileUpdated, recipientIDs, user.ToPublicProfile())
+	if err := h.publisher.PublishToExchange("messages", models.EventRoutingKey(event.Type), event); err != nil {
+		log.Printf("Failed to publish profile update for %s: %v", user.ID.Hex(), err)
+	}
+}
+
+// profileAudience returns the IDs of users who see userID's profile, including userID itself
+func (h *UserHandler) profileAudience(ctx context.Context, userID primitive.ObjectID) ([]string, error) {
+	db := h.usersCollection.Database()
+	audience := map[primitive.ObjectID]bool{userID: true}
+
+	addAll := func(values []interface{}) {
+		for _, value := range values {
+			if id, ok := value.(primitive.ObjectID); ok {
+				audience[id] = true
+			}
+		}
+	}
+
+	contactOwners, err := db.Collection("contacts").Distinct(ctx, "UserID", bson.M{"contact_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	addAll(contactOwners)
+
+	groupMembers, err := db.Collection("groups").Distinct(ctx, "member_ids", bson.M{"member_ids": userID})
+	if err != nil {
+		return nil, err
+	}
+	addAll(groupMembers)
+
+	messages := db.Collection("messages")
+	receivers, err := messages.Distinct(ctx, "receiver_id", bson.M{"sender_id": userID, "group_id": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, err
+	}
+	addAll(receivers)
+
+	senders, err := messages.Distinct(ctx, "sender_id", bson.M{"receiver_id": userID, "group_id": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, err
+	}
+	addAll(senders)
+
+	recipientIDs := make([]string, 0, len(audience))
+	for id := range audience {
+		recipientIDs = append(recipientIDs, id.Hex())
+	}
+	return recipientIDs, nil
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,21 +16,33 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 
+	"whatsapp/internal/user-service/loginguard"
 	"whatsapp/pkg/auth"
 	"whatsapp/pkg/models"
 )
 
 // UserHandler handles user-related requests
 type UserHandler struct {
-    usersCollection *mongo.Collection
-    authService     *auth.Service
+    usersCollection     *mongo.Collection
+    redirectsCollection *mongo.Collection
+    authService         *auth.Service
+    loginGuard          *loginguard.Guard
+    usernamePolicy      UsernamePolicy
+    publisher           EventPublisher
+    contactSecret       []byte
 }
 
-// NewUserHandler creates a new user handler
-func NewUserHandler(db *mongo.Database, authService *auth.Service) *UserHandler {
+// NewUserHandler creates a new user handler. publisher may be nil when RabbitMQ is unavailable.
+// contactSecret keys the discovery hashes, see models.ContactKey.
+func NewUserHandler(db *mongo.Database, authService *auth.Service, loginGuard *loginguard.Guard, usernamePolicy UsernamePolicy, publisher EventPublisher, contactSecret []byte) *UserHandler {
     return &UserHandler{
-        usersCollection: db.Collection("users"),
-        authService:     authService,
+        usersCollection:     db.Collection("users"),
+        redirectsCollection: db.Collection("username_redirects"),
+        authService:         authService,
+        loginGuard:          loginGuard,
+        usernamePolicy:      usernamePolicy,
+        publisher:           publisher,
+        contactSecret:       contactSecret,
     }
 }
 
@@ -51,22 +65,10 @@ func (h *UserHandler) Register(c *gin.Context) {
         return
     }
 
-    var existingUser models.User
-    err := h.usersCollection.FindOne(context.Background(), bson.M{"username": input.Username}).Decode(&existingUser)
-    if err == nil {
-        c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
-        return
-    } else if err != mongo.ErrNoDocuments {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-        return
-    }
-
-    err = h.usersCollection.FindOne(context.Background(), bson.M{"email": input.Email}).Decode(&existingUser)
-    if err == nil {
-        c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
-        return
-    } else if err != mongo.ErrNoDocuments {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+    input.Username = NormalizeUsername(input.Username)
+    input.Email = normalizeEmail(input.Email)
+    if err := validateUsername(input.Username); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
 
@@ -76,12 +78,28 @@ func (h *UserHandler) Register(c *gin.Context) {
         return
     }
 
+    // Handles that still redirect to a renamed account cannot be taken yet.
+    // Reserving the handle also keeps a rename from giving it up meanwhile.
+    ctx := context.Background()
     now := time.Now()
+    userID := primitive.NewObjectID()
+    reserved, err := h.reserveHandle(ctx, input.Username, userID, true, now, now.Add(handleClaimTimeout))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+        return
+    }
+    if !reserved {
+        c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+        return
+    }
+    defer h.releaseHandle(ctx, input.Username, userID)
+
     newUser := models.User{
-        ID:           primitive.NewObjectID(),
+        ID:           userID,
         Username:     input.Username,
         PasswordHash: string(hashedPassword),
         Email:        input.Email,
+        EmailKey:     models.ContactKey(h.contactSecret, models.ContactHash(input.Email)),
         FullName:     input.FullName,
         AvatarURL:    input.AvatarURL,
         CreatedAt:    now,
@@ -89,8 +107,14 @@ func (h *UserHandler) Register(c *gin.Context) {
         Status:       "online",
     }
 
-    _, err = h.usersCollection.InsertOne(context.Background(), newUser)
+    // Uniqueness is enforced by the case-insensitive unique indexes, which
+    // unlike a lookup before the insert cannot race with concurrent registrations
+    _, err = h.usersCollection.InsertOne(ctx, newUser)
     if err != nil {
+        if field := duplicateKeyField(err); field != "" {
+            c.JSON(http.StatusConflict, gin.H{"error": field + " already exists"})
+            return
+        }
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
         return
     }
@@ -102,15 +126,7 @@ func (h *UserHandler) Register(c *gin.Context) {
         return
     }
 
-    userResponse := models.UserResponse{
-        ID:        newUser.ID.Hex(),
-        Username:  newUser.Username,
-        Email:     newUser.Email,
-        FullName:  newUser.FullName,
-        AvatarURL: newUser.AvatarURL,
-        CreatedAt: newUser.CreatedAt.Format(time.RFC3339),
-        Status:    newUser.Status,
-    }
+    userResponse := newUser.ToResponse()
 
     c.JSON(http.StatusCreated, models.LoginResponse{
         Token:     token,
@@ -129,6 +145,7 @@ func (h *UserHandler) Register(c *gin.Context) {
 // @Success      200          {object}  models.LoginResponse
 // @Failure      400          {object}  models.ErrorResponse
 // @Failure      401          {object}  models.ErrorResponse
+// @Failure      429          {object}  models.RateLimitResponse
 // @Failure      500          {object}  models.ErrorResponse
 // @Router       /users/login [post]
 func (h *UserHandler) Login(c *gin.Context) {
@@ -138,11 +155,27 @@ func (h *UserHandler) Login(c *gin.Context) {
         return
     }
 
+    clientIP := c.ClientIP()
+
+    // The attempt counts before the password is checked, so parallel guesses
+    // cannot all get past the throttle
+    wait, err := h.loginGuard.Reserve(context.Background(), input.Username, clientIP)
+    if err != nil {
+        log.Printf("Failed to reserve login attempt: %v", err)
+    } else if wait > 0 {
+        respondTooManyRequests(c, "Too many login attempts, please try again later", wait)
+        return
+    }
+
     var user models.User
-    err := h.usersCollection.FindOne(context.Background(), bson.M{"username": input.Username}).Decode(&user)
+    err = h.usersCollection.FindOne(
+        context.Background(),
+        bson.M{"username": NormalizeUsername(input.Username)},
+        options.FindOne().SetCollation(caseInsensitive),
+    ).Decode(&user)
     if err != nil {
         if err == mongo.ErrNoDocuments {
-            c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+            h.recordLoginFailure(c, input.Username, clientIP, "unknown_user")
         } else {
             c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
         }
@@ -151,10 +184,14 @@ func (h *UserHandler) Login(c *gin.Context) {
 
     err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.Password))
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+        h.recordLoginFailure(c, input.Username, clientIP, "invalid_password")
         return
     }
 
+    if err := h.loginGuard.RecordSuccess(context.Background(), input.Username, clientIP); err != nil {
+        log.Printf("Failed to reset login attempts: %v", err)
+    }
+
     token, expiration, err := h.authService.GenerateToken(user.ID.Hex(), user.Username)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
@@ -172,15 +209,8 @@ func (h *UserHandler) Login(c *gin.Context) {
         log.Printf("Failed to update last login time: %v", err)
     }
 
-    userResponse := models.UserResponse{
-        ID:        user.ID.Hex(),
-        Username:  user.Username,
-        Email:     user.Email,
-        FullName:  user.FullName,
-        AvatarURL: user.AvatarURL,
-        CreatedAt: user.CreatedAt.Format(time.RFC3339),
-        Status:    "online",
-    }
+    userResponse := user.ToResponse()
+    userResponse.Status = "online"
 
     c.JSON(http.StatusOK, models.LoginResponse{
         Token:     token,
@@ -189,6 +219,31 @@ func (h *UserHandler) Login(c *gin.Context) {
     })
 }
 
+// recordLoginFailure audits a failed login and responds with 401, or 429 if the failure triggered a block
+func (h *UserHandler) recordLoginFailure(c *gin.Context, username, clientIP, reason string) {
+    wait, err := h.loginGuard.RecordFailure(context.Background(), username, clientIP, c.Request.UserAgent(), reason)
+    if err != nil {
+        log.Printf("Failed to record login failure: %v", err)
+    }
+
+    if wait > 0 {
+        respondTooManyRequests(c, "Too many login attempts, please try again later", wait)
+        return
+    }
+
+    c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+}
+
+// respondTooManyRequests writes a 429 response with a Retry-After header
+func respondTooManyRequests(c *gin.Context, message string, wait time.Duration) {
+    seconds := int(math.Ceil(wait.Seconds()))
+    c.Header("Retry-After", strconv.Itoa(seconds))
+    c.JSON(http.StatusTooManyRequests, models.RateLimitResponse{
+        Error:      message,
+        RetryAfter: seconds,
+    })
+}
+
 // GetProfile godoc
 // @Summary      Get user profile
 // @Description  Retrieves the user's profile information
@@ -221,15 +276,7 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
         return
     }
 
-    userResponse := models.UserResponse{
-        ID:        user.ID.Hex(),
-        Username:  user.Username,
-        Email:     user.Email,
-        FullName:  user.FullName,
-        AvatarURL: user.AvatarURL,
-        CreatedAt: user.CreatedAt.Format(time.RFC3339),
-        Status:    user.Status,
-    }
+    userResponse := userResponseFor(c, user)
 
     c.JSON(http.StatusOK, userResponse)
 }
@@ -265,6 +312,7 @@ func (h *UserHandler) SearchUsers(c *gin.Context) {
             {"username": bson.M{"$regex": query, "$options": "i"}},
             {"full_name": bson.M{"$regex": query, "$options": "i"}},
         },
+        "deleted_at": bson.M{"$exists": false},
     }
 
     findOptions := options.Find().
@@ -286,15 +334,7 @@ func (h *UserHandler) SearchUsers(c *gin.Context) {
 
     var userResponses []models.UserResponse
     for _, user := range users {
-        userResponses = append(userResponses, models.UserResponse{
-            ID:        user.ID.Hex(),
-            Username:  user.Username,
-            Email:     user.Email,
-            FullName:  user.FullName,
-            AvatarURL: user.AvatarURL,
-            CreatedAt: user.CreatedAt.Format(time.RFC3339),
-            Status:    user.Status,
-        })
+        userResponses = append(userResponses, userResponseFor(c, user))
     }
 
     c.JSON(http.StatusOK, userResponses)
@@ -339,9 +379,15 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
         return
     }
 
+    if err := validateProfileUpdate(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    now := time.Now()
     update := bson.M{
         "$set": bson.M{
-            "updated_at": time.Now(),
+            "updated_at": now,
         },
     }
 
@@ -355,6 +401,29 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
     if input.Status != "" {
         updateSet["status"] = input.Status
     }
+    if input.About != nil {
+        updateSet["about"] = *input.About
+        updateSet["about_updated_at"] = now
+    }
+    if input.Timezone != nil {
+        updateSet["timezone"] = *input.Timezone
+    }
+
+    if input.PhoneNumber != nil {
+        // A different number has to be verified again before it can be discovered.
+        // Changing it in the same write keeps a pending verification of the old
+        // number from confirming the new one.
+        _, err := h.usersCollection.UpdateOne(context.Background(),
+            bson.M{"_id": objectID, "phone_number": bson.M{"$ne": *input.PhoneNumber}},
+            bson.M{
+                "$set":   bson.M{"phone_number": *input.PhoneNumber},
+                "$unset": bson.M{"phone_verified": "", "phone_key": ""},
+            })
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+            return
+        }
+    }
 
     result, err := h.usersCollection.UpdateOne(context.Background(), bson.M{"_id": objectID}, update)
     if err != nil {
@@ -374,15 +443,9 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
         return
     }
 
-    userResponse := models.UserResponse{
-        ID:        user.ID.Hex(),
-        Username:  user.Username,
-        Email:     user.Email,
-        FullName:  user.FullName,
-        AvatarURL: user.AvatarURL,
-        CreatedAt: user.CreatedAt.Format(time.RFC3339),
-        Status:    user.Status,
-    }
+    userResponse := user.ToResponse()
+
+    go h.publishProfileUpdated(user)
 
     c.JSON(http.StatusOK, userResponse)
 }
@@ -409,6 +472,11 @@ func (h *UserHandler) UpdateStatus(c *gin.Context) {
         return
     }
 
+    if !models.IsValidPresence(input.Status) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status, use the about field for custom text"})
+        return
+    }
+
     objectID, err := primitive.ObjectIDFromHex(UserID)
     if err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
@@ -440,7 +508,7 @@ func (h *UserHandler) UpdateStatus(c *gin.Context) {
 }
 // GetUserContacts godoc
 // @Summary      Get user contacts
-// @Description  Retrieves the list of users that the current user has exchanged messages with or added as contacts
+// @Description  Retrieves the list of users that the current user has exchanged messages with, added as contacts or left a draft for. Chats with a draft carry its text.
 // @Tags         users
 // @Accept       json
 // @Produce      json
@@ -467,7 +535,10 @@ func (h *UserHandler) GetUserContacts(c *gin.Context) {
 	type ContactInfo struct {
 		ID              primitive.ObjectID
 		LastMessage     string
+		LastMessageType models.MessageType
 		LastMessageTime time.Time
+		Draft           string
+		DraftUpdatedAt  time.Time
 	}
 	contactMap := make(map[primitive.ObjectID]ContactInfo)
 
@@ -488,11 +559,7 @@ func (h *UserHandler) GetUserContacts(c *gin.Context) {
 			"$sort": bson.M{"created_at": 1}, // Sort by time ascending first
 		},
 		{
-			"$project": bson.M{
-				"sender_id":   1,
-				"receiver_id": 1,
-				"content":     1,
-				"created_at":  1,
+			"$addFields": bson.M{
 				"contact_id": bson.M{
 					"$cond": bson.M{
 						"if":   bson.M{"$eq": []interface{}{"$sender_id", objectID}},
@@ -505,8 +572,7 @@ func (h *UserHandler) GetUserContacts(c *gin.Context) {
 		{
 			"$group": bson.M{
 				"_id": "$contact_id",
-				"last_message": bson.M{"$last": "$content"},
-				"last_message_time": bson.M{"$last": "$created_at"},
+				"last_message": bson.M{"$last": "$$ROOT"},
 			},
 		},
 	}
@@ -519,9 +585,8 @@ func (h *UserHandler) GetUserContacts(c *gin.Context) {
 	defer cursor.Close(context.Background())
 
 	var results []struct {
-		ID              primitive.ObjectID `bson:"_id"`
-		LastMessage     string             `bson:"last_message"`
-		LastMessageTime time.Time          `bson:"last_message_time"`
+		ID          primitive.ObjectID `bson:"_id"`
+		LastMessage models.Message     `bson:"last_message"`
 	}
 
 	if err := cursor.All(context.Background(), &results); err != nil {
@@ -531,10 +596,12 @@ func (h *UserHandler) GetUserContacts(c *gin.Context) {
 
 	// Add message contacts to the map
 	for _, result := range results {
+		// Typed messages are summarized, e.g. "Photo: caption" or "Location"
 		contactMap[result.ID] = ContactInfo{
 			ID:              result.ID,
-			LastMessage:     result.LastMessage,
-			LastMessageTime: result.LastMessageTime,
+			LastMessage:     result.LastMessage.Preview(),
+			LastMessageType: result.LastMessage.TypeOrDefault(),
+			LastMessageTime: result.LastMessage.CreatedAt,
 		}
 	}
 
@@ -572,7 +639,32 @@ func (h *UserHandler) GetUserContacts(c *gin.Context) {
 		}
 	}
 
-	// If no contacts found in either source, return empty array
+	// 3. Add drafts, which also bring up chats that have no messages yet
+	draftsCollection := h.usersCollection.Database().Collection("drafts")
+	draftsCursor, err := draftsCollection.Find(
+		context.Background(),
+		bson.M{"user_id": objectID, "group": false},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve drafts"})
+		return
+	}
+
+	var drafts []models.Draft
+	if err := draftsCursor.All(context.Background(), &drafts); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse drafts"})
+		return
+	}
+
+	for _, draft := range drafts {
+		info := contactMap[draft.ChatID]
+		info.ID = draft.ChatID
+		info.Draft = draft.Text
+		info.DraftUpdatedAt = draft.UpdatedAt
+		contactMap[draft.ChatID] = info
+	}
+
+	// If no contacts found in any source, return empty array
 	if len(contactMap) == 0 {
 		c.JSON(http.StatusOK, []models.UserResponse{})
 		return
@@ -605,22 +697,19 @@ func (h *UserHandler) GetUserContacts(c *gin.Context) {
 
 	var userResponses []models.UserResponse
 	for _, user := range users {
-		response := models.UserResponse{
-			ID:        user.ID.Hex(),
-			Username:  user.Username,
-			Email:     user.Email,
-			FullName:  user.FullName,
-			AvatarURL: user.AvatarURL,
-			CreatedAt: user.CreatedAt.Format(time.RFC3339),
-			Status:    user.Status,
-		}
+		response := user.ToPublicResponse()
 		
 		// Enrich with last message info if available
 		if info, ok := contactMap[user.ID]; ok {
 			response.LastMessage = info.LastMessage
+			response.LastMessageType = info.LastMessageType
 			if !info.LastMessageTime.IsZero() {
 				response.LastMessageTime = info.LastMessageTime.Format(time.RFC3339)
 			}
+			if info.Draft != "" {
+				response.Draft = info.Draft
+				response.DraftUpdatedAt = info.DraftUpdatedAt.Format(time.RFC3339)
+			}
 		}
 		
 		userResponses = append(userResponses, response)
@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"whatsapp/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UsernamePolicy controls how often handles can change and how long old ones keep resolving
+type UsernamePolicy struct {
+	MinChangeInterval time.Duration // minimum time between two username changes
+	RedirectPeriod    time.Duration // how long a previous handle redirects to the account
+}
+
+// DefaultUsernamePolicy returns the default username change policy
+func DefaultUsernamePolicy() UsernamePolicy {
+	return UsernamePolicy{
+		MinChangeInterval: 7 * 24 * time.Hour,
+		RedirectPeriod:    30 * 24 * time.Hour,
+	}
+}
+
+// handleClaimTimeout is how long a handle stays reserved for a registration or
+// rename that takes it, should the request stop halfway
+const handleClaimTimeout = time.Minute
+
+// caseInsensitive matches the collation of the unique username and email indexes.
+// Queries must use it to be served by those indexes and to find legacy mixed-case handles.
+var caseInsensitive = &options.Collation{Locale: "en", Strength: 2}
+
+// Names of the unique indexes, used to tell which field a duplicate key error refers to
+const (
+	usernameIndexName = "username_unique_ci"
+	emailIndexName    = "email_unique_ci"
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_.]{3,32}$`)
+
+// NormalizeUsername returns the canonical form of a handle
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// validateUsername checks a normalized handle
+func validateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return errors.New("Username must be 3-32 characters of letters, digits, '_' or '.'")
+	}
+	return nil
+}
+
+// duplicateKeyField returns "Username" or "Email" if err is a duplicate key
+// error on the corresponding unique index, and "" otherwise
+func duplicateKeyField(err error) string {
+	if !mongo.IsDuplicateKeyError(err) {
+		return ""
+	}
+	switch {
+	case strings.Contains(err.Error(), usernameIndexName):
+		return "Username"
+	case strings.Contains(err.Error(), emailIndexName):
+		return "Email"
+	}
+	return "Account"
+}
+
+// EnsureIndexes creates the unique, case-insensitive indexes on handles and emails,
+// the unique index on verified phone numbers and the TTL index that expires
+// username redirects
+func (h *UserHandler) EnsureIndexes(ctx context.Context) error {
+	_, err := h.usersCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "username", Value: 1}},
+			Options: options.Index().SetName(usernameIndexName).SetUnique(true).SetCollation(caseInsensitive),
+		},
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetName(emailIndexName).SetUnique(true).SetCollation(caseInsensitive),
+		},
+		{
+			// Anyone can type any number into their profile, but only one
+			// account can verify it
+			Keys: bson.D{{Key: "phone_number", Value: 1}},
+			Options: options.Index().SetName("phone_number_verified").SetUnique(true).
+				SetPartialFilterExpression(bson.M{"phone_verified": true}),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = h.redirectsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+	})
+	return err
+}
+
+// reserveHandle reserves username for userID in the redirects collection, as a
+// redirect or, if pending, for a registration or rename in progress. Handles
+// are the _id there, so this fails atomically, reporting false, while another
+// account's redirect or reservation of the handle is still valid. Reserving a
+// handle before an account takes it keeps registrations and renames from
+// claiming a handle that is just being given up.
+func (h *UserHandler) reserveHandle(ctx context.Context, username string, userID primitive.ObjectID, pending bool, now, expiresAt time.Time) (bool, error) {
+	reservation := models.UsernameRedirect{
+		OldUsername: username,
+		UserID:      userID,
+		Pending:     pending,
+		CreatedAt:   now,
+		ExpiresAt:   expiresAt,
+	}
+	filter := bson.M{
+		"_id": username,
+		"$or": []bson.M{{"user_id": userID}, {"expires_at": bson.M{"$lte": now}}},
+	}
+	// Without a matching document the upsert inserts, which the _id rejects if
+	// the handle is reserved by someone else
+	_, err := h.redirectsCollection.ReplaceOne(ctx, filter, reservation, options.Replace().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// releaseHandle drops the pending reservation of username by userID
+func (h *UserHandler) releaseHandle(ctx context.Context, username string, userID primitive.ObjectID) {
+	if _, err := h.redirectsCollection.DeleteOne(ctx, bson.M{"_id": username, "user_id": userID, "pending": true}); err != nil {
+		log.Printf("Failed to release handle %s: %v", username, err)
+	}
+}
+
+// ChangeUsername godoc
+// @Summary      Change username
+// @Description  Changes the current user's handle. The previous handle keeps resolving to the account for a while and cannot be claimed by others in the meantime.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        username  body      models.UsernameChangeRequest  true  "New username"
+// @Success      200       {object}  models.LoginResponse
+// @Failure      400       {object}  models.ErrorResponse
+// @Failure      401       {object}  models.ErrorResponse
+// @Failure      409       {object}  models.ErrorResponse
+// @Failure      429       {object}  models.RateLimitResponse
+// @Failure      500       {object}  models.ErrorResponse
+// @Router       /users/me/username [put]
+func (h *UserHandler) ChangeUsername(c *gin.Context) {
+	userID, exists := c.Get("UserID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var input models.UsernameChangeRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	newUsername := NormalizeUsername(input.Username)
+	if err := validateUsername(newUsername); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+
+	var user models.User
+	if err := h.usersCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	oldUsername := NormalizeUsername(user.Username)
+	if newUsername == oldUsername {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New username must differ from the current one"})
+		return
+	}
+
+	now := time.Now()
+	if next := user.UsernameChangedAt.Add(h.usernamePolicy.MinChangeInterval); now.Before(next) {
+		respondTooManyRequests(c, "Username was changed recently, please try again later", next.Sub(now))
+		return
+	}
+
+	// Reserve the new handle first. Taking back one's own previous handle
+	// turns its redirect into the reservation.
+	reserved, err := h.reserveHandle(ctx, newUsername, objectID, true, now, now.Add(handleClaimTimeout))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !reserved {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+		return
+	}
+
+	// The old handle redirects before it is given up, so nobody can register it
+	// in between. Should the rename fail, a redirect of the handle the account
+	// still holds is harmless.
+	reserved, err = h.reserveHandle(ctx, oldUsername, objectID, false, now, now.Add(h.usernamePolicy.RedirectPeriod))
+	if err != nil || !reserved {
+		h.releaseHandle(ctx, newUsername, objectID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update username redirects"})
+		} else {
+			c.JSON(http.StatusConflict, gin.H{"error": "Username was changed concurrently"})
+		}
+		return
+	}
+
+	// The filter on the previous change time makes concurrent changes by the same user fail
+	filter := bson.M{"_id": objectID, "username": user.Username}
+	if user.UsernameChangedAt.IsZero() {
+		filter["username_changed_at"] = bson.M{"$exists": false}
+	} else {
+		filter["username_changed_at"] = user.UsernameChangedAt
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"username":            newUsername,
+			"username_changed_at": now,
+			"updated_at":          now,
+		},
+	}
+
+	result, err := h.usersCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		h.releaseHandle(ctx, newUsername, objectID)
+		if field := duplicateKeyField(err); field != "" {
+			c.JSON(http.StatusConflict, gin.H{"error": field + " already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change username"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		h.releaseHandle(ctx, newUsername, objectID)
+		c.JSON(http.StatusConflict, gin.H{"error": "Username was changed concurrently"})
+		return
+	}
+
+	// The account holds the new handle now
+	h.releaseHandle(ctx, newUsername, objectID)
+
+	user.Username = newUsername
+	user.UsernameChangedAt = now
+
+	// Tokens carry the username, so hand out a fresh one
+	token, expiration, err := h.authService.GenerateToken(user.ID.Hex(), user.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.LoginResponse{
+		Token:     token,
+		ExpiresAt: expiration.Format(time.RFC3339),
+		User:      user.ToResponse(),
+	})
+}
+
+// GetByUsername godoc
+// @Summary      Look up a user by handle
+// @Description  Finds a user by username, case-insensitively. Recently changed handles resolve to their account and set redirected_from.
+// @Tags         users
+// @Produce      json
+// @Param        username  path      string  true  "Username"
+// @Success      200       {object}  models.UserResponse
+// @Failure      401       {object}  models.ErrorResponse
+// @Failure      404       {object}  models.ErrorResponse
+// @Failure      500       {object}  models.ErrorResponse
+// @Router       /users/handle/{username} [get]
+func (h *UserHandler) GetByUsername(c *gin.Context) {
+	username := NormalizeUsername(c.Param("username"))
+	ctx := context.Background()
+
+	var user models.User
+	err := h.usersCollection.FindOne(
+		ctx,
+		bson.M{"username": username, "deleted_at": bson.M{"$exists": false}},
+		options.FindOne().SetCollation(caseInsensitive),
+	).Decode(&user)
+	if err == nil {
+		c.JSON(http.StatusOK, userResponseFor(c, user))
+		return
+	}
+	if err != mongo.ErrNoDocuments {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var redirect models.UsernameRedirect
+	err = h.redirectsCollection.FindOne(ctx, bson.M{
+		"_id":        username,
+		"pending":    bson.M{"$ne": true},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&redirect)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	err = h.usersCollection.FindOne(ctx, bson.M{
+		"_id":        redirect.UserID,
+		"deleted_at": bson.M{"$exists": false},
+	}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	response := userResponseFor(c, user)
+	response.RedirectedFrom = username
+	c.JSON(http.StatusOK, response)
+}
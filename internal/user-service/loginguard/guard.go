@@ -0,0 +1,182 @@
+// Package loginguard throttles password guessing against the user service.
+// Failed logins are counted per account and per client IP; after a few free
+// attempts every further failure doubles the delay before the next attempt is
+// accepted, and reaching the lockout threshold blocks the key outright.
+package loginguard
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"whatsapp/pkg/models"
+)
+
+// Policy describes how quickly failures for one kind of key are throttled
+type Policy struct {
+	FreeAttempts     int           // failures tolerated before any backoff applies
+	BaseDelay        time.Duration // delay after the first failure past FreeAttempts
+	MaxDelay         time.Duration // upper bound for the exponential backoff
+	LockoutThreshold int           // failures that trigger a full lockout
+	LockoutDuration  time.Duration // how long a lockout lasts
+	Window           time.Duration // idle period after which failures are forgotten
+}
+
+// DefaultAccountPolicy returns the throttling policy applied per username
+func DefaultAccountPolicy() Policy {
+	return Policy{
+		FreeAttempts:     3,
+		BaseDelay:        2 * time.Second,
+		MaxDelay:         5 * time.Minute,
+		LockoutThreshold: 10,
+		LockoutDuration:  15 * time.Minute,
+		Window:           time.Hour,
+	}
+}
+
+// DefaultIPPolicy returns the throttling policy applied per client IP.
+// It is more lenient than the account policy because several users may share an address.
+func DefaultIPPolicy() Policy {
+	return Policy{
+		FreeAttempts:     10,
+		BaseDelay:        time.Second,
+		MaxDelay:         5 * time.Minute,
+		LockoutThreshold: 50,
+		LockoutDuration:  30 * time.Minute,
+		Window:           time.Hour,
+	}
+}
+
+// delayAfter returns how long a key must wait after its n-th consecutive failure
+func (p Policy) delayAfter(failures int) time.Duration {
+	if p.LockoutThreshold > 0 && failures >= p.LockoutThreshold {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return delay
+}
+
+// Guard decides whether a login attempt may proceed and records its outcome.
+// Every attempt is counted by Reserve and then settled by RecordFailure or
+// RecordSuccess.
+type Guard struct {
+	store   Store
+	account Policy
+	ip      Policy
+	now     func() time.Time
+}
+
+// NewGuard creates a guard that applies the given policies on top of store
+func NewGuard(store Store, account, ip Policy) *Guard {
+	return &Guard{
+		store:   store,
+		account: account,
+		ip:      ip,
+		now:     time.Now,
+	}
+}
+
+// Check returns how long the caller must wait before trying to log in again.
+// A zero duration means the attempt may proceed.
+func (g *Guard) Check(ctx context.Context, username, ip string) (time.Duration, error) {
+	now := g.now()
+	var wait time.Duration
+
+	for _, key := range g.keys(username, ip) {
+		attempt, err := g.store.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if remaining := attempt.BlockedUntil.Sub(now); remaining > wait {
+			wait = remaining
+		}
+	}
+
+	return wait, nil
+}
+
+// Reserve counts a login attempt for both the account and the client IP before
+// the password is checked, and returns how long the caller must wait if either
+// is blocked. Counting up front keeps parallel guesses from all passing the
+// throttle before the first of them fails; a zero duration means the attempt
+// may proceed and must be followed by RecordFailure or RecordSuccess.
+func (g *Guard) Reserve(ctx context.Context, username, ip string) (time.Duration, error) {
+	now := g.now()
+	var wait time.Duration
+
+	keys := g.keys(username, ip)
+	for i, policy := range []Policy{g.account, g.ip} {
+		attempt, ok, err := g.store.Reserve(ctx, keys[i], now, policy.Window, policy.delayAfter)
+		if err != nil {
+			return 0, err
+		}
+		if remaining := attempt.BlockedUntil.Sub(now); !ok && remaining > wait {
+			wait = remaining
+		}
+	}
+
+	return wait, nil
+}
+
+// RecordFailure writes an audit entry for a failed attempt, which Reserve
+// already counted, and returns how long the caller is now blocked for.
+func (g *Guard) RecordFailure(ctx context.Context, username, ip, userAgent, reason string) (time.Duration, error) {
+	now := g.now()
+	wait, err := g.Check(ctx, username, ip)
+	if err != nil {
+		return 0, err
+	}
+
+	entry := models.LoginAuditEntry{
+		ID:        primitive.NewObjectID(),
+		Username:  normalizeUsername(username),
+		IP:        ip,
+		UserAgent: userAgent,
+		Reason:    reason,
+		CreatedAt: now,
+	}
+	if wait > 0 {
+		entry.BlockedUntil = now.Add(wait)
+	}
+	if err := g.store.Audit(ctx, entry); err != nil {
+		return wait, err
+	}
+
+	return wait, nil
+}
+
+// RecordSuccess clears the failure history of the account and takes back the
+// attempt Reserve counted for the client IP. Earlier failures of the IP are
+// kept so that logging into one's own account cannot be used to reset the
+// throttle while guessing passwords for others.
+func (g *Guard) RecordSuccess(ctx context.Context, username, ip string) error {
+	if err := g.store.Reset(ctx, accountKey(username)); err != nil {
+		return err
+	}
+	return g.store.Release(ctx, g.keys(username, ip)[1])
+}
+
+// keys returns the account key followed by the client IP key
+func (g *Guard) keys(username, ip string) []string {
+	return []string{accountKey(username), "ip:" + ip}
+}
+
+func accountKey(username string) string {
+	return "user:" + normalizeUsername(username)
+}
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
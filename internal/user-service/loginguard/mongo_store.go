@@ -0,0 +1,118 @@
+package loginguard
+
+import (
+	"context"
+	"time"
+
+	"whatsapp/pkg/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps login attempts in MongoDB so that every user-service instance shares them
+type MongoStore struct {
+	attempts *mongo.Collection
+	audit    *mongo.Collection
+}
+
+// NewMongoStore creates a store backed by the login_attempts and login_audit collections
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{
+		attempts: db.Collection("login_attempts"),
+		audit:    db.Collection("login_audit"),
+	}
+}
+
+// EnsureIndexes creates the TTL indexes that expire stale attempt records and old audit entries
+func (s *MongoStore) EnsureIndexes(ctx context.Context, auditRetention time.Duration) error {
+	_, err := s.attempts.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.audit.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(auditRetention.Seconds())),
+		},
+		{
+			Keys: bson.D{{Key: "username", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+	})
+	return err
+}
+
+// Get returns the attempt record for key
+func (s *MongoStore) Get(ctx context.Context, key string) (Attempt, error) {
+	var attempt Attempt
+	err := s.attempts.FindOne(ctx, bson.M{
+		"_id":        key,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&attempt)
+	if err == mongo.ErrNoDocuments {
+		return Attempt{Key: key}, nil
+	}
+	return attempt, err
+}
+
+// Reserve counts an attempt for key unless it is blocked. The record is
+// replaced only if nobody changed it since it was read, so the count and the
+// block it leads to are written together.
+func (s *MongoStore) Reserve(ctx context.Context, key string, now time.Time, window time.Duration, delay func(failures int) time.Duration) (Attempt, bool, error) {
+	for {
+		var attempt Attempt
+		err := s.attempts.FindOne(ctx, bson.M{"_id": key}).Decode(&attempt)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return Attempt{}, false, err
+		}
+
+		// TTL cleanup runs only once a minute, so an expired record counts from scratch
+		filter := bson.M{"_id": key, "failures": attempt.Failures, "last_failure": attempt.LastFailure}
+		if err == mongo.ErrNoDocuments || !attempt.ExpiresAt.After(now) {
+			attempt = Attempt{Key: key}
+			filter = bson.M{"_id": key, "expires_at": bson.M{"$lte": now}}
+		}
+		if attempt.BlockedUntil.After(now) {
+			return attempt, false, nil
+		}
+
+		next := nextAttempt(attempt, now, window, delay)
+		result, err := s.attempts.ReplaceOne(ctx, filter, next, options.Replace().SetUpsert(true))
+		if mongo.IsDuplicateKeyError(err) {
+			// Another attempt created the record first
+			continue
+		}
+		if err != nil {
+			return Attempt{}, false, err
+		}
+		if result.MatchedCount > 0 || result.UpsertedCount > 0 {
+			return next, true, nil
+		}
+	}
+}
+
+// Release takes back one attempt counted for key
+func (s *MongoStore) Release(ctx context.Context, key string) error {
+	_, err := s.attempts.UpdateOne(ctx,
+		bson.M{"_id": key, "failures": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"failures": -1}},
+	)
+	return err
+}
+
+// Reset clears the attempt record for key
+func (s *MongoStore) Reset(ctx context.Context, key string) error {
+	_, err := s.attempts.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+// Audit stores a failed login attempt
+func (s *MongoStore) Audit(ctx context.Context, entry models.LoginAuditEntry) error {
+	_, err := s.audit.InsertOne(ctx, entry)
+	return err
+}
@@ -0,0 +1,140 @@
+package loginguard
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"whatsapp/pkg/models"
+)
+
+// Attempt tracks consecutive failed logins for a single key (an account or a client IP)
+type Attempt struct {
+	Key          string    `bson:"_id" json:"key"`
+	Failures     int       `bson:"failures" json:"failures"`
+	LastFailure  time.Time `bson:"last_failure" json:"last_failure"`
+	BlockedUntil time.Time `bson:"blocked_until,omitempty" json:"blocked_until,omitempty"`
+	ExpiresAt    time.Time `bson:"expires_at" json:"expires_at"`
+}
+
+// Store persists login attempts and the audit trail of failures
+type Store interface {
+	// Get returns the current attempt record for key, or a zero Attempt if there is none
+	Get(ctx context.Context, key string) (Attempt, error)
+	// Reserve atomically counts an attempt for key unless key is blocked, and
+	// blocks it for delay(failures) in the same step. Records idle for longer
+	// than window are reset first. ok is false if the attempt was refused, in
+	// which case the returned Attempt says until when.
+	Reserve(ctx context.Context, key string, now time.Time, window time.Duration, delay func(failures int) time.Duration) (attempt Attempt, ok bool, err error)
+	// Release takes back one attempt counted for key
+	Release(ctx context.Context, key string) error
+	// Reset clears the attempt record for key
+	Reset(ctx context.Context, key string) error
+	// Audit stores a failed login attempt for later review
+	Audit(ctx context.Context, entry models.LoginAuditEntry) error
+}
+
+// nextAttempt returns attempt with one more failure counted at now, blocked
+// for as long as delay says
+func nextAttempt(attempt Attempt, now time.Time, window time.Duration, delay func(failures int) time.Duration) Attempt {
+	attempt.Failures++
+	attempt.LastFailure = now
+	attempt.ExpiresAt = now.Add(window)
+	if d := delay(attempt.Failures); d > 0 {
+		attempt.BlockedUntil = now.Add(d)
+	}
+	if attempt.BlockedUntil.After(attempt.ExpiresAt) {
+		attempt.ExpiresAt = attempt.BlockedUntil
+	}
+	return attempt
+}
+
+// maxMemoryAuditEntries bounds the in-memory audit log
+const maxMemoryAuditEntries = 10000
+
+// MemoryStore is an in-process Store, suitable for a single user-service instance and development
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]Attempt
+	audit    []models.LoginAuditEntry
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		attempts: make(map[string]Attempt),
+	}
+}
+
+// Get returns the attempt record for key
+func (s *MemoryStore) Get(ctx context.Context, key string) (Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok || time.Now().After(attempt.ExpiresAt) {
+		delete(s.attempts, key)
+		return Attempt{Key: key}, nil
+	}
+	return attempt, nil
+}
+
+// Reserve counts an attempt for key unless it is blocked
+func (s *MemoryStore) Reserve(ctx context.Context, key string, now time.Time, window time.Duration, delay func(failures int) time.Duration) (Attempt, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok || now.After(attempt.ExpiresAt) {
+		attempt = Attempt{Key: key}
+	}
+	if attempt.BlockedUntil.After(now) {
+		return attempt, false, nil
+	}
+	attempt = nextAttempt(attempt, now, window, delay)
+	s.attempts[key] = attempt
+	return attempt, true, nil
+}
+
+// Release takes back one attempt counted for key
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if attempt, ok := s.attempts[key]; ok && attempt.Failures > 0 {
+		attempt.Failures--
+		s.attempts[key] = attempt
+	}
+	return nil
+}
+
+// Reset clears the attempt record for key
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+// Audit appends a failed attempt to the in-memory log, dropping the oldest entries when full
+func (s *MemoryStore) Audit(ctx context.Context, entry models.LoginAuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.audit = append(s.audit, entry)
+	if len(s.audit) > maxMemoryAuditEntries {
+		s.audit = s.audit[len(s.audit)-maxMemoryAuditEntries:]
+	}
+	return nil
+}
+
+// AuditEntries returns a copy of the recorded audit log
+func (s *MemoryStore) AuditEntries() []models.LoginAuditEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]models.LoginAuditEntry, len(s.audit))
+	copy(entries, s.audit)
+	return entries
+}
@@ -0,0 +1,136 @@
+// Package ratelimit provides fixed-window rate limiting backed by MongoDB or memory.
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Store keeps counters per key and time window
+type Store interface {
+	// Add adds n to the counter of key in the window starting at windowStart
+	// and returns the new total
+	Add(ctx context.Context, key string, n int, windowStart time.Time, window time.Duration) (int, error)
+}
+
+// Limiter allows up to limit units per key in each window
+type Limiter struct {
+	store  Store
+	limit  int
+	window time.Duration
+}
+
+// NewLimiter creates a limiter allowing limit units per window
+func NewLimiter(store Store, limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		store:  store,
+		limit:  limit,
+		window: window,
+	}
+}
+
+// Limit returns the number of units allowed per window
+func (l *Limiter) Limit() int {
+	return l.limit
+}
+
+// Allow consumes cost units for key. It returns zero if the request is within
+// the limit, or how long the caller has to wait for the next window.
+func (l *Limiter) Allow(ctx context.Context, key string, cost int) (time.Duration, error) {
+	now := time.Now()
+	windowStart := now.Truncate(l.window)
+
+	total, err := l.store.Add(ctx, key, cost, windowStart, l.window)
+	if err != nil {
+		return 0, err
+	}
+
+	if total > l.limit {
+		return windowStart.Add(l.window).Sub(now), nil
+	}
+	return 0, nil
+}
+
+// MemoryStore keeps counters in process memory
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]memoryCounter
+}
+
+type memoryCounter struct {
+	count     int
+	expiresAt time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		counters: make(map[string]memoryCounter),
+	}
+}
+
+// Add adds n to the counter of key in the given window
+func (s *MemoryStore) Add(ctx context.Context, key string, n int, windowStart time.Time, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, counter := range s.counters {
+		if now.After(counter.expiresAt) {
+			delete(s.counters, k)
+		}
+	}
+
+	windowKey := key + ":" + strconv.FormatInt(windowStart.Unix(), 10)
+	counter := s.counters[windowKey]
+	counter.count += n
+	counter.expiresAt = windowStart.Add(window)
+	s.counters[windowKey] = counter
+
+	return counter.count, nil
+}
+
+// MongoStore keeps counters in the rate_limits collection so that all instances share them
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoStore creates a store backed by the rate_limits collection
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{
+		collection: db.Collection("rate_limits"),
+	}
+}
+
+// EnsureIndexes creates the TTL index that removes finished windows
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// Add adds n to the counter of key in the given window
+func (s *MongoStore) Add(ctx context.Context, key string, n int, windowStart time.Time, window time.Duration) (int, error) {
+	windowKey := key + ":" + strconv.FormatInt(windowStart.Unix(), 10)
+	update := bson.M{
+		"$inc":         bson.M{"count": n},
+		"$setOnInsert": bson.M{"expires_at": windowStart.Add(window)},
+	}
+	opts := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After)
+
+	var counter struct {
+		Count int `bson:"count"`
+	}
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": windowKey}, update, opts).Decode(&counter)
+	return counter.Count, err
+}
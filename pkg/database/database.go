@@ -43,3 +43,8 @@ func (c *Client) Close() error {
 func (c *Client) GetCollection(database, collection string) *mongo.Collection {
 	return c.client.Database(database).Collection(collection)
 }
+
+// GetDatabase gets a MongoDB database
+func (c *Client) GetDatabase(database string) *mongo.Database {
+	return c.client.Database(database)
+}
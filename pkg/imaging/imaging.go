@@ -0,0 +1,123 @@
+// Package imaging resizes images, computes blurhash placeholders and strips
+// privacy-sensitive metadata from uploaded image files.
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+)
+
+// Fit scales src down so that its longer side is at most maxSide, keeping the
+// aspect ratio. Images that are already small enough are copied unscaled.
+func Fit(src image.Image, maxSide int) *image.NRGBA {
+	width, height := FitSize(src.Bounds().Dx(), src.Bounds().Dy(), maxSide)
+	return Resize(src, width, height)
+}
+
+// FitSize returns the dimensions of a width x height image scaled down to fit maxSide
+func FitSize(width, height, maxSide int) (int, int) {
+	if width <= maxSide && height <= maxSide {
+		return width, height
+	}
+	if width >= height {
+		return maxSide, max(1, height*maxSide/width)
+	}
+	return max(1, width*maxSide/height), maxSide
+}
+
+// Resize scales src to width x height by averaging the source pixels covered
+// by each destination pixel, which gives good results when shrinking
+func Resize(src image.Image, width, height int) *image.NRGBA {
+	bounds := src.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*srcHeight/height
+		y1 := max(bounds.Min.Y+(y+1)*srcHeight/height, y0+1)
+
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*srcWidth/width
+			x1 := max(bounds.Min.X+(x+1)*srcWidth/width, x0+1)
+
+			// Sum premultiplied values so that transparent pixels don't darken the result
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r += uint64(pr)
+					g += uint64(pg)
+					b += uint64(pb)
+					a += uint64(pa)
+					n++
+				}
+			}
+
+			var pixel color.NRGBA
+			if a > 0 {
+				pixel = color.NRGBA{
+					R: uint8(r * 0xff / a),
+					G: uint8(g * 0xff / a),
+					B: uint8(b * 0xff / a),
+					A: uint8(a / n >> 8),
+				}
+			}
+			dst.SetNRGBA(x, y, pixel)
+		}
+	}
+
+	return dst
+}
+
+// Orient applies an EXIF orientation (1-8) to src, so that the result
+// displays correctly without the orientation tag
+func Orient(src image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = width-1-x, y
+			case 3: // rotated 180°
+				dx, dy = width-1-x, height-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, height-1-y
+			case 5: // mirrored along the top-left diagonal
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise
+				dx, dy = height-1-y, x
+			case 7: // mirrored along the top-right diagonal
+				dx, dy = height-1-y, width-1-x
+			case 8: // rotated 90° counter-clockwise
+				dx, dy = y, width-1-x
+			}
+			dst.Set(dx, dy, src.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+
+	return dst
+}
+
+// EncodeJPEG writes img as a JPEG, flattening transparency onto a white background
+func EncodeJPEG(w io.Writer, img image.Image, quality int) error {
+	bounds := img.Bounds()
+	flat := image.NewRGBA(bounds)
+	draw.Draw(flat, bounds, image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, bounds, img, bounds.Min, draw.Over)
+	return jpeg.Encode(w, flat, &jpeg.Options{Quality: quality})
+}
@@ -0,0 +1,77 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func TestFitSize(t *testing.T) {
+	tests := []struct {
+		width, height, maxSide int
+		wantWidth, wantHeight  int
+	}{
+		{640, 480, 1280, 640, 480},
+		{1280, 1280, 1280, 1280, 1280},
+		{4000, 3000, 1280, 1280, 960},
+		{3000, 4000, 1280, 960, 1280},
+		{10000, 10, 100, 100, 1},
+	}
+	for _, test := range tests {
+		width, height := FitSize(test.width, test.height, test.maxSide)
+		if width != test.wantWidth || height != test.wantHeight {
+			t.Errorf("FitSize(%d, %d, %d) returned %dx%d, want %dx%d",
+				test.width, test.height, test.maxSide, width, height, test.wantWidth, test.wantHeight)
+		}
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// A 3x2 image with a marked top-left pixel
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	marked := color.NRGBA{R: 255, A: 255}
+	src.SetNRGBA(0, 0, marked)
+
+	tests := []struct {
+		orientation int
+		size        image.Point
+		marked      image.Point // where the top-left pixel ends up
+	}{
+		{1, image.Pt(3, 2), image.Pt(0, 0)},
+		{2, image.Pt(3, 2), image.Pt(2, 0)},
+		{3, image.Pt(3, 2), image.Pt(2, 1)},
+		{4, image.Pt(3, 2), image.Pt(0, 1)},
+		{5, image.Pt(2, 3), image.Pt(0, 0)},
+		{6, image.Pt(2, 3), image.Pt(1, 0)},
+		{7, image.Pt(2, 3), image.Pt(1, 2)},
+		{8, image.Pt(2, 3), image.Pt(0, 2)},
+	}
+	for _, test := range tests {
+		dst := Orient(src, test.orientation)
+		if size := dst.Bounds().Size(); size != test.size {
+			t.Errorf("Orient(%d) returned a %v image, want %v", test.orientation, size, test.size)
+			continue
+		}
+		if got := color.NRGBAModel.Convert(dst.At(test.marked.X, test.marked.Y)); got != marked {
+			t.Errorf("Orient(%d) moved the top-left pixel away from %v", test.orientation, test.marked)
+		}
+	}
+}
+
+func TestEncodeJPEGKeepsDimensions(t *testing.T) {
+	src := Fit(image.NewNRGBA(image.Rect(0, 0, 400, 100)), 200)
+
+	var encoded bytes.Buffer
+	if err := EncodeJPEG(&encoded, src, 80); err != nil {
+		t.Fatalf("EncodeJPEG: %v", err)
+	}
+	config, err := jpeg.DecodeConfig(&encoded)
+	if err != nil {
+		t.Fatalf("decoding JPEG: %v", err)
+	}
+	if config.Width != 200 || config.Height != 50 {
+		t.Errorf("encoded JPEG is %dx%d, want 200x50", config.Width, config.Height)
+	}
+}
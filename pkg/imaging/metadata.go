@@ -0,0 +1,220 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrMalformed is returned when an image file cannot be parsed
+var ErrMalformed = errors.New("imaging: malformed image file")
+
+// StripMetadata removes EXIF, XMP, IPTC and text metadata (including GPS
+// location) from a JPEG, PNG or WebP file without re-encoding the image.
+// For JPEG files the EXIF orientation found before stripping is returned
+// (1 if absent), so that callers can rotate the pixels instead. Files of other
+// types are returned unchanged.
+func StripMetadata(mimeType string, data []byte) ([]byte, int, error) {
+	switch mimeType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		stripped, err := stripPNG(data)
+		return stripped, 1, err
+	case "image/webp":
+		stripped, err := stripWebP(data)
+		return stripped, 1, err
+	default:
+		return data, 1, nil
+	}
+}
+
+// stripJPEG drops APP1 (EXIF/XMP), APP13 (IPTC) and comment segments.
+// APP0, ICC profiles (APP2) and Adobe color information (APP14) are kept.
+func stripJPEG(data []byte) ([]byte, int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 1, ErrMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	orientation := 1
+
+	pos := 2
+	for pos < len(data) {
+		if data[pos] != 0xFF {
+			return nil, 1, ErrMalformed
+		}
+		// Skip fill bytes
+		for pos+1 < len(data) && data[pos+1] == 0xFF {
+			pos++
+		}
+		if pos+1 >= len(data) {
+			return nil, 1, ErrMalformed
+		}
+		marker := data[pos+1]
+
+		// Markers without a length field
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD9) {
+			out.Write(data[pos : pos+2])
+			pos += 2
+			if marker == 0xD9 {
+				break
+			}
+			continue
+		}
+
+		if pos+4 > len(data) {
+			return nil, 1, ErrMalformed
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, 1, ErrMalformed
+		}
+
+		switch marker {
+		case 0xE1:
+			if o := exifOrientation(data[pos+4 : end]); o != 0 {
+				orientation = o
+			}
+		case 0xED, 0xFE:
+		case 0xDA:
+			// Start of scan: the rest is entropy-coded image data
+			out.Write(data[pos:])
+			return out.Bytes(), orientation, nil
+		default:
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+
+	return out.Bytes(), orientation, nil
+}
+
+// exifOrientation reads the orientation tag from an APP1 EXIF payload,
+// returning 0 if there is none
+func exifOrientation(payload []byte) int {
+	if len(payload) < 14 || string(payload[:6]) != "Exif\x00\x00" {
+		return 0
+	}
+	tiff := payload[6:]
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd : ifd+2]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// pngMetadataChunks are the ancillary PNG chunks that may carry personal data
+var pngMetadataChunks = map[string]bool{
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"eXIf": true,
+	"tIME": true,
+}
+
+func stripPNG(data []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if len(data) < len(signature) || string(data[:len(signature)]) != signature {
+		return nil, ErrMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.WriteString(signature)
+
+	pos := len(signature)
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, ErrMalformed
+		}
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		chunkType := string(data[pos+4 : pos+8])
+		end := pos + 12 + length
+		if length < 0 || end > len(data) || end < pos {
+			return nil, ErrMalformed
+		}
+
+		if !pngMetadataChunks[chunkType] {
+			out.Write(data[pos:end])
+		}
+		pos = end
+		if chunkType == "IEND" {
+			break
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+// VP8X feature flags announcing EXIF and XMP chunks
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrMalformed
+	}
+
+	var chunks bytes.Buffer
+	pos := 12
+	for pos+8 <= len(data) {
+		chunkType := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		end := pos + 8 + size + size%2
+		if size < 0 || end > len(data) || end < pos {
+			// Tolerate a missing padding byte on the last chunk
+			if pos+8+size == len(data) {
+				end = len(data)
+			} else {
+				return nil, ErrMalformed
+			}
+		}
+
+		switch chunkType {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[pos:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= webpFlagEXIF | webpFlagXMP
+			}
+			chunks.Write(chunk)
+		default:
+			chunks.Write(data[pos:end])
+		}
+		pos = end
+	}
+
+	out := make([]byte, 12, 12+chunks.Len())
+	copy(out, data[:12])
+	binary.LittleEndian.PutUint32(out[4:8], uint32(4+chunks.Len()))
+	return append(out, chunks.Bytes()...), nil
+}
@@ -0,0 +1,142 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// gpsSecret is written into the GPS data of test photos, so that any trace of
+// it left in a stripped file shows up
+const gpsSecret = "GPS 52.5200N 13.4050E"
+
+// exifSegment returns an APP1 segment with an orientation tag and a GPS IFD
+func exifSegment(orientation uint16) []byte {
+	order := binary.LittleEndian
+	var tiff bytes.Buffer
+	tiff.WriteString("II")
+	binary.Write(&tiff, order, uint16(42))
+	binary.Write(&tiff, order, uint32(8))
+
+	// IFD0 at 8: orientation and a pointer to the GPS IFD
+	const gpsIFD = 8 + 2 + 2*12 + 4
+	binary.Write(&tiff, order, uint16(2))
+	binary.Write(&tiff, order, []uint16{0x0112, 3})
+	binary.Write(&tiff, order, uint32(1))
+	binary.Write(&tiff, order, []uint16{orientation, 0})
+	binary.Write(&tiff, order, []uint16{0x8825, 4})
+	binary.Write(&tiff, order, uint32(1))
+	binary.Write(&tiff, order, uint32(gpsIFD))
+	binary.Write(&tiff, order, uint32(0))
+
+	// GPS IFD: the processing method, stored after the IFD
+	const gpsData = gpsIFD + 2 + 12 + 4
+	binary.Write(&tiff, order, uint16(1))
+	binary.Write(&tiff, order, []uint16{0x001B, 7})
+	binary.Write(&tiff, order, uint32(len(gpsSecret)))
+	binary.Write(&tiff, order, uint32(gpsData))
+	binary.Write(&tiff, order, uint32(0))
+	tiff.WriteString(gpsSecret)
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	return segment(0xE1, payload)
+}
+
+func segment(marker byte, payload []byte) []byte {
+	header := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(payload)+2))
+	return append(header, payload...)
+}
+
+// testPhoto encodes a width x height JPEG and inserts the given segments after
+// the start of image marker, as cameras do
+func testPhoto(t *testing.T, width, height int, segments ...[]byte) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 255 / width), G: uint8(y * 255 / height), B: 128, A: 255})
+		}
+	}
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, nil); err != nil {
+		t.Fatalf("encoding test photo: %v", err)
+	}
+
+	photo := append([]byte{}, encoded.Bytes()[:2]...)
+	for _, s := range segments {
+		photo = append(photo, s...)
+	}
+	return append(photo, encoded.Bytes()[2:]...)
+}
+
+func TestStripMetadataJPEG(t *testing.T) {
+	photo := testPhoto(t, 40, 30,
+		exifSegment(6),
+		segment(0xED, []byte("Photoshop 3.0\x00IPTC city: Berlin")),
+		segment(0xFE, []byte("taken at home")),
+	)
+	if !bytes.Contains(photo, []byte(gpsSecret)) {
+		t.Fatal("test photo has no GPS data")
+	}
+
+	stripped, orientation, err := StripMetadata("image/jpeg", photo)
+	if err != nil {
+		t.Fatalf("StripMetadata: %v", err)
+	}
+	if orientation != 6 {
+		t.Errorf("StripMetadata returned orientation %d, want 6", orientation)
+	}
+	for _, leak := range []string{gpsSecret, "Exif", "Berlin", "taken at home"} {
+		if bytes.Contains(stripped, []byte(leak)) {
+			t.Errorf("stripped file still contains %q", leak)
+		}
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		t.Fatalf("decoding stripped file: %v", err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(40, 30) {
+		t.Errorf("stripped file is %v, want 40x30", size)
+	}
+	if size := Orient(img, orientation).Bounds().Size(); size != image.Pt(30, 40) {
+		t.Errorf("oriented image is %v, want 30x40", size)
+	}
+}
+
+func TestStripMetadataJPEGWithoutEXIF(t *testing.T) {
+	photo := testPhoto(t, 16, 8)
+
+	stripped, orientation, err := StripMetadata("image/jpeg", photo)
+	if err != nil {
+		t.Fatalf("StripMetadata: %v", err)
+	}
+	if orientation != 1 {
+		t.Errorf("StripMetadata returned orientation %d, want 1", orientation)
+	}
+	if !bytes.Equal(stripped, photo) {
+		t.Error("StripMetadata changed a file without metadata")
+	}
+}
+
+func TestStripMetadataMalformedJPEG(t *testing.T) {
+	photo := testPhoto(t, 16, 8, exifSegment(1))
+
+	tests := map[string][]byte{
+		"empty":             {},
+		"no start of image": photo[2:],
+		"truncated segment": photo[:10],
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := StripMetadata("image/jpeg", data); !errors.Is(err, ErrMalformed) {
+				t.Errorf("StripMetadata returned %v, want ErrMalformed", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxBroadcastRecipients is the most recipients a broadcast list can have
+const MaxBroadcastRecipients = 256
+
+// BroadcastList is a user's list of recipients that a message can be sent to at
+// once. Every recipient gets their own copy in the 1:1 chat with the owner.
+type BroadcastList struct {
+	ID           primitive.ObjectID   `bson:"_id"`
+	OwnerID      primitive.ObjectID   `bson:"owner_id"`
+	Name         string               `bson:"name"`
+	RecipientIDs []primitive.ObjectID `bson:"recipient_ids"`
+	CreatedAt    time.Time            `bson:"created_at"`
+	UpdatedAt    time.Time            `bson:"updated_at"`
+}
+
+// BroadcastListRequest creates a broadcast list or replaces one
+type BroadcastListRequest struct {
+	Name         string   `json:"name" binding:"required,max=100" example:"Team"`
+	RecipientIDs []string `json:"recipient_ids" binding:"required" example:"5f8d0f1b9d9d9d9d9d9d9d9e"`
+}
+
+// BroadcastListResponse is a broadcast list in API responses
+type BroadcastListResponse struct {
+	ID           string   `json:"id" example:"5f8d0f1b9d9d9d9d9d9d9d9b"`
+	Name         string   `json:"name" example:"Team"`
+	RecipientIDs []string `json:"recipient_ids" example:"5f8d0f1b9d9d9d9d9d9d9d9e"`
+	CreatedAt    string   `json:"created_at" example:"2023-08-01T15:04:05Z"`
+	UpdatedAt    string   `json:"updated_at" example:"2023-08-01T15:04:05Z"`
+}
+
+// BroadcastResponse reports the messages one broadcast created
+type BroadcastResponse struct {
+	BroadcastID string            `json:"broadcast_id" example:"5f8d0f1b9d9d9d9d9d9d9d9b"`
+	Messages    []MessageResponse `json:"messages"`                                                 // one per recipient that got the message
+	SkippedIDs  []string          `json:"skipped_recipient_ids" example:"5f8d0f1b9d9d9d9d9d9d9d9c"` // recipients who have not added the sender as a contact
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CallRingTimeout is how long a call rings before it counts as missed
+const CallRingTimeout = 45 * time.Second
+
+// CallFrameType is the type of WebSocket frames that carry call signals
+const CallFrameType = "call"
+
+// Signals clients exchange to set up calls, see CallSignal
+const (
+	CallSignalOffer        = "offer"         // starts a call, or carries an SDP offer to a participant of one
+	CallSignalAnswer       = "answer"        // SDP answer to an offer
+	CallSignalICECandidate = "ice_candidate" // ICE candidate for the peer connection with TargetID
+	CallSignalRinging      = "ringing"       // the callee's device is ringing
+	CallSignalAccept       = "accept"        // the callee picked up
+	CallSignalReject       = "reject"        // the callee declined
+	CallSignalHangup       = "hangup"        // leaves the call; without a call ID, whatever call the user is in
+)
+
+// IsValidCallSignal reports whether signal is one of the call signals
+func IsValidCallSignal(signal string) bool {
+	switch signal {
+	case CallSignalOffer, CallSignalAnswer, CallSignalICECandidate, CallSignalRinging,
+		CallSignalAccept, CallSignalReject, CallSignalHangup:
+		return true
+	}
+	return false
+}
+
+// CallRoutingKey returns the routing key gateways publish signals from clients with
+func CallRoutingKey(signal string) string {
+	return "call." + signal
+}
+
+// CallEventRoutingKey returns the routing key call events are published with.
+// Every gateway binds its own queue to them and delivers them to the recipients
+// connected to it, so that the sides of a call may be on different gateways.
+func CallEventRoutingKey(eventType string) string {
+	return "call_event." + eventType
+}
+
+// Events about calls
+const (
+	EventCallOffer        = "call_offer"         // a call rings, or a participant sends an SDP offer; data is CallSignal
+	EventCallAnswer       = "call_answer"        // data is CallSignal
+	EventCallICECandidate = "call_ice_candidate" // data is CallSignal
+	EventCallRinging      = "call_ringing"       // sent to the caller; data is CallSignal
+	EventCallUpdated      = "call_updated"       // the call started, someone picked up, declined or left; data is CallResponse
+	EventCallEnded        = "call_ended"         // data is CallResponse with the reason
+	EventCallFailed       = "call_failed"        // sent to the sender of a signal that was refused; data is CallError
+)
+
+// States of a call
+const (
+	CallStateRinging = "ringing" // nobody picked up yet
+	CallStateActive  = "active"
+	CallStateEnded   = "ended"
+)
+
+// Reasons a call ended
+const (
+	CallEndCompleted = "completed" // someone picked up and everyone hung up
+	CallEndMissed    = "missed"    // nobody picked up before the ring timeout
+	CallEndCancelled = "cancelled" // the caller hung up before anyone picked up
+	CallEndRejected  = "rejected"  // everyone called declined
+	CallEndBusy      = "busy"      // everyone called was in another call
+)
+
+// CallSignal is a call signaling frame. Clients send it on the WebSocket with
+// type "call"; the gateway fills in the sender and relays it to the message
+// service, which forwards it to the other participants as a call_* event.
+type CallSignal struct {
+	Type       string          `json:"type,omitempty" example:"call"`
+	Signal     string          `json:"signal" example:"offer"`
+	CallID     string          `json:"call_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9b"` // empty when starting a call
+	SenderID   string          `json:"sender_id" example:"5f8d0f1b9d9d9d9d9d9d9d9d"`
+	SessionID  string          `json:"session_id,omitempty" swaggerignore:"true"`                // connection the signal came from, set by the gateway
+	ReceiverID string          `json:"receiver_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9e"` // callee of a new 1:1 call
+	GroupID    string          `json:"group_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9a"`    // group of a new group call
+	TargetID   string          `json:"target_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9e"`   // participant an offer, answer or candidate is for; defaults to the other side of a 1:1 call
+	Video      bool            `json:"video,omitempty" example:"false"`
+	SDP        string          `json:"sdp,omitempty"`
+	Candidate  json.RawMessage `json:"candidate,omitempty" swaggertype:"object"` // as produced by RTCPeerConnection
+	Timestamp  string          `json:"timestamp,omitempty" example:"2023-08-01T15:04:05Z"`
+}
+
+// CallError tells the sender of a call signal why it was refused
+type CallError struct {
+	Signal string `json:"signal" example:"offer"`
+	CallID string `json:"call_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9b"`
+	Error  string `json:"error" example:"You are already in a call"`
+}
+
+// Call is a 1:1 or group voice or video call and, once ended, its entry in the call log
+type Call struct {
+	ID            primitive.ObjectID   `bson:"_id"`
+	CallerID      primitive.ObjectID   `bson:"caller_id"`
+	ReceiverID    primitive.ObjectID   `bson:"receiver_id,omitempty"` // 1:1 calls
+	GroupID       primitive.ObjectID   `bson:"group_id,omitempty"`    // group calls
+	Video         bool                 `bson:"video"`
+	State         string               `bson:"state"`
+	InviteeIDs    []primitive.ObjectID `bson:"invitee_ids"`            // everyone called apart from the caller
+	JoinedIDs     []primitive.ObjectID `bson:"joined_ids"`             // in the call now, starting with the caller
+	AnsweredIDs   []primitive.ObjectID `bson:"answered_ids,omitempty"` // invitees who picked up at some point
+	RejectedIDs   []primitive.ObjectID `bson:"rejected_ids,omitempty"`
+	BusyIDs       []primitive.ObjectID `bson:"busy_ids,omitempty"` // invitees who were in another call
+	RingExpiresAt time.Time            `bson:"ring_expires_at"`
+	AnsweredAt    *time.Time           `bson:"answered_at,omitempty"`
+	EndedAt       *time.Time           `bson:"ended_at,omitempty"`
+	EndReason     string               `bson:"end_reason,omitempty"`
+	Duration      int64                `bson:"duration,omitempty"`   // seconds from the first pick up to the end
+	MessageID     primitive.ObjectID   `bson:"message_id,omitempty"` // the call entry in the chat
+	CreatedAt     time.Time            `bson:"created_at"`
+}
+
+// CallInfo describes a call entry in a chat
+type CallInfo struct {
+	CallID    primitive.ObjectID `bson:"call_id" json:"call_id"`
+	Video     bool               `bson:"video" json:"video" example:"false"`
+	EndReason string             `bson:"end_reason" json:"end_reason" example:"completed"`
+	Duration  int64              `bson:"duration,omitempty" json:"duration,omitempty" example:"95"` // seconds
+}
+
+// Summary returns a one-line summary of the call, e.g. "Missed voice call"
+func (c *CallInfo) Summary() string {
+	kind := "voice call"
+	if c.Video {
+		kind = "video call"
+	}
+	switch c.EndReason {
+	case CallEndCompleted:
+		label := "Voice call"
+		if c.Video {
+			label = "Video call"
+		}
+		return fmt.Sprintf("%s (%d:%02d)", label, c.Duration/60, c.Duration%60)
+	case CallEndRejected:
+		return "Declined " + kind
+	default:
+		return "Missed " + kind
+	}
+}
+
+// CallResponse represents a call in API responses and call events
+type CallResponse struct {
+	ID          string   `json:"id" example:"5f8d0f1b9d9d9d9d9d9d9d9b"`
+	CallerID    string   `json:"caller_id" example:"5f8d0f1b9d9d9d9d9d9d9d9d"`
+	ReceiverID  string   `json:"receiver_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9e"`
+	GroupID     string   `json:"group_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9a"`
+	Video       bool     `json:"video" example:"false"`
+	State       string   `json:"state" example:"active"`
+	InviteeIDs  []string `json:"invitee_ids"`
+	JoinedIDs   []string `json:"joined_ids,omitempty"` // in the call now
+	RejectedIDs []string `json:"rejected_ids,omitempty"`
+	BusyIDs     []string `json:"busy_ids,omitempty"`
+	AnsweredAt  string   `json:"answered_at,omitempty" example:"2023-08-01T15:04:12Z"`
+	EndedAt     string   `json:"ended_at,omitempty" example:"2023-08-01T15:05:47Z"`
+	EndReason   string   `json:"end_reason,omitempty" example:"completed"`
+	Duration    int64    `json:"duration,omitempty" example:"95"` // seconds
+	MessageID   string   `json:"message_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9f"`
+	CreatedAt   string   `json:"created_at" example:"2023-08-01T15:04:05Z"`
+}
+
+// CallLogEntry is a call as seen in the call log of one of its participants
+type CallLogEntry struct {
+	CallResponse
+	Outgoing bool `json:"outgoing" example:"false"` // the user placed the call
+	Missed   bool `json:"missed" example:"true"`    // an incoming call the user never picked up
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EventChannelPost is the type of posts pushed to the followers of a channel
+const EventChannelPost = "channel_post"
+
+// ChannelRoutingKey is the routing key posts of a channel are published with.
+// Each gateway binds the channels its connected users follow, so a post is
+// published once rather than once per follower.
+func ChannelRoutingKey(channelID string) string {
+	return "channel." + channelID
+}
+
+// ChannelFollowsRoutingKey is the routing key follow changes of userID are
+// published with, so that gateways can update their channel bindings
+func ChannelFollowsRoutingKey(userID string) string {
+	return "channel_follows." + userID
+}
+
+// Channel is a one-to-many announcement channel. Admins post, followers read
+// and react.
+type Channel struct {
+	ID            primitive.ObjectID   `bson:"_id"`
+	Name          string               `bson:"name"`
+	Description   string               `bson:"description,omitempty"`
+	OwnerID       primitive.ObjectID   `bson:"owner_id"`
+	AdminIDs      []primitive.ObjectID `bson:"admin_ids"` // includes the owner
+	FollowerCount int64                `bson:"follower_count"`
+	CreatedAt     time.Time            `bson:"created_at"`
+	UpdatedAt     time.Time            `bson:"updated_at"`
+}
+
+// IsAdmin reports whether userID may post in the channel
+func (ch *Channel) IsAdmin(userID primitive.ObjectID) bool {
+	for _, adminID := range ch.AdminIDs {
+		if adminID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// ChannelFollower records that a user follows a channel
+type ChannelFollower struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	ChannelID  primitive.ObjectID `bson:"channel_id"`
+	UserID     primitive.ObjectID `bson:"user_id"`
+	FollowedAt time.Time          `bson:"followed_at"`
+}
+
+// ChannelReaction is a follower's reaction to a channel post. Each follower has
+// at most one per post; the post keeps the counts.
+type ChannelReaction struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	PostID    primitive.ObjectID `bson:"post_id"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	Emoji     string             `bson:"emoji"`
+	ReactedAt time.Time          `bson:"reacted_at"`
+}
+
+// ChannelRequest creates a channel
+type ChannelRequest struct {
+	Name        string `json:"name" binding:"required,max=100" example:"Company announcements"`
+	Description string `json:"description" binding:"max=500" example:"News for everyone at the company"`
+}
+
+// ChannelAdminRequest makes a user an admin of a channel
+type ChannelAdminRequest struct {
+	UserID string `json:"user_id" binding:"required" example:"5f8d0f1b9d9d9d9d9d9d9d9d"`
+}
+
+// ReactionRequest sets the caller's reaction to a post
+type ReactionRequest struct {
+	Emoji string `json:"emoji" binding:"required" example:"👍"`
+}
+
+// ChannelResponse is a channel in API responses
+type ChannelResponse struct {
+	ID            string   `json:"id" example:"5f8d0f1b9d9d9d9d9d9d9d9a"`
+	Name          string   `json:"name" example:"Company announcements"`
+	Description   string   `json:"description,omitempty" example:"News for everyone at the company"`
+	OwnerID       string   `json:"owner_id" example:"5f8d0f1b9d9d9d9d9d9d9d9d"`
+	AdminIDs      []string `json:"admin_ids"`
+	FollowerCount int64    `json:"follower_count" example:"20000"`
+	Following     bool     `json:"following" example:"true"` // the caller follows the channel
+	IsAdmin       bool     `json:"is_admin" example:"false"` // the caller can post
+	CreatedAt     string   `json:"created_at" example:"2023-08-01T15:04:05Z"`
+}
+
+// ChannelFollowUpdate tells gateways that a user followed or unfollowed a channel
+type ChannelFollowUpdate struct {
+	ChannelID string `json:"channel_id"`
+	UserID    string `json:"user_id"`
+	Following bool   `json:"following"`
+}
+
+// ChannelPostEvent is a new post as published to the followers of a channel
+type ChannelPostEvent struct {
+	Type      string          `json:"type" example:"channel_post"`
+	ChannelID string          `json:"channel_id" example:"5f8d0f1b9d9d9d9d9d9d9d9a"`
+	Post      MessageResponse `json:"post"`
+	Timestamp string          `json:"timestamp" example:"2023-08-01T15:04:05Z"`
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Events about chat settings and disappearing messages
+const (
+	EventChatSettingsUpdated = "chat_settings_updated"
+	EventMessagesExpired     = "messages_expired"
+)
+
+// SystemActionDisappearingTimer is the action of system messages announcing a new disappearing messages timer
+const SystemActionDisappearingTimer = "disappearing_timer"
+
+// DisappearingTimerOff turns disappearing messages off
+const DisappearingTimerOff = "off"
+
+// DisappearingTimers maps the disappearing messages timers a chat can have to how long messages last
+var DisappearingTimers = map[string]time.Duration{
+	DisappearingTimerOff: 0,
+	"24h":                24 * time.Hour,
+	"7d":                 7 * 24 * time.Hour,
+	"90d":                90 * 24 * time.Hour,
+}
+
+// ChatSettings holds the settings shared by everyone in a group or direct chat
+type ChatSettings struct {
+	ID                string               `bson:"_id"` // the group ID, or the two user IDs of a direct chat joined by ':' in ascending order
+	GroupID           primitive.ObjectID   `bson:"group_id,omitempty"`
+	UserIDs           []primitive.ObjectID `bson:"user_ids,omitempty"`
+	DisappearingTimer string               `bson:"disappearing_timer"`
+	PinnedCount       int64                `bson:"pinned_count"` // pinned messages that are not deleted, at most 3
+	UpdatedBy         primitive.ObjectID   `bson:"updated_by"`
+	UpdatedAt         time.Time            `bson:"updated_at"`
+}
+
+// DisappearingTimerRequest changes the disappearing messages timer of a chat
+type DisappearingTimerRequest struct {
+	Timer string `json:"timer" binding:"required" example:"24h"` // off, 24h, 7d or 90d
+}
+
+// ChatSettingsResponse is the settings of a chat in API responses and chat_settings_updated events
+type ChatSettingsResponse struct {
+	GroupID           string   `json:"group_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9a"`
+	UserIDs           []string `json:"user_ids,omitempty"` // the two users of a direct chat
+	DisappearingTimer string   `json:"disappearing_timer" example:"24h"`
+	UpdatedBy         string   `json:"updated_by,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9d"`
+	UpdatedAt         string   `json:"updated_at,omitempty" example:"2023-08-01T15:04:05Z"`
+}
+
+// MessagesExpired lists the messages of a chat that disappeared
+type MessagesExpired struct {
+	GroupID    string   `json:"group_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9a"`
+	UserIDs    []string `json:"user_ids,omitempty"` // the two users of a direct chat
+	MessageIDs []string `json:"message_ids"`
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Community groups related groups under one roof. Every community has an
+// announcements group that all of its members belong to and only community
+// admins can post in; belonging to it is what makes a user a member.
+type Community struct {
+	ID                  primitive.ObjectID   `bson:"_id"`
+	Name                string               `bson:"name"`
+	Description         string               `bson:"description,omitempty"`
+	OwnerID             primitive.ObjectID   `bson:"owner_id"`
+	AdminIDs            []primitive.ObjectID `bson:"admin_ids"` // includes the owner
+	AnnouncementGroupID primitive.ObjectID   `bson:"announcement_group_id"`
+	CreatedAt           time.Time            `bson:"created_at"`
+	UpdatedAt           time.Time            `bson:"updated_at"`
+}
+
+// IsAdmin reports whether userID administers the community
+func (c *Community) IsAdmin(userID primitive.ObjectID) bool {
+	for _, adminID := range c.AdminIDs {
+		if adminID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// CommunityRequest creates a community, optionally linking groups the caller administers
+type CommunityRequest struct {
+	Name        string   `json:"name" binding:"required,max=100" example:"Riverside neighbourhood"`
+	Description string   `json:"description" binding:"max=500" example:"Everything happening on our street"`
+	GroupIDs    []string `json:"group_ids"`
+}
+
+// CommunityGroupRequest links an existing group to a community
+type CommunityGroupRequest struct {
+	GroupID string `json:"group_id" binding:"required" example:"5f8d0f1b9d9d9d9d9d9d9d9b"`
+}
+
+// CommunityAdminRequest makes a member an admin of a community
+type CommunityAdminRequest struct {
+	UserID string `json:"user_id" binding:"required" example:"5f8d0f1b9d9d9d9d9d9d9d9d"`
+}
+
+// CommunityResponse is a community in API responses
+type CommunityResponse struct {
+	ID                  string   `json:"id" example:"5f8d0f1b9d9d9d9d9d9d9d9a"`
+	Name                string   `json:"name" example:"Riverside neighbourhood"`
+	Description         string   `json:"description,omitempty" example:"Everything happening on our street"`
+	OwnerID             string   `json:"owner_id" example:"5f8d0f1b9d9d9d9d9d9d9d9d"`
+	AdminIDs            []string `json:"admin_ids"`
+	AnnouncementGroupID string   `json:"announcement_group_id" example:"5f8d0f1b9d9d9d9d9d9d9d9c"`
+	IsAdmin             bool     `json:"is_admin" example:"true"` // the caller administers the community
+	CreatedAt           string   `json:"created_at" example:"2023-08-01T15:04:05Z"`
+}
+
+// CommunityGroupResponse is a group of a community as members see it when
+// looking for groups to join
+type CommunityGroupResponse struct {
+	ID            string `json:"id" example:"5f8d0f1b9d9d9d9d9d9d9d9b"`
+	Name          string `json:"name" example:"Garden club"`
+	Description   string `json:"description,omitempty" example:"Swapping seeds and tips"`
+	MemberCount   int    `json:"member_count" example:"12"`
+	Announcements bool   `json:"announcements,omitempty" example:"false"`
+	Joined        bool   `json:"joined" example:"true"` // the caller is a member
+}
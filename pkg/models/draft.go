@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EventDraftUpdated is sent to a user when one of their drafts was saved or
+// cleared, so that their other devices can follow; data is DraftResponse
+const EventDraftUpdated = "draft_updated"
+
+// Draft is the unsent text a user left in a chat. Each user has at most one per chat.
+type Draft struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	ChatID    primitive.ObjectID `bson:"chat_id"` // the group, or the other user of a direct chat
+	Group     bool               `bson:"group"`
+	Text      string             `bson:"text"`
+	UpdatedAt time.Time          `bson:"updated_at"`
+}
+
+// DraftRequest saves the draft of a chat; empty text clears it. UpdatedAt is
+// when the text was edited on the device, so that an older edit arriving late
+// does not overwrite a newer one; it defaults to the time of the request.
+type DraftRequest struct {
+	Text      string `json:"text" binding:"max=65536" example:"See you at"`
+	UpdatedAt string `json:"updated_at,omitempty" example:"2023-08-01T15:04:05.123Z"`
+}
+
+// DraftResponse is a draft in API responses and draft_updated events
+type DraftResponse struct {
+	ChatID    string `json:"chat_id" example:"5f8d0f1b9d9d9d9d9d9d9d9a"` // the group, or the other user of a direct chat
+	Group     bool   `json:"group" example:"false"`
+	Text      string `json:"text" example:"See you at"` // empty once the draft was cleared
+	UpdatedAt string `json:"updated_at" example:"2023-08-01T15:04:05.123Z"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Event types delivered to WebSocket clients
+const (
+	EventProfileUpdated = "profile_updated"
+	EventMessageUpdated = "message_updated" // data is the MessageResponse, e.g. after a link preview was attached
+)
+
+// Event is a real-time notification that the API gateway relays to the
+// WebSocket connections of its recipients. Services publish events once on
+// the messages exchange using EventRoutingKey instead of once per recipient.
+type Event struct {
+	Type         string      `json:"type" example:"profile_updated"`
+	RecipientIDs []string    `json:"recipient_ids,omitempty"`
+	Data         interface{} `json:"data"`
+	Timestamp    string      `json:"timestamp" example:"2023-08-01T15:04:05Z"`
+}
+
+// NewEvent creates an event of the given type for recipients
+func NewEvent(eventType string, recipientIDs []string, data interface{}) Event {
+	return Event{
+		Type:         eventType,
+		RecipientIDs: recipientIDs,
+		Data:         data,
+		Timestamp:    time.Now().Format(time.RFC3339),
+	}
+}
+
+// EventRoutingKey returns the routing key events of the given type are published with
+func EventRoutingKey(eventType string) string {
+	return "event." + eventType
+}
@@ -8,14 +8,23 @@ import (
 
 // Group represents a chat group
 type Group struct {
-	ID          primitive.ObjectID   `bson:"_id" json:"id"`
-	Name        string               `bson:"name" json:"name"`
-	Description string               `bson:"description,omitempty" json:"description,omitempty"`
-	OwnerID     primitive.ObjectID   `bson:"owner_id" json:"owner_id"`
-	MemberIDs   []primitive.ObjectID `bson:"member_ids" json:"member_ids"`
-	AvatarURL   string               `bson:"avatar_url,omitempty" json:"avatar_url,omitempty"`
-	CreatedAt   time.Time            `bson:"created_at" json:"created_at"`
-	UpdatedAt   time.Time            `bson:"updated_at" json:"updated_at"`
+	ID               primitive.ObjectID   `bson:"_id" json:"id"`
+	Name             string               `bson:"name" json:"name"`
+	Description      string               `bson:"description,omitempty" json:"description,omitempty"`
+	OwnerID          primitive.ObjectID   `bson:"owner_id" json:"owner_id"`
+	MemberIDs        []primitive.ObjectID `bson:"member_ids" json:"member_ids"`
+	AvatarURL        string               `bson:"avatar_url,omitempty" json:"avatar_url,omitempty"`
+	OnlyAdminsCanPin bool                 `bson:"only_admins_can_pin,omitempty" json:"only_admins_can_pin,omitempty"`
+	CommunityID      primitive.ObjectID   `bson:"community_id,omitempty" json:"community_id,omitempty"`
+	Announcements    bool                 `bson:"announcements,omitempty" json:"announcements,omitempty"` // the announcements group of its community
+	CreatedAt        time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt        time.Time            `bson:"updated_at" json:"updated_at"`
+}
+
+// IsAdmin reports whether userID administers the group. Admins may mention
+// every member with @all; for now the owner is the only admin.
+func (g *Group) IsAdmin(userID primitive.ObjectID) bool {
+	return g.OwnerID == userID
 }
 
 // GroupRequest represents a request to create a group
@@ -27,11 +36,21 @@ type GroupRequest struct {
 
 // GroupResponse represents a group in API responses
 type GroupResponse struct {
-	ID          string   `json:"id"`
-	Name        string   `json:"name"`
-	Description string   `json:"description,omitempty"`
-	OwnerID     string   `json:"owner_id"`
-	MemberIDs   []string `json:"member_ids"`
-	AvatarURL   string   `json:"avatar_url,omitempty"`
-	CreatedAt   string   `json:"created_at"`
+	ID               string   `json:"id"`
+	Name             string   `json:"name"`
+	Description      string   `json:"description,omitempty"`
+	OwnerID          string   `json:"owner_id"`
+	MemberIDs        []string `json:"member_ids"`
+	AvatarURL        string   `json:"avatar_url,omitempty"`
+	OnlyAdminsCanPin bool     `json:"only_admins_can_pin,omitempty"`
+	CommunityID      string   `json:"community_id,omitempty"`
+	Announcements    bool     `json:"announcements,omitempty"`
+	Draft            string   `json:"draft,omitempty"` // your unsent text in the group, see Draft
+	DraftUpdatedAt   string   `json:"draft_updated_at,omitempty"`
+	CreatedAt        string   `json:"created_at"`
+}
+
+// GroupSettingsRequest changes the settings of a group; omitted fields are left as they are
+type GroupSettingsRequest struct {
+	OnlyAdminsCanPin *bool `json:"only_admins_can_pin,omitempty" example:"true"`
 }
@@ -0,0 +1,11 @@
+package models
+
+// LinkPreview summarizes the page behind the first link in a text message.
+// The message service attaches it shortly after the message is sent.
+type LinkPreview struct {
+	URL         string `bson:"url" json:"url" example:"https://go.dev/blog"`
+	Title       string `bson:"title,omitempty" json:"title,omitempty" example:"The Go Blog"`
+	Description string `bson:"description,omitempty" json:"description,omitempty"`
+	SiteName    string `bson:"site_name,omitempty" json:"site_name,omitempty" example:"go.dev"`
+	ImageURL    string `bson:"image_url,omitempty" json:"image_url,omitempty"`
+}
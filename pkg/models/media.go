@@ -0,0 +1,176 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Media kinds, derived from the detected MIME type
+const (
+	MediaKindImage    = "image"
+	MediaKindVideo    = "video"
+	MediaKindAudio    = "audio"
+	MediaKindDocument = "document"
+)
+
+// MediaURLPrefix is the path under which the API gateway serves media
+const MediaURLPrefix = "/api/media/"
+
+// Media describes an uploaded file
+type Media struct {
+	ID         primitive.ObjectID `bson:"_id" json:"id"`
+	OwnerID    primitive.ObjectID `bson:"owner_id" json:"owner_id"`
+	Filename   string             `bson:"filename" json:"filename"` // name of the file on the uploader's device
+	MimeType   string             `bson:"mime_type" json:"mime_type"`
+	Kind       string             `bson:"kind" json:"kind"`
+	Size       int64              `bson:"size" json:"size"`
+	SHA256     string             `bson:"sha256" json:"sha256"`
+	Width      int                `bson:"width,omitempty" json:"width,omitempty"`
+	Height     int                `bson:"height,omitempty" json:"height,omitempty"`
+	Blurhash   string             `bson:"blurhash,omitempty" json:"blurhash,omitempty"` // compact placeholder shown while the image loads
+	Thumbnails []MediaThumbnail   `bson:"thumbnails,omitempty" json:"thumbnails,omitempty"`
+	StorageKey string             `bson:"storage_key" json:"-"` // key of the file in blob storage
+	RefCount   int64              `bson:"ref_count" json:"-"`   // messages, pending scheduled messages, channel posts and statuses using the media
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// MediaThumbnail is a downscaled JPEG copy of an image, kept in blob storage
+type MediaThumbnail struct {
+	Width      int    `bson:"width" json:"width"`
+	Height     int    `bson:"height" json:"height"`
+	StorageKey string `bson:"storage_key" json:"-"`
+}
+
+// MediaThumbnailResponse represents a thumbnail in API responses
+type MediaThumbnailResponse struct {
+	URL    string `json:"url"` // signed, expiring URL
+	Width  int    `json:"width" example:"320"`
+	Height int    `json:"height" example:"240"`
+}
+
+// MediaResponse represents an uploaded file in API responses
+type MediaResponse struct {
+	ID          string                   `json:"id" example:"5f8d0f1b9d9d9d9d9d9d9d9c"`
+	URL         string                   `json:"url" example:"/api/media/5f8d0f1b9d9d9d9d9d9d9d9c"` // stable, attach it to messages as media_url
+	DownloadURL string                   `json:"download_url,omitempty"`                            // signed, expiring URL of the file itself
+	Filename    string                   `json:"filename" example:"holiday.jpg"`
+	MimeType    string                   `json:"mime_type" example:"image/jpeg"`
+	Kind        string                   `json:"kind" example:"image"`
+	Size        int64                    `json:"size" example:"482113"`
+	SHA256      string                   `json:"sha256" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	Width       int                      `json:"width,omitempty" example:"1280"`
+	Height      int                      `json:"height,omitempty" example:"960"`
+	Blurhash    string                   `json:"blurhash,omitempty" example:"LEHV6nWB2yk8pyo0adR*.7kCMdnj"`
+	Thumbnails  []MediaThumbnailResponse `json:"thumbnails,omitempty"` // smallest first
+	CreatedAt   string                   `json:"created_at" example:"2023-08-01T15:04:05Z"`
+}
+
+// ToResponse converts the media record into its API representation
+func (m *Media) ToResponse() MediaResponse {
+	return MediaResponse{
+		ID:        m.ID.Hex(),
+		URL:       MediaURLPrefix + m.ID.Hex(),
+		Filename:  m.Filename,
+		MimeType:  m.MimeType,
+		Kind:      m.Kind,
+		Size:      m.Size,
+		SHA256:    m.SHA256,
+		Width:     m.Width,
+		Height:    m.Height,
+		Blurhash:  m.Blurhash,
+		CreatedAt: m.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// MediaIDFromURL extracts the media ID from a URL returned by an upload.
+// It returns false for any other URL.
+func MediaIDFromURL(url string) (primitive.ObjectID, bool) {
+	if !strings.HasPrefix(url, MediaURLPrefix) {
+		return primitive.NilObjectID, false
+	}
+	id, err := primitive.ObjectIDFromHex(strings.TrimPrefix(url, MediaURLPrefix))
+	if err != nil {
+		return primitive.NilObjectID, false
+	}
+	return id, true
+}
+
+// MediaUpload tracks a resumable upload until it is finalized into a Media record
+type MediaUpload struct {
+	ID         primitive.ObjectID `bson:"_id" json:"id"`
+	OwnerID    primitive.ObjectID `bson:"owner_id" json:"owner_id"`
+	Filename   string             `bson:"filename" json:"filename"`
+	Size       int64              `bson:"size" json:"size"`                         // total size announced when the upload was created
+	Offset     int64              `bson:"offset" json:"offset"`                     // bytes received so far
+	SHA256     string             `bson:"sha256,omitempty" json:"sha256,omitempty"` // expected checksum of the complete file
+	Chunks     []UploadChunk      `bson:"chunks" json:"-"`
+	Finalizing bool               `bson:"finalizing,omitempty" json:"-"`
+	Reserved   bool               `bson:"reserved,omitempty" json:"-"` // Size is charged to the owner's quota until the upload ends
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+	ExpiresAt  time.Time          `bson:"expires_at" json:"expires_at"` // abandoned uploads are removed after this
+}
+
+// UploadChunk is a part of a resumable upload kept in blob storage
+type UploadChunk struct {
+	StorageKey string `bson:"storage_key"`
+	Offset     int64  `bson:"offset"`
+	Size       int64  `bson:"size"`
+}
+
+// MediaUploadRequest starts a resumable upload
+type MediaUploadRequest struct {
+	Filename string `json:"filename" binding:"required" example:"holiday.mp4"`
+	Size     int64  `json:"size" binding:"required" example:"52428800"`
+	SHA256   string `json:"sha256,omitempty" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"` // hex SHA-256 of the complete file, verified on finalize
+}
+
+// MediaUploadResponse describes the state of a resumable upload
+type MediaUploadResponse struct {
+	ID        string `json:"id" example:"5f8d0f1b9d9d9d9d9d9d9d9b"`
+	URL       string `json:"url" example:"/api/media/uploads/5f8d0f1b9d9d9d9d9d9d9d9b"` // target of PATCH, HEAD, finalize and DELETE requests
+	Size      int64  `json:"size" example:"52428800"`
+	Offset    int64  `json:"offset" example:"0"`
+	ExpiresAt string `json:"expires_at" example:"2023-08-02T15:04:05Z"`
+}
+
+// ToResponse converts the upload into its API representation
+func (u *MediaUpload) ToResponse() MediaUploadResponse {
+	return MediaUploadResponse{
+		ID:        u.ID.Hex(),
+		URL:       MediaURLPrefix + "uploads/" + u.ID.Hex(),
+		Size:      u.Size,
+		Offset:    u.Offset,
+		ExpiresAt: u.ExpiresAt.Format(time.RFC3339),
+	}
+}
+
+// MediaBlob is a file in blob storage shared by all media with the same content.
+// It is deleted once no media refers to it anymore.
+type MediaBlob struct {
+	SHA256        string    `bson:"_id"` // also the storage key of the file
+	Size          int64     `bson:"size"`
+	MimeType      string    `bson:"mime_type"`
+	Keys          []string  `bson:"keys"`                     // storage keys of the file and its thumbnails
+	RefCount      int       `bson:"ref_count"`                // number of media records using the blob
+	Stored        bool      `bson:"stored"`                   // set once the files have been written
+	Deleting      bool      `bson:"deleting,omitempty"`       // set while the files are being removed
+	DeletingSince time.Time `bson:"deleting_since,omitempty"` // lets an interrupted deletion be resumed
+	CreatedAt     time.Time `bson:"created_at"`
+}
+
+// MediaUsage is the storage used by the media a user uploaded
+type MediaUsage struct {
+	UserID primitive.ObjectID `bson:"_id"`
+	Bytes  int64              `bson:"bytes"`
+	Count  int64              `bson:"count"`
+}
+
+// MediaUsageResponse reports a user's storage usage
+type MediaUsageResponse struct {
+	UsedBytes  int64 `json:"used_bytes" example:"73400320"`
+	QuotaBytes int64 `json:"quota_bytes" example:"2147483648"` // 0 means unlimited
+	MediaCount int64 `json:"media_count" example:"112"`
+}
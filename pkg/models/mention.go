@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MentionAll is the handle group admins use to mention every member, as in "@all"
+const MentionAll = "all"
+
+// GroupMemberSettings holds one member's notification preferences and read state in a group
+type GroupMemberSettings struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	GroupID        primitive.ObjectID `bson:"group_id"`
+	UserID         primitive.ObjectID `bson:"user_id"`
+	Muted          bool               `bson:"muted"`
+	MutedUntil     *time.Time         `bson:"muted_until,omitempty"`      // nil while muted means indefinitely
+	MentionsReadAt time.Time          `bson:"mentions_read_at,omitempty"` // mentions up to here have been seen
+}
+
+// IsMuted reports whether the group is muted at the given time
+func (s *GroupMemberSettings) IsMuted(now time.Time) bool {
+	return s.Muted && (s.MutedUntil == nil || s.MutedUntil.After(now))
+}
+
+// GroupMuteRequest mutes a group until the given time, or indefinitely without one
+type GroupMuteRequest struct {
+	Until *time.Time `json:"until,omitempty" example:"2023-08-01T23:00:00Z"`
+}
+
+// GroupMuteResponse is the mute state of a group for the current user
+type GroupMuteResponse struct {
+	GroupID    string     `json:"group_id" example:"5f8d0f1b9d9d9d9d9d9d9d9a"`
+	Muted      bool       `json:"muted" example:"true"`
+	MutedUntil *time.Time `json:"muted_until,omitempty"`
+}
+
+// UnreadMentions counts the unseen messages mentioning the current user in one group
+type UnreadMentions struct {
+	GroupID         string `json:"group_id" example:"5f8d0f1b9d9d9d9d9d9d9d9a"`
+	Count           int    `json:"count" example:"2"`
+	LatestMessageID string `json:"latest_message_id" example:"5f8d0f1b9d9d9d9d9d9d9d9f"`
+}
@@ -21,19 +21,50 @@ type Message struct {
 	SenderID   primitive.ObjectID `bson:"sender_id" json:"sender_id"`
 	ReceiverID primitive.ObjectID `bson:"receiver_id,omitempty" json:"receiver_id,omitempty"` 
 	GroupID    primitive.ObjectID `bson:"group_id,omitempty" json:"group_id,omitempty"`       
-	Content    string             `bson:"content" json:"content"`
+	Type       MessageType        `bson:"type,omitempty" json:"type,omitempty"` // empty for messages sent before types existed, see TypeOrDefault
+	Content    string             `bson:"content" json:"content"`              // text, or the caption of media
 	MediaURL   string             `bson:"media_url,omitempty" json:"media_url,omitempty"`
+	MediaID    primitive.ObjectID `bson:"media_id,omitempty" json:"media_id,omitempty"` // set for uploaded media, see Media
+	MediaInfo  *MediaInfo         `bson:"media_info,omitempty" json:"media_info,omitempty"`
+	Document   *DocumentInfo      `bson:"document,omitempty" json:"document,omitempty"`
+	Location   *Location          `bson:"location,omitempty" json:"location,omitempty"`
+	Contact    *ContactCard       `bson:"contact,omitempty" json:"contact,omitempty"`
+	Poll       *Poll              `bson:"poll,omitempty" json:"poll,omitempty"`
+	LinkPreview *LinkPreview      `bson:"link_preview,omitempty" json:"link_preview,omitempty"`
+	Mentions    []primitive.ObjectID `bson:"mentions,omitempty" json:"mentions,omitempty"` // group members mentioned with @username or @all
+	MentionsAll bool              `bson:"mentions_all,omitempty" json:"mentions_all,omitempty"`
+	System      *SystemMessage    `bson:"system,omitempty" json:"system,omitempty"`
+	Call        *CallInfo         `bson:"call,omitempty" json:"call,omitempty"`
+	PinnedAt    *time.Time        `bson:"pinned_at,omitempty" json:"pinned_at,omitempty"`
+	PinnedBy    primitive.ObjectID `bson:"pinned_by,omitempty" json:"pinned_by,omitempty"`
+	ExpiresAt   *time.Time        `bson:"expires_at,omitempty" json:"expires_at,omitempty"` // set while disappearing messages are on in the chat
+	ChannelID   primitive.ObjectID `bson:"channel_id,omitempty" json:"channel_id,omitempty"` // set for channel posts, which are kept apart from chats
+	ReactionCounts map[string]int64 `bson:"reaction_counts,omitempty" json:"reaction_counts,omitempty"` // channel posts only, by emoji
+	ThreadRootID   primitive.ObjectID `bson:"thread_root_id,omitempty" json:"thread_root_id,omitempty"` // set for thread replies, which stay out of the group timeline
+	ThreadReplyCount int64            `bson:"thread_reply_count,omitempty" json:"thread_reply_count,omitempty"` // thread roots only
+	ThreadLastReplyAt *time.Time      `bson:"thread_last_reply_at,omitempty" json:"thread_last_reply_at,omitempty"`
+	ThreadParticipantIDs []primitive.ObjectID `bson:"thread_participant_ids,omitempty" json:"-"` // everyone who replied in the thread
 	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt  time.Time          `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
 	Status     MessageStatus      `bson:"status" json:"status"`
+	DeletedAt  time.Time          `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"` // content removed, e.g. after the sender deleted their account
 }
 
 // MessageRequest represents a request to send a message
 type MessageRequest struct {
 	ReceiverID string `json:"receiver_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9d"` // Optional if GroupID is set
 	GroupID    string `json:"group_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9a"`    // Optional if ReceiverID is set
-	Content    string `json:"content" example:"Hello, how are you?" binding:"required"`
+	BroadcastID string `json:"broadcast_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9b"` // sends a copy to each recipient of one of your broadcast lists instead
+	Type       MessageType `json:"type,omitempty" example:"text"` // defaults to text, or to the kind of the attached media
+	Content    string `json:"content" example:"Hello, how are you?"` // required for text messages, a caption otherwise
 	MediaURL   string `json:"media_url,omitempty" example:"https://example.com/image.jpg"`
+	MediaID    string `json:"media_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9c"` // uploaded media; a media_url returned by an upload works too
+	MediaInfo  *MediaInfo    `json:"media_info,omitempty"` // audio, voice and video messages
+	Document   *DocumentInfo `json:"document,omitempty"`   // document messages; filename and size default to the upload's
+	Location   *Location     `json:"location,omitempty"`   // required for location messages
+	Contact    *ContactCard  `json:"contact,omitempty"`    // required for contact messages
+	Poll       *PollRequest  `json:"poll,omitempty"`       // required for poll messages
+	ThreadRootID string      `json:"thread_root_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9f"` // replies in the thread of a message in the group
 }
 
 // MessageResponse represents a message in API responses
@@ -43,10 +74,36 @@ type MessageResponse struct {
     SenderUsername string `json:"sender_username,omitempty" example:"johndoe"`
 	ReceiverID     string `json:"receiver_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9e"`
 	GroupID        string `json:"group_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9a"`
+	Type           MessageType `json:"type" example:"text"`
 	Content        string `json:"content" example:"Hello, how are you?"`
+	Preview        string `json:"preview" example:"Hello, how are you?"` // one-line summary for conversation lists
 	MediaURL       string `json:"media_url,omitempty" example:"https://example.com/image.jpg"`
+	MediaID        string `json:"media_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9c"`
+	Media          *MediaResponse `json:"media,omitempty"` // type, dimensions, placeholder and thumbnails of the attached media
+	MediaInfo      *MediaInfo     `json:"media_info,omitempty"`
+	Document       *DocumentInfo  `json:"document,omitempty"`
+	Location       *Location      `json:"location,omitempty"`
+	Contact        *ContactCard   `json:"contact,omitempty"`
+	Poll           *PollResults   `json:"poll,omitempty"` // question, options and current tally
+	LinkPreview    *LinkPreview   `json:"link_preview,omitempty"` // added asynchronously, see the message_updated event
+	Mentions       []string       `json:"mentions,omitempty"` // IDs of mentioned group members
+	MentionsAll    bool           `json:"mentions_all,omitempty" example:"false"` // an admin mentioned everyone with @all
+	Silent         bool           `json:"silent,omitempty" example:"false"` // the recipient muted the group and is not mentioned, so clients should not notify
+	Starred        bool           `json:"starred,omitempty" example:"false"` // the caller starred the message
+	System         *SystemMessage `json:"system,omitempty"` // what happened, for system messages
+	Call           *CallInfo      `json:"call,omitempty"` // call entries: kind, outcome and duration of the call
+	PinnedAt       string         `json:"pinned_at,omitempty" example:"2023-08-01T15:04:05Z"`
+	PinnedBy       string         `json:"pinned_by,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9d"`
+	ExpiresAt      string         `json:"expires_at,omitempty" example:"2023-08-02T15:04:05Z"` // when the message disappears
+	ChannelID      string         `json:"channel_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9a"` // set for channel posts
+	Reactions      map[string]int64 `json:"reactions,omitempty"` // channel posts: number of reactions by emoji
+	MyReaction     string         `json:"my_reaction,omitempty" example:"👍"` // channel posts: the caller's reaction
+	ThreadRootID   string         `json:"thread_root_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9f"` // set for thread replies
+	ThreadReplyCount int64        `json:"thread_reply_count,omitempty" example:"4"` // thread roots: number of replies
+	ThreadLastReplyAt string      `json:"thread_last_reply_at,omitempty" example:"2023-08-01T15:04:05Z"`
 	CreatedAt      string `json:"created_at" example:"2023-08-01T15:04:05Z"`
 	Status         string `json:"status" example:"delivered"`
+	Deleted        bool   `json:"deleted,omitempty" example:"false"`
 }
 
 // MessageStatusUpdate represents a request to update message status
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MessageType tells clients how to render a message
+type MessageType string
+
+const (
+	MessageTypeText     MessageType = "text"
+	MessageTypeImage    MessageType = "image"
+	MessageTypeVideo    MessageType = "video"
+	MessageTypeAudio    MessageType = "audio" // audio file
+	MessageTypeVoice    MessageType = "voice" // recorded voice note
+	MessageTypeDocument MessageType = "document"
+	MessageTypeLocation MessageType = "location"
+	MessageTypeContact  MessageType = "contact"
+	MessageTypePoll     MessageType = "poll"
+	MessageTypeSystem   MessageType = "system" // created by the server, e.g. when a message is pinned
+	MessageTypeCall     MessageType = "call"   // created by the server when a call ends, see CallInfo
+)
+
+// IsValidMessageType reports whether t is a type clients may send
+func IsValidMessageType(t MessageType) bool {
+	switch t {
+	case MessageTypeText, MessageTypeImage, MessageTypeVideo, MessageTypeAudio, MessageTypeVoice,
+		MessageTypeDocument, MessageTypeLocation, MessageTypeContact, MessageTypePoll:
+		return true
+	}
+	return false
+}
+
+// HasMedia reports whether messages of type t carry a file
+func (t MessageType) HasMedia() bool {
+	switch t {
+	case MessageTypeImage, MessageTypeVideo, MessageTypeAudio, MessageTypeVoice, MessageTypeDocument:
+		return true
+	}
+	return false
+}
+
+// MediaInfo describes the playback of audio, voice and video messages
+type MediaInfo struct {
+	Duration float64 `bson:"duration,omitempty" json:"duration,omitempty" example:"12.5"` // seconds
+	Waveform []int   `bson:"waveform,omitempty" json:"waveform,omitempty"`                // amplitude samples from 0 to 100 for voice notes
+}
+
+// DocumentInfo describes a document message
+type DocumentInfo struct {
+	Filename  string `bson:"filename" json:"filename" example:"report.pdf"`
+	Size      int64  `bson:"size,omitempty" json:"size,omitempty" example:"482113"`
+	PageCount int    `bson:"page_count,omitempty" json:"page_count,omitempty" example:"12"`
+}
+
+// Location is a shared place or, with LiveUntil set, a live location
+type Location struct {
+	Latitude  float64    `bson:"latitude" json:"latitude" example:"41.0082"`
+	Longitude float64    `bson:"longitude" json:"longitude" example:"28.9784"`
+	Name      string     `bson:"name,omitempty" json:"name,omitempty" example:"Galata Tower"`
+	Address   string     `bson:"address,omitempty" json:"address,omitempty"`
+	LiveUntil *time.Time `bson:"live_until,omitempty" json:"live_until,omitempty"` // end of live location sharing
+}
+
+// ContactCard is a shared contact in vCard format
+type ContactCard struct {
+	DisplayName string `bson:"display_name" json:"display_name" example:"Jane Doe"`
+	VCard       string `bson:"vcard" json:"vcard" example:"BEGIN:VCARD\nVERSION:3.0\nFN:Jane Doe\nTEL:+905551234567\nEND:VCARD"`
+}
+
+// TypeOrDefault returns the type of m, treating messages stored before types
+// existed as text or, with an attachment, as documents
+func (m *Message) TypeOrDefault() MessageType {
+	if m.Type != "" {
+		return m.Type
+	}
+	if !m.MediaID.IsZero() {
+		return MessageTypeDocument
+	}
+	return MessageTypeText
+}
+
+// Preview returns a one-line summary of m for conversation lists and search results
+func (m *Message) Preview() string {
+	if !m.DeletedAt.IsZero() {
+		return "This message was deleted"
+	}
+
+	caption := strings.TrimSpace(m.Content)
+	withCaption := func(label string) string {
+		if caption != "" {
+			return label + ": " + caption
+		}
+		return label
+	}
+
+	switch m.TypeOrDefault() {
+	case MessageTypeImage:
+		return withCaption("Photo")
+	case MessageTypeVideo:
+		return withCaption("Video" + m.durationSuffix())
+	case MessageTypeAudio:
+		return withCaption("Audio" + m.durationSuffix())
+	case MessageTypeVoice:
+		return "Voice message" + m.durationSuffix()
+	case MessageTypeDocument:
+		if m.Document != nil && m.Document.Filename != "" {
+			return withCaption(m.Document.Filename)
+		}
+		return withCaption("Document")
+	case MessageTypeLocation:
+		label := "Location"
+		if m.Location != nil && m.Location.LiveUntil != nil {
+			label = "Live location"
+		}
+		if m.Location != nil && m.Location.Name != "" {
+			label += ": " + m.Location.Name
+		}
+		return label
+	case MessageTypeContact:
+		if m.Contact != nil && m.Contact.DisplayName != "" {
+			return "Contact: " + m.Contact.DisplayName
+		}
+		return "Contact"
+	case MessageTypePoll:
+		if m.Poll != nil {
+			return "Poll: " + m.Poll.Question
+		}
+		return "Poll"
+	case MessageTypeSystem:
+		if m.System != nil {
+			switch m.System.Action {
+			case SystemActionPinned:
+				return "Pinned a message"
+			case SystemActionUnpinned:
+				return "Unpinned a message"
+			case SystemActionDisappearingTimer:
+				if m.System.Timer == DisappearingTimerOff {
+					return "Turned off disappearing messages"
+				}
+				return "Turned on disappearing messages (" + m.System.Timer + ")"
+			}
+		}
+		return ""
+	case MessageTypeCall:
+		if m.Call != nil {
+			return m.Call.Summary()
+		}
+		return "Call"
+	default:
+		return m.Content
+	}
+}
+
+// durationSuffix formats the media duration as " (m:ss)", or "" if unknown
+func (m *Message) durationSuffix() string {
+	if m.MediaInfo == nil || m.MediaInfo.Duration <= 0 {
+		return ""
+	}
+	seconds := int(m.MediaInfo.Duration + 0.5)
+	return fmt.Sprintf(" (%d:%02d)", seconds/60, seconds%60)
+}
@@ -0,0 +1,30 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// EventPinsUpdated is sent to the participants of a chat when a message is pinned or unpinned
+const EventPinsUpdated = "pins_updated"
+
+// Actions of system messages
+const (
+	SystemActionPinned   = "pinned"
+	SystemActionUnpinned = "unpinned"
+)
+
+// SystemMessage describes something that happened in a chat, shown in its
+// timeline. The sender of a system message is the user who caused it.
+type SystemMessage struct {
+	Action    string             `bson:"action" json:"action" example:"pinned"`
+	MessageID primitive.ObjectID `bson:"message_id,omitempty" json:"message_id,omitempty"`     // the message acted on
+	Timer     string             `bson:"timer,omitempty" json:"timer,omitempty" example:"24h"` // the new disappearing messages timer
+}
+
+// PinsUpdate carries the pinned messages of a chat after a change
+type PinsUpdate struct {
+	GroupID   string            `json:"group_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9a"`
+	UserIDs   []string          `json:"user_ids,omitempty"` // the two users of a direct chat
+	Action    string            `json:"action" example:"pinned"`
+	MessageID string            `json:"message_id" example:"5f8d0f1b9d9d9d9d9d9d9d9f"`
+	ActorID   string            `json:"actor_id" example:"5f8d0f1b9d9d9d9d9d9d9d9d"`
+	Pinned    []MessageResponse `json:"pinned"` // most recently pinned first
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EventPollUpdated is sent to the participants of a chat when a vote changes a poll's tally
+const EventPollUpdated = "poll_updated"
+
+// Poll is the payload of a poll message
+type Poll struct {
+	Question       string       `bson:"question" json:"question" example:"Lunch on Friday?"`
+	Options        []PollOption `bson:"options" json:"options"`
+	MultipleChoice bool         `bson:"multiple_choice" json:"multiple_choice" example:"false"` // voters may pick more than one option
+	Anonymous      bool         `bson:"anonymous" json:"anonymous" example:"false"`             // hides who voted for what
+}
+
+// PollOption is one answer of a poll. IDs are assigned in order, starting at 0.
+type PollOption struct {
+	ID   int    `bson:"id" json:"id" example:"0"`
+	Text string `bson:"text" json:"text" example:"Pizza"`
+}
+
+// PollRequest creates a poll
+type PollRequest struct {
+	Question       string   `json:"question" example:"Lunch on Friday?"`
+	Options        []string `json:"options" example:"Pizza,Sushi"`
+	MultipleChoice bool     `json:"multiple_choice,omitempty"`
+	Anonymous      bool     `json:"anonymous,omitempty"`
+}
+
+// PollVote is the current choice of one user in a poll
+type PollVote struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	MessageID primitive.ObjectID `bson:"message_id"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	OptionIDs []int              `bson:"option_ids"`
+	CreatedAt time.Time          `bson:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at"`
+}
+
+// PollVoteRequest replaces the caller's vote; an empty list retracts it
+type PollVoteRequest struct {
+	OptionIDs []int `json:"option_ids"`
+}
+
+// PollResults is the tally of a poll
+type PollResults struct {
+	MessageID      string              `json:"message_id" example:"5f8d0f1b9d9d9d9d9d9d9d9f"`
+	Question       string              `json:"question" example:"Lunch on Friday?"`
+	MultipleChoice bool                `json:"multiple_choice" example:"false"`
+	Anonymous      bool                `json:"anonymous" example:"false"`
+	Options        []PollOptionResults `json:"options"`
+	TotalVoters    int                 `json:"total_voters" example:"5"`
+	MyVote         []int               `json:"my_vote,omitempty"` // option IDs the caller voted for
+}
+
+// PollOptionResults is the tally of one poll option
+type PollOptionResults struct {
+	ID     int         `json:"id" example:"0"`
+	Text   string      `json:"text" example:"Pizza"`
+	Votes  int         `json:"votes" example:"3"`
+	Voters []PollVoter `json:"voters,omitempty"` // only in results of polls that are not anonymous
+}
+
+// PollVoter identifies who voted for an option
+type PollVoter struct {
+	UserID   string `json:"user_id" example:"5f8d0f1b9d9d9d9d9d9d9d9d"`
+	Username string `json:"username" example:"johndoe"`
+}
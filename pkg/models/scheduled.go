@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EventScheduledMessageUpdated is sent to the author of a scheduled message when it was sent or failed
+const EventScheduledMessageUpdated = "scheduled_message_updated"
+
+// ScheduledStatus is the state of a scheduled message
+type ScheduledStatus string
+
+const (
+	ScheduledStatusPending ScheduledStatus = "pending"
+	ScheduledStatusSending ScheduledStatus = "sending" // claimed by a scheduler
+	ScheduledStatusSent    ScheduledStatus = "sent"
+	ScheduledStatusFailed  ScheduledStatus = "failed"
+)
+
+// ScheduledMessage is a message queued to be sent later
+type ScheduledMessage struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	SenderID   primitive.ObjectID `bson:"sender_id"`
+	Message    MessageRequest     `bson:"message"`
+	MessageID  primitive.ObjectID `bson:"message_id"`         // fixed up front, so a retried send cannot store the message twice
+	MediaID    primitive.ObjectID `bson:"media_id,omitempty"` // attached upload, kept from cleanup until sent
+	SendAt     time.Time          `bson:"send_at"`
+	Timezone   string             `bson:"timezone,omitempty"` // the zone send_at was given in, for display
+	Status     ScheduledStatus    `bson:"status"`
+	Attempts   int                `bson:"attempts"`
+	LeaseOwner string             `bson:"lease_owner,omitempty"`
+	LeaseUntil time.Time          `bson:"lease_until,omitempty"`
+	Error      string             `bson:"error,omitempty"`
+	SentAt     *time.Time         `bson:"sent_at,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at"`
+	UpdatedAt  time.Time          `bson:"updated_at"`
+}
+
+// ScheduledMessageRequest schedules a message, or changes a pending one. The time is either
+// send_at with an offset, or local_time as wall clock time in timezone.
+type ScheduledMessageRequest struct {
+	Message   *MessageRequest `json:"message,omitempty"`                                     // required when scheduling
+	SendAt    string          `json:"send_at,omitempty" example:"2023-08-02T09:00:00+03:00"` // RFC 3339
+	LocalTime string          `json:"local_time,omitempty" example:"2023-08-02T09:00"`       // used with timezone instead of send_at
+	Timezone  string          `json:"timezone,omitempty" example:"Europe/Istanbul"`          // IANA name
+}
+
+// ScheduledMessageResponse is a scheduled message in API responses
+type ScheduledMessageResponse struct {
+	ID        string          `json:"id" example:"5f8d0f1b9d9d9d9d9d9d9d9b"`
+	Message   MessageRequest  `json:"message"`
+	SendAt    string          `json:"send_at" example:"2023-08-02T06:00:00Z"`
+	Timezone  string          `json:"timezone,omitempty" example:"Europe/Istanbul"`
+	Status    ScheduledStatus `json:"status" example:"pending"`
+	Error     string          `json:"error,omitempty"`
+	MessageID string          `json:"message_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9f"` // the sent message
+	SentAt    string          `json:"sent_at,omitempty" example:"2023-08-02T06:00:01Z"`
+	CreatedAt string          `json:"created_at" example:"2023-08-01T15:04:05Z"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StarredMessage bookmarks a message for one user. Stars are kept apart from
+// the message so that they do not depend on what else the user can see.
+type StarredMessage struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	MessageID primitive.ObjectID `bson:"message_id"`
+	ChatID    primitive.ObjectID `bson:"chat_id"` // the group, or the other user of a direct chat
+	StarredAt time.Time          `bson:"starred_at"`
+}
+
+// StarredMessageResponse is a starred message in API responses
+type StarredMessageResponse struct {
+	Message   MessageResponse `json:"message"`
+	ChatID    string          `json:"chat_id" example:"5f8d0f1b9d9d9d9d9d9d9d9a"`
+	StarredAt string          `json:"starred_at" example:"2023-08-01T15:04:05Z"`
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StatusLifetime is how long a status stays visible after it was posted
+const StatusLifetime = 24 * time.Hour
+
+// Events about statuses
+const (
+	EventStatusPosted  = "status_posted"  // sent to the audience of a new status
+	EventStatusDeleted = "status_deleted" // sent to the audience when the author deletes a status early
+	EventStatusViewed  = "status_viewed"  // sent to the author when someone views their status
+)
+
+// Values of StatusPrivacy.Audience
+const (
+	StatusAudienceContacts       = "contacts"        // all of the author's contacts
+	StatusAudienceContactsExcept = "contacts_except" // contacts except ExcludedIDs
+	StatusAudienceOnlyShareWith  = "only_share_with" // only the contacts in IncludedIDs
+)
+
+// IsValidStatusAudience reports whether value is a valid StatusPrivacy.Audience
+func IsValidStatusAudience(value string) bool {
+	switch value {
+	case StatusAudienceContacts, StatusAudienceContactsExcept, StatusAudienceOnlyShareWith:
+		return true
+	}
+	return false
+}
+
+// Status is a text or media update that the author's contacts can see for a
+// day. Who can see it is decided when it is posted.
+type Status struct {
+	ID              primitive.ObjectID   `bson:"_id"`
+	AuthorID        primitive.ObjectID   `bson:"author_id"`
+	Type            MessageType          `bson:"type"`              // text, image or video
+	Content         string               `bson:"content,omitempty"` // text, or the caption of media
+	MediaID         primitive.ObjectID   `bson:"media_id,omitempty"`
+	BackgroundColor string               `bson:"background_color,omitempty"`
+	AudienceIDs     []primitive.ObjectID `bson:"audience_ids"`
+	ViewCount       int64                `bson:"view_count"`
+	CreatedAt       time.Time            `bson:"created_at"`
+	ExpiresAt       time.Time            `bson:"expires_at"`
+}
+
+// StatusView records that a user viewed a status
+type StatusView struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty"`
+	StatusID primitive.ObjectID `bson:"status_id"`
+	ViewerID primitive.ObjectID `bson:"viewer_id"`
+	ViewedAt time.Time          `bson:"viewed_at"`
+}
+
+// StatusPrivacy decides who sees the statuses a user posts
+type StatusPrivacy struct {
+	UserID      primitive.ObjectID   `bson:"_id"`
+	Audience    string               `bson:"audience"`
+	ExcludedIDs []primitive.ObjectID `bson:"excluded_ids,omitempty"`
+	IncludedIDs []primitive.ObjectID `bson:"included_ids,omitempty"`
+	UpdatedAt   time.Time            `bson:"updated_at"`
+}
+
+// StatusRequest posts a status: text, or an uploaded image or video with an optional caption
+type StatusRequest struct {
+	Content         string `json:"content" binding:"max=700" example:"Off to the mountains"`
+	MediaID         string `json:"media_id,omitempty" example:"5f8d0f1b9d9d9d9d9d9d9d9c"` // a media_url returned by an upload works too
+	MediaURL        string `json:"media_url,omitempty"`
+	BackgroundColor string `json:"background_color,omitempty" binding:"omitempty,hexcolor" example:"#25d366"` // text statuses
+}
+
+// StatusPrivacyRequest changes who sees new statuses. Omitted lists are left
+// as they are, so switching the audience back and forth keeps them.
+type StatusPrivacyRequest struct {
+	Audience    string   `json:"audience" binding:"required" example:"contacts_except"`
+	ExcludedIDs []string `json:"excluded_ids,omitempty"`
+	IncludedIDs []string `json:"included_ids,omitempty"`
+}
+
+// StatusPrivacyResponse is the status privacy of the current user
+type StatusPrivacyResponse struct {
+	Audience    string   `json:"audience" example:"contacts"`
+	ExcludedIDs []string `json:"excluded_ids"`
+	IncludedIDs []string `json:"included_ids"`
+}
+
+// StatusPostResponse is a status in API responses
+type StatusPostResponse struct {
+	ID              string         `json:"id" example:"5f8d0f1b9d9d9d9d9d9d9d9f"`
+	AuthorID        string         `json:"author_id" example:"5f8d0f1b9d9d9d9d9d9d9d9d"`
+	AuthorUsername  string         `json:"author_username,omitempty" example:"johndoe"`
+	Type            MessageType    `json:"type" example:"image"`
+	Content         string         `json:"content,omitempty" example:"Off to the mountains"`
+	Media           *MediaResponse `json:"media,omitempty"`
+	BackgroundColor string         `json:"background_color,omitempty" example:"#25d366"`
+	ViewCount       int64          `json:"view_count,omitempty" example:"12"` // only shown to the author
+	Viewed          bool           `json:"viewed,omitempty" example:"false"`  // the caller has viewed the status
+	CreatedAt       string         `json:"created_at" example:"2023-08-01T15:04:05Z"`
+	ExpiresAt       string         `json:"expires_at" example:"2023-08-02T15:04:05Z"`
+}
+
+// UserStatuses are the active statuses of one contact, oldest first
+type UserStatuses struct {
+	UserID       string               `json:"user_id" example:"5f8d0f1b9d9d9d9d9d9d9d9d"`
+	Username     string               `json:"username,omitempty" example:"johndoe"`
+	Statuses     []StatusPostResponse `json:"statuses"`
+	AllViewed    bool                 `json:"all_viewed" example:"false"`
+	LastPostedAt string               `json:"last_posted_at" example:"2023-08-01T15:04:05Z"`
+}
+
+// StatusViewerResponse is someone who viewed a status
+type StatusViewerResponse struct {
+	UserID   string `json:"user_id" example:"5f8d0f1b9d9d9d9d9d9d9d9e"`
+	Username string `json:"username,omitempty" example:"janedoe"`
+	ViewedAt string `json:"viewed_at" example:"2023-08-01T15:04:05Z"`
+}
+
+// StatusViewed tells an author that someone viewed their status
+type StatusViewed struct {
+	StatusID string `json:"status_id" example:"5f8d0f1b9d9d9d9d9d9d9d9f"`
+	ViewerID string `json:"viewer_id" example:"5f8d0f1b9d9d9d9d9d9d9d9e"`
+	ViewedAt string `json:"viewed_at" example:"2023-08-01T15:04:05Z"`
+}
+
+// StatusDeleted tells the audience of a status that it is gone
+type StatusDeleted struct {
+	StatusID string `json:"status_id" example:"5f8d0f1b9d9d9d9d9d9d9d9f"`
+	AuthorID string `json:"author_id" example:"5f8d0f1b9d9d9d9d9d9d9d9d"`
+}
@@ -0,0 +1,27 @@
+package models
+
+// Events about threads in group chats
+const (
+	EventThreadReply   = "thread_reply"   // sent to the participants of a thread when someone replies
+	EventThreadUpdated = "thread_updated" // sent to the rest of the group, so that timelines can update the root
+)
+
+// ThreadUpdate carries the state of a thread after a reply
+type ThreadUpdate struct {
+	RootID      string `json:"root_id" example:"5f8d0f1b9d9d9d9d9d9d9d9f"`
+	GroupID     string `json:"group_id" example:"5f8d0f1b9d9d9d9d9d9d9d9a"`
+	ReplyCount  int64  `json:"reply_count" example:"4"`
+	LastReplyAt string `json:"last_reply_at" example:"2023-08-01T15:04:05Z"`
+}
+
+// ThreadReply is a new reply as sent to the participants of its thread
+type ThreadReply struct {
+	ThreadUpdate
+	Reply MessageResponse `json:"reply"`
+}
+
+// ThreadResponse is a thread root with a page of its replies
+type ThreadResponse struct {
+	Root    MessageResponse   `json:"root"`
+	Replies []MessageResponse `json:"replies"` // newest first
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -18,7 +21,71 @@ type User struct {
 	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
 	LastLogin    time.Time          `bson:"last_login,omitempty" json:"last_login,omitempty"`
-	Status       string             `bson:"status" json:"status"` // online, offline, away
+	Status       string             `bson:"status" json:"status"` // presence: online, offline, away
+
+	About          string    `bson:"about,omitempty" json:"about,omitempty"` // user-authored "about" line
+	AboutUpdatedAt time.Time `bson:"about_updated_at,omitempty" json:"about_updated_at,omitempty"`
+	PhoneNumber    string    `bson:"phone_number,omitempty" json:"phone_number,omitempty"` // E.164
+	PhoneVerified  bool      `bson:"phone_verified,omitempty" json:"phone_verified,omitempty"` // confirmed with a code, see PhoneVerificationRequest
+	Timezone       string    `bson:"timezone,omitempty" json:"timezone,omitempty"`         // IANA name, e.g. Europe/Istanbul
+
+	UsernameChangedAt time.Time `bson:"username_changed_at,omitempty" json:"username_changed_at,omitempty"`
+
+	// Keyed hashes used for contact discovery, see ContactKey
+	PhoneKey  string          `bson:"phone_key,omitempty" json:"-"`
+	EmailKey  string          `bson:"email_key,omitempty" json:"-"`
+	Privacy   PrivacySettings `bson:"privacy" json:"privacy"`
+
+	DeletionRequestedAt time.Time `bson:"deletion_requested_at,omitempty" json:"deletion_requested_at,omitempty"`
+	DeletionScheduledAt time.Time `bson:"deletion_scheduled_at,omitempty" json:"deletion_scheduled_at,omitempty"`
+	DeletedAt           time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	Deleted             bool      `bson:"deleted,omitempty" json:"deleted,omitempty"` // anonymized, see DeletedAt
+}
+
+// Values of PrivacySettings.DiscoverableBy
+const (
+	DiscoverableByEveryone = "everyone"
+	DiscoverableByContacts = "contacts" // only users the account has added as contacts
+	DiscoverableByNobody   = "nobody"
+)
+
+// PrivacySettings control what other users can learn about an account
+type PrivacySettings struct {
+	DiscoverableBy string `bson:"discoverable_by,omitempty" json:"discoverable_by" example:"everyone"` // who can find the account by phone number or email hash
+}
+
+// Normalized returns the settings with defaults applied to unset fields
+func (p PrivacySettings) Normalized() PrivacySettings {
+	if p.DiscoverableBy == "" {
+		p.DiscoverableBy = DiscoverableByEveryone
+	}
+	return p
+}
+
+// IsValidDiscoverableBy reports whether value is a valid PrivacySettings.DiscoverableBy
+func IsValidDiscoverableBy(value string) bool {
+	switch value {
+	case DiscoverableByEveryone, DiscoverableByContacts, DiscoverableByNobody:
+		return true
+	}
+	return false
+}
+
+// ContactHash returns the hex-encoded SHA-256 of a normalized phone number
+// (E.164, e.g. +905551234567) or email address (trimmed and lowercased).
+// Clients hash address book entries the same way before a contact sync.
+func ContactHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// ContactKey returns the hex-encoded HMAC-SHA256 of a ContactHash under
+// secret. Accounts store this form, so a leaked users collection cannot be
+// reversed by hashing every phone number without the secret as well.
+func ContactKey(secret []byte, hash string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(hash))
+	return hex.EncodeToString(mac.Sum(nil))
 }
 
 // UserRegistration represents the user registration request
@@ -36,6 +103,23 @@ type UserLogin struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// LoginAuditEntry records a failed login attempt
+type LoginAuditEntry struct {
+	ID           primitive.ObjectID `bson:"_id" json:"id"`
+	Username     string             `bson:"username" json:"username"`
+	IP           string             `bson:"ip" json:"ip"`
+	UserAgent    string             `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	Reason       string             `bson:"reason" json:"reason"` // unknown_user, invalid_password
+	BlockedUntil time.Time          `bson:"blocked_until,omitempty" json:"blocked_until,omitempty"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// RateLimitResponse is returned with 429 Too Many Requests
+type RateLimitResponse struct {
+	Error      string `json:"error" example:"Too many login attempts"`
+	RetryAfter int    `json:"retry_after" example:"30"` // seconds
+}
+
 // UserResponse represents the user response
 type UserResponse struct {
 	ID              string `json:"id"`
@@ -45,8 +129,20 @@ type UserResponse struct {
 	AvatarURL       string `json:"avatar_url"`
 	CreatedAt       string `json:"created_at"`
 	Status          string `json:"status"`
-	LastMessage     string `json:"last_message,omitempty"`
+	About           string `json:"about,omitempty"`
+	AboutUpdatedAt  string `json:"about_updated_at,omitempty"`
+	PhoneNumber     string `json:"phone_number,omitempty"`
+	PhoneVerified   bool   `json:"phone_verified,omitempty"`
+	Timezone        string `json:"timezone,omitempty"`
+	LastMessage     string `json:"last_message,omitempty"` // preview of the last message, see Message.Preview
+	LastMessageType MessageType `json:"last_message_type,omitempty"`
 	LastMessageTime string `json:"last_message_time,omitempty"`
+	Draft           string `json:"draft,omitempty"` // your unsent text in the chat with this user, see Draft
+	DraftUpdatedAt  string `json:"draft_updated_at,omitempty"`
+
+	DeletionScheduledAt string `json:"deletion_scheduled_at,omitempty"`
+	RedirectedFrom      string `json:"redirected_from,omitempty"` // previous handle the lookup was made with
+	Deleted             bool   `json:"deleted,omitempty"`         // the account was deleted and anonymized
 }
 
 // LoginResponse represents the login response
@@ -56,11 +152,28 @@ type LoginResponse struct {
 	User      UserResponse `json:"user"`
 }
 
-// ProfileUpdate represents the profile update request
+// ProfileUpdate represents the profile update request.
+// Pointer fields are optional; an empty string clears them.
 type ProfileUpdate struct {
-	FullName  string `json:"full_name"`
-	AvatarURL string `json:"avatar_url"`
-	Status    string `json:"status"`
+	FullName    string  `json:"full_name"`
+	AvatarURL   string  `json:"avatar_url"`
+	Status      string  `json:"status"` // presence only, see UserPresences
+	About       *string `json:"about,omitempty" example:"Hey there! I am using WhatsApp."`
+	PhoneNumber *string `json:"phone_number,omitempty" example:"+905551234567"`
+	Timezone    *string `json:"timezone,omitempty" example:"Europe/Istanbul"`
+}
+
+// UserPresences lists the valid values of User.Status
+var UserPresences = []string{"online", "offline", "away"}
+
+// IsValidPresence reports whether status is a valid presence value
+func IsValidPresence(status string) bool {
+	for _, presence := range UserPresences {
+		if status == presence {
+			return true
+		}
+	}
+	return false
 }
 
 // StatusUpdate represents a status update request
@@ -75,6 +188,40 @@ type StatusResponse struct {
 }
 
 
+// UsernameChangeRequest represents a request to change the current user's handle
+type UsernameChangeRequest struct {
+	Username string `json:"username" binding:"required" example:"johndoe"`
+}
+
+// UsernameRedirect keeps a previous handle pointing at its account for a while
+// after a rename. Pending entries reserve a handle while a registration or
+// rename that takes it is in progress.
+type UsernameRedirect struct {
+	OldUsername string             `bson:"_id" json:"old_username"`
+	UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Pending     bool               `bson:"pending,omitempty" json:"-"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	ExpiresAt   time.Time          `bson:"expires_at" json:"expires_at"`
+}
+
+// AccountDeletionRequest confirms an account deletion with the user's password
+type AccountDeletionRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// AccountDeletionResponse describes a scheduled account deletion
+type AccountDeletionResponse struct {
+	Message     string `json:"message" example:"Account scheduled for deletion"`
+	ScheduledAt string `json:"scheduled_at" example:"2023-08-15T15:04:05Z"`
+}
+
+// AccountDeletedEvent is published on the messages exchange once an account has been anonymized
+type AccountDeletedEvent struct {
+	Type      string `json:"type" example:"account_deleted"`
+	UserID    string `json:"user_id" example:"5f8d0f1b9d9d9d9d9d9d9d9d"`
+	DeletedAt string `json:"deleted_at" example:"2023-08-15T15:04:05Z"`
+}
+
 // ErrorResponse represents an error response
 type ErrorResponse struct {
 	Error   string `json:"error"`
@@ -106,7 +253,7 @@ func (u *User) VerifyPassword(password string) bool {
 }
 
 func (u *User) ToResponse() UserResponse {
-	return UserResponse{
+	response := UserResponse{
 		ID:        u.ID.Hex(),
 		Username:  u.Username,
 		Email:     u.Email,
@@ -115,11 +262,93 @@ func (u *User) ToResponse() UserResponse {
 		CreatedAt: u.CreatedAt.Format(time.RFC3339),
 		Status:    u.Status,
 	}
+	response.About = u.About
+	if !u.AboutUpdatedAt.IsZero() {
+		response.AboutUpdatedAt = u.AboutUpdatedAt.Format(time.RFC3339)
+	}
+	response.PhoneNumber = u.PhoneNumber
+	response.PhoneVerified = u.PhoneVerified
+	response.Timezone = u.Timezone
+	if !u.DeletionScheduledAt.IsZero() {
+		response.DeletionScheduledAt = u.DeletionScheduledAt.Format(time.RFC3339)
+	}
+	response.Deleted = u.Deleted
+	return response
+}
+
+// ToPublicResponse returns what other users see of u: the response without
+// the contact details and account state only u may see
+func (u *User) ToPublicResponse() UserResponse {
+	response := u.ToResponse()
+	response.Email = ""
+	response.PhoneNumber = ""
+	response.PhoneVerified = false
+	response.DeletionScheduledAt = ""
+	return response
+}
+
+// PublicProfile is the part of a profile other users display, as sent in profile_updated events
+type PublicProfile struct {
+	ID             string `json:"id" example:"5f8d0f1b9d9d9d9d9d9d9d9d"`
+	Username       string `json:"username" example:"johndoe"`
+	FullName       string `json:"full_name" example:"John Doe"`
+	AvatarURL      string `json:"avatar_url" example:"https://example.com/avatar.jpg"`
+	About          string `json:"about,omitempty" example:"Available"`
+	AboutUpdatedAt string `json:"about_updated_at,omitempty" example:"2023-08-01T15:04:05Z"`
+}
+
+// ToPublicProfile returns the public profile of u
+func (u *User) ToPublicProfile() PublicProfile {
+	profile := PublicProfile{
+		ID:        u.ID.Hex(),
+		Username:  u.Username,
+		FullName:  u.FullName,
+		AvatarURL: u.AvatarURL,
+		About:     u.About,
+	}
+	if !u.AboutUpdatedAt.IsZero() {
+		profile.AboutUpdatedAt = u.AboutUpdatedAt.Format(time.RFC3339)
+	}
+	return profile
 }
 type ContactRequest struct {
     ContactID string `json:"contact_id" binding:"required"`
 }
 
+// ContactSyncRequest uploads hashed address book entries, see ContactHash
+type ContactSyncRequest struct {
+	Hashes      []string `json:"hashes" binding:"required"`
+	AddContacts bool     `json:"add_contacts"` // add every match to the contact list
+}
+
+// ContactMatch pairs an uploaded hash with the registered user it belongs to
+type ContactMatch struct {
+	Hash string       `json:"hash"`
+	User UserResponse `json:"user"`
+}
+
+// ContactSyncResponse lists the uploaded hashes that belong to registered users
+type ContactSyncResponse struct {
+	Matches []ContactMatch `json:"matches"`
+	Added   int            `json:"added"` // contacts created because of add_contacts
+}
+
+// PhoneVerificationResponse tells where a verification code was sent
+type PhoneVerificationResponse struct {
+	PhoneNumber string `json:"phone_number" example:"+905551234567"`
+	ExpiresAt   string `json:"expires_at" example:"2023-08-01T15:14:05Z"`
+}
+
+// PhoneVerificationRequest confirms the phone number on a profile with the code sent to it
+type PhoneVerificationRequest struct {
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+// PrivacyUpdate represents a privacy settings update request
+type PrivacyUpdate struct {
+	DiscoverableBy string `json:"discoverable_by" binding:"required" example:"contacts"`
+}
+
 // SuccessResponse is a generic success response
 type SuccessResponse struct {
     Message string `json:"message"`
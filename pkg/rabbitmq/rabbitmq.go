@@ -15,6 +15,7 @@ type Client struct {
     uri          string
     clientMutex  sync.RWMutex
     queues       map[string]amqp.Queue      // Track declared queues
+    transient    map[string]bool            // Queues declared with DeclareTransientQueue
     exchanges    map[string]string          // Track declared exchanges by name->type
     bindings     map[string][]bindingInfo   // Track queue bindings
 }
@@ -42,6 +43,7 @@ func NewClient(uri string) (*Client, error) {
         channel:    channel,
         uri:        uri,
         queues:     make(map[string]amqp.Queue),
+        transient:  make(map[string]bool),
         exchanges:  make(map[string]string),
         bindings:   make(map[string][]bindingInfo),
     }
@@ -80,6 +82,28 @@ func (c *Client) DeclareQueue(name string) (amqp.Queue, error) {
     return queue, err
 }
 
+// DeclareTransientQueue declares a non-durable queue that is deleted once its
+// last consumer goes away, for consumers that only care about live messages
+func (c *Client) DeclareTransientQueue(name string) (amqp.Queue, error) {
+    queue, err := c.channel.QueueDeclare(
+        name,  // name
+        false, // durable
+        true,  // delete when unused
+        false, // exclusive
+        false, // no-wait
+        nil,   // arguments
+    )
+
+    if err == nil {
+        c.clientMutex.Lock()
+        c.queues[name] = queue
+        c.transient[name] = true
+        c.clientMutex.Unlock()
+    }
+
+    return queue, err
+}
+
 // DeclareQueueWithDLX declares a queue with a dead-letter exchange
 func (c *Client) DeclareQueueWithDLX(name, dlxName string) (amqp.Queue, error) {
     args := amqp.Table{
@@ -149,6 +173,30 @@ func (c *Client) BindQueue(queueName, routingKey, exchangeName string) error {
     return err
 }
 
+// UnbindQueue removes a binding made with BindQueue
+func (c *Client) UnbindQueue(queueName, routingKey, exchangeName string) error {
+    err := c.channel.QueueUnbind(
+        queueName,    // queue name
+        routingKey,   // routing key
+        exchangeName, // exchange
+        nil,          // arguments
+    )
+
+    if err == nil {
+        c.clientMutex.Lock()
+        bindings := c.bindings[queueName][:0]
+        for _, binding := range c.bindings[queueName] {
+            if binding.RoutingKey != routingKey || binding.ExchangeName != exchangeName {
+                bindings = append(bindings, binding)
+            }
+        }
+        c.bindings[queueName] = bindings
+        c.clientMutex.Unlock()
+    }
+
+    return err
+}
+
 // Publish publishes a message to a queue directly
 func (c *Client) Publish(queue string, data interface{}) error {
     body, err := json.Marshal(data)
@@ -234,6 +282,7 @@ func (c *Client) DeleteQueue(name string) error {
     
     c.clientMutex.Lock()
     delete(c.queues, name)
+    delete(c.transient, name)
     c.clientMutex.Unlock()
     
     return nil
@@ -301,8 +350,9 @@ func (c *Client) handleReconnect() {
         
         // Redeclare queues
         for name := range c.queues {
+            durable := !c.transient[name]
             _, err = c.channel.QueueDeclare(
-                name, true, false, false, false, nil)
+                name, durable, !durable, false, false, nil)
             if err != nil {
                 log.Printf("Failed to redeclare queue %s: %v", name, err)
             }
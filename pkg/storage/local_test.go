@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLocalStore(t *testing.T) *LocalStore {
+	t.Helper()
+	store, err := NewLocalStore(t.TempDir(), "/api/media/blobs/", []byte("test-secret"))
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+	return store
+}
+
+// signedQuery returns the query of a download URL from store
+func signedQuery(t *testing.T, store *LocalStore, key string, expiry time.Duration, opts URLOptions) url.Values {
+	t.Helper()
+	rawURL, err := store.URL(key, expiry, opts)
+	if err != nil {
+		t.Fatalf("URL: %v", err)
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", rawURL, err)
+	}
+	if !strings.HasPrefix(parsed.Path, "/api/media/blobs/") {
+		t.Fatalf("URL %s is not below the base URL", rawURL)
+	}
+	return parsed.Query()
+}
+
+func TestLocalStorePutGetDelete(t *testing.T) {
+	store := newTestLocalStore(t)
+	ctx := context.Background()
+
+	content := "hello, media"
+	if err := store.Put(ctx, "photo.jpg", strings.NewReader(content), int64(len(content)), "image/jpeg"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	blob, err := store.Get(ctx, "photo.jpg")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, _ := io.ReadAll(blob)
+	blob.Close()
+	if string(data) != content {
+		t.Errorf("Get returned %q, want %q", data, content)
+	}
+
+	if err := store.Delete(ctx, "photo.jpg"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, "photo.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestLocalStoreRejectsPathTraversal(t *testing.T) {
+	store := newTestLocalStore(t)
+
+	if err := store.Put(context.Background(), "../escape", strings.NewReader("x"), 1, ""); err == nil {
+		t.Error("Put accepted a key outside the store directory")
+	}
+}
+
+func TestLocalStoreSignedURL(t *testing.T) {
+	store := newTestLocalStore(t)
+	opts := URLOptions{ContentType: "application/pdf", ContentDisposition: `attachment; filename="report.pdf"`}
+
+	query := signedQuery(t, store, "report.pdf", time.Minute, opts)
+	got, err := store.Verify("report.pdf", query)
+	if err != nil {
+		t.Fatalf("Verify rejected a fresh URL: %v", err)
+	}
+	if got != opts {
+		t.Errorf("Verify returned options %+v, want %+v", got, opts)
+	}
+}
+
+func TestLocalStoreSignedURLExpires(t *testing.T) {
+	store := newTestLocalStore(t)
+
+	query := signedQuery(t, store, "report.pdf", -time.Minute, URLOptions{})
+	if _, err := store.Verify("report.pdf", query); !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("Verify of an expired URL returned %v, want ErrInvalidURL", err)
+	}
+}
+
+func TestLocalStoreSignedURLTampering(t *testing.T) {
+	store := newTestLocalStore(t)
+	opts := URLOptions{ContentType: "application/pdf"}
+
+	tests := []struct {
+		name   string
+		key    string
+		tamper func(url.Values)
+	}{
+		{"other key", "other.pdf", func(url.Values) {}},
+		{"extended expiry", "report.pdf", func(q url.Values) {
+			q.Set("expires", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		}},
+		{"changed content type", "report.pdf", func(q url.Values) { q.Set("type", "text/html") }},
+		{"added disposition", "report.pdf", func(q url.Values) { q.Set("disposition", "inline") }},
+		{"forged signature", "report.pdf", func(q url.Values) { q.Set("signature", strings.Repeat("0", 64)) }},
+		{"missing signature", "report.pdf", func(q url.Values) { q.Del("signature") }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query := signedQuery(t, store, "report.pdf", time.Minute, opts)
+			test.tamper(query)
+			if _, err := store.Verify(test.key, query); !errors.Is(err, ErrInvalidURL) {
+				t.Errorf("Verify returned %v, want ErrInvalidURL", err)
+			}
+		})
+	}
+}
+
+func TestLocalStoreSignedURLOtherSecret(t *testing.T) {
+	store := newTestLocalStore(t)
+	other, err := NewLocalStore(t.TempDir(), "/api/media/blobs/", []byte("other-secret"))
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+
+	query := signedQuery(t, other, "report.pdf", time.Minute, URLOptions{})
+	if _, err := store.Verify("report.pdf", query); !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("Verify of a URL signed with another secret returned %v, want ErrInvalidURL", err)
+	}
+}
@@ -0,0 +1,34 @@
+// Package storage provides blob storage backends for uploaded media.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("storage: blob not found")
+
+// ErrInvalidURL is returned when a signed URL is malformed, tampered with or expired
+var ErrInvalidURL = errors.New("storage: invalid or expired URL")
+
+// URLOptions override response headers of a download URL
+type URLOptions struct {
+	ContentType        string
+	ContentDisposition string
+}
+
+// Store keeps blobs addressed by key
+type Store interface {
+	// Put stores size bytes read from r under key
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the blob stored under key
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under key. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL returns a URL the blob can be downloaded from without further
+	// authentication until expiry has passed
+	URL(key string, expiry time.Duration, opts URLOptions) (string, error)
+}